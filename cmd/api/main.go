@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/lgreene/gravix-dashboards/pkg/warehouse"
+)
+
+// writeErrorJSON writes a structured JSON error response.
+func writeErrorJSON(w http.ResponseWriter, code int, errMsg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": errMsg,
+		"code":  code,
+	})
+}
+
+type cacheEntry struct {
+	rows      []warehouse.MetricRow
+	fetchedAt time.Time
+}
+
+// metricsCache keeps each day's decoded rows in memory for a short TTL so
+// dashboard refreshes don't re-download the same parquet on every request.
+// Expired days are dropped whenever a day is loaded, so only days queried
+// within the TTL stay in memory.
+type metricsCache struct {
+	store  storage.ObjectStore
+	prefix string
+	ttl    time.Duration
+	now    func() time.Time
+
+	readOpts []warehouse.ReadOption
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func newMetricsCache(store storage.ObjectStore, prefix string, ttl time.Duration) *metricsCache {
+	return &metricsCache{
+		store:   store,
+		prefix:  prefix,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// Rows returns all metric rows for a day, loading them from the store on a cache miss.
+func (c *metricsCache) Rows(ctx context.Context, day string) ([]warehouse.MetricRow, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[day]
+	c.mu.Unlock()
+	if ok && c.now().Sub(entry.fetchedAt) < c.ttl {
+		return entry.rows, nil
+	}
+
+	keys, err := warehouse.DayKeys(ctx, c.store, c.prefix, day)
+	if err != nil {
+		return nil, err
+	}
+	var rows []warehouse.MetricRow
+	for _, key := range keys {
+		r, err := warehouse.ReadMetricRows(ctx, c.store, key, c.readOpts...)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, r...)
+	}
+
+	now := c.now()
+	c.mu.Lock()
+	for d, e := range c.entries {
+		if now.Sub(e.fetchedAt) >= c.ttl {
+			delete(c.entries, d)
+		}
+	}
+	c.entries[day] = cacheEntry{rows: rows, fetchedAt: now}
+	c.mu.Unlock()
+	return rows, nil
+}
+
+// handleMetrics serves GET /api/v1/metrics?day=YYYY-MM-DD&service=name.
+// day defaults to today (UTC); service is optional and filters rows exactly.
+func handleMetrics(cache *metricsCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeErrorJSON(w, http.StatusMethodNotAllowed, "only GET is accepted")
+			return
+		}
+
+		day := r.URL.Query().Get("day")
+		if day == "" {
+			day = cache.now().UTC().Format("2006-01-02")
+		}
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			writeErrorJSON(w, http.StatusBadRequest, "day must be formatted as YYYY-MM-DD")
+			return
+		}
+		service := r.URL.Query().Get("service")
+
+		rows, err := cache.Rows(r.Context(), day)
+		if err != nil {
+			log.Printf("Failed to load metrics for %s: %v", day, err)
+			writeErrorJSON(w, http.StatusInternalServerError, "failed to load metrics")
+			return
+		}
+
+		out := make([]warehouse.MetricRow, 0, len(rows))
+		for _, row := range rows {
+			if service != "" && row.Service != service {
+				continue
+			}
+			out = append(out, row)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"day":     day,
+			"service": service,
+			"count":   len(out),
+			"rows":    out,
+		})
+	}
+}
+
+// authMiddleware checks for X-API-Key header if apiKey is configured
+func authMiddleware(apiKey string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiKey != "" {
+			reqKey := r.Header.Get("X-API-Key")
+			if subtle.ConstantTimeCompare([]byte(reqKey), []byte(apiKey)) != 1 {
+				writeErrorJSON(w, http.StatusUnauthorized, "invalid or missing X-API-Key header")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func main() {
+	port := flag.Int("port", 8082, "HTTP port")
+	dataDir := flag.String("data-dir", "./data", "Base data directory (used for local storage)")
+	warehousePrefix := flag.String("warehouse-prefix", "warehouse/request_metrics_minute", "Store key prefix of the metrics dataset")
+	cacheTTL := flag.Duration("cache-ttl", 60*time.Second, "How long a day's rows are served from memory before re-reading the store")
+	schemaVersion := flag.String("schema-version", "lenient", "How to read metrics files written by a newer rollup: lenient (as the newest known layout) or strict (fail the request)")
+	flag.Parse()
+
+	apiKey := os.Getenv("API_KEY")
+	if trimmed := strings.TrimSpace(apiKey); trimmed != apiKey {
+		// A secret mount's trailing newline would otherwise make every request 401
+		log.Println("WARNING: API_KEY has leading or trailing whitespace; using the trimmed value")
+		apiKey = trimmed
+	}
+	if apiKey == "" {
+		log.Println("WARNING: API_KEY environment variable not set. Authentication disabled.")
+	}
+
+	store, err := storage.FromEnv(context.Background(), *dataDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize store: %v", err)
+	}
+
+	cache := newMetricsCache(store, *warehousePrefix, *cacheTTL)
+	switch *schemaVersion {
+	case "lenient":
+	case "strict":
+		cache.readOpts = append(cache.readOpts, warehouse.WithMaxSchemaVersion(warehouse.MetricSchemaVersion))
+	default:
+		log.Fatalf("-schema-version must be lenient or strict, got %q", *schemaVersion)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/metrics", authMiddleware(apiKey, handleMetrics(cache)))
+	mux.HandleFunc("/live", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("up"))
+	})
+
+	addr := fmt.Sprintf(":%d", *port)
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	shutdownCh := make(chan os.Signal, 1)
+	signal.Notify(shutdownCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-shutdownCh
+		log.Printf("Received %v, shutting down...", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("HTTP shutdown error: %v", err)
+		}
+	}()
+
+	log.Printf("Starting metrics API on %s (prefix %s)...", addr, *warehousePrefix)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	log.Println("Server stopped gracefully.")
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/lgreene/gravix-dashboards/pkg/warehouse"
+	"github.com/parquet-go/parquet-go"
+)
+
+const testPrefix = "warehouse/request_metrics_minute"
+
+func putRows(t *testing.T, store storage.ObjectStore, key string, rows []warehouse.MetricRow) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, rows); err != nil {
+		t.Fatalf("failed to write parquet: %v", err)
+	}
+	if err := store.Put(context.Background(), key, &buf); err != nil {
+		t.Fatalf("failed to put %s: %v", key, err)
+	}
+}
+
+type metricsResponse struct {
+	Day   string                `json:"day"`
+	Count int                   `json:"count"`
+	Rows  []warehouse.MetricRow `json:"rows"`
+}
+
+func getMetrics(t *testing.T, handler http.HandlerFunc, query string) (int, metricsResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/metrics?"+query, nil)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	var resp metricsResponse
+	if rr.Code == http.StatusOK {
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("response is not valid JSON: %v", err)
+		}
+	}
+	return rr.Code, resp
+}
+
+func TestHandleMetrics_FiltersByService(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	putRows(t, store, testPrefix+"/metrics_a_2025-01-15.parquet", []warehouse.MetricRow{
+		{BucketStart: "2025-01-15 10:30:00", Service: "api", RequestCount: 3, EventDay: "2025-01-15"},
+		{BucketStart: "2025-01-15 10:30:00", Service: "web", RequestCount: 5, EventDay: "2025-01-15"},
+	})
+
+	handler := handleMetrics(newMetricsCache(store, testPrefix, time.Minute))
+
+	code, resp := getMetrics(t, handler, "day=2025-01-15")
+	if code != http.StatusOK || resp.Count != 2 {
+		t.Fatalf("expected 2 rows, got %d (status %d)", resp.Count, code)
+	}
+
+	code, resp = getMetrics(t, handler, "day=2025-01-15&service=web")
+	if code != http.StatusOK || resp.Count != 1 || resp.Rows[0].RequestCount != 5 {
+		t.Fatalf("expected only the web row, got %+v (status %d)", resp.Rows, code)
+	}
+
+	code, resp = getMetrics(t, handler, "day=2025-01-16")
+	if code != http.StatusOK || resp.Count != 0 {
+		t.Fatalf("expected no rows for a day without output, got %d", resp.Count)
+	}
+}
+
+func TestHandleMetrics_InvalidDay(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	handler := handleMetrics(newMetricsCache(store, testPrefix, time.Minute))
+
+	if code, _ := getMetrics(t, handler, "day=yesterday"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for malformed day, got %d", code)
+	}
+}
+
+func TestHandleMetrics_DefaultsToToday(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	putRows(t, store, testPrefix+"/metrics_a_2025-01-15.parquet", []warehouse.MetricRow{{Service: "api", EventDay: "2025-01-15"}})
+	cache := newMetricsCache(store, testPrefix, time.Minute)
+	cache.now = func() time.Time { return time.Date(2025, 1, 15, 23, 0, 0, 0, time.UTC) }
+
+	code, resp := getMetrics(t, handleMetrics(cache), "")
+	if code != http.StatusOK || resp.Day != "2025-01-15" || resp.Count != 1 {
+		t.Fatalf("expected today's row, got day %s with %d rows (status %d)", resp.Day, resp.Count, code)
+	}
+}
+
+func TestMetricsCache_DropsExpiredDays(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	now := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	cache := newMetricsCache(store, testPrefix, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.Rows(ctx, "2025-01-13")
+	now = now.Add(30 * time.Second)
+	cache.Rows(ctx, "2025-01-14")
+	now = now.Add(45 * time.Second)
+	cache.Rows(ctx, "2025-01-15")
+
+	if _, ok := cache.entries["2025-01-13"]; ok {
+		t.Error("expected the expired day to be dropped")
+	}
+	if len(cache.entries) != 2 {
+		t.Errorf("expected the 2 days within the TTL to be kept, got %d", len(cache.entries))
+	}
+}
+
+func TestMetricsCache_ExpiresAfterTTL(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	key := testPrefix + "/metrics_a_2025-01-15.parquet"
+	putRows(t, store, key, []warehouse.MetricRow{{Service: "api", EventDay: "2025-01-15"}})
+
+	now := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	cache := newMetricsCache(store, testPrefix, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	if rows, _ := cache.Rows(ctx, "2025-01-15"); len(rows) != 1 {
+		t.Fatalf("expected 1 row on first load, got %d", len(rows))
+	}
+
+	// Within the TTL the cached rows are served even though the object is gone
+	store.Delete(ctx, key)
+	if rows, _ := cache.Rows(ctx, "2025-01-15"); len(rows) != 1 {
+		t.Fatalf("expected cached row within TTL, got %d", len(rows))
+	}
+
+	now = now.Add(2 * time.Minute)
+	if rows, _ := cache.Rows(ctx, "2025-01-15"); len(rows) != 0 {
+		t.Fatalf("expected cache refresh after TTL, got %d rows", len(rows))
+	}
+}
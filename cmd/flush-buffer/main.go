@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+)
+
+// bufferFile is a local batch waiting to be uploaded.
+type bufferFile struct {
+	Path    string
+	Topic   string
+	ModTime time.Time // Picks the upload hour (and the day, unless the file sits in an event-day partition)
+}
+
+func main() {
+	var bufferDir string
+	var dataDir string
+	var includeCurrent bool
+	var dryRun bool
+
+	flag.StringVar(&bufferDir, "buffer-dir", "./data/buffer", "Ingestion buffer directory to flush (one subdirectory per topic)")
+	flag.StringVar(&dataDir, "data-dir", "./data", "Base data directory (used for local storage)")
+	flag.BoolVar(&includeCurrent, "include-current", false, "Also rotate and upload each topic's current.jsonl (only safe while ingestion is stopped)")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print what would be uploaded without uploading or deleting")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	store, err := storage.FromEnv(ctx, dataDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize store: %v", err)
+	}
+
+	files, err := findBufferFiles(bufferDir, includeCurrent)
+	if err != nil {
+		log.Fatalf("Failed to scan %s: %v", bufferDir, err)
+	}
+	if len(files) == 0 {
+		log.Printf("No batch files found in %s", bufferDir)
+		return
+	}
+
+	uploaded, failed := flushFiles(ctx, store, files, dryRun)
+	action := "uploaded"
+	if dryRun {
+		action = "would upload"
+	}
+	log.Printf("Flush complete: %s %d files, %d failed", action, uploaded, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// findBufferFiles walks bufferDir and returns every batch_*.jsonl file, inferring
+// the topic from the parent directory just like the ingestion startup scan.
+// Files in an event-day partition (<topic>/<YYYY-MM-DD>/) keep that day.
+// With includeCurrent, current.jsonl files are returned too.
+func findBufferFiles(bufferDir string, includeCurrent bool) ([]bufferFile, error) {
+	var files []bufferFile
+	err := filepath.Walk(bufferDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name := filepath.Base(path)
+		isBatch := strings.HasPrefix(name, "batch_") && strings.HasSuffix(name, ".jsonl")
+		isCurrent := includeCurrent && name == "current.jsonl" && info.Size() > 0
+		if !isBatch && !isCurrent {
+			return nil
+		}
+		bf := bufferFile{
+			Path:    path,
+			Topic:   filepath.Base(filepath.Dir(path)),
+			ModTime: info.ModTime().UTC(),
+		}
+		if day, err := time.Parse("2006-01-02", bf.Topic); err == nil {
+			bf.Topic = filepath.Base(filepath.Dir(filepath.Dir(path)))
+			bf.ModTime = time.Date(day.Year(), day.Month(), day.Day(), bf.ModTime.Hour(), 0, 0, 0, time.UTC)
+		}
+		files = append(files, bf)
+		return nil
+	})
+	return files, err
+}
+
+// flushFiles uploads each file and deletes it locally once the upload succeeds.
+// It returns the number of files uploaded (or that would be, in dry-run) and the number that failed.
+func flushFiles(ctx context.Context, store storage.ObjectStore, files []bufferFile, dryRun bool) (int, int) {
+	uploaded, failed := 0, 0
+	for _, bf := range files {
+		if dryRun {
+			log.Printf("[dry-run] would upload %s to %s", bf.Path, destKey(bf.Topic, batchName(bf), bf.ModTime))
+			uploaded++
+			continue
+		}
+
+		path := bf.Path
+		if filepath.Base(path) == "current.jsonl" {
+			// Give it a batch name first so a failed upload leaves a file the ingestion startup scan will retry
+			renamed := filepath.Join(filepath.Dir(path), batchName(bf))
+			if err := os.Rename(path, renamed); err != nil {
+				log.Printf("Failed to rotate %s: %v", path, err)
+				failed++
+				continue
+			}
+			path = renamed
+		}
+
+		key := destKey(bf.Topic, filepath.Base(path), bf.ModTime)
+		if err := uploadFile(ctx, store, path, key); err != nil {
+			log.Printf("Failed to upload %s (file preserved): %v", path, err)
+			failed++
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("Warning: uploaded %s but failed to remove local file: %v", path, err)
+		}
+		log.Printf("Uploaded %s to storage key %s", path, key)
+		uploaded++
+	}
+	return uploaded, failed
+}
+
+func uploadFile(ctx context.Context, store storage.ObjectStore, path, key string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return store.Put(ctx, key, f)
+}
+
+// batchName returns the file name a buffer file is uploaded under.
+// current.jsonl is given the batch_<ts>_<uuid>.jsonl name the ingestion rotation would have used.
+func batchName(bf bufferFile) string {
+	name := filepath.Base(bf.Path)
+	if name != "current.jsonl" {
+		return name
+	}
+	return fmt.Sprintf("batch_%s_%s.jsonl", bf.ModTime.Format("20060102150405"), uuid.New().String())
+}
+
+// destKey mirrors the ingestion service's layout: raw/<topic>/YYYY-MM-DD/HH/<file>.
+func destKey(topic, name string, t time.Time) string {
+	return fmt.Sprintf("raw/%s/%s/%s/%s", topic, t.Format("2006-01-02"), t.Format("15"), name)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+)
+
+// writeBufferFile creates a file in the buffer dir with the given modification time.
+func writeBufferFile(t *testing.T, bufferDir, topic, name string, mtime time.Time) string {
+	t.Helper()
+	dir := filepath.Join(bufferDir, topic)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create topic dir: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(`{"event_id":"x"}`+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("failed to set mtime: %v", err)
+	}
+	return path
+}
+
+func TestFlushFiles_UploadsAndDeletes(t *testing.T) {
+	bufferDir := t.TempDir()
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	mtime := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	batch := writeBufferFile(t, bufferDir, "request_facts", "batch_20250115103000_abc.jsonl", mtime)
+	writeBufferFile(t, bufferDir, "request_facts", "current.jsonl", mtime)
+	writeBufferFile(t, bufferDir, "request_facts", "notes.txt", mtime)
+
+	files, err := findBufferFiles(bufferDir, false)
+	if err != nil {
+		t.Fatalf("findBufferFiles failed: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != batch {
+		t.Fatalf("expected only the batch file, got %+v", files)
+	}
+
+	uploaded, failed := flushFiles(ctx, store, files, false)
+	if uploaded != 1 || failed != 0 {
+		t.Fatalf("expected 1 uploaded and 0 failed, got %d/%d", uploaded, failed)
+	}
+
+	want := "raw/request_facts/2025-01-15/10/batch_20250115103000_abc.jsonl"
+	if exists, _ := store.Exists(ctx, want); !exists {
+		t.Errorf("expected %s in store", want)
+	}
+	if _, err := os.Stat(batch); !os.IsNotExist(err) {
+		t.Error("expected local batch to be deleted after upload")
+	}
+}
+
+func TestFlushFiles_DryRun(t *testing.T) {
+	bufferDir := t.TempDir()
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	batch := writeBufferFile(t, bufferDir, "service_events", "batch_1.jsonl", time.Now())
+	files, _ := findBufferFiles(bufferDir, false)
+
+	if uploaded, _ := flushFiles(ctx, store, files, true); uploaded != 1 {
+		t.Errorf("expected dry-run to report 1 file, got %d", uploaded)
+	}
+	if _, err := os.Stat(batch); err != nil {
+		t.Error("dry-run must not delete local files")
+	}
+	if keys, _ := store.List(ctx, "raw"); len(keys) != 0 {
+		t.Errorf("dry-run must not upload, found %v", keys)
+	}
+}
+
+func TestFlushFiles_IncludeCurrent(t *testing.T) {
+	bufferDir := t.TempDir()
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	mtime := time.Date(2025, 1, 15, 23, 59, 0, 0, time.UTC)
+	current := writeBufferFile(t, bufferDir, "request_facts", "current.jsonl", mtime)
+
+	files, _ := findBufferFiles(bufferDir, true)
+	if uploaded, failed := flushFiles(ctx, store, files, false); uploaded != 1 || failed != 0 {
+		t.Fatalf("expected 1 uploaded and 0 failed, got %d/%d", uploaded, failed)
+	}
+
+	keys, _ := store.List(ctx, "raw/request_facts/2025-01-15/23")
+	if len(keys) != 1 || !strings.Contains(keys[0], "/batch_20250115235900_") {
+		t.Errorf("expected current.jsonl uploaded under a batch name, got %v", keys)
+	}
+	if _, err := os.Stat(current); !os.IsNotExist(err) {
+		t.Error("expected current.jsonl to be removed after upload")
+	}
+}
+
+func TestFindBufferFiles_EventDayPartition(t *testing.T) {
+	bufferDir := t.TempDir()
+
+	// A batch from the 15th's partition that was written just after midnight
+	mtime := time.Date(2025, 1, 16, 0, 5, 0, 0, time.UTC)
+	writeBufferFile(t, bufferDir, "request_facts/2025-01-15", "batch_1.jsonl", mtime)
+
+	files, err := findBufferFiles(bufferDir, false)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected 1 file, got %+v (err %v)", files, err)
+	}
+	got := destKey(files[0].Topic, "batch_1.jsonl", files[0].ModTime)
+	if want := "raw/request_facts/2025-01-15/00/batch_1.jsonl"; got != want {
+		t.Errorf("destKey = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// batchFile is a rotated batch waiting to be uploaded.
+type batchFile struct {
+	Name      string `json:"name"`
+	Bytes     int64  `json:"bytes"`
+	Timestamp string `json:"timestamp,omitempty"` // Rotation time embedded in batch_<ts>_<uuid>.jsonl, RFC3339
+}
+
+// partitionReport describes one buffer directory: a topic, or one event-day
+// partition of a topic when ingestion runs with -partition-by-event-day.
+type partitionReport struct {
+	Topic        string      `json:"topic"`
+	Day          string      `json:"day,omitempty"`
+	CurrentBytes int64       `json:"current_bytes"`
+	CurrentLines int         `json:"current_lines"`
+	PartialLine  bool        `json:"partial_line,omitempty"` // current.jsonl ends mid-record, e.g. after a crash during a write
+	Batches      []batchFile `json:"batches"`
+	PendingBytes int64       `json:"pending_bytes"` // current.jsonl plus every batch
+}
+
+// bufferReport is the state of a whole buffer directory.
+type bufferReport struct {
+	BufferDir    string            `json:"buffer_dir"`
+	Partitions   []partitionReport `json:"partitions"`
+	PendingBytes int64             `json:"pending_bytes"`
+}
+
+func main() {
+	var bufferDir string
+	var asJSON bool
+
+	flag.StringVar(&bufferDir, "buffer-dir", "./data/buffer", "Ingestion buffer directory to inspect (one subdirectory per topic)")
+	flag.BoolVar(&asJSON, "json", false, "Print the report as JSON instead of a table")
+	flag.Parse()
+
+	report, err := inspectBuffer(bufferDir)
+	if err != nil {
+		log.Fatalf("Failed to inspect %s: %v", bufferDir, err)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+		return
+	}
+	if err := writeTable(os.Stdout, report); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+}
+
+// inspectBuffer walks bufferDir without modifying anything. Directories are
+// mapped to topics the same way the ingestion startup scan does: <topic>/ or,
+// for an event-day partition, <topic>/<YYYY-MM-DD>/.
+func inspectBuffer(bufferDir string) (bufferReport, error) {
+	report := bufferReport{BufferDir: bufferDir, Partitions: []partitionReport{}}
+	partitions := make(map[string]*partitionReport)
+
+	err := filepath.Walk(bufferDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name := filepath.Base(path)
+		isBatch := strings.HasPrefix(name, "batch_") && strings.HasSuffix(name, ".jsonl")
+		if !isBatch && name != "current.jsonl" {
+			return nil
+		}
+
+		dir := filepath.Dir(path)
+		p, ok := partitions[dir]
+		if !ok {
+			p = &partitionReport{Topic: filepath.Base(dir), Batches: []batchFile{}}
+			if _, err := time.Parse("2006-01-02", p.Topic); err == nil {
+				p.Day = p.Topic
+				p.Topic = filepath.Base(filepath.Dir(dir))
+			}
+			partitions[dir] = p
+		}
+
+		if isBatch {
+			bf := batchFile{Name: name, Bytes: info.Size()}
+			if ts, ok := batchTimestamp(name); ok {
+				bf.Timestamp = ts.Format(time.RFC3339)
+			}
+			p.Batches = append(p.Batches, bf)
+		} else {
+			lines, partial, err := countLines(path)
+			if err != nil {
+				return err
+			}
+			p.CurrentBytes = info.Size()
+			p.CurrentLines = lines
+			p.PartialLine = partial
+		}
+		p.PendingBytes += info.Size()
+		report.PendingBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return bufferReport{}, err
+	}
+
+	for _, p := range partitions {
+		sort.Slice(p.Batches, func(i, j int) bool { return p.Batches[i].Name < p.Batches[j].Name })
+		report.Partitions = append(report.Partitions, *p)
+	}
+	sort.Slice(report.Partitions, func(i, j int) bool {
+		a, b := report.Partitions[i], report.Partitions[j]
+		if a.Topic == b.Topic {
+			return a.Day < b.Day
+		}
+		return a.Topic < b.Topic
+	})
+	return report, nil
+}
+
+// batchTimestamp parses the rotation time from batch_<20060102150405>_<uuid>.jsonl.
+func batchTimestamp(name string) (time.Time, bool) {
+	ts, _, ok := strings.Cut(strings.TrimPrefix(name, "batch_"), "_")
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("20060102150405", ts)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// countLines counts complete records in path and reports whether it ends
+// with an unterminated one.
+func countLines(path string) (int, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	lines := 0
+	var last byte
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			lines += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	return lines, last != 0 && last != '\n', nil
+}
+
+// writeTable prints one row per file followed by the pending total.
+func writeTable(w io.Writer, report bufferReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOPIC\tDAY\tFILE\tBYTES\tLINES\tTIMESTAMP")
+	for _, p := range report.Partitions {
+		day := p.Day
+		if day == "" {
+			day = "-"
+		}
+		if p.CurrentBytes > 0 || p.CurrentLines > 0 {
+			lines := fmt.Sprint(p.CurrentLines)
+			if p.PartialLine {
+				lines += " (+partial)"
+			}
+			fmt.Fprintf(tw, "%s\t%s\tcurrent.jsonl\t%d\t%s\t-\n", p.Topic, day, p.CurrentBytes, lines)
+		}
+		for _, b := range p.Batches {
+			ts := b.Timestamp
+			if ts == "" {
+				ts = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t-\t%s\n", p.Topic, day, b.Name, b.Bytes, ts)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d partitions, %d bytes not yet uploaded\n", len(report.Partitions), report.PendingBytes)
+	return err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBufferFile creates a file with the given content under bufferDir/dir.
+func writeBufferFile(t *testing.T, bufferDir, dir, name, content string) {
+	t.Helper()
+	full := filepath.Join(bufferDir, dir)
+	if err := os.MkdirAll(full, 0755); err != nil {
+		t.Fatalf("failed to create %s: %v", full, err)
+	}
+	if err := os.WriteFile(filepath.Join(full, name), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+}
+
+func TestInspectBuffer(t *testing.T) {
+	bufferDir := t.TempDir()
+	writeBufferFile(t, bufferDir, "request_facts", "current.jsonl", "{\"a\":1}\n{\"a\":2}\n{\"a\"")
+	writeBufferFile(t, bufferDir, "request_facts", "batch_20250115103000_abc.jsonl", "{\"a\":0}\n")
+	writeBufferFile(t, bufferDir, "request_facts", "notes.txt", "ignored")
+	writeBufferFile(t, bufferDir, "service_events/2025-01-14", "batch_garbled.jsonl", "{}\n")
+	before := snapshot(t, bufferDir)
+
+	report, err := inspectBuffer(bufferDir)
+	if err != nil {
+		t.Fatalf("inspectBuffer failed: %v", err)
+	}
+	if len(report.Partitions) != 2 {
+		t.Fatalf("expected 2 partitions, got %+v", report.Partitions)
+	}
+
+	facts := report.Partitions[0]
+	if facts.Topic != "request_facts" || facts.Day != "" {
+		t.Errorf("expected request_facts without a day first, got %s/%s", facts.Topic, facts.Day)
+	}
+	if facts.CurrentLines != 2 || !facts.PartialLine || facts.CurrentBytes != 20 {
+		t.Errorf("expected 20 bytes, 2 lines and a partial line in current.jsonl, got %+v", facts)
+	}
+	if len(facts.Batches) != 1 || facts.Batches[0].Timestamp != "2025-01-15T10:30:00Z" || facts.Batches[0].Bytes != 8 {
+		t.Errorf("expected one 8-byte batch from 2025-01-15T10:30:00Z, got %+v", facts.Batches)
+	}
+	if facts.PendingBytes != 28 {
+		t.Errorf("expected 28 pending bytes, got %d", facts.PendingBytes)
+	}
+
+	events := report.Partitions[1]
+	if events.Topic != "service_events" || events.Day != "2025-01-14" {
+		t.Errorf("expected the service_events 2025-01-14 partition, got %s/%s", events.Topic, events.Day)
+	}
+	if len(events.Batches) != 1 || events.Batches[0].Timestamp != "" {
+		t.Errorf("expected a batch without a parseable timestamp, got %+v", events.Batches)
+	}
+	if report.PendingBytes != 31 {
+		t.Errorf("expected 31 pending bytes in total, got %d", report.PendingBytes)
+	}
+
+	var out bytes.Buffer
+	if err := writeTable(&out, report); err != nil {
+		t.Fatalf("writeTable failed: %v", err)
+	}
+	for _, want := range []string{"current.jsonl", "2 (+partial)", "batch_20250115103000_abc.jsonl", "2025-01-14", "31 bytes not yet uploaded"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected table to contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	if after := snapshot(t, bufferDir); after != before {
+		t.Errorf("inspection modified the buffer:\nbefore %s\nafter  %s", before, after)
+	}
+}
+
+func TestInspectBuffer_Empty(t *testing.T) {
+	report, err := inspectBuffer(t.TempDir())
+	if err != nil {
+		t.Fatalf("inspectBuffer failed: %v", err)
+	}
+	if len(report.Partitions) != 0 || report.PendingBytes != 0 {
+		t.Errorf("expected an empty report, got %+v", report)
+	}
+	if _, err := inspectBuffer(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing buffer dir")
+	}
+}
+
+// snapshot lists every file under dir with its modification time.
+func snapshot(t *testing.T, dir string) string {
+	t.Helper()
+	var b strings.Builder
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			b.WriteString(path)
+			b.WriteString(" ")
+			b.WriteString(info.ModTime().String())
+			b.WriteString(";")
+		}
+		return nil
+	})
+	return b.String()
+}
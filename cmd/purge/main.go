@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/lgreene/gravix-dashboards/pkg/storage"
@@ -15,58 +17,47 @@ func main() {
 	var retentionDays int
 	var dryRun bool
 	var dataDir string
+	var onlyNew bool
+	var byModTime bool
 
 	flag.IntVar(&retentionDays, "retention-days", 30, "Delete data older than this many days")
 	flag.BoolVar(&dryRun, "dry-run", false, "Print files that would be deleted without actually deleting")
 	flag.StringVar(&dataDir, "data-dir", "./data", "Base data directory (used for local storage)")
+	flag.BoolVar(&onlyNew, "only-new", false, "Start from each prefix's recorded watermark instead of listing all history")
+	flag.BoolVar(&byModTime, "by-mod-time", false, "Judge age by each object's modification time instead of the date in its key")
 	flag.Parse()
 
+	if byModTime && onlyNew {
+		// Watermarks are key dates, which -by-mod-time ignores
+		log.Fatal("-by-mod-time cannot be combined with -only-new")
+	}
+
 	cutoff := time.Now().UTC().AddDate(0, 0, -retentionDays)
 	cutoffStr := cutoff.Format("2006-01-02")
 	log.Printf("Purging data older than %d days (cutoff: %s, dry-run: %v)", retentionDays, cutoffStr, dryRun)
 
 	ctx := context.Background()
 
-	var store storage.ObjectStore
-	if os.Getenv("S3_ENDPOINT") != "" {
-		log.Println("Using S3/MinIO storage...")
-		var err error
-		store, err = storage.NewS3Store(
-			ctx,
-			os.Getenv("S3_ENDPOINT"),
-			os.Getenv("S3_REGION"),
-			os.Getenv("S3_BUCKET"),
-			os.Getenv("S3_ACCESS_KEY"),
-			os.Getenv("S3_SECRET_KEY"),
-		)
-		if err != nil {
-			log.Fatalf("Failed to initialize S3 store: %v", err)
-		}
-	} else {
-		log.Printf("Using local storage at %s...", dataDir)
-		var err error
-		store, err = storage.NewLocalStore(dataDir)
-		if err != nil {
-			log.Fatalf("Failed to initialize local store: %v", err)
-		}
-	}
-
-	// Purge raw JSONL data
-	rawDeleted, err := purgeOldData(ctx, store, "raw/request_facts", cutoffStr, dryRun)
+	store, err := storage.FromEnv(ctx, dataDir)
 	if err != nil {
-		log.Printf("Error purging raw/request_facts: %v", err)
+		log.Fatalf("Failed to initialize store: %v", err)
 	}
 
-	eventDeleted, err := purgeOldData(ctx, store, "raw/service_events", cutoffStr, dryRun)
-	if err != nil {
-		log.Printf("Error purging raw/service_events: %v", err)
+	targets := []purgeTarget{
+		{Prefix: "raw/request_facts", DayPartitioned: true},
+		{Prefix: "raw/service_events", DayPartitioned: true},
+		{Prefix: "warehouse/request_metrics_minute"},
 	}
 
-	// Purge warehouse Parquet data
-	warehouseDeleted, err := purgeOldData(ctx, store, "warehouse/request_metrics_minute", cutoffStr, dryRun)
-	if err != nil {
-		log.Printf("Error purging warehouse/request_metrics_minute: %v", err)
+	counts := make([]int, len(targets))
+	for i, target := range targets {
+		deleted, err := purgeTargetData(ctx, store, target, cutoffStr, dryRun, onlyNew, byModTime)
+		if err != nil {
+			log.Printf("Error purging %s: %v", target.Prefix, err)
+		}
+		counts[i] = deleted
 	}
+	rawDeleted, eventDeleted, warehouseDeleted := counts[0], counts[1], counts[2]
 
 	total := rawDeleted + eventDeleted + warehouseDeleted
 	action := "deleted"
@@ -77,34 +68,150 @@ func main() {
 		action, total, rawDeleted, eventDeleted, warehouseDeleted)
 }
 
+// purgeTarget is a dataset prefix subject to retention.
+type purgeTarget struct {
+	Prefix         string
+	DayPartitioned bool // keys live under <prefix>/YYYY-MM-DD/, so a single day can be listed on its own
+}
+
+// watermarkKey is where the oldest date that may still hold data under prefix is recorded.
+// It lives outside the dataset so table scans (Trino) never see it.
+func watermarkKey(prefix string) string {
+	return "_purge/" + prefix + ".watermark"
+}
+
+// readWatermark returns the recorded oldest remaining date for prefix, or "" if none.
+func readWatermark(ctx context.Context, store storage.ObjectStore, prefix string) (string, error) {
+	key := watermarkKey(prefix)
+	exists, err := store.Exists(ctx, key)
+	if err != nil || !exists {
+		return "", err
+	}
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return "", err
+	}
+	date := strings.TrimSpace(string(data))
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "", fmt.Errorf("corrupt watermark %s: %q", key, date)
+	}
+	return date, nil
+}
+
+func writeWatermark(ctx context.Context, store storage.ObjectStore, prefix, date string) error {
+	return store.Put(ctx, watermarkKey(prefix), strings.NewReader(date+"\n"))
+}
+
+// purgeTargetData deletes everything older than cutoffDate under target and, after a clean
+// (non dry-run) pass, records cutoffDate as the prefix's watermark. With onlyNew, it starts
+// from the previous watermark: nothing is listed if the cutoff hasn't moved past it, and
+// day-partitioned prefixes only list the days between the watermark and the new cutoff.
+// With byModTime, objects are aged by modification time and no watermark is recorded, since
+// a key dated before the cutoff may survive a pass.
+func purgeTargetData(ctx context.Context, store storage.ObjectStore, target purgeTarget, cutoffDate string, dryRun, onlyNew, byModTime bool) (int, error) {
+	watermark := ""
+	if onlyNew {
+		var err error
+		watermark, err = readWatermark(ctx, store, target.Prefix)
+		if err != nil {
+			return 0, fmt.Errorf("read watermark: %w", err)
+		}
+	}
+	if watermark != "" && cutoffDate <= watermark {
+		log.Printf("Skipping %s: already purged up to %s", target.Prefix, watermark)
+		return 0, nil
+	}
+
+	var deleted, failed int
+	if watermark == "" || !target.DayPartitioned {
+		var err error
+		deleted, failed, err = purgeOldData(ctx, store, target.Prefix, cutoffDate, dryRun, byModTime)
+		if err != nil {
+			return deleted, err
+		}
+	} else {
+		day, _ := time.Parse("2006-01-02", watermark)
+		for ; day.Format("2006-01-02") < cutoffDate; day = day.AddDate(0, 0, 1) {
+			n, f, err := purgeOldData(ctx, store, target.Prefix+"/"+day.Format("2006-01-02"), cutoffDate, dryRun, byModTime)
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+			failed += f
+		}
+	}
+
+	if !dryRun && !byModTime && failed == 0 {
+		if err := writeWatermark(ctx, store, target.Prefix, cutoffDate); err != nil {
+			return deleted, fmt.Errorf("write watermark: %w", err)
+		}
+	}
+	return deleted, nil
+}
+
 // purgeOldData lists all keys under a prefix and deletes those containing dates older than the cutoff.
-// Date partitions are expected in YYYY-MM-DD format within the key path.
-func purgeOldData(ctx context.Context, store storage.ObjectStore, prefix, cutoffDate string, dryRun bool) (int, error) {
+// Date partitions are expected in YYYY-MM-DD format within the key path. With byModTime, the date is
+// instead the day each object was last modified, which costs a Stat per key.
+// The deletions go to the store in one DeleteBatch, so S3 needs a call per 1000 keys rather than per key.
+// It returns the number of files deleted and the number whose deletion (or Stat) failed.
+func purgeOldData(ctx context.Context, store storage.ObjectStore, prefix, cutoffDate string, dryRun, byModTime bool) (int, int, error) {
 	keys, err := store.List(ctx, prefix)
 	if err != nil {
-		return 0, fmt.Errorf("list %s: %w", prefix, err)
+		return 0, 0, fmt.Errorf("list %s: %w", prefix, err)
 	}
 
-	deleted := 0
+	var old []string
+	dates := make(map[string]string)
+	statFailed := 0
 	for _, key := range keys {
 		dateStr := extractDate(key)
+		if byModTime {
+			info, err := store.Stat(ctx, key)
+			if err != nil {
+				log.Printf("Failed to stat %s: %v", key, err)
+				statFailed++
+				continue
+			}
+			dateStr = info.ModTime.UTC().Format("2006-01-02")
+		}
 		if dateStr == "" {
 			continue // No parseable date in path
 		}
 		if dateStr < cutoffDate {
 			if dryRun {
 				log.Printf("[dry-run] would delete: %s (date: %s)", key, dateStr)
-			} else {
-				if err := store.Delete(ctx, key); err != nil {
-					log.Printf("Failed to delete %s: %v", key, err)
-					continue
-				}
-				log.Printf("Deleted: %s (date: %s)", key, dateStr)
 			}
-			deleted++
+			old = append(old, key)
+			dates[key] = dateStr
 		}
 	}
-	return deleted, nil
+	if dryRun || len(old) == 0 {
+		return len(old), statFailed, nil
+	}
+
+	failed := make(map[string]error)
+	if err := store.DeleteBatch(ctx, old); err != nil {
+		var batchErr *storage.DeleteBatchError
+		if !errors.As(err, &batchErr) {
+			// Not broken down by key, so nothing can be assumed deleted
+			log.Printf("Failed to delete %d keys under %s: %v", len(old), prefix, err)
+			return 0, len(old) + statFailed, nil
+		}
+		failed = batchErr.Failed
+	}
+	for _, key := range old {
+		if err, ok := failed[key]; ok {
+			log.Printf("Failed to delete %s: %v", key, err)
+			continue
+		}
+		log.Printf("Deleted: %s (date: %s)", key, dates[key])
+	}
+	return len(old) - len(failed), len(failed) + statFailed, nil
 }
 
 // extractDate finds the first YYYY-MM-DD pattern anywhere in a key.
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+)
+
+// listRecorder wraps an ObjectStore and records every List prefix.
+type listRecorder struct {
+	storage.ObjectStore
+	listed []string
+}
+
+func (r *listRecorder) List(ctx context.Context, prefix string) ([]string, error) {
+	r.listed = append(r.listed, prefix)
+	return r.ObjectStore.List(ctx, prefix)
+}
+
+func newRecorder(t *testing.T) *listRecorder {
+	t.Helper()
+	local, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	return &listRecorder{ObjectStore: local}
+}
+
+func putDay(t *testing.T, store storage.ObjectStore, prefix, day string) string {
+	t.Helper()
+	key := fmt.Sprintf("%s/%s/10/batch.jsonl", prefix, day)
+	if err := store.Put(context.Background(), key, strings.NewReader("{}")); err != nil {
+		t.Fatalf("failed to put %s: %v", key, err)
+	}
+	return key
+}
+
+func TestPurgeTargetData_OnlyNewUsesWatermark(t *testing.T) {
+	store := newRecorder(t)
+	ctx := context.Background()
+	target := purgeTarget{Prefix: "raw/request_facts", DayPartitioned: true}
+
+	for d := 10; d <= 20; d++ {
+		putDay(t, store, target.Prefix, fmt.Sprintf("2025-01-%02d", d))
+	}
+
+	// First run has no watermark, so it lists the whole prefix
+	deleted, err := purgeTargetData(ctx, store, target, "2025-01-15", false, true, false)
+	if err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+	if deleted != 5 {
+		t.Errorf("expected 5 deletions, got %d", deleted)
+	}
+	if wm, _ := readWatermark(ctx, store, target.Prefix); wm != "2025-01-15" {
+		t.Errorf("expected watermark 2025-01-15, got %q", wm)
+	}
+
+	// Same cutoff again: nothing to do, nothing listed
+	store.listed = nil
+	if deleted, _ := purgeTargetData(ctx, store, target, "2025-01-15", false, true, false); deleted != 0 {
+		t.Errorf("expected no deletions on a repeat run, got %d", deleted)
+	}
+	if len(store.listed) != 0 {
+		t.Errorf("expected no listing on a repeat run, listed %v", store.listed)
+	}
+
+	// Cutoff moved two days: only those two day partitions are listed
+	store.listed = nil
+	deleted, err = purgeTargetData(ctx, store, target, "2025-01-17", false, true, false)
+	if err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("expected 2 deletions, got %d", deleted)
+	}
+	want := []string{"raw/request_facts/2025-01-15", "raw/request_facts/2025-01-16"}
+	if len(store.listed) != 2 || store.listed[0] != want[0] || store.listed[1] != want[1] {
+		t.Errorf("expected listings %v, got %v", want, store.listed)
+	}
+
+	remaining, _ := store.List(ctx, target.Prefix)
+	if len(remaining) != 4 {
+		t.Errorf("expected days 17-20 to remain, got %v", remaining)
+	}
+}
+
+func TestPurgeTargetData_DryRunLeavesWatermark(t *testing.T) {
+	store := newRecorder(t)
+	ctx := context.Background()
+	target := purgeTarget{Prefix: "raw/service_events", DayPartitioned: true}
+	key := putDay(t, store, target.Prefix, "2025-01-10")
+
+	if deleted, _ := purgeTargetData(ctx, store, target, "2025-01-15", true, true, false); deleted != 1 {
+		t.Errorf("expected dry-run to report 1 file, got %d", deleted)
+	}
+	if exists, _ := store.Exists(ctx, key); !exists {
+		t.Error("dry-run deleted a file")
+	}
+	if wm, _ := readWatermark(ctx, store, target.Prefix); wm != "" {
+		t.Errorf("dry-run must not record a watermark, got %q", wm)
+	}
+}
+
+func TestPurgeTargetData_FlatPrefixRelistsWhenCutoffMoves(t *testing.T) {
+	store := newRecorder(t)
+	ctx := context.Background()
+	target := purgeTarget{Prefix: "warehouse/request_metrics_minute"}
+	store.Put(ctx, target.Prefix+"/metrics_a_2025-01-10.parquet", strings.NewReader("x"))
+	store.Put(ctx, target.Prefix+"/metrics_b_2025-01-16.parquet", strings.NewReader("x"))
+
+	if deleted, _ := purgeTargetData(ctx, store, target, "2025-01-15", false, true, false); deleted != 1 {
+		t.Errorf("expected 1 deletion, got %d", deleted)
+	}
+
+	store.listed = nil
+	if deleted, _ := purgeTargetData(ctx, store, target, "2025-01-17", false, true, false); deleted != 1 {
+		t.Errorf("expected 1 deletion, got %d", deleted)
+	}
+	if len(store.listed) != 1 || store.listed[0] != target.Prefix {
+		t.Errorf("expected a full listing of the flat prefix, got %v", store.listed)
+	}
+}
+
+// batchRecorder wraps an ObjectStore, records DeleteBatch and Delete calls
+// and fails the deletion of the keys in fail.
+type batchRecorder struct {
+	storage.ObjectStore
+	batches [][]string
+	deletes int
+	fail    map[string]bool
+}
+
+func (r *batchRecorder) Delete(ctx context.Context, key string) error {
+	r.deletes++
+	return r.ObjectStore.Delete(ctx, key)
+}
+
+func (r *batchRecorder) DeleteBatch(ctx context.Context, keys []string) error {
+	r.batches = append(r.batches, keys)
+	var ok []string
+	failed := make(map[string]error)
+	for _, k := range keys {
+		if r.fail[k] {
+			failed[k] = errors.New("AccessDenied: simulated")
+		} else {
+			ok = append(ok, k)
+		}
+	}
+	if err := r.ObjectStore.DeleteBatch(ctx, ok); err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return &storage.DeleteBatchError{Failed: failed}
+	}
+	return nil
+}
+
+func TestPurgeTargetData_DeletesInOneBatch(t *testing.T) {
+	store := &batchRecorder{ObjectStore: newRecorder(t)}
+	ctx := context.Background()
+	target := purgeTarget{Prefix: "raw/request_facts", DayPartitioned: true}
+	var old []string
+	for d := 10; d <= 12; d++ {
+		old = append(old, putDay(t, store, target.Prefix, fmt.Sprintf("2025-01-%02d", d)))
+	}
+	kept := putDay(t, store, target.Prefix, "2025-01-16")
+	store.fail = map[string]bool{old[1]: true}
+
+	deleted, err := purgeTargetData(ctx, store, target, "2025-01-15", false, true, false)
+	if err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("expected 2 deletions with one failing key, got %d", deleted)
+	}
+	if len(store.batches) != 1 || len(store.batches[0]) != 3 || store.deletes != 0 {
+		t.Errorf("expected one DeleteBatch of 3 keys and no single deletes, got %v and %d deletes", store.batches, store.deletes)
+	}
+	for _, key := range []string{old[1], kept} {
+		if exists, _ := store.Exists(ctx, key); !exists {
+			t.Errorf("expected %s to remain", key)
+		}
+	}
+	// A failed key must be retried on the next run, so the watermark can't move past it
+	if wm, _ := readWatermark(ctx, store, target.Prefix); wm != "" {
+		t.Errorf("expected no watermark after a failed deletion, got %q", wm)
+	}
+}
+
+func TestPurgeTargetData_ByModTime(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	target := purgeTarget{Prefix: "warehouse/request_metrics_minute"}
+
+	// Written today, but the key embeds an unrelated old date
+	fresh := target.Prefix + "/backfill_of_2024-06-01/metrics.parquet"
+	// No date in the key at all, but last written long ago
+	stale := target.Prefix + "/metrics_compacted.parquet"
+	for _, key := range []string{fresh, stale} {
+		if err := store.Put(ctx, key, strings.NewReader("x")); err != nil {
+			t.Fatalf("failed to put %s: %v", key, err)
+		}
+	}
+	old := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, stale), old, old); err != nil {
+		t.Fatalf("failed to age %s: %v", stale, err)
+	}
+
+	deleted, err := purgeTargetData(ctx, store, target, "2025-01-15", false, false, true)
+	if err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 deletion, got %d", deleted)
+	}
+	if exists, _ := store.Exists(ctx, stale); exists {
+		t.Errorf("expected %s to be deleted", stale)
+	}
+	if exists, _ := store.Exists(ctx, fresh); !exists {
+		t.Errorf("expected %s to remain", fresh)
+	}
+	if wm, _ := readWatermark(ctx, store, target.Prefix); wm != "" {
+		t.Errorf("expected no watermark when purging by modification time, got %q", wm)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/lgreene/gravix-dashboards/schemas"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The same shape of traffic as cmd/load_generator.
+var (
+	services   = []string{"auth-service", "payment-service", "inventory-service", "user-service", "cart-service"}
+	methods    = []string{"GET", "POST", "PUT", "DELETE"}
+	paths      = []string{"/api/v1/login", "/api/v1/users/:id", "/api/v1/products", "/api/v1/cart/checkout"}
+	userAgents = []string{"Chrome", "Firefox", "Safari", "Edge", "Postman", "LoadGenerator"}
+	eventTypes = []string{"deploy_started", "deploy_completed", "restart", "scale_up", "scale_down", "health_check_failed"}
+)
+
+// seedConfig is how much data to write for each day.
+type seedConfig struct {
+	FactsPerDay  int
+	EventsPerDay int
+}
+
+func main() {
+	var startDay, endDay string
+	var dataDir string
+	var cfg seedConfig
+
+	flag.StringVar(&startDay, "start-day", "", "First day to seed (YYYY-MM-DD, required)")
+	flag.StringVar(&endDay, "end-day", "", "Last day to seed, inclusive (YYYY-MM-DD, default: -start-day)")
+	flag.StringVar(&dataDir, "data-dir", "./data", "Base data directory (used for local storage)")
+	flag.IntVar(&cfg.FactsPerDay, "facts-per-day", 10000, "Request facts to write per day, spread evenly over its hours")
+	flag.IntVar(&cfg.EventsPerDay, "events-per-day", 100, "Service events to write per day, spread evenly over its hours")
+	flag.Parse()
+
+	if startDay == "" {
+		log.Fatal("-start-day is required")
+	}
+	if endDay == "" {
+		endDay = startDay
+	}
+	start, err := time.Parse("2006-01-02", startDay)
+	if err != nil {
+		log.Fatalf("Invalid -start-day %q: %v", startDay, err)
+	}
+	end, err := time.Parse("2006-01-02", endDay)
+	if err != nil {
+		log.Fatalf("Invalid -end-day %q: %v", endDay, err)
+	}
+	if end.Before(start) {
+		log.Fatalf("-end-day %s is before -start-day %s", endDay, startDay)
+	}
+	if cfg.FactsPerDay < 0 || cfg.EventsPerDay < 0 {
+		log.Fatal("-facts-per-day and -events-per-day must not be negative")
+	}
+
+	ctx := context.Background()
+
+	store, err := storage.FromEnv(ctx, dataDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize store: %v", err)
+	}
+
+	var facts, events int
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		f, e, err := seedDay(ctx, store, day, cfg)
+		if err != nil {
+			log.Fatalf("Failed to seed %s: %v", day.Format("2006-01-02"), err)
+		}
+		log.Printf("Seeded %s: %d facts, %d events", day.Format("2006-01-02"), f, e)
+		facts += f
+		events += e
+	}
+	log.Printf("Seed complete: %d facts and %d events from %s to %s", facts, events, startDay, endDay)
+}
+
+// seedDay writes one batch per topic and hour of day under
+// raw/<topic>/YYYY-MM-DD/HH/, the layout the ingestion service uploads to, so
+// the rollups and purge see seeded data exactly like ingested data. It returns
+// the number of facts and events written.
+func seedDay(ctx context.Context, store storage.ObjectStore, day time.Time, cfg seedConfig) (int, int, error) {
+	var facts, events int
+	for hour := range 24 {
+		hourStart := day.Add(time.Duration(hour) * time.Hour)
+
+		n, err := putBatch(ctx, store, "request_facts", hourStart, perHour(cfg.FactsPerDay, hour), func(t time.Time) proto.Message {
+			return generateFact(t)
+		})
+		facts += n
+		if err != nil {
+			return facts, events, err
+		}
+
+		n, err = putBatch(ctx, store, "service_events", hourStart, perHour(cfg.EventsPerDay, hour), func(t time.Time) proto.Message {
+			return generateEvent(t)
+		})
+		events += n
+		if err != nil {
+			return facts, events, err
+		}
+	}
+	return facts, events, nil
+}
+
+// perHour splits perDay records over 24 hours, giving the remainder to the earliest hours.
+func perHour(perDay, hour int) int {
+	n := perDay / 24
+	if hour < perDay%24 {
+		n++
+	}
+	return n
+}
+
+// putBatch writes n records with event times inside the hour starting at
+// hourStart as one JSONL batch. It writes nothing when n is 0.
+func putBatch(ctx context.Context, store storage.ObjectStore, topic string, hourStart time.Time, n int, generate func(time.Time) proto.Message) (int, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	marshalOpts := protojson.MarshalOptions{UseProtoNames: true}
+	var buf bytes.Buffer
+	for range n {
+		t := hourStart.Add(rand.N(time.Hour))
+		line, err := marshalOpts.Marshal(generate(t))
+		if err != nil {
+			return 0, fmt.Errorf("marshal %s record: %w", topic, err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	key := fmt.Sprintf("raw/%s/%s/%s/batch_%s_%s.jsonl", topic, hourStart.Format("2006-01-02"), hourStart.Format("15"),
+		hourStart.Format("20060102150405"), uuid.New().String())
+	if err := store.Put(ctx, key, &buf); err != nil {
+		return 0, fmt.Errorf("put %s: %w", key, err)
+	}
+	return n, nil
+}
+
+func generateFact(t time.Time) *schemas.RequestFact {
+	// Roughly the load generator's latency and status mix
+	var latencyMs int32
+	switch r := rand.Float64(); {
+	case r < 0.90:
+		latencyMs = int32(rand.IntN(100) + 10)
+	case r < 0.99:
+		latencyMs = int32(rand.IntN(500) + 100)
+	default:
+		latencyMs = int32(rand.IntN(2000) + 500)
+	}
+
+	status := int32(200)
+	switch r := rand.Float64(); {
+	case r > 0.98:
+		status = 500
+	case r > 0.95:
+		status = 400
+	}
+
+	return &schemas.RequestFact{
+		EventId:         eventID(),
+		EventTime:       timestamppb.New(t),
+		Service:         services[rand.IntN(len(services))],
+		Method:          methods[rand.IntN(len(methods))],
+		PathTemplate:    paths[rand.IntN(len(paths))],
+		StatusCode:      status,
+		LatencyMs:       latencyMs,
+		UserAgentFamily: userAgents[rand.IntN(len(userAgents))],
+	}
+}
+
+func generateEvent(t time.Time) *schemas.ServiceEvent {
+	service := services[rand.IntN(len(services))]
+	return &schemas.ServiceEvent{
+		EventId:   eventID(),
+		EventTime: timestamppb.New(t),
+		Service:   service,
+		EventType: eventTypes[rand.IntN(len(eventTypes))],
+		Properties: map[string]string{
+			"version":  fmt.Sprintf("1.%d.%d", rand.IntN(10), rand.IntN(100)),
+			"instance": fmt.Sprintf("%s-%d", service, rand.IntN(5)),
+		},
+	}
+}
+
+func eventID() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		id = uuid.New()
+	}
+	return id.String()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/lgreene/gravix-dashboards/schemas"
+)
+
+func TestSeedDay_WritesHourlyBatches(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	facts, events, err := seedDay(ctx, store, day, seedConfig{FactsPerDay: 50, EventsPerDay: 3})
+	if err != nil {
+		t.Fatalf("seedDay failed: %v", err)
+	}
+	if facts != 50 || events != 3 {
+		t.Fatalf("expected 50 facts and 3 events, got %d/%d", facts, events)
+	}
+
+	keys, err := store.List(ctx, "raw/request_facts/2025-01-15/")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 24 {
+		t.Fatalf("expected one fact batch per hour, got %d: %v", len(keys), keys)
+	}
+	total := 0
+	for _, key := range keys {
+		hour := strings.Split(key, "/")[3]
+		for _, line := range readLines(t, store, key) {
+			fact, err := schemas.ParseRequestFact([]byte(line))
+			if err != nil {
+				t.Fatalf("%s holds an invalid fact: %v", key, err)
+			}
+			et := fact.EventTime.AsTime()
+			if et.Format("2006-01-02") != "2025-01-15" || et.Format("15") != hour {
+				t.Errorf("%s holds a fact from %s", key, et)
+			}
+			total++
+		}
+	}
+	if total != 50 {
+		t.Errorf("expected 50 fact lines, got %d", total)
+	}
+
+	// 3 events a day only fill the first 3 hours
+	keys, err = store.List(ctx, "raw/service_events/2025-01-15/")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 event batches, got %d: %v", len(keys), keys)
+	}
+	for _, key := range keys {
+		for _, line := range readLines(t, store, key) {
+			if _, err := schemas.ParseServiceEvent([]byte(line)); err != nil {
+				t.Fatalf("%s holds an invalid event: %v", key, err)
+			}
+		}
+	}
+}
+
+func TestPerHour(t *testing.T) {
+	sum := 0
+	for hour := range 24 {
+		sum += perHour(100, hour)
+	}
+	if sum != 100 {
+		t.Errorf("expected 100 records over the day, got %d", sum)
+	}
+	if perHour(100, 0) != 5 || perHour(100, 23) != 4 {
+		t.Errorf("expected the remainder in the earliest hours, got %d and %d", perHour(100, 0), perHour(100, 23))
+	}
+}
+
+func readLines(t *testing.T, store storage.ObjectStore, key string) []string {
+	t.Helper()
+	rc, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get %s failed: %v", key, err)
+	}
+	defer rc.Close()
+	var lines []string
+	sc := bufio.NewScanner(rc)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("read %s failed: %v", key, err)
+	}
+	return lines
+}
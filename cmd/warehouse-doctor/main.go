@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+)
+
+// outputKeyRegex matches rollup outputs such as metrics_<uuid>_<day>.parquet or events_<uuid>_<day>.parquet,
+// outputs of a rollup run with -bucket such as metrics_5m_<uuid>_<day>.parquet,
+// and the parts of a split output such as metrics_<uuid>_<day>.part00.parquet.
+var outputKeyRegex = regexp.MustCompile(`(?:^|/)[a-z]+(?:_\d+[mh])?_([0-9a-fA-F-]{36})_(\d{4}-\d{2}-\d{2})(?:\.part\d+)?\.parquet$`)
+
+// outputFile is a single parquet object in a warehouse prefix.
+type outputFile struct {
+	Key     string
+	ID      string // Shared by every part of one output
+	Day     string
+	Written time.Time // From the UUIDv7 in the key, else the modification time; zero if neither is known
+}
+
+// duplicateDay describes a day that has more than one output.
+type duplicateDay struct {
+	Day    string
+	Keep   string   // Empty if the newest output cannot be determined; its first part if it is split
+	Delete []string // Files that should be removed to restore a single output
+}
+
+func main() {
+	var prefix string
+	var dataDir string
+	var fix bool
+	var dryRun bool
+
+	flag.StringVar(&prefix, "prefix", "warehouse/request_metrics_minute", "Warehouse key prefix to inspect")
+	flag.StringVar(&dataDir, "data-dir", "./data", "Base data directory (used for local storage)")
+	flag.BoolVar(&fix, "fix", false, "Repair duplicate days by keeping the newest file and deleting the rest")
+	flag.BoolVar(&dryRun, "dry-run", true, "With -fix, only print what would be deleted (set -dry-run=false to delete)")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	store, err := storage.FromEnv(ctx, dataDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize store: %v", err)
+	}
+
+	dups, err := findDuplicates(ctx, store, prefix)
+	if err != nil {
+		log.Fatalf("Failed to inspect %s: %v", prefix, err)
+	}
+	if len(dups) == 0 {
+		log.Printf("No duplicate days found under %s.", prefix)
+		return
+	}
+
+	for _, d := range dups {
+		if d.Keep == "" {
+			log.Printf("Day %s: %d files, cannot determine newest (no write time) — manual review required: %v",
+				d.Day, len(d.Delete), d.Delete)
+			continue
+		}
+		log.Printf("Day %s: keeping %s, %d duplicate(s): %v", d.Day, d.Keep, len(d.Delete), d.Delete)
+	}
+
+	if !fix {
+		log.Printf("Found %d duplicate day(s). Re-run with -fix to repair.", len(dups))
+		os.Exit(1)
+	}
+
+	deleted := repairDuplicates(ctx, store, dups, dryRun)
+	action := "deleted"
+	if dryRun {
+		action = "would delete"
+	}
+	log.Printf("Repair complete: %s %d files across %d duplicate day(s).", action, deleted, len(dups))
+}
+
+// findDuplicates lists a warehouse prefix and returns every day with more than one parquet output.
+// The parts of a split output count as one. The newest output per day is chosen by the write time
+// embedded in its UUIDv7 key or, for legacy UUIDv4 keys, by the object's modification time.
+func findDuplicates(ctx context.Context, store storage.ObjectStore, prefix string) ([]duplicateDay, error) {
+	keys, err := store.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", prefix, err)
+	}
+
+	byDay := make(map[string][]outputFile)
+	for _, key := range keys {
+		m := outputKeyRegex.FindStringSubmatch(key)
+		if m == nil {
+			continue
+		}
+		f := outputFile{Key: key, ID: m[1], Day: m[2]}
+		if id, err := uuid.Parse(m[1]); err == nil && id.Version() == 7 {
+			sec, nsec := id.Time().UnixTime()
+			f.Written = time.Unix(sec, nsec).UTC()
+		}
+		byDay[f.Day] = append(byDay[f.Day], f)
+	}
+
+	var dups []duplicateDay
+	for day, files := range byDay {
+		ids := make(map[string]bool)
+		for _, f := range files {
+			ids[f.ID] = true
+		}
+		if len(ids) < 2 {
+			continue
+		}
+		for i := range files {
+			if !files[i].Written.IsZero() {
+				continue
+			}
+			info, err := store.Stat(ctx, files[i].Key)
+			if err != nil {
+				log.Printf("Failed to stat %s: %v", files[i].Key, err)
+				continue
+			}
+			files[i].Written = info.ModTime.UTC()
+		}
+		dups = append(dups, resolveDay(day, files))
+	}
+	sort.Slice(dups, func(i, j int) bool { return dups[i].Day < dups[j].Day })
+	return dups, nil
+}
+
+// resolveDay picks the newest output for a day. If any file has no write time
+// the choice would be a guess, so nothing is marked to keep.
+func resolveDay(day string, files []outputFile) duplicateDay {
+	d := duplicateDay{Day: day}
+	for _, f := range files {
+		if f.Written.IsZero() {
+			for _, f := range files {
+				d.Delete = append(d.Delete, f.Key)
+			}
+			sort.Strings(d.Delete)
+			return d
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Written.Equal(files[j].Written) {
+			return files[i].ID > files[j].ID
+		}
+		return files[i].Written.After(files[j].Written)
+	})
+	keep := files[0].ID
+	for _, f := range files {
+		if f.ID != keep {
+			d.Delete = append(d.Delete, f.Key)
+		} else if d.Keep == "" || f.Key < d.Keep {
+			d.Keep = f.Key
+		}
+	}
+	return d
+}
+
+// repairDuplicates deletes all but the newest file for each resolvable duplicate day.
+// Days without a determinable newest file are left untouched.
+func repairDuplicates(ctx context.Context, store storage.ObjectStore, dups []duplicateDay, dryRun bool) int {
+	deleted := 0
+	for _, d := range dups {
+		if d.Keep == "" {
+			continue
+		}
+		for _, key := range d.Delete {
+			if dryRun {
+				log.Printf("[dry-run] would delete: %s", key)
+				deleted++
+				continue
+			}
+			if err := store.Delete(ctx, key); err != nil {
+				log.Printf("Failed to delete %s: %v", key, err)
+				continue
+			}
+			log.Printf("Deleted: %s", key)
+			deleted++
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+)
+
+// v7At returns a UUIDv7 string whose embedded timestamp is t.
+func v7At(t *testing.T, ts time.Time) string {
+	t.Helper()
+	id, err := uuid.NewV7()
+	if err != nil {
+		t.Fatalf("failed to generate UUIDv7: %v", err)
+	}
+	ms := uint64(ts.UnixMilli())
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ms >> (40 - 8*i))
+	}
+	return id.String()
+}
+
+func putKey(t *testing.T, store storage.ObjectStore, key string) {
+	t.Helper()
+	if err := store.Put(context.Background(), key, strings.NewReader("parquet")); err != nil {
+		t.Fatalf("failed to put %s: %v", key, err)
+	}
+}
+
+func TestFindDuplicates_KeepsNewest(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	base := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	older := fmt.Sprintf("warehouse/request_metrics_minute/metrics_%s_2025-01-15.parquet", v7At(t, base))
+	newer := fmt.Sprintf("warehouse/request_metrics_minute/metrics_%s_2025-01-15.parquet", v7At(t, base.Add(5*time.Minute)))
+	single := fmt.Sprintf("warehouse/request_metrics_minute/metrics_%s_2025-01-16.parquet", v7At(t, base))
+	putKey(t, store, older)
+	putKey(t, store, newer)
+	putKey(t, store, single)
+
+	dups, err := findDuplicates(ctx, store, "warehouse/request_metrics_minute")
+	if err != nil {
+		t.Fatalf("findDuplicates failed: %v", err)
+	}
+	if len(dups) != 1 {
+		t.Fatalf("expected 1 duplicate day, got %d: %+v", len(dups), dups)
+	}
+	if dups[0].Day != "2025-01-15" || dups[0].Keep != newer {
+		t.Errorf("expected to keep %s for 2025-01-15, got %+v", newer, dups[0])
+	}
+	if len(dups[0].Delete) != 1 || dups[0].Delete[0] != older {
+		t.Errorf("expected to delete %s, got %v", older, dups[0].Delete)
+	}
+
+	// Dry-run must not delete anything
+	if n := repairDuplicates(ctx, store, dups, true); n != 1 {
+		t.Errorf("expected dry-run to report 1 file, got %d", n)
+	}
+	if exists, _ := store.Exists(ctx, older); !exists {
+		t.Fatal("dry-run deleted a file")
+	}
+
+	repairDuplicates(ctx, store, dups, false)
+	if exists, _ := store.Exists(ctx, older); exists {
+		t.Error("expected older duplicate to be deleted")
+	}
+	if exists, _ := store.Exists(ctx, newer); !exists {
+		t.Error("newest file must be kept")
+	}
+}
+
+func TestFindDuplicates_LegacyKeysUseModTime(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	// Legacy keys embed a random UUIDv4, so the modification time decides
+	base := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	older := fmt.Sprintf("warehouse/request_metrics_minute/metrics_%s_2025-01-15.parquet", uuid.New().String())
+	newer := fmt.Sprintf("warehouse/request_metrics_minute/metrics_%s_2025-01-15.parquet", uuid.New().String())
+	for key, mtime := range map[string]time.Time{older: base, newer: base.Add(5 * time.Minute)} {
+		putKey(t, store, key)
+		if err := os.Chtimes(filepath.Join(dir, key), mtime, mtime); err != nil {
+			t.Fatalf("failed to set mtime of %s: %v", key, err)
+		}
+	}
+
+	dups, err := findDuplicates(ctx, store, "warehouse/request_metrics_minute")
+	if err != nil {
+		t.Fatalf("findDuplicates failed: %v", err)
+	}
+	if len(dups) != 1 || dups[0].Keep != newer || len(dups[0].Delete) != 1 || dups[0].Delete[0] != older {
+		t.Fatalf("expected to keep %s and delete %s, got %+v", newer, older, dups)
+	}
+}
+
+// noStatStore fails every Stat, as when object metadata can't be read.
+type noStatStore struct {
+	storage.ObjectStore
+}
+
+func (s noStatStore) Stat(ctx context.Context, key string) (storage.ObjectInfo, error) {
+	return storage.ObjectInfo{}, fmt.Errorf("injected stat failure")
+}
+
+func TestFindDuplicates_AmbiguousWithoutTimestamp(t *testing.T) {
+	local, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	store := noStatStore{ObjectStore: local}
+	ctx := context.Background()
+
+	// Neither the UUIDv4 keys nor the store tell which is newer
+	a := fmt.Sprintf("warehouse/request_metrics_minute/metrics_%s_2025-01-15.parquet", uuid.New().String())
+	b := fmt.Sprintf("warehouse/request_metrics_minute/metrics_%s_2025-01-15.parquet", uuid.New().String())
+	putKey(t, store, a)
+	putKey(t, store, b)
+
+	dups, err := findDuplicates(ctx, store, "warehouse/request_metrics_minute")
+	if err != nil {
+		t.Fatalf("findDuplicates failed: %v", err)
+	}
+	if len(dups) != 1 || dups[0].Keep != "" {
+		t.Fatalf("expected 1 unresolved duplicate day, got %+v", dups)
+	}
+
+	if n := repairDuplicates(ctx, store, dups, false); n != 0 {
+		t.Errorf("expected no deletions for ambiguous day, got %d", n)
+	}
+	for _, k := range []string{a, b} {
+		if exists, _ := store.Exists(ctx, k); !exists {
+			t.Errorf("%s should not have been deleted", k)
+		}
+	}
+}
+
+func TestFindDuplicates_SplitOutputIsOne(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	base := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	newer := v7At(t, base.Add(5*time.Minute))
+	part0 := fmt.Sprintf("warehouse/request_metrics_minute/metrics_%s_2025-01-15.part00.parquet", newer)
+	part1 := fmt.Sprintf("warehouse/request_metrics_minute/metrics_%s_2025-01-15.part01.parquet", newer)
+	putKey(t, store, part0)
+	putKey(t, store, part1)
+
+	// The parts of one output are not duplicates of each other
+	dups, err := findDuplicates(ctx, store, "warehouse/request_metrics_minute")
+	if err != nil || len(dups) != 0 {
+		t.Fatalf("expected no duplicates for a split output, got %+v (err %v)", dups, err)
+	}
+
+	older := fmt.Sprintf("warehouse/request_metrics_minute/metrics_%s_2025-01-15.parquet", v7At(t, base))
+	putKey(t, store, older)
+	dups, err = findDuplicates(ctx, store, "warehouse/request_metrics_minute")
+	if err != nil {
+		t.Fatalf("findDuplicates failed: %v", err)
+	}
+	if len(dups) != 1 || dups[0].Keep != part0 || len(dups[0].Delete) != 1 || dups[0].Delete[0] != older {
+		t.Fatalf("expected to keep the split output and delete %s, got %+v", older, dups)
+	}
+}
+
+func TestFindDuplicates_BucketedOutput(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	// A rerun with -bucket 5m replaces the day's 1m output, so the two are duplicates
+	base := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	older := fmt.Sprintf("warehouse/request_metrics_minute/metrics_%s_2025-01-15.parquet", v7At(t, base))
+	newer := fmt.Sprintf("warehouse/request_metrics_minute/metrics_5m_%s_2025-01-15.parquet", v7At(t, base.Add(5*time.Minute)))
+	putKey(t, store, older)
+	putKey(t, store, newer)
+
+	dups, err := findDuplicates(ctx, store, "warehouse/request_metrics_minute")
+	if err != nil {
+		t.Fatalf("findDuplicates failed: %v", err)
+	}
+	if len(dups) != 1 || dups[0].Keep != newer || len(dups[0].Delete) != 1 || dups[0].Delete[0] != older {
+		t.Fatalf("expected to keep %s and delete %s, got %+v", newer, older, dups)
+	}
+}
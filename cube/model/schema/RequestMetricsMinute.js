@@ -23,6 +23,32 @@ cube(`RequestMetricsMinute`, {
       title: `Total Errors`
     },
 
+    // By status class. NULL in files written before these columns existed,
+    // so their sum can fall short of requestCount over old days.
+    count2xx: {
+      sql: `count_2xx`,
+      type: `sum`,
+      title: `2xx Responses`
+    },
+
+    count3xx: {
+      sql: `count_3xx`,
+      type: `sum`,
+      title: `3xx Responses`
+    },
+
+    count4xx: {
+      sql: `count_4xx`,
+      type: `sum`,
+      title: `4xx Responses`
+    },
+
+    count5xx: {
+      sql: `count_5xx`,
+      type: `sum`,
+      title: `5xx Responses`
+    },
+
     errorRate: {
       sql: `sum(error_count) / NULLIF(sum(request_count), 0)`,
       type: `number`,
@@ -50,6 +76,28 @@ cube(`RequestMetricsMinute`, {
       sql: `p99_latency_ms`,
       type: `max`,
       title: `P99 Latency (Max)`
+    },
+
+    // NULL unless the rollup runs with -percentiles including 90 / 99.9
+    p90Latency: {
+      sql: `p90_latency_ms`,
+      type: `max`,
+      title: `P90 Latency (Max)`
+    },
+
+    p999Latency: {
+      sql: `p999_latency_ms`,
+      type: `max`,
+      title: `P99.9 Latency (Max)`
+    },
+
+    // apdex * request_count is satisfied + tolerating/2, so weighting by
+    // request_count re-aggregates exactly. Rows from before the column
+    // existed are NULL and left out of both sums.
+    apdex: {
+      sql: `sum(apdex * request_count) / NULLIF(sum(CASE WHEN apdex IS NOT NULL THEN request_count END), 0)`,
+      type: `number`,
+      title: `Apdex`
     }
   },
 
@@ -60,6 +108,13 @@ cube(`RequestMetricsMinute`, {
       title: `Time`
     },
 
+    // Width of bucketStart's bucket, from the rollup's -bucket. NULL means 60.
+    bucketSeconds: {
+      sql: `COALESCE(bucket_seconds, 60)`,
+      type: `number`,
+      title: `Bucket Seconds`
+    },
+
     eventDay: {
       sql: `event_day`,
       type: `string`,
@@ -83,6 +138,20 @@ cube(`RequestMetricsMinute`, {
       sql: `path_template`,
       type: `string`,
       title: `Endpoint`
+    },
+
+    // Only populated when the rollup runs with -group-by including user_agent_family
+    userAgentFamily: {
+      sql: `user_agent_family`,
+      type: `string`,
+      title: `User Agent`
+    },
+
+    // Only populated when the rollup runs with -group-by including source
+    source: {
+      sql: `source`,
+      type: `string`,
+      title: `Source Topic`
     }
   },
 
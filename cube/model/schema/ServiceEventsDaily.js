@@ -15,6 +15,13 @@ cube(`ServiceEventsDaily`, {
       sql: `event_count`,
       type: `sum`,
       title: `Total Events`
+    },
+
+    // Only meaningful when the rollup runs with -entity-dimension
+    distinctEntities: {
+      sql: `NULLIF(entity_id, '')`,
+      type: `countDistinct`,
+      title: `Distinct Entities`
     }
   },
 
@@ -24,17 +24,19 @@ const (
 
 // RequestFact represents a raw HTTP request event.
 type RequestFact struct {
-	state           protoimpl.MessageState `protogen:"open.v1"`
-	EventId         string                 `protobuf:"bytes,1,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
-	EventTime       *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=event_time,json=eventTime,proto3" json:"event_time,omitempty"`
-	Service         string                 `protobuf:"bytes,3,opt,name=service,proto3" json:"service,omitempty"`
-	Method          string                 `protobuf:"bytes,4,opt,name=method,proto3" json:"method,omitempty"`
-	PathTemplate    string                 `protobuf:"bytes,5,opt,name=path_template,json=pathTemplate,proto3" json:"path_template,omitempty"`
-	StatusCode      int32                  `protobuf:"varint,6,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
-	LatencyMs       int32                  `protobuf:"varint,7,opt,name=latency_ms,json=latencyMs,proto3" json:"latency_ms,omitempty"`
-	UserAgentFamily string                 `protobuf:"bytes,8,opt,name=user_agent_family,json=userAgentFamily,proto3" json:"user_agent_family,omitempty"`
-	unknownFields   protoimpl.UnknownFields
-	sizeCache       protoimpl.SizeCache
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	EventId            string                 `protobuf:"bytes,1,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
+	EventTime          *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=event_time,json=eventTime,proto3" json:"event_time,omitempty"`
+	Service            string                 `protobuf:"bytes,3,opt,name=service,proto3" json:"service,omitempty"`
+	Method             string                 `protobuf:"bytes,4,opt,name=method,proto3" json:"method,omitempty"`
+	PathTemplate       string                 `protobuf:"bytes,5,opt,name=path_template,json=pathTemplate,proto3" json:"path_template,omitempty"`
+	StatusCode         int32                  `protobuf:"varint,6,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	LatencyMs          int32                  `protobuf:"varint,7,opt,name=latency_ms,json=latencyMs,proto3" json:"latency_ms,omitempty"`
+	UserAgentFamily    string                 `protobuf:"bytes,8,opt,name=user_agent_family,json=userAgentFamily,proto3" json:"user_agent_family,omitempty"`
+	SkewMs             int64                  `protobuf:"varint,9,opt,name=skew_ms,json=skewMs,proto3" json:"skew_ms,omitempty"`                                        // Set by ingestion -clock-skew-action=tag: event_time minus receive time
+	EventTimeDefaulted bool                   `protobuf:"varint,10,opt,name=event_time_defaulted,json=eventTimeDefaulted,proto3" json:"event_time_defaulted,omitempty"` // Set by ingestion -default-event-time: event_time is the receive time
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
 }
 
 func (x *RequestFact) Reset() {
@@ -123,6 +125,20 @@ func (x *RequestFact) GetUserAgentFamily() string {
 	return ""
 }
 
+func (x *RequestFact) GetSkewMs() int64 {
+	if x != nil {
+		return x.SkewMs
+	}
+	return 0
+}
+
+func (x *RequestFact) GetEventTimeDefaulted() bool {
+	if x != nil {
+		return x.EventTimeDefaulted
+	}
+	return false
+}
+
 // ServiceEvent represents a generic lifecycle or operational event.
 type ServiceEvent struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -220,7 +236,7 @@ var File_proto_gravix_proto protoreflect.FileDescriptor
 
 const file_proto_gravix_proto_rawDesc = "" +
 	"\n" +
-	"\x12proto/gravix.proto\x12\tgravix.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xa6\x02\n" +
+	"\x12proto/gravix.proto\x12\tgravix.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xf1\x02\n" +
 	"\vRequestFact\x12\x19\n" +
 	"\bevent_id\x18\x01 \x01(\tR\aeventId\x129\n" +
 	"\n" +
@@ -232,7 +248,10 @@ const file_proto_gravix_proto_rawDesc = "" +
 	"statusCode\x12\x1d\n" +
 	"\n" +
 	"latency_ms\x18\a \x01(\x05R\tlatencyMs\x12*\n" +
-	"\x11user_agent_family\x18\b \x01(\tR\x0fuserAgentFamily\"\xdc\x02\n" +
+	"\x11user_agent_family\x18\b \x01(\tR\x0fuserAgentFamily\x12\x17\n" +
+	"\askew_ms\x18\t \x01(\x03R\x06skewMs\x120\n" +
+	"\x14event_time_defaulted\x18\n" +
+	" \x01(\bR\x12eventTimeDefaulted\"\xdc\x02\n" +
 	"\fServiceEvent\x12\x19\n" +
 	"\bevent_id\x18\x01 \x01(\tR\aeventId\x129\n" +
 	"\n" +
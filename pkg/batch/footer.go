@@ -0,0 +1,74 @@
+// Package batch defines the optional integrity footer appended to rotated
+// JSONL batches by the ingestion service and checked by the rollups.
+package batch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+)
+
+// FooterMeta is the __meta value that marks a batch footer control line.
+const FooterMeta = "batch_footer"
+
+// Footer is the final line of a batch: {"__meta":"batch_footer","count":N,"sha256":"..."}.
+// Count is the number of lines before the footer and SHA256 is the hex digest
+// of those lines, each including its trailing newline.
+type Footer struct {
+	Meta   string `json:"__meta"`
+	Count  int64  `json:"count"`
+	SHA256 string `json:"sha256"`
+}
+
+// ParseFooter reports whether line is a batch footer and decodes it.
+func ParseFooter(line []byte) (Footer, bool) {
+	if !bytes.HasPrefix(line, []byte(`{"__meta"`)) {
+		return Footer{}, false
+	}
+	var f Footer
+	if err := json.Unmarshal(line, &f); err != nil || f.Meta != FooterMeta {
+		return Footer{}, false
+	}
+	return f, true
+}
+
+// Checksum accumulates the line count and digest of a batch's records.
+type Checksum struct {
+	h     hash.Hash
+	count int64
+}
+
+func NewChecksum() *Checksum {
+	return &Checksum{h: sha256.New()}
+}
+
+// Add records one line, given without its trailing newline.
+func (c *Checksum) Add(line []byte) {
+	c.h.Write(line)
+	c.h.Write([]byte("\n"))
+	c.count++
+}
+
+// Footer returns the footer describing every line added so far.
+func (c *Checksum) Footer() Footer {
+	return Footer{
+		Meta:   FooterMeta,
+		Count:  c.count,
+		SHA256: hex.EncodeToString(c.h.Sum(nil)),
+	}
+}
+
+// Verify compares the lines added so far against a footer read from the batch.
+func (c *Checksum) Verify(f Footer) error {
+	got := c.Footer()
+	if got.Count != f.Count {
+		return fmt.Errorf("footer count %d does not match %d lines read", f.Count, got.Count)
+	}
+	if got.SHA256 != f.SHA256 {
+		return fmt.Errorf("footer sha256 %s does not match content sha256 %s", f.SHA256, got.SHA256)
+	}
+	return nil
+}
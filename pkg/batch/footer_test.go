@@ -0,0 +1,68 @@
+package batch
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFooter_RoundTrip(t *testing.T) {
+	lines := []string{`{"event_id":"a"}`, `{"event_id":"b"}`}
+
+	writer := NewChecksum()
+	for _, l := range lines {
+		writer.Add([]byte(l))
+	}
+	data, err := json.Marshal(writer.Footer())
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+
+	footer, ok := ParseFooter(data)
+	if !ok {
+		t.Fatalf("ParseFooter did not recognise %s", data)
+	}
+	if footer.Count != 2 {
+		t.Errorf("expected count 2, got %d", footer.Count)
+	}
+
+	reader := NewChecksum()
+	for _, l := range lines {
+		reader.Add([]byte(l))
+	}
+	if err := reader.Verify(footer); err != nil {
+		t.Errorf("Verify failed on intact batch: %v", err)
+	}
+}
+
+func TestFooter_DetectsTruncationAndCorruption(t *testing.T) {
+	writer := NewChecksum()
+	writer.Add([]byte(`{"event_id":"a"}`))
+	writer.Add([]byte(`{"event_id":"b"}`))
+	footer := writer.Footer()
+
+	truncated := NewChecksum()
+	truncated.Add([]byte(`{"event_id":"a"}`))
+	if err := truncated.Verify(footer); err == nil {
+		t.Error("expected count mismatch for truncated batch")
+	}
+
+	corrupted := NewChecksum()
+	corrupted.Add([]byte(`{"event_id":"a"}`))
+	corrupted.Add([]byte(`{"event_id":"X"}`))
+	if err := corrupted.Verify(footer); err == nil {
+		t.Error("expected sha256 mismatch for corrupted batch")
+	}
+}
+
+func TestParseFooter_IgnoresRecords(t *testing.T) {
+	for _, line := range []string{
+		`{"event_id":"a"}`,
+		`{"__meta":"something_else","count":1}`,
+		`{"__meta":`,
+		``,
+	} {
+		if _, ok := ParseFooter([]byte(line)); ok {
+			t.Errorf("ParseFooter(%q) should not recognise a footer", line)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	breakerFailureThreshold = 5                // consecutive failed operations before opening
+	breakerCooldown         = 30 * time.Second // time spent open before a half-open probe
+)
+
+// ErrCircuitOpen is returned without contacting the backend while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("storage circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+var (
+	storageBreakerState = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "storage_circuit_breaker_state",
+			Help: "Current object store circuit breaker state (0=closed, 1=open, 2=half-open).",
+		},
+	)
+	storageBreakerTransitionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "storage_circuit_breaker_transitions_total",
+			Help: "Total number of object store circuit breaker state transitions.",
+		},
+		[]string{"to"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(storageBreakerState)
+	prometheus.MustRegister(storageBreakerTransitionsTotal)
+}
+
+// circuitBreaker fails fast after a run of consecutive backend failures.
+// Once the cooldown elapses a single probe call is let through (half-open);
+// its outcome decides whether the breaker closes again or re-opens.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether a call may proceed, returning ErrCircuitOpen if not.
+func (cb *circuitBreaker) allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case breakerOpen:
+		if cb.now().Sub(cb.openedAt) < cb.cooldown {
+			return ErrCircuitOpen
+		}
+		cb.transition(breakerHalfOpen)
+		cb.probing = true
+		return nil
+	case breakerHalfOpen:
+		// Only one probe at a time while we find out whether the backend recovered
+		if cb.probing {
+			return ErrCircuitOpen
+		}
+		cb.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record updates the breaker with the outcome of a call that was allowed through.
+func (cb *circuitBreaker) record(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return // The caller gave up; says nothing about backend health
+	}
+	if !countsAsBackendFailure(err) {
+		cb.failures = 0
+		if cb.state != breakerClosed {
+			cb.transition(breakerClosed)
+		}
+		return
+	}
+
+	cb.failures++
+	if cb.state == breakerHalfOpen || cb.failures >= cb.threshold {
+		cb.openedAt = cb.now()
+		cb.transition(breakerOpen)
+	}
+}
+
+func (cb *circuitBreaker) transition(to breakerState) {
+	if cb.state == to {
+		return
+	}
+	cb.state = to
+	storageBreakerState.Set(float64(to))
+	storageBreakerTransitionsTotal.WithLabelValues(to.String()).Inc()
+}
+
+// countsAsBackendFailure reports whether err indicates the backend is unhealthy.
+// Client-side faults (missing keys, bad requests) mean the backend answered,
+// so they must not trip the breaker.
+func countsAsBackendFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorFault() == smithy.FaultClient {
+		return false
+	}
+	var gcsErr *googleapi.Error
+	if errors.As(err, &gcsErr) && gcsErr.Code >= 400 && gcsErr.Code < 500 && gcsErr.Code != 429 {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"google.golang.org/api/googleapi"
+)
+
+var errBackendDown = errors.New("connection refused")
+
+// newTestBreaker returns a breaker driven by a controllable clock.
+func newTestBreaker(threshold int, cooldown time.Duration) (*circuitBreaker, *time.Time) {
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	cb := newCircuitBreaker(threshold, cooldown)
+	cb.now = func() time.Time { return now }
+	return cb, &now
+}
+
+func TestCircuitBreaker_OpensAfterThreshold(t *testing.T) {
+	cb, _ := newTestBreaker(3, 30*time.Second)
+
+	for i := 0; i < 3; i++ {
+		if err := cb.allow(); err != nil {
+			t.Fatalf("call %d should be allowed while closed: %v", i+1, err)
+		}
+		cb.record(errBackendDown)
+	}
+
+	if err := cb.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen after %d failures, got %v", 3, err)
+	}
+}
+
+func TestCircuitBreaker_SuccessResetsFailures(t *testing.T) {
+	cb, _ := newTestBreaker(3, 30*time.Second)
+
+	cb.allow()
+	cb.record(errBackendDown)
+	cb.allow()
+	cb.record(errBackendDown)
+	cb.allow()
+	cb.record(nil) // Not consecutive any more
+	cb.allow()
+	cb.record(errBackendDown)
+
+	if err := cb.allow(); err != nil {
+		t.Fatalf("breaker should still be closed, got %v", err)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	cb, now := newTestBreaker(1, 30*time.Second)
+
+	cb.allow()
+	cb.record(errBackendDown)
+	if err := cb.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open breaker, got %v", err)
+	}
+
+	// After the cooldown exactly one probe is let through
+	*now = now.Add(31 * time.Second)
+	if err := cb.allow(); err != nil {
+		t.Fatalf("expected half-open probe to be allowed, got %v", err)
+	}
+	if err := cb.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected concurrent call during probe to fail fast, got %v", err)
+	}
+
+	// Failed probe re-opens for a fresh cooldown
+	cb.record(errBackendDown)
+	*now = now.Add(10 * time.Second)
+	if err := cb.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected breaker to re-open after failed probe, got %v", err)
+	}
+
+	// Successful probe closes the breaker
+	*now = now.Add(31 * time.Second)
+	if err := cb.allow(); err != nil {
+		t.Fatalf("expected second probe to be allowed, got %v", err)
+	}
+	cb.record(nil)
+	for i := 0; i < 3; i++ {
+		if err := cb.allow(); err != nil {
+			t.Fatalf("expected closed breaker after successful probe, got %v", err)
+		}
+		cb.record(nil)
+	}
+}
+
+func TestCircuitBreaker_IgnoresClientErrorsAndCancellation(t *testing.T) {
+	cb, _ := newTestBreaker(1, 30*time.Second)
+
+	cb.allow()
+	cb.record(&smithy.GenericAPIError{Code: "NoSuchKey", Fault: smithy.FaultClient})
+	cb.allow()
+	cb.record(&googleapi.Error{Code: 404})
+	cb.allow()
+	cb.record(context.Canceled)
+
+	if err := cb.allow(); err != nil {
+		t.Fatalf("client errors and cancellations must not open the breaker, got %v", err)
+	}
+}
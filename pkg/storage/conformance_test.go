@@ -0,0 +1,38 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/lgreene/gravix-dashboards/pkg/storage/storagetest"
+)
+
+func TestLocalStore_Conformance(t *testing.T) {
+	storagetest.StoreConformanceTest(t, func() storage.ObjectStore {
+		store, err := storage.NewLocalStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+		return store
+	})
+}
+
+func TestTeeStore_Conformance(t *testing.T) {
+	storagetest.StoreConformanceTest(t, func() storage.ObjectStore {
+		primary, err := storage.NewLocalStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+		secondary, err := storage.NewLocalStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+		return storage.NewTeeStore(primary, secondary)
+	})
+}
+
+func TestMemStore_Conformance(t *testing.T) {
+	storagetest.StoreConformanceTest(t, func() storage.ObjectStore {
+		return storage.NewMemStore()
+	})
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// s3RequiredEnvVars are the S3 settings that must be set together. REGION is
+// optional (MinIO ignores it) and doesn't select S3 on its own.
+var s3RequiredEnvVars = []string{"ENDPOINT", "BUCKET", "ACCESS_KEY", "SECRET_KEY"}
+
+// FromEnv returns the object store every command uses. S3 (or MinIO) is
+// selected when any of S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY or S3_SECRET_KEY
+// is set, and then all four must be, so a half-configured deployment fails at
+// startup with the missing names instead of silently writing to local disk.
+// Google Cloud Storage is selected by GCS_BUCKET, with Application Default
+// Credentials; setting it together with S3 variables is an error.
+// Otherwise it returns a LocalStore rooted at localDir. S3_REGION is optional.
+func FromEnv(ctx context.Context, localDir string) (ObjectStore, error) {
+	gcsBucket := os.Getenv("GCS_BUCKET")
+	s3, ok, err := s3FromEnv(ctx, "S3_")
+	if err != nil {
+		return nil, err
+	}
+	if ok && gcsBucket != "" {
+		return nil, fmt.Errorf("GCS_BUCKET and S3_* are both set; configure one object store")
+	}
+	if ok {
+		return s3, nil
+	}
+	if gcsBucket != "" {
+		store, err := NewGCSStore(ctx, gcsBucket)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Using GCS bucket %s", gcsBucket)
+		return store, nil
+	}
+	log.Printf("Using local storage at %s", localDir)
+	return NewLocalStore(localDir)
+}
+
+// MirrorFromEnv wraps primary in a TeeStore that mirrors writes to the bucket
+// described by the MIRROR_S3_* variables, which follow the same rules as
+// S3_*. Without them it returns primary unchanged.
+func MirrorFromEnv(ctx context.Context, primary ObjectStore) (ObjectStore, error) {
+	mirror, ok, err := s3FromEnv(ctx, "MIRROR_S3_")
+	if err != nil || !ok {
+		return primary, err
+	}
+	return NewTeeStore(primary, mirror), nil
+}
+
+// s3FromEnv builds an S3Store from the variables named prefix+ENDPOINT,
+// REGION, BUCKET, ACCESS_KEY and SECRET_KEY. It reports false if none of the
+// required ones is set.
+func s3FromEnv(ctx context.Context, prefix string) (ObjectStore, bool, error) {
+	values := make(map[string]string, len(s3RequiredEnvVars))
+	var set, missing []string
+	for _, name := range s3RequiredEnvVars {
+		values[name] = os.Getenv(prefix + name)
+		if values[name] != "" {
+			set = append(set, prefix+name)
+		} else {
+			missing = append(missing, prefix+name)
+		}
+	}
+	if len(set) == 0 {
+		return nil, false, nil
+	}
+	if len(missing) > 0 {
+		return nil, false, fmt.Errorf("%s set but missing %s", strings.Join(set, ", "), strings.Join(missing, ", "))
+	}
+
+	store, err := NewS3Store(ctx, values["ENDPOINT"], os.Getenv(prefix+"REGION"), values["BUCKET"], values["ACCESS_KEY"], values["SECRET_KEY"])
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", strings.TrimSuffix(prefix, "_"), err)
+	}
+	log.Printf("Using bucket %s at %s (%s*)", values["BUCKET"], values["ENDPOINT"], prefix)
+	return store, true, nil
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// clearS3Env unsets every variable FromEnv and MirrorFromEnv read.
+func clearS3Env(t *testing.T) {
+	t.Helper()
+	for _, prefix := range []string{"S3_", "MIRROR_S3_"} {
+		for _, name := range append(s3RequiredEnvVars, "REGION") {
+			t.Setenv(prefix+name, "")
+		}
+	}
+	t.Setenv("GCS_BUCKET", "")
+}
+
+func setS3Env(t *testing.T, prefix string) {
+	t.Helper()
+	t.Setenv(prefix+"ENDPOINT", "http://localhost:9000")
+	t.Setenv(prefix+"BUCKET", "gravix")
+	t.Setenv(prefix+"ACCESS_KEY", "admin")
+	t.Setenv(prefix+"SECRET_KEY", "secret")
+}
+
+func TestFromEnv_LocalByDefault(t *testing.T) {
+	clearS3Env(t)
+	// A region alone doesn't select S3
+	t.Setenv("S3_REGION", "us-east-1")
+
+	store, err := FromEnv(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatalf("FromEnv failed: %v", err)
+	}
+	if _, ok := store.(*LocalStore); !ok {
+		t.Errorf("expected a LocalStore, got %T", store)
+	}
+}
+
+func TestFromEnv_S3(t *testing.T) {
+	clearS3Env(t)
+	setS3Env(t, "S3_")
+
+	store, err := FromEnv(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatalf("FromEnv failed: %v", err)
+	}
+	if _, ok := store.(*S3Store); !ok {
+		t.Errorf("expected an S3Store, got %T", store)
+	}
+}
+
+func TestFromEnv_GCS(t *testing.T) {
+	clearS3Env(t)
+	t.Setenv("GCS_BUCKET", "gravix")
+	// The emulator setting makes the client skip credentials; nothing is contacted yet
+	t.Setenv("STORAGE_EMULATOR_HOST", "localhost:4443")
+
+	store, err := FromEnv(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatalf("FromEnv failed: %v", err)
+	}
+	if _, ok := store.(*GCSStore); !ok {
+		t.Errorf("expected a GCSStore, got %T", store)
+	}
+
+	setS3Env(t, "S3_")
+	if _, err := FromEnv(context.Background(), t.TempDir()); err == nil || !strings.Contains(err.Error(), "both set") {
+		t.Errorf("expected an error with both GCS_BUCKET and S3_* set, got %v", err)
+	}
+}
+
+func TestFromEnv_MissingVars(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     map[string]string
+		missing []string
+	}{
+		{
+			name:    "endpoint only",
+			set:     map[string]string{"S3_ENDPOINT": "http://localhost:9000"},
+			missing: []string{"S3_BUCKET", "S3_ACCESS_KEY", "S3_SECRET_KEY"},
+		},
+		{
+			name:    "no endpoint",
+			set:     map[string]string{"S3_BUCKET": "gravix", "S3_ACCESS_KEY": "admin", "S3_SECRET_KEY": "secret"},
+			missing: []string{"S3_ENDPOINT"},
+		},
+		{
+			name:    "no secret key",
+			set:     map[string]string{"S3_ENDPOINT": "http://localhost:9000", "S3_BUCKET": "gravix", "S3_ACCESS_KEY": "admin"},
+			missing: []string{"S3_SECRET_KEY"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearS3Env(t)
+			for k, v := range tt.set {
+				t.Setenv(k, v)
+			}
+			_, err := FromEnv(context.Background(), t.TempDir())
+			if err == nil {
+				t.Fatal("expected an error for incomplete S3 settings")
+			}
+			_, msg, _ := strings.Cut(err.Error(), "missing ")
+			if msg != strings.Join(tt.missing, ", ") {
+				t.Errorf("expected missing %v, got %q", tt.missing, err)
+			}
+		})
+	}
+}
+
+func TestMirrorFromEnv(t *testing.T) {
+	clearS3Env(t)
+	primary := newTestLocalStore(t)
+
+	store, err := MirrorFromEnv(context.Background(), primary)
+	if err != nil || store != ObjectStore(primary) {
+		t.Fatalf("expected the primary unchanged without MIRROR_S3_*, got %T (err %v)", store, err)
+	}
+
+	setS3Env(t, "MIRROR_S3_")
+	store, err = MirrorFromEnv(context.Background(), primary)
+	if err != nil {
+		t.Fatalf("MirrorFromEnv failed: %v", err)
+	}
+	if _, ok := store.(*TeeStore); !ok {
+		t.Errorf("expected a TeeStore, got %T", store)
+	}
+
+	t.Setenv("MIRROR_S3_BUCKET", "")
+	if _, err := MirrorFromEnv(context.Background(), primary); err == nil || !strings.Contains(err.Error(), "missing MIRROR_S3_BUCKET") {
+		t.Errorf("expected an error naming MIRROR_S3_BUCKET, got %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/iterator"
+)
+
+// GCSStore implements ObjectStore using Google Cloud Storage.
+type GCSStore struct {
+	client  *gcs.Client
+	bucket  *gcs.BucketHandle
+	name    string
+	breaker *circuitBreaker
+}
+
+// NewGCSStore opens bucket with Application Default Credentials: the key file
+// named by GOOGLE_APPLICATION_CREDENTIALS, or the attached service account on
+// GCE and GKE. The client honours STORAGE_EMULATOR_HOST for local testing.
+func NewGCSStore(ctx context.Context, bucket string) (*GCSStore, error) {
+	client, err := gcs.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	// Retries are ours (retryWithBackoff), except for Put; see there
+	client.SetRetry(gcs.WithPolicy(gcs.RetryNever))
+	return &GCSStore{
+		client:  client,
+		bucket:  client.Bucket(bucket),
+		name:    bucket,
+		breaker: newCircuitBreaker(breakerFailureThreshold, breakerCooldown),
+	}, nil
+}
+
+// Verify reads the bucket's attributes once so a bad bucket name or missing
+// credentials surface at startup. Like S3Store.Verify it skips the retry
+// loop and circuit breaker.
+func (s *GCSStore) Verify(ctx context.Context) error {
+	if _, err := s.bucket.Attrs(ctx); err != nil {
+		return fmt.Errorf("GCS bucket %q is not reachable: %w", s.name, err)
+	}
+	return nil
+}
+
+// do runs a GCS operation through the circuit breaker and retry loop.
+func (s *GCSStore) do(ctx context.Context, operation string, fn func() error) error {
+	if err := s.breaker.allow(); err != nil {
+		return fmt.Errorf("GCS %s: %w", operation, err)
+	}
+	err := retryWithBackoff(ctx, "GCS "+operation, fn)
+	s.breaker.record(err)
+	return err
+}
+
+// Put streams reader to the object without buffering it whole. A consumed
+// reader can't be replayed, so instead of retryWithBackoff the client's own
+// resumable upload retries each chunk, with the same attempts and backoff.
+// Tags are stored as object metadata, as GCS has no object tags.
+func (s *GCSStore) Put(ctx context.Context, key string, reader io.Reader, opts ...PutOption) error {
+	if err := s.breaker.allow(); err != nil {
+		return fmt.Errorf("GCS Put: %w", err)
+	}
+	obj := s.bucket.Object(key).Retryer(
+		gcs.WithPolicy(gcs.RetryAlways), // An overwrite with the same bytes is safe to repeat
+		gcs.WithMaxAttempts(maxRetries+1),
+		gcs.WithBackoff(gax.Backoff{Initial: baseRetryDelay, Multiplier: 2}),
+	)
+	w := obj.NewWriter(ctx)
+	if o := ApplyPutOptions(opts); len(o.Tags) > 0 {
+		w.Metadata = o.Tags
+	}
+	_, err := io.Copy(w, reader)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	s.breaker.record(err)
+	if err != nil {
+		return fmt.Errorf("GCS Put %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *GCSStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	var result io.ReadCloser
+	var notFound bool
+	err := s.do(ctx, "Get", func() error {
+		r, err := s.bucket.Object(key).NewReader(ctx)
+		if errors.Is(err, gcs.ErrObjectNotExist) {
+			notFound = true // Not worth retrying
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		result = r
+		return nil
+	})
+	if err == nil && notFound {
+		return nil, fmt.Errorf("get %s: %w", key, gcs.ErrObjectNotExist)
+	}
+	return result, err
+}
+
+func (s *GCSStore) Delete(ctx context.Context, key string) error {
+	var notFound bool
+	err := s.do(ctx, "Delete", func() error {
+		err := s.bucket.Object(key).Delete(ctx)
+		if errors.Is(err, gcs.ErrObjectNotExist) {
+			notFound = true
+			return nil
+		}
+		return err
+	})
+	if err == nil && notFound {
+		return fmt.Errorf("delete %s: %w", key, gcs.ErrObjectNotExist)
+	}
+	return err
+}
+
+// DeleteBatch deletes keys one at a time; the Go client has no batch delete.
+func (s *GCSStore) DeleteBatch(ctx context.Context, keys []string) error {
+	failed := make(map[string]error)
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil {
+			failed[key] = err
+		}
+	}
+	if len(failed) > 0 {
+		return &DeleteBatchError{Failed: failed}
+	}
+	return nil
+}
+
+func (s *GCSStore) Exists(ctx context.Context, key string) (bool, error) {
+	var exists bool
+	err := s.do(ctx, "Exists", func() error {
+		_, err := s.bucket.Object(key).Attrs(ctx)
+		if errors.Is(err, gcs.ErrObjectNotExist) {
+			exists = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		exists = true
+		return nil
+	})
+	return exists, err
+}
+
+func (s *GCSStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	var info ObjectInfo
+	var notFound bool
+	err := s.do(ctx, "Stat", func() error {
+		attrs, err := s.bucket.Object(key).Attrs(ctx)
+		if errors.Is(err, gcs.ErrObjectNotExist) {
+			notFound = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		info = ObjectInfo{Size: attrs.Size, ModTime: attrs.Updated}
+		return nil
+	})
+	if err == nil && notFound {
+		return ObjectInfo{}, fmt.Errorf("stat %s: %w", key, fs.ErrNotExist)
+	}
+	return info, err
+}
+
+func (s *GCSStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := s.do(ctx, "List", func() error {
+		keys = nil // Reset on retry
+		query := &gcs.Query{Prefix: prefix}
+		if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+			return err
+		}
+		it := s.bucket.Objects(ctx, query)
+		for {
+			attrs, err := it.Next()
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			keys = append(keys, attrs.Name)
+		}
+	})
+	return keys, err
+}
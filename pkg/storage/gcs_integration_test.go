@@ -0,0 +1,66 @@
+//go:build integration
+
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/lgreene/gravix-dashboards/pkg/storage/storagetest"
+)
+
+// These tests run GCSStore against a GCS emulator such as fake-gcs-server.
+// They are skipped unless STORAGE_EMULATOR_HOST is set:
+//
+//	docker run -d -p 4443:4443 fsouza/fake-gcs-server -scheme http
+//	STORAGE_EMULATOR_HOST=localhost:4443 go test -tags integration ./pkg/storage/
+//
+// Each conformance subtest creates and removes its own bucket.
+
+func requireGCSEmulator(t *testing.T) {
+	t.Helper()
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		t.Skip("STORAGE_EMULATOR_HOST not set")
+	}
+}
+
+func newEmulatorGCSStore(t *testing.T) *storage.GCSStore {
+	t.Helper()
+	requireGCSEmulator(t)
+	ctx := context.Background()
+
+	// GCSStore doesn't manage buckets, so use a plain client for setup and teardown
+	admin, err := gcs.NewClient(ctx)
+	if err != nil {
+		t.Fatalf("failed to create GCS client: %v", err)
+	}
+	bucket := fmt.Sprintf("gravix-it-%d", time.Now().UnixNano())
+	if err := admin.Bucket(bucket).Create(ctx, "gravix-test", nil); err != nil {
+		t.Fatalf("failed to create bucket %s: %v", bucket, err)
+	}
+
+	store, err := storage.NewGCSStore(ctx, bucket)
+	if err != nil {
+		t.Fatalf("failed to create GCS store: %v", err)
+	}
+	t.Cleanup(func() {
+		keys, _ := store.List(ctx, "")
+		store.DeleteBatch(ctx, keys)
+		admin.Bucket(bucket).Delete(ctx)
+		admin.Close()
+	})
+	return store
+}
+
+func TestGCSStore_Conformance(t *testing.T) {
+	// Skip here, as the store factory runs inside each subtest
+	requireGCSEmulator(t)
+	storagetest.StoreConformanceTest(t, func() storage.ObjectStore {
+		return newEmulatorGCSStore(t)
+	})
+}
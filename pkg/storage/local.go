@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -25,6 +26,23 @@ func NewLocalStore(baseDir string) (*LocalStore, error) {
 	return &LocalStore{baseDir: abs}, nil
 }
 
+// Verify checks that the base directory exists and is writable by creating and removing a probe file.
+func (l *LocalStore) Verify(ctx context.Context) error {
+	info, err := os.Stat(l.baseDir)
+	if err != nil {
+		return fmt.Errorf("local store %s: %w", l.baseDir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("local store %s: not a directory", l.baseDir)
+	}
+	probe, err := os.CreateTemp(l.baseDir, ".verify-*")
+	if err != nil {
+		return fmt.Errorf("local store %s is not writable: %w", l.baseDir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
 // sanitizeKey rejects keys that would escape the base directory via path traversal.
 func (l *LocalStore) sanitizeKey(key string) (string, error) {
 	cleaned := filepath.Clean(key)
@@ -38,7 +56,8 @@ func (l *LocalStore) sanitizeKey(key string) (string, error) {
 	return full, nil
 }
 
-func (l *LocalStore) Put(ctx context.Context, key string, reader io.Reader) error {
+// Put writes the object to disk. Tags are not supported on the filesystem and are ignored.
+func (l *LocalStore) Put(ctx context.Context, key string, reader io.Reader, opts ...PutOption) error {
 	path, err := l.sanitizeKey(key)
 	if err != nil {
 		return err
@@ -75,6 +94,20 @@ func (l *LocalStore) Delete(ctx context.Context, key string) error {
 	return os.Remove(path)
 }
 
+// DeleteBatch removes each key in turn; the filesystem has no batch delete.
+func (l *LocalStore) DeleteBatch(ctx context.Context, keys []string) error {
+	failed := make(map[string]error)
+	for _, key := range keys {
+		if err := l.Delete(ctx, key); err != nil {
+			failed[key] = err
+		}
+	}
+	if len(failed) > 0 {
+		return &DeleteBatchError{Failed: failed}
+	}
+	return nil
+}
+
 func (l *LocalStore) Exists(ctx context.Context, key string) (bool, error) {
 	path, err := l.sanitizeKey(key)
 	if err != nil {
@@ -90,6 +123,23 @@ func (l *LocalStore) Exists(ctx context.Context, key string) (bool, error) {
 	return false, err
 }
 
+// Stat reports the file's size and modification time. A directory is not an
+// object, so it is reported as not existing.
+func (l *LocalStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	path, err := l.sanitizeKey(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+	}
+	return ObjectInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
 func (l *LocalStore) List(ctx context.Context, prefix string) ([]string, error) {
 	searchDir, err := l.sanitizeKey(prefix)
 	if err != nil {
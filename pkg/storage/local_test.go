@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"io"
+	"os"
 	"strings"
 	"testing"
 )
@@ -184,3 +185,56 @@ func TestLocalStore_ValidKeys(t *testing.T) {
 		})
 	}
 }
+
+func TestLocalStore_PutIgnoresTags(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	ctx := context.Background()
+	tags := WithTags(map[string]string{"dataset": "request_metrics_minute"})
+	if err := store.Put(ctx, "tagged.txt", strings.NewReader("data"), tags); err != nil {
+		t.Fatalf("Put with tags should succeed on local storage: %v", err)
+	}
+	if exists, _ := store.Exists(ctx, "tagged.txt"); !exists {
+		t.Error("expected tagged object to be written")
+	}
+}
+
+func TestApplyPutOptions_MergesTags(t *testing.T) {
+	o := ApplyPutOptions([]PutOption{
+		WithTags(map[string]string{"dataset": "request_metrics_minute"}),
+		WithTags(map[string]string{"day": "2025-01-15"}),
+	})
+	if o.Tags["dataset"] != "request_metrics_minute" || o.Tags["day"] != "2025-01-15" {
+		t.Errorf("expected both tags to be applied, got %v", o.Tags)
+	}
+	if got := encodeTags(o.Tags); got != "dataset=request_metrics_minute&day=2025-01-15" {
+		t.Errorf("unexpected tag encoding %q", got)
+	}
+}
+
+func TestLocalStore_Verify(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := Verify(ctx, store); err != nil {
+		t.Fatalf("Verify failed on a writable dir: %v", err)
+	}
+	if keys, _ := store.List(ctx, ""); len(keys) != 0 {
+		t.Errorf("Verify left probe files behind: %v", keys)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(ctx, store); err == nil {
+		t.Error("expected Verify to fail once the base dir is gone")
+	}
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemStore implements ObjectStore in memory, for tests that don't need a
+// real filesystem. Keys are validated like LocalStore's, but List matches
+// prefixes as plain strings, like S3, so "raw/a" also lists "raw/ab/x".
+type MemStore struct {
+	mu      sync.Mutex
+	objects map[string]memObject
+}
+
+type memObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{objects: make(map[string]memObject)}
+}
+
+// Reset removes every object, so one store can be reused across subtests.
+func (m *MemStore) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects = make(map[string]memObject)
+}
+
+// memKey rejects the keys LocalStore.sanitizeKey rejects and returns the
+// rest in the form LocalStore stores them: cleaned and relative.
+func memKey(key string) (string, error) {
+	cleaned := path.Clean(key)
+	if strings.Contains(cleaned, "..") {
+		return "", fmt.Errorf("invalid key %q: path traversal not allowed", key)
+	}
+	cleaned = strings.TrimPrefix(cleaned, "/")
+	if cleaned == "." || cleaned == "" {
+		return "", fmt.Errorf("invalid key %q: empty", key)
+	}
+	return cleaned, nil
+}
+
+// notExist returns the error LocalStore's filesystem calls give for a missing key.
+func notExist(op, key string) error {
+	return &fs.PathError{Op: op, Path: key, Err: fs.ErrNotExist}
+}
+
+// Put stores a copy of the reader's content. Tags are ignored.
+func (m *MemStore) Put(ctx context.Context, key string, reader io.Reader, opts ...PutOption) error {
+	k, err := memKey(key)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[k] = memObject{data: data, modTime: time.Now()}
+	return nil
+}
+
+func (m *MemStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	k, err := memKey(key)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[k]
+	if !ok {
+		return nil, notExist("open", key)
+	}
+	// Put never modifies a stored slice, so readers can share it
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+func (m *MemStore) Delete(ctx context.Context, key string) error {
+	k, err := memKey(key)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.objects[k]; !ok {
+		return notExist("remove", key)
+	}
+	delete(m.objects, k)
+	return nil
+}
+
+func (m *MemStore) DeleteBatch(ctx context.Context, keys []string) error {
+	failed := make(map[string]error)
+	for _, key := range keys {
+		if err := m.Delete(ctx, key); err != nil {
+			failed[key] = err
+		}
+	}
+	if len(failed) > 0 {
+		return &DeleteBatchError{Failed: failed}
+	}
+	return nil
+}
+
+func (m *MemStore) Exists(ctx context.Context, key string) (bool, error) {
+	k, err := memKey(key)
+	if err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.objects[k]
+	return ok, nil
+}
+
+func (m *MemStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	k, err := memKey(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[k]
+	if !ok {
+		return ObjectInfo{}, notExist("stat", key)
+	}
+	return ObjectInfo{Size: int64(len(obj.data)), ModTime: obj.modTime}, nil
+}
+
+// List returns the keys starting with prefix, sorted.
+func (m *MemStore) List(ctx context.Context, prefix string) ([]string, error) {
+	if strings.Contains(path.Clean(prefix), "..") {
+		return nil, fmt.Errorf("invalid key %q: path traversal not allowed", prefix)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for k := range m.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
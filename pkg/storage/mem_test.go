@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMemStore_PathTraversal(t *testing.T) {
+	store := NewMemStore()
+	ctx := context.Background()
+	for _, key := range []string{"../etc/passwd", "foo/../../etc/shadow", "../../../tmp/evil"} {
+		if err := store.Put(ctx, key, strings.NewReader("malicious")); err == nil {
+			t.Errorf("Put(%q) should fail with path traversal error", key)
+		}
+		if _, err := store.Get(ctx, key); err == nil {
+			t.Errorf("Get(%q) should fail with path traversal error", key)
+		}
+		if _, err := store.Exists(ctx, key); err == nil {
+			t.Errorf("Exists(%q) should fail with path traversal error", key)
+		}
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) should fail with path traversal error", key)
+		}
+		if _, err := store.List(ctx, key); err == nil {
+			t.Errorf("List(%q) should fail with path traversal error", key)
+		}
+	}
+}
+
+func TestMemStore_KeysNormalizedLikeLocalStore(t *testing.T) {
+	store := NewMemStore()
+	ctx := context.Background()
+	if err := store.Put(ctx, "./raw//a.json", strings.NewReader("x")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	ok, err := store.Exists(ctx, "raw/a.json")
+	if err != nil || !ok {
+		t.Errorf("Exists(raw/a.json) = %v, %v; want true", ok, err)
+	}
+	if _, err := store.Get(ctx, "raw/missing.json"); !os.IsNotExist(err) {
+		t.Errorf("Get of a missing key: want a not-exist error, got %v", err)
+	}
+}
+
+func TestMemStore_ListMatchesStringPrefixSorted(t *testing.T) {
+	store := NewMemStore()
+	ctx := context.Background()
+	for _, key := range []string{"raw/b/2.json", "raw/a/1.json", "raw_jsonl/x.json", "other/y.json"} {
+		if err := store.Put(ctx, key, strings.NewReader("x")); err != nil {
+			t.Fatalf("Put(%q) failed: %v", key, err)
+		}
+	}
+
+	keys, err := store.List(ctx, "raw")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	want := []string{"raw/a/1.json", "raw/b/2.json", "raw_jsonl/x.json"}
+	if !slices.Equal(keys, want) {
+		t.Errorf("List(raw) = %v, want %v", keys, want)
+	}
+
+	keys, _ = store.List(ctx, "raw/")
+	if want := want[:2]; !slices.Equal(keys, want) {
+		t.Errorf("List(raw/) = %v, want %v", keys, want)
+	}
+}
+
+func TestMemStore_Reset(t *testing.T) {
+	store := NewMemStore()
+	ctx := context.Background()
+	if err := store.Put(ctx, "a/b.json", strings.NewReader("x")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	store.Reset()
+	keys, err := store.List(ctx, "")
+	if err != nil || len(keys) != 0 {
+		t.Errorf("after Reset, List = %v, %v; want empty", keys, err)
+	}
+	if err := store.Put(ctx, "a/b.json", strings.NewReader("x")); err != nil {
+		t.Errorf("Put after Reset failed: %v", err)
+	}
+}
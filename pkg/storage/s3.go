@@ -6,14 +6,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"math"
 	"math/rand"
+	"net/url"
+	"slices"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go"
@@ -24,10 +28,16 @@ const (
 	baseRetryDelay = 500 * time.Millisecond
 )
 
+// multipartThreshold is the object size above which Put streams a multipart
+// upload instead of buffering the whole object. It is also the part size.
+const multipartThreshold = 8 << 20
+
 // S3Store implements ObjectStore using AWS S3 (or MinIO).
 type S3Store struct {
-	client *s3.Client
-	bucket string
+	client   *s3.Client
+	uploader *manager.Uploader
+	bucket   string
+	breaker  *circuitBreaker
 }
 
 func NewS3Store(ctx context.Context, endpoint, region, bucket, accessKey, secretKey string) (*S3Store, error) {
@@ -44,14 +54,46 @@ func NewS3Store(ctx context.Context, endpoint, region, bucket, accessKey, secret
 		o.UsePathStyle = true // Required for MinIO
 	})
 
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = multipartThreshold
+		// Parts are retried by the SDK, with as many attempts as retryWithBackoff makes
+		u.ClientOptions = append(u.ClientOptions, func(o *s3.Options) {
+			o.RetryMaxAttempts = maxRetries + 1
+		})
+	})
+
 	return &S3Store{
-		client: client,
-		bucket: bucket,
+		client:   client,
+		uploader: uploader,
+		bucket:   bucket,
+		breaker:  newCircuitBreaker(breakerFailureThreshold, breakerCooldown),
 	}, nil
 }
 
+// Verify issues a single HeadBucket so a bad endpoint, bucket or credentials
+// surface at startup rather than on the first upload. It deliberately skips
+// the retry loop and circuit breaker.
+func (s *S3Store) Verify(ctx context.Context) error {
+	if _, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucket)}); err != nil {
+		return fmt.Errorf("S3 bucket %q is not reachable: %w", s.bucket, err)
+	}
+	return nil
+}
+
+// do runs an S3 operation through the circuit breaker and retry loop.
+// While the breaker is open, calls fail immediately instead of spending
+// several seconds in backoff against an unavailable backend.
+func (s *S3Store) do(ctx context.Context, operation string, fn func() error) error {
+	if err := s.breaker.allow(); err != nil {
+		return fmt.Errorf("S3 %s: %w", operation, err)
+	}
+	err := retryWithBackoff(ctx, "S3 "+operation, fn)
+	s.breaker.record(err)
+	return err
+}
+
 // retryWithBackoff retries the given function up to maxRetries times with exponential backoff + jitter.
-// It stops early if the context is cancelled.
+// It stops early if the context is cancelled. operation names the backend and call, e.g. "S3 Put".
 func retryWithBackoff(ctx context.Context, operation string, fn func() error) error {
 	var lastErr error
 	for attempt := 0; attempt <= maxRetries; attempt++ {
@@ -69,7 +111,7 @@ func retryWithBackoff(ctx context.Context, operation string, fn func() error) er
 			delay := time.Duration(float64(baseRetryDelay) * math.Pow(2, float64(attempt)))
 			// Add jitter: 0.5x to 1.5x the delay
 			jitter := time.Duration(float64(delay) * (0.5 + rand.Float64()))
-			log.Printf("S3 %s failed (attempt %d/%d), retrying in %v: %v", operation, attempt+1, maxRetries+1, jitter, lastErr)
+			log.Printf("%s failed (attempt %d/%d), retrying in %v: %v", operation, attempt+1, maxRetries+1, jitter, lastErr)
 
 			select {
 			case <-ctx.Done():
@@ -78,29 +120,67 @@ func retryWithBackoff(ctx context.Context, operation string, fn func() error) er
 			}
 		}
 	}
-	return fmt.Errorf("S3 %s failed after %d attempts: %w", operation, maxRetries+1, lastErr)
+	return fmt.Errorf("%s failed after %d attempts: %w", operation, maxRetries+1, lastErr)
 }
 
-func (s *S3Store) Put(ctx context.Context, key string, reader io.Reader) error {
+// Put buffers objects up to multipartThreshold so the whole PutObject can be
+// retried. Larger objects are streamed as a multipart upload, which holds a
+// few parts in memory at a time and retries each part on its own.
+func (s *S3Store) Put(ctx context.Context, key string, reader io.Reader, opts ...PutOption) error {
 	// Buffer the reader so we can retry (reader may be consumed on first attempt)
-	data, err := io.ReadAll(reader)
+	data, err := io.ReadAll(io.LimitReader(reader, multipartThreshold+1))
 	if err != nil {
 		return fmt.Errorf("failed to read data for upload: %w", err)
 	}
 
-	return retryWithBackoff(ctx, "Put", func() error {
-		_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
-			Bucket: aws.String(s.bucket),
-			Key:    aws.String(key),
-			Body:   bytes.NewReader(data),
-		})
+	o := ApplyPutOptions(opts)
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if len(o.Tags) > 0 {
+		input.Tagging = aws.String(encodeTags(o.Tags))
+	}
+
+	if len(data) > multipartThreshold {
+		input.Body = io.MultiReader(bytes.NewReader(data), reader)
+		return s.putMultipart(ctx, input)
+	}
+
+	return s.do(ctx, "Put", func() error {
+		input.Body = bytes.NewReader(data)
+		_, err := s.client.PutObject(ctx, input)
 		return err
 	})
 }
 
+// putMultipart uploads input.Body in parts. It goes through the circuit
+// breaker but not retryWithBackoff, since the body can't be replayed. A
+// failed upload is aborted so its parts don't linger in the bucket.
+func (s *S3Store) putMultipart(ctx context.Context, input *s3.PutObjectInput) error {
+	if err := s.breaker.allow(); err != nil {
+		return fmt.Errorf("S3 Put: %w", err)
+	}
+	_, err := s.uploader.Upload(ctx, input)
+	s.breaker.record(err)
+	if err != nil {
+		return fmt.Errorf("S3 multipart Put %s: %w", aws.ToString(input.Key), err)
+	}
+	return nil
+}
+
+// encodeTags renders tags in the URL query format expected by the x-amz-tagging header.
+func encodeTags(tags map[string]string) string {
+	values := url.Values{}
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
+
 func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
 	var result io.ReadCloser
-	err := retryWithBackoff(ctx, "Get", func() error {
+	err := s.do(ctx, "Get", func() error {
 		out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
 			Bucket: aws.String(s.bucket),
 			Key:    aws.String(key),
@@ -115,7 +195,7 @@ func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
 }
 
 func (s *S3Store) Delete(ctx context.Context, key string) error {
-	return retryWithBackoff(ctx, "Delete", func() error {
+	return s.do(ctx, "Delete", func() error {
 		_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 			Bucket: aws.String(s.bucket),
 			Key:    aws.String(key),
@@ -124,25 +204,56 @@ func (s *S3Store) Delete(ctx context.Context, key string) error {
 	})
 }
 
+// deleteBatchSize is the most keys one S3 DeleteObjects call accepts.
+const deleteBatchSize = 1000
+
+// DeleteBatch deletes keys with one DeleteObjects call per deleteBatchSize
+// keys. A call that fails after retries fails all of its keys; otherwise S3
+// reports failures per key, and those are not retried.
+func (s *S3Store) DeleteBatch(ctx context.Context, keys []string) error {
+	failed := make(map[string]error)
+	for chunk := range slices.Chunk(keys, deleteBatchSize) {
+		objects := make([]types.ObjectIdentifier, len(chunk))
+		for i, key := range chunk {
+			objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+		}
+		var out *s3.DeleteObjectsOutput
+		err := s.do(ctx, "DeleteBatch", func() error {
+			var err error
+			out, err = s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+				Bucket: aws.String(s.bucket),
+				Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+			})
+			return err
+		})
+		if err != nil {
+			for _, key := range chunk {
+				failed[key] = err
+			}
+			continue
+		}
+		for _, e := range out.Errors {
+			failed[aws.ToString(e.Key)] = fmt.Errorf("%s: %s", aws.ToString(e.Code), aws.ToString(e.Message))
+		}
+	}
+	if len(failed) > 0 {
+		return &DeleteBatchError{Failed: failed}
+	}
+	return nil
+}
+
 func (s *S3Store) Exists(ctx context.Context, key string) (bool, error) {
 	var exists bool
-	err := retryWithBackoff(ctx, "Exists", func() error {
+	err := s.do(ctx, "Exists", func() error {
 		_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
 			Bucket: aws.String(s.bucket),
 			Key:    aws.String(key),
 		})
+		if isNotFound(err) {
+			exists = false
+			return nil // Not an error, just doesn't exist
+		}
 		if err != nil {
-			// Check if it's a "not found" error — don't retry these
-			var nsk *types.NotFound
-			if errors.As(err, &nsk) {
-				exists = false
-				return nil // Not an error, just doesn't exist
-			}
-			var apiErr smithy.APIError
-			if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NotFound" || apiErr.ErrorCode() == "NoSuchKey") {
-				exists = false
-				return nil
-			}
 			return err
 		}
 		exists = true
@@ -151,9 +262,44 @@ func (s *S3Store) Exists(ctx context.Context, key string) (bool, error) {
 	return exists, err
 }
 
+// isNotFound reports whether a HeadObject error means the key doesn't
+// exist. These are not worth retrying.
+func isNotFound(err error) bool {
+	var nsk *types.NotFound
+	if errors.As(err, &nsk) {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NotFound" || apiErr.ErrorCode() == "NoSuchKey")
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	var info ObjectInfo
+	var notFound bool
+	err := s.do(ctx, "Stat", func() error {
+		out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+		})
+		if isNotFound(err) {
+			notFound = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		info = ObjectInfo{Size: aws.ToInt64(out.ContentLength), ModTime: aws.ToTime(out.LastModified)}
+		return nil
+	})
+	if err == nil && notFound {
+		return ObjectInfo{}, fmt.Errorf("stat %s: %w", key, fs.ErrNotExist)
+	}
+	return info, err
+}
+
 func (s *S3Store) List(ctx context.Context, prefix string) ([]string, error) {
 	var keys []string
-	err := retryWithBackoff(ctx, "List", func() error {
+	err := s.do(ctx, "List", func() error {
 		keys = nil // Reset on retry
 		paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
 			Bucket: aws.String(s.bucket),
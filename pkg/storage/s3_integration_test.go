@@ -0,0 +1,249 @@
+//go:build integration
+
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/lgreene/gravix-dashboards/pkg/storage/storagetest"
+)
+
+// These tests run S3Store against a real MinIO. They are skipped unless
+// MINIO_ENDPOINT is set:
+//
+//	MINIO_ENDPOINT=http://localhost:9000 MINIO_ROOT_USER=admin MINIO_ROOT_PASSWORD=... \
+//	  go test -tags integration ./pkg/storage/
+//
+// Each test, and each conformance subtest, creates and removes its own bucket.
+
+func minioEndpoint(t *testing.T) string {
+	t.Helper()
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("MINIO_ENDPOINT not set")
+	}
+	return endpoint
+}
+
+// newMinIOStore creates a temporary bucket and an S3Store pointed at endpoint,
+// which is either MinIO itself or a proxy in front of it.
+func newMinIOStore(t *testing.T, endpoint string) *storage.S3Store {
+	t.Helper()
+	ctx := context.Background()
+	user := os.Getenv("MINIO_ROOT_USER")
+	if user == "" {
+		user = "minioadmin"
+	}
+	password := os.Getenv("MINIO_ROOT_PASSWORD")
+	if password == "" {
+		password = "minioadmin"
+	}
+
+	// S3Store doesn't manage buckets, so use a plain client for setup and teardown
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion("us-east-1"),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(user, password, "")),
+	)
+	if err != nil {
+		t.Fatalf("failed to load SDK config: %v", err)
+	}
+	admin := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(os.Getenv("MINIO_ENDPOINT"))
+		o.UsePathStyle = true
+	})
+	bucket := fmt.Sprintf("gravix-it-%d", time.Now().UnixNano())
+	if _, err := admin.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(bucket)}); err != nil {
+		t.Fatalf("failed to create bucket %s: %v", bucket, err)
+	}
+
+	store, err := storage.NewS3Store(ctx, endpoint, "us-east-1", bucket, user, password)
+	if err != nil {
+		t.Fatalf("failed to create S3 store: %v", err)
+	}
+	t.Cleanup(func() {
+		keys, _ := store.List(ctx, "")
+		for _, k := range keys {
+			store.Delete(ctx, k)
+		}
+		admin.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(bucket)})
+	})
+	return store
+}
+
+// faultProxy forwards requests to MinIO, answering the next failNext of them
+// with 503 instead.
+type faultProxy struct {
+	*httptest.Server
+	requests atomic.Int32
+	failNext atomic.Int32
+}
+
+func newFaultProxy(t *testing.T, target string) *faultProxy {
+	t.Helper()
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatalf("invalid MINIO_ENDPOINT: %v", err)
+	}
+	rp := httputil.NewSingleHostReverseProxy(u)
+	p := &faultProxy{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.requests.Add(1)
+		if p.failNext.Add(-1) >= 0 {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `<Error><Code>ServiceUnavailable</Code><Message>injected</Message></Error>`)
+			return
+		}
+		// Host is left as the proxy's so the SigV4 signature still matches
+		rp.ServeHTTP(w, r)
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestS3Store_Conformance(t *testing.T) {
+	endpoint := minioEndpoint(t)
+	storagetest.StoreConformanceTest(t, func() storage.ObjectStore {
+		return newMinIOStore(t, endpoint)
+	})
+}
+
+func TestS3Store_RetriesTransientErrors(t *testing.T) {
+	proxy := newFaultProxy(t, minioEndpoint(t))
+	store := newMinIOStore(t, proxy.URL)
+	ctx := context.Background()
+
+	proxy.requests.Store(0)
+	proxy.failNext.Store(2)
+	if err := store.Put(ctx, "retry/data.jsonl", strings.NewReader("payload")); err != nil {
+		t.Fatalf("Put should succeed after transient failures: %v", err)
+	}
+	if n := proxy.requests.Load(); n < 3 {
+		t.Errorf("expected at least 3 requests (2 failed + 1 retry), got %d", n)
+	}
+	if got := storagetest.ReadKey(t, store, "retry/data.jsonl"); got != "payload" {
+		t.Errorf("expected retried Put to store the full payload, got %q", got)
+	}
+}
+
+func TestS3Store_ExistsDoesNotRetryNotFound(t *testing.T) {
+	proxy := newFaultProxy(t, minioEndpoint(t))
+	store := newMinIOStore(t, proxy.URL)
+
+	proxy.requests.Store(0)
+	exists, err := store.Exists(context.Background(), "missing/key.jsonl")
+	if err != nil || exists {
+		t.Fatalf("expected exists=false without error, got exists=%v err=%v", exists, err)
+	}
+	if n := proxy.requests.Load(); n != 1 {
+		t.Errorf("a 404 should be classified as not found and not retried, got %d requests", n)
+	}
+}
+
+func TestS3Store_ListPaginates(t *testing.T) {
+	store := newMinIOStore(t, minioEndpoint(t))
+	ctx := context.Background()
+
+	// ListObjectsV2 returns at most 1000 keys per page
+	const total = 1001
+	sem := make(chan struct{}, 16)
+	var wg sync.WaitGroup
+	errs := make(chan error, total)
+	for i := 0; i < total; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			key := fmt.Sprintf("paged/2025-01-15/batch_%04d.jsonl", i)
+			if err := store.Put(ctx, key, strings.NewReader("x")); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	keys, err := store.List(ctx, "paged/")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != total {
+		t.Errorf("expected %d keys across pages, got %d", total, len(keys))
+	}
+}
+
+// patternReader yields n bytes of a repeating, non-zero pattern without
+// holding them all in memory.
+type patternReader struct {
+	n, off int64
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.off >= r.n {
+		return 0, io.EOF
+	}
+	p = p[:min(int64(len(p)), r.n-r.off)]
+	for i := range p {
+		p[i] = byte((r.off + int64(i)) % 251)
+	}
+	r.off += int64(len(p))
+	return len(p), nil
+}
+
+func TestS3Store_PutLargeObjectStreamsMultipart(t *testing.T) {
+	store := newMinIOStore(t, minioEndpoint(t))
+	ctx := context.Background()
+
+	// Above the multipart threshold, and not a whole number of parts
+	const size = 20<<20 + 12345
+	key := "warehouse/request_metrics_minute/metrics_large_2025-01-15.parquet"
+	if err := store.Put(ctx, key, &patternReader{n: size}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	info, err := store.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Size != size {
+		t.Errorf("expected size %d, got %d", size, info.Size)
+	}
+
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer rc.Close()
+	want := sha256.New()
+	io.Copy(want, &patternReader{n: size})
+	got := sha256.New()
+	if _, err := io.Copy(got, rc); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(got.Sum(nil), want.Sum(nil)) {
+		t.Error("object read back differs from what was uploaded")
+	}
+}
@@ -2,14 +2,112 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"sort"
+	"strings"
+	"time"
 )
 
 // ObjectStore defines the interface for interacting with object storage (Local, S3, MinIO, etc.)
 type ObjectStore interface {
-	Put(ctx context.Context, key string, reader io.Reader) error
+	Put(ctx context.Context, key string, reader io.Reader, opts ...PutOption) error
 	Get(ctx context.Context, key string) (io.ReadCloser, error)
 	Delete(ctx context.Context, key string) error
 	List(ctx context.Context, prefix string) ([]string, error)
 	Exists(ctx context.Context, key string) (bool, error)
+
+	// DeleteBatch deletes keys with as few backend calls as the store
+	// allows. It attempts every key; if any fails it returns a
+	// *DeleteBatchError listing them, and every other key was deleted.
+	DeleteBatch(ctx context.Context, keys []string) error
+
+	// Stat returns the object's size and last modification time. If key
+	// doesn't exist the error wraps fs.ErrNotExist, whatever the backend.
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+}
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Size    int64
+	ModTime time.Time // When the object was last written, as recorded by the backend
+}
+
+// DeleteBatchError reports the keys DeleteBatch failed to delete, with the
+// error of each.
+type DeleteBatchError struct {
+	Failed map[string]error
+}
+
+// maxErrorKeys bounds the keys named in a DeleteBatchError message.
+const maxErrorKeys = 5
+
+func (e *DeleteBatchError) Error() string {
+	keys := make([]string, 0, len(e.Failed))
+	for k := range e.Failed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys[:min(len(keys), maxErrorKeys)] {
+		parts = append(parts, fmt.Sprintf("%s: %v", k, e.Failed[k]))
+	}
+	if len(keys) > maxErrorKeys {
+		parts = append(parts, fmt.Sprintf("and %d more", len(keys)-maxErrorKeys))
+	}
+	return fmt.Sprintf("failed to delete %d keys: %s", len(keys), strings.Join(parts, "; "))
+}
+
+func (e *DeleteBatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, err := range e.Failed {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Verifier is implemented by stores that can check, up front, that they are
+// reachable and writable.
+type Verifier interface {
+	Verify(ctx context.Context) error
+}
+
+// Verify checks connectivity for stores that implement Verifier. Stores that
+// don't are assumed to be usable.
+func Verify(ctx context.Context, store ObjectStore) error {
+	if v, ok := store.(Verifier); ok {
+		return v.Verify(ctx)
+	}
+	return nil
+}
+
+// PutOptions holds optional per-object settings for Put. Backends ignore
+// options they have no equivalent for.
+type PutOptions struct {
+	Tags map[string]string // Object tags (S3 only), e.g. dataset=request_metrics_minute
+}
+
+// PutOption configures a single Put call.
+type PutOption func(*PutOptions)
+
+// WithTags attaches key/value tags to the stored object so lifecycle rules and
+// cost reports can select objects by tag.
+func WithTags(tags map[string]string) PutOption {
+	return func(o *PutOptions) {
+		if o.Tags == nil {
+			o.Tags = make(map[string]string, len(tags))
+		}
+		for k, v := range tags {
+			o.Tags[k] = v
+		}
+	}
+}
+
+// ApplyPutOptions resolves a list of options into a PutOptions value.
+func ApplyPutOptions(opts []PutOption) PutOptions {
+	var o PutOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
 }
@@ -0,0 +1,193 @@
+// Package storagetest provides a conformance suite for storage.ObjectStore
+// implementations.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+)
+
+// StoreConformanceTest checks the behaviour every ObjectStore must provide.
+// newStore is called once per subtest and must return an empty store, so a
+// new backend proves compliance with:
+//
+//	storagetest.StoreConformanceTest(t, func() storage.ObjectStore { return newMyStore(t) })
+func StoreConformanceTest(t *testing.T, newStore func() storage.ObjectStore) {
+	ctx := context.Background()
+
+	t.Run("PutGetRoundTrip", func(t *testing.T) {
+		store := newStore()
+		key := "raw/request_facts/2025-01-15/10/batch_a.jsonl"
+		if err := store.Put(ctx, key, strings.NewReader("hello world\n")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if got := ReadKey(t, store, key); got != "hello world\n" {
+			t.Errorf("expected %q, got %q", "hello world\n", got)
+		}
+	})
+
+	t.Run("PutOverwrites", func(t *testing.T) {
+		store := newStore()
+		key := "warehouse/metrics.parquet"
+		if err := store.Put(ctx, key, strings.NewReader("a much longer first version")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if err := store.Put(ctx, key, strings.NewReader("second")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if got := ReadKey(t, store, key); got != "second" {
+			t.Errorf("expected the second write to replace the first, got %q", got)
+		}
+	})
+
+	t.Run("DeleteThenGetFails", func(t *testing.T) {
+		store := newStore()
+		key := "raw/service_events/2025-01-15/10/batch_a.jsonl"
+		if err := store.Put(ctx, key, strings.NewReader("x")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if err := store.Delete(ctx, key); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if rc, err := store.Get(ctx, key); err == nil {
+			rc.Close()
+			t.Error("expected Get to fail after Delete")
+		}
+	})
+
+	t.Run("ExistsBeforeAndAfter", func(t *testing.T) {
+		store := newStore()
+		key := "_purge/raw/request_facts.watermark"
+		if exists, err := store.Exists(ctx, key); err != nil || exists {
+			t.Fatalf("expected missing key before Put, got exists=%v err=%v", exists, err)
+		}
+		if err := store.Put(ctx, key, strings.NewReader("2025-01-15")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if exists, err := store.Exists(ctx, key); err != nil || !exists {
+			t.Fatalf("expected key after Put, got exists=%v err=%v", exists, err)
+		}
+		if err := store.Delete(ctx, key); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if exists, err := store.Exists(ctx, key); err != nil || exists {
+			t.Errorf("expected missing key after Delete, got exists=%v err=%v", exists, err)
+		}
+	})
+
+	t.Run("StatSizeAndModTime", func(t *testing.T) {
+		store := newStore()
+		key := "warehouse/request_metrics_minute/metrics_2025-01-15.parquet"
+		if _, err := store.Stat(ctx, key); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected fs.ErrNotExist before Put, got %v", err)
+		}
+		// Backends record modification times to the second at best
+		before := time.Now().Add(-time.Second)
+		if err := store.Put(ctx, key, strings.NewReader("twelve bytes")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		info, err := store.Stat(ctx, key)
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if info.Size != 12 {
+			t.Errorf("expected size 12, got %d", info.Size)
+		}
+		if info.ModTime.Before(before) || info.ModTime.After(time.Now().Add(time.Minute)) {
+			t.Errorf("ModTime %v is not around the time of the Put", info.ModTime)
+		}
+	})
+
+	t.Run("ListPrefix", func(t *testing.T) {
+		store := newStore()
+		day := []string{
+			"raw/request_facts/2025-01-15/10/batch_a.jsonl",
+			"raw/request_facts/2025-01-15/11/batch_b.jsonl",
+		}
+		other := []string{
+			"raw/request_facts/2025-01-16/00/batch_c.jsonl",
+			"raw/service_events/2025-01-15/10/batch_d.jsonl",
+		}
+		putKeys(t, store, append(day, other...)...)
+
+		// Keys come back in full, relative to the store root, with forward slashes
+		assertKeys(t, store, "raw/request_facts/2025-01-15", day)
+		assertKeys(t, store, "raw/request_facts", append(day, other[0]))
+		assertKeys(t, store, "raw/does-not-exist", nil)
+	})
+
+	t.Run("DeleteBatch", func(t *testing.T) {
+		store := newStore()
+		doomed := []string{
+			"warehouse/request_metrics_minute/metrics_a_2025-01-14.parquet",
+			"warehouse/request_metrics_minute/metrics_b_2025-01-14.parquet",
+		}
+		kept := []string{"warehouse/request_metrics_minute/metrics_c_2025-01-15.parquet"}
+		putKeys(t, store, append(doomed, kept...)...)
+
+		if err := store.DeleteBatch(ctx, doomed); err != nil {
+			t.Fatalf("DeleteBatch failed: %v", err)
+		}
+		assertKeys(t, store, "warehouse/request_metrics_minute", kept)
+		if err := store.DeleteBatch(ctx, nil); err != nil {
+			t.Errorf("expected an empty DeleteBatch to succeed, got %v", err)
+		}
+	})
+
+	t.Run("ListEmptyPrefix", func(t *testing.T) {
+		store := newStore()
+		assertKeys(t, store, "", nil)
+
+		keys := []string{"top.txt", "raw/request_facts/2025-01-15/10/batch_a.jsonl"}
+		putKeys(t, store, keys...)
+		assertKeys(t, store, "", keys)
+	})
+}
+
+// ReadKey returns the full content of key, failing the test on any error.
+func ReadKey(t *testing.T, store storage.ObjectStore, key string) string {
+	t.Helper()
+	rc, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get %s failed: %v", key, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", key, err)
+	}
+	return string(data)
+}
+
+func putKeys(t *testing.T, store storage.ObjectStore, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if err := store.Put(context.Background(), key, strings.NewReader("x")); err != nil {
+			t.Fatalf("Put %s failed: %v", key, err)
+		}
+	}
+}
+
+// assertKeys checks that List(prefix) returns exactly want, in any order.
+func assertKeys(t *testing.T, store storage.ObjectStore, prefix string, want []string) {
+	t.Helper()
+	got, err := store.List(context.Background(), prefix)
+	if err != nil {
+		t.Fatalf("List(%q) failed: %v", prefix, err)
+	}
+	got = append([]string(nil), got...)
+	want = append([]string(nil), want...)
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("List(%q) = %v, want %v", prefix, got, want)
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var storageTeeSecondaryFailuresTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "storage_tee_secondary_failures_total",
+		Help: "Total number of writes or deletes that succeeded on the primary store but failed on a secondary.",
+	},
+	[]string{"secondary", "operation"},
+)
+
+func init() {
+	prometheus.MustRegister(storageTeeSecondaryFailuresTotal)
+}
+
+// TeeStore writes to a primary store and mirrors every Put and Delete to one
+// or more secondaries, e.g. a hot MinIO copy plus a cold S3 archive. The
+// primary is authoritative: its errors are returned, and Get, List and Exists
+// only consult it. Secondary failures are logged and counted in
+// storage_tee_secondary_failures_total (secondaries numbered from 1), so a
+// secondary can fall behind and must be repaired by rerunning the job.
+type TeeStore struct {
+	primary     ObjectStore
+	secondaries []ObjectStore
+}
+
+// NewTeeStore mirrors writes from primary to each secondary.
+func NewTeeStore(primary ObjectStore, secondaries ...ObjectStore) *TeeStore {
+	return &TeeStore{primary: primary, secondaries: secondaries}
+}
+
+// Put buffers the object so it can be written to every store. Secondaries are
+// skipped if the primary write fails.
+func (t *TeeStore) Put(ctx context.Context, key string, reader io.Reader, opts ...PutOption) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", key, err)
+	}
+	if err := t.primary.Put(ctx, key, bytes.NewReader(data), opts...); err != nil {
+		return err
+	}
+	t.mirror("put", key, func(s ObjectStore) error {
+		return s.Put(ctx, key, bytes.NewReader(data), opts...)
+	})
+	return nil
+}
+
+func (t *TeeStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return t.primary.Get(ctx, key)
+}
+
+// Delete removes key from the primary, then from each secondary.
+func (t *TeeStore) Delete(ctx context.Context, key string) error {
+	if err := t.primary.Delete(ctx, key); err != nil {
+		return err
+	}
+	t.mirror("delete", key, func(s ObjectStore) error { return s.Delete(ctx, key) })
+	return nil
+}
+
+// DeleteBatch removes keys from the primary, then mirrors the deletion of
+// those the primary removed to each secondary.
+func (t *TeeStore) DeleteBatch(ctx context.Context, keys []string) error {
+	err := t.primary.DeleteBatch(ctx, keys)
+	deleted := keys
+	if err != nil {
+		var batchErr *DeleteBatchError
+		if !errors.As(err, &batchErr) {
+			return err
+		}
+		deleted = slices.DeleteFunc(slices.Clone(keys), func(k string) bool {
+			_, failed := batchErr.Failed[k]
+			return failed
+		})
+	}
+	if len(deleted) > 0 {
+		t.mirror("delete", fmt.Sprintf("%d keys", len(deleted)), func(s ObjectStore) error { return s.DeleteBatch(ctx, deleted) })
+	}
+	return err
+}
+
+func (t *TeeStore) List(ctx context.Context, prefix string) ([]string, error) {
+	return t.primary.List(ctx, prefix)
+}
+
+func (t *TeeStore) Exists(ctx context.Context, key string) (bool, error) {
+	return t.primary.Exists(ctx, key)
+}
+
+func (t *TeeStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	return t.primary.Stat(ctx, key)
+}
+
+// Verify checks the primary. An unreachable secondary is only logged, since
+// secondaries never fail a write.
+func (t *TeeStore) Verify(ctx context.Context) error {
+	if err := Verify(ctx, t.primary); err != nil {
+		return err
+	}
+	for i, s := range t.secondaries {
+		if err := Verify(ctx, s); err != nil {
+			log.Printf("WARNING: secondary store %d failed verification: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (t *TeeStore) mirror(operation, key string, fn func(ObjectStore) error) {
+	for i, s := range t.secondaries {
+		if err := fn(s); err != nil {
+			log.Printf("Secondary store %d: %s %s failed: %v", i+1, operation, key, err)
+			storageTeeSecondaryFailuresTotal.WithLabelValues(strconv.Itoa(i+1), operation).Inc()
+		}
+	}
+}
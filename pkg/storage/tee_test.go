@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// failingStore rejects every write and delete.
+type failingStore struct {
+	ObjectStore
+}
+
+func (failingStore) Put(context.Context, string, io.Reader, ...PutOption) error {
+	return errors.New("secondary unavailable")
+}
+
+func (failingStore) Delete(context.Context, string) error {
+	return errors.New("secondary unavailable")
+}
+
+func newTestLocalStore(t *testing.T) *LocalStore {
+	t.Helper()
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	return store
+}
+
+func teeFailures(t *testing.T, secondary, operation string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := storageTeeSecondaryFailuresTotal.WithLabelValues(secondary, operation).Write(&m); err != nil {
+		t.Fatalf("failed to read metric: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestTeeStore_MirrorsWritesAndDeletes(t *testing.T) {
+	primary, secondary := newTestLocalStore(t), newTestLocalStore(t)
+	tee := NewTeeStore(primary, secondary)
+	ctx := context.Background()
+	key := "warehouse/request_metrics_minute/metrics_a_2025-01-15.parquet"
+
+	if err := tee.Put(ctx, key, strings.NewReader("rows"), WithTags(map[string]string{"day": "2025-01-15"})); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	for name, s := range map[string]ObjectStore{"primary": primary, "secondary": secondary} {
+		rc, err := s.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("%s: Get failed: %v", name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(data) != "rows" {
+			t.Errorf("%s: expected %q, got %q", name, "rows", data)
+		}
+	}
+
+	if err := tee.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	for name, s := range map[string]ObjectStore{"primary": primary, "secondary": secondary} {
+		if exists, _ := s.Exists(ctx, key); exists {
+			t.Errorf("%s: expected %s to be deleted", name, key)
+		}
+	}
+}
+
+func TestTeeStore_SecondaryFailureIsNotFatal(t *testing.T) {
+	storageTeeSecondaryFailuresTotal.DeleteLabelValues("2", "put")
+	storageTeeSecondaryFailuresTotal.DeleteLabelValues("2", "delete")
+	primary, healthy := newTestLocalStore(t), newTestLocalStore(t)
+	tee := NewTeeStore(primary, healthy, failingStore{})
+	ctx := context.Background()
+
+	if err := tee.Put(ctx, "a.parquet", strings.NewReader("x")); err != nil {
+		t.Fatalf("a failing secondary must not fail Put: %v", err)
+	}
+	if exists, _ := healthy.Exists(ctx, "a.parquet"); !exists {
+		t.Error("expected the healthy secondary to still receive the write")
+	}
+	if err := tee.Delete(ctx, "a.parquet"); err != nil {
+		t.Fatalf("a failing secondary must not fail Delete: %v", err)
+	}
+	if got := teeFailures(t, "2", "put"); got != 1 {
+		t.Errorf("expected 1 put failure for secondary 2, got %v", got)
+	}
+	if got := teeFailures(t, "2", "delete"); got != 1 {
+		t.Errorf("expected 1 delete failure for secondary 2, got %v", got)
+	}
+}
+
+func TestTeeStore_PrimaryFailureSkipsSecondaries(t *testing.T) {
+	secondary := newTestLocalStore(t)
+	tee := NewTeeStore(failingStore{}, secondary)
+	ctx := context.Background()
+
+	if err := tee.Put(ctx, "a.parquet", strings.NewReader("x")); err == nil {
+		t.Fatal("expected the primary's error")
+	}
+	if exists, _ := secondary.Exists(ctx, "a.parquet"); exists {
+		t.Error("secondaries must not get objects the primary rejected")
+	}
+}
+
+func TestTeeStore_DeleteBatchMirrorsOnlyPrimaryDeletions(t *testing.T) {
+	primary, secondary := newTestLocalStore(t), newTestLocalStore(t)
+	tee := NewTeeStore(primary, secondary)
+	ctx := context.Background()
+
+	for _, s := range []ObjectStore{primary, secondary} {
+		if err := s.Put(ctx, "a.parquet", strings.NewReader("x")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if err := secondary.Put(ctx, "b.parquet", strings.NewReader("x")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// b.parquet is missing from the primary, so only a.parquet is deleted there
+	err := tee.DeleteBatch(ctx, []string{"a.parquet", "b.parquet"})
+	var batchErr *DeleteBatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Failed) != 1 || batchErr.Failed["b.parquet"] == nil {
+		t.Fatalf("expected a DeleteBatchError for b.parquet only, got %v", err)
+	}
+	if exists, _ := secondary.Exists(ctx, "a.parquet"); exists {
+		t.Error("expected a.parquet to be deleted from the secondary")
+	}
+	if exists, _ := secondary.Exists(ctx, "b.parquet"); !exists {
+		t.Error("expected b.parquet, which the primary failed to delete, to stay on the secondary")
+	}
+}
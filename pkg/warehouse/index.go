@@ -0,0 +1,100 @@
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+)
+
+// IndexName is the object under a dataset prefix that records each day's
+// current output. The leading underscore makes Trino and other Hive-style
+// readers skip it as a hidden file.
+const IndexName = "_index.json"
+
+// IndexEntry describes the current output object of one day. SHA256 is over
+// the object's bytes, so it changes only when the day's data does, while Key
+// and WrittenAt change on every rewrite.
+//
+// An output split into part files lists every part, in order, in Parts; Key
+// is then the first part and SHA256 is over all the parts' bytes in order.
+type IndexEntry struct {
+	Key       string    `json:"key"`
+	Parts     []string  `json:"parts,omitempty"`
+	SHA256    string    `json:"sha256"`
+	RowCount  int       `json:"row_count"`
+	WrittenAt time.Time `json:"written_at"`
+}
+
+// NewIndexEntry returns the entry for data written to key.
+func NewIndexEntry(key string, data []byte, rows int, writtenAt time.Time) IndexEntry {
+	sum := sha256.Sum256(data)
+	return IndexEntry{Key: key, SHA256: hex.EncodeToString(sum[:]), RowCount: rows, WrittenAt: writtenAt.UTC()}
+}
+
+// Index maps each day (YYYY-MM-DD) of a dataset to its current output.
+type Index map[string]IndexEntry
+
+// IndexKey returns the key of the index for the dataset under prefix.
+func IndexKey(prefix string) string {
+	return strings.TrimSuffix(prefix, "/") + "/" + IndexName
+}
+
+// ReadIndex returns the index of the dataset under prefix, or an empty index
+// if none has been written yet.
+func ReadIndex(ctx context.Context, store storage.ObjectStore, prefix string) (Index, error) {
+	key := IndexKey(prefix)
+	exists, err := store.Exists(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("check %s: %w", key, err)
+	}
+	if !exists {
+		return Index{}, nil
+	}
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", key, err)
+	}
+	idx := Index{}
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", key, err)
+	}
+	return idx, nil
+}
+
+// UpdateIndex sets day's entry in the index under prefix, or removes it when
+// entry is nil, and writes the whole index back with a single Put. Callers
+// must not update the same index concurrently; the rollup jobs' run lock
+// ensures that.
+func UpdateIndex(ctx context.Context, store storage.ObjectStore, prefix, day string, entry *IndexEntry) error {
+	idx, err := ReadIndex(ctx, store, prefix)
+	if err != nil {
+		return err
+	}
+	if entry != nil {
+		idx[day] = *entry
+	} else {
+		delete(idx, day)
+	}
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode index: %w", err)
+	}
+	key := IndexKey(prefix)
+	if err := store.Put(ctx, key, bytes.NewReader(append(data, '\n'))); err != nil {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	return nil
+}
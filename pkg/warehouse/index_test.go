@@ -0,0 +1,47 @@
+package warehouse
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+)
+
+func TestUpdateIndex(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	prefix := "warehouse/request_metrics_minute"
+
+	idx, err := ReadIndex(ctx, store, prefix)
+	if err != nil || len(idx) != 0 {
+		t.Fatalf("expected an empty index before the first update, got %v (err %v)", idx, err)
+	}
+
+	now := time.Date(2025, 1, 16, 2, 0, 0, 0, time.UTC)
+	first := NewIndexEntry(prefix+"/metrics_a_2025-01-15.parquet", []byte("rows"), 3, now)
+	second := NewIndexEntry(prefix+"/metrics_b_2025-01-14.parquet", []byte("other rows"), 1, now)
+	for day, entry := range map[string]IndexEntry{"2025-01-15": first, "2025-01-14": second} {
+		if err := UpdateIndex(ctx, store, prefix, day, &entry); err != nil {
+			t.Fatalf("UpdateIndex failed: %v", err)
+		}
+	}
+	if err := UpdateIndex(ctx, store, prefix, "2025-01-14", nil); err != nil {
+		t.Fatalf("UpdateIndex failed: %v", err)
+	}
+
+	idx, err = ReadIndex(ctx, store, prefix)
+	if err != nil {
+		t.Fatalf("ReadIndex failed: %v", err)
+	}
+	if len(idx) != 1 || !reflect.DeepEqual(idx["2025-01-15"], first) {
+		t.Errorf("expected only the 2025-01-15 entry, got %+v", idx)
+	}
+	if first.SHA256 == second.SHA256 || len(first.SHA256) != 64 {
+		t.Errorf("expected distinct hex sha256 sums, got %q and %q", first.SHA256, second.SHA256)
+	}
+}
@@ -0,0 +1,294 @@
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/parquet-go/parquet-go"
+)
+
+// MetricRow represents a time bucket (1 minute unless the rollup ran with
+// -bucket) for a specific service/path/method tuple.
+// It is the row schema of the request_metrics_minute warehouse dataset.
+// Dimensions the rollup was not grouped by are absent from the file and
+// decode as empty strings.
+//
+// Columns added after the original schema are optional (nullable), and any
+// further column must be too: files written before it existed lack it, and
+// readers that merge files with different schemas (Trino, Spark, pyarrow)
+// only accept a missing column that is nullable. Zero values are written as
+// NULL and read back as zero.
+//
+// The percentile columns are optional pointers instead: nil is written as
+// NULL, for buckets with fewer requests than the rollup's -min-samples, while
+// a genuine 0 ms percentile stays 0. Files written before they became
+// optional read back with every percentile set. Apdex is a pointer for the
+// same reason: 0 is a real score, and files written before it read back nil.
+// p90 and p99.9 are NULL unless the rollup's -percentiles selects them, so
+// the schema is the same whichever percentiles a deployment computes.
+type MetricRow struct {
+	BucketStart     string   `json:"bucket_start" parquet:"bucket_start"`
+	Service         string   `json:"service" parquet:"service"`
+	Method          string   `json:"method" parquet:"method"`
+	PathTemplate    string   `json:"path_template" parquet:"path_template"`
+	UserAgentFamily string   `json:"user_agent_family,omitempty" parquet:"user_agent_family,optional"`
+	Source          string   `json:"source,omitempty" parquet:"source,optional"`
+	RequestCount    int64    `json:"request_count" parquet:"request_count"`
+	ErrorCount      int64    `json:"error_count" parquet:"error_count"`
+	ErrorRate       float64  `json:"error_rate" parquet:"error_rate"`
+	BucketSeconds   int64    `json:"bucket_seconds" parquet:"bucket_seconds,optional"`
+	Count2xx        int64    `json:"count_2xx" parquet:"count_2xx,optional"`
+	Count3xx        int64    `json:"count_3xx" parquet:"count_3xx,optional"`
+	Count4xx        int64    `json:"count_4xx" parquet:"count_4xx,optional"`
+	Count5xx        int64    `json:"count_5xx" parquet:"count_5xx,optional"`
+	P50LatencyMs    *float64 `json:"p50_latency_ms" parquet:"p50_latency_ms,optional"`
+	P90LatencyMs    *float64 `json:"p90_latency_ms" parquet:"p90_latency_ms,optional"`
+	P95LatencyMs    *float64 `json:"p95_latency_ms" parquet:"p95_latency_ms,optional"`
+	P99LatencyMs    *float64 `json:"p99_latency_ms" parquet:"p99_latency_ms,optional"`
+	P999LatencyMs   *float64 `json:"p999_latency_ms" parquet:"p999_latency_ms,optional"`
+	Apdex           *float64 `json:"apdex" parquet:"apdex,optional"`
+	EventDay        string   `json:"event_day" parquet:"event_day"`
+}
+
+// BucketSize is the width of the row's time bucket, from the rollup's
+// -bucket. Files written before the column existed are always 1 minute.
+func (m MetricRow) BucketSize() time.Duration {
+	if m.BucketSeconds == 0 {
+		return time.Minute
+	}
+	return time.Duration(m.BucketSeconds) * time.Second
+}
+
+// SecondsMetricRow is MetricRow with the percentiles in seconds, as the
+// rollup writes it with -latency-unit s. Apart from the percentile columns it
+// matches MetricRow.
+type SecondsMetricRow struct {
+	BucketStart        string   `json:"bucket_start" parquet:"bucket_start"`
+	Service            string   `json:"service" parquet:"service"`
+	Method             string   `json:"method" parquet:"method"`
+	PathTemplate       string   `json:"path_template" parquet:"path_template"`
+	UserAgentFamily    string   `json:"user_agent_family,omitempty" parquet:"user_agent_family,optional"`
+	Source             string   `json:"source,omitempty" parquet:"source,optional"`
+	RequestCount       int64    `json:"request_count" parquet:"request_count"`
+	ErrorCount         int64    `json:"error_count" parquet:"error_count"`
+	ErrorRate          float64  `json:"error_rate" parquet:"error_rate"`
+	BucketSeconds      int64    `json:"bucket_seconds" parquet:"bucket_seconds,optional"`
+	Count2xx           int64    `json:"count_2xx" parquet:"count_2xx,optional"`
+	Count3xx           int64    `json:"count_3xx" parquet:"count_3xx,optional"`
+	Count4xx           int64    `json:"count_4xx" parquet:"count_4xx,optional"`
+	Count5xx           int64    `json:"count_5xx" parquet:"count_5xx,optional"`
+	P50LatencySeconds  *float64 `json:"p50_latency_seconds" parquet:"p50_latency_seconds,optional"`
+	P90LatencySeconds  *float64 `json:"p90_latency_seconds" parquet:"p90_latency_seconds,optional"`
+	P95LatencySeconds  *float64 `json:"p95_latency_seconds" parquet:"p95_latency_seconds,optional"`
+	P99LatencySeconds  *float64 `json:"p99_latency_seconds" parquet:"p99_latency_seconds,optional"`
+	P999LatencySeconds *float64 `json:"p999_latency_seconds" parquet:"p999_latency_seconds,optional"`
+	Apdex              *float64 `json:"apdex" parquet:"apdex,optional"`
+	EventDay           string   `json:"event_day" parquet:"event_day"`
+}
+
+// InSeconds converts rows to SecondsMetricRow.
+func InSeconds(metrics []MetricRow) []SecondsMetricRow {
+	rows := make([]SecondsMetricRow, len(metrics))
+	for i, m := range metrics {
+		rows[i] = SecondsMetricRow{
+			BucketStart:        m.BucketStart,
+			Service:            m.Service,
+			Method:             m.Method,
+			PathTemplate:       m.PathTemplate,
+			UserAgentFamily:    m.UserAgentFamily,
+			Source:             m.Source,
+			RequestCount:       m.RequestCount,
+			ErrorCount:         m.ErrorCount,
+			ErrorRate:          m.ErrorRate,
+			BucketSeconds:      m.BucketSeconds,
+			Count2xx:           m.Count2xx,
+			Count3xx:           m.Count3xx,
+			Count4xx:           m.Count4xx,
+			Count5xx:           m.Count5xx,
+			P50LatencySeconds:  scale(m.P50LatencyMs, 0.001),
+			P90LatencySeconds:  scale(m.P90LatencyMs, 0.001),
+			P95LatencySeconds:  scale(m.P95LatencyMs, 0.001),
+			P99LatencySeconds:  scale(m.P99LatencyMs, 0.001),
+			P999LatencySeconds: scale(m.P999LatencyMs, 0.001),
+			Apdex:              m.Apdex,
+			EventDay:           m.EventDay,
+		}
+	}
+	return rows
+}
+
+// inMilliseconds converts rows back to MetricRow.
+func inMilliseconds(rows []SecondsMetricRow) []MetricRow {
+	metrics := make([]MetricRow, len(rows))
+	for i, r := range rows {
+		metrics[i] = MetricRow{
+			BucketStart:     r.BucketStart,
+			Service:         r.Service,
+			Method:          r.Method,
+			PathTemplate:    r.PathTemplate,
+			UserAgentFamily: r.UserAgentFamily,
+			Source:          r.Source,
+			RequestCount:    r.RequestCount,
+			ErrorCount:      r.ErrorCount,
+			ErrorRate:       r.ErrorRate,
+			BucketSeconds:   r.BucketSeconds,
+			Count2xx:        r.Count2xx,
+			Count3xx:        r.Count3xx,
+			Count4xx:        r.Count4xx,
+			Count5xx:        r.Count5xx,
+			P50LatencyMs:    scale(r.P50LatencySeconds, 1000),
+			P90LatencyMs:    scale(r.P90LatencySeconds, 1000),
+			P95LatencyMs:    scale(r.P95LatencySeconds, 1000),
+			P99LatencyMs:    scale(r.P99LatencySeconds, 1000),
+			P999LatencyMs:   scale(r.P999LatencySeconds, 1000),
+			Apdex:           r.Apdex,
+			EventDay:        r.EventDay,
+		}
+	}
+	return metrics
+}
+
+// scale multiplies a nullable value by f; NULL stays NULL.
+func scale(v *float64, f float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	s := *v * f
+	return &s
+}
+
+// Parquet key-value metadata the rollup writes into every metrics file.
+const (
+	// SchemaVersionKey records the MetricSchemaVersion a file was written with.
+	SchemaVersionKey = "gravix.schema_version"
+	// LatencyUnitKey records the unit of the percentile columns: ms for
+	// p*_latency_ms (MetricRow) or s for p*_latency_seconds (SecondsMetricRow).
+	LatencyUnitKey = "gravix.latency_unit"
+)
+
+// MetricSchemaVersion is the newest layout of metrics files this package
+// knows how to read. Files without SchemaVersionKey are version 1.
+//
+//	1: MetricRow, percentiles in milliseconds
+//	2: MetricRow or SecondsMetricRow, as named by LatencyUnitKey
+//
+// A new version is only needed when a change can't be read as before: added
+// nullable columns already decode as zero values in every version.
+const MetricSchemaVersion = 2
+
+// ErrSchemaTooNew is returned when a file's schema version is above the
+// maximum set with WithMaxSchemaVersion.
+var ErrSchemaTooNew = errors.New("metrics file schema version is newer than supported")
+
+// ReadOption configures ReadMetricRows and DecodeMetricRows.
+type ReadOption func(*readConfig)
+
+type readConfig struct {
+	maxVersion int // 0 means any
+}
+
+// WithMaxSchemaVersion refuses files whose schema version is above v, instead
+// of decoding them as the newest known version. Pass MetricSchemaVersion to
+// fail on files written by a newer rollup than the reader.
+func WithMaxSchemaVersion(v int) ReadOption {
+	return func(c *readConfig) {
+		c.maxVersion = v
+	}
+}
+
+// ReadMetricRows downloads a metrics parquet object and decodes all of its rows.
+// Columns the file lacks, e.g. because it predates them, decode as zero values.
+func ReadMetricRows(ctx context.Context, store storage.ObjectStore, key string, opts ...ReadOption) ([]MetricRow, error) {
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	defer rc.Close()
+
+	// Parquet needs random access to the footer, so buffer the object
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", key, err)
+	}
+
+	rows, err := DecodeMetricRows(bytes.NewReader(data), int64(len(data)), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", key, err)
+	}
+	return rows, nil
+}
+
+// DecodeMetricRows decodes the metrics parquet file in r according to its
+// schema version and latency unit. Percentiles are always returned in
+// milliseconds.
+func DecodeMetricRows(r io.ReaderAt, size int64, opts ...ReadOption) ([]MetricRow, error) {
+	var cfg readConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	f, err := parquet.OpenFile(r, size)
+	if err != nil {
+		return nil, err
+	}
+	version := 1
+	if v, ok := f.Lookup(SchemaVersionKey); ok {
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid %s %q", SchemaVersionKey, v)
+		}
+	}
+	if cfg.maxVersion > 0 && version > cfg.maxVersion {
+		return nil, fmt.Errorf("%w: %d > %d", ErrSchemaTooNew, version, cfg.maxVersion)
+	}
+
+	unit := "ms"
+	if version >= 2 {
+		if u, ok := f.Lookup(LatencyUnitKey); ok {
+			unit = u
+		}
+	}
+	switch unit {
+	case "ms":
+		return parquet.Read[MetricRow](r, size)
+	case "s":
+		rows, err := parquet.Read[SecondsMetricRow](r, size)
+		if err != nil {
+			return nil, err
+		}
+		return inMilliseconds(rows), nil
+	}
+	return nil, fmt.Errorf("unknown %s %q", LatencyUnitKey, unit)
+}
+
+// partSuffix matches the part number of a split output, e.g. the ".part03"
+// of metrics_<uuid>_<day>.part03.parquet.
+var partSuffix = regexp.MustCompile(`\.part\d+$`)
+
+// DayKeys returns the parquet objects under prefix that belong to the given
+// day (YYYY-MM-DD), sorted. Every part of an output split with the rollup's
+// -max-part-rows is included, in part order.
+func DayKeys(ctx context.Context, store storage.ObjectStore, prefix, day string) ([]string, error) {
+	keys, err := store.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", prefix, err)
+	}
+
+	var out []string
+	for _, k := range keys {
+		name, ok := strings.CutSuffix(k, ".parquet")
+		if ok && strings.HasSuffix(partSuffix.ReplaceAllString(name, ""), "_"+day) {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
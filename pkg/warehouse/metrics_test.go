@@ -0,0 +1,162 @@
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestReadMetricRows_RoundTrip(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	rows := []MetricRow{
+		{BucketStart: "2025-01-15 10:30:00", Service: "api", Method: "GET", PathTemplate: "/users", RequestCount: 3, EventDay: "2025-01-15"},
+		{BucketStart: "2025-01-15 10:31:00", Service: "web", Method: "GET", PathTemplate: "/", RequestCount: 1, EventDay: "2025-01-15"},
+	}
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, rows); err != nil {
+		t.Fatalf("failed to write parquet: %v", err)
+	}
+	key := "warehouse/request_metrics_minute/metrics_abc_2025-01-15.parquet"
+	if err := store.Put(ctx, key, &buf); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	got, err := ReadMetricRows(ctx, store, key)
+	if err != nil {
+		t.Fatalf("ReadMetricRows failed: %v", err)
+	}
+	if len(got) != 2 || got[0] != rows[0] || got[1] != rows[1] {
+		t.Errorf("round trip mismatch: got %+v", got)
+	}
+}
+
+// originalMetricRow is MetricRow as first released, before any optional columns.
+type originalMetricRow struct {
+	BucketStart  string  `parquet:"bucket_start"`
+	Service      string  `parquet:"service"`
+	Method       string  `parquet:"method"`
+	PathTemplate string  `parquet:"path_template"`
+	RequestCount int64   `parquet:"request_count"`
+	ErrorCount   int64   `parquet:"error_count"`
+	ErrorRate    float64 `parquet:"error_rate"`
+	P50LatencyMs float64 `parquet:"p50_latency_ms"`
+	P95LatencyMs float64 `parquet:"p95_latency_ms"`
+	P99LatencyMs float64 `parquet:"p99_latency_ms"`
+	EventDay     string  `parquet:"event_day"`
+}
+
+func TestReadMetricRows_OldSchema(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	old := originalMetricRow{BucketStart: "2025-01-15 10:30:00", Service: "api", Method: "GET", PathTemplate: "/users", RequestCount: 3, ErrorCount: 1, P99LatencyMs: 42, EventDay: "2025-01-15"}
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, []originalMetricRow{old}); err != nil {
+		t.Fatalf("failed to write parquet: %v", err)
+	}
+	key := "warehouse/request_metrics_minute/metrics_old_2025-01-15.parquet"
+	if err := store.Put(ctx, key, &buf); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	got, err := ReadMetricRows(ctx, store, key)
+	if err != nil {
+		t.Fatalf("ReadMetricRows failed on an old-schema file: %v", err)
+	}
+	// The percentiles were required then, so every one of them is set
+	zero, p99 := 0.0, 42.0
+	want := MetricRow{BucketStart: old.BucketStart, Service: "api", Method: "GET", PathTemplate: "/users", RequestCount: 3, ErrorCount: 1, P50LatencyMs: &zero, P95LatencyMs: &zero, P99LatencyMs: &p99, EventDay: "2025-01-15"}
+	if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Errorf("expected %+v with zero-valued new columns, got %+v", want, got)
+	}
+}
+
+func TestMetricRow_NewColumnsAreOptional(t *testing.T) {
+	original := parquet.SchemaOf(originalMetricRow{})
+	for _, f := range parquet.SchemaOf(MetricRow{}).Fields() {
+		if _, ok := original.Lookup(f.Name()); ok {
+			continue
+		}
+		if !f.Optional() {
+			t.Errorf("column %s was added after the original schema and must be optional", f.Name())
+		}
+	}
+}
+
+// writeParquet encodes rows as a parquet file.
+func writeParquet[T any](t *testing.T, rows []T, opts ...parquet.WriterOption) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, rows, opts...); err != nil {
+		t.Fatalf("failed to write parquet: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeMetricRows_SchemaVersions(t *testing.T) {
+	p99Ms, p99S := 42.0, 0.042
+	v1 := writeParquet(t, []originalMetricRow{{BucketStart: "2025-01-15 10:30:00", Service: "api", RequestCount: 3, P99LatencyMs: p99Ms, EventDay: "2025-01-15"}})
+	v2 := writeParquet(t, []SecondsMetricRow{{BucketStart: "2025-01-15 10:30:00", Service: "api", RequestCount: 3, P99LatencySeconds: &p99S, EventDay: "2025-01-15"}},
+		parquet.KeyValueMetadata(SchemaVersionKey, "2"), parquet.KeyValueMetadata(LatencyUnitKey, "s"))
+
+	for name, data := range map[string][]byte{"v1": v1, "v2": v2} {
+		rows, err := DecodeMetricRows(bytes.NewReader(data), int64(len(data)), WithMaxSchemaVersion(MetricSchemaVersion))
+		if err != nil {
+			t.Fatalf("%s: DecodeMetricRows failed: %v", name, err)
+		}
+		if len(rows) != 1 || rows[0].Service != "api" || rows[0].RequestCount != 3 || rows[0].P99LatencyMs == nil || *rows[0].P99LatencyMs != p99Ms {
+			t.Errorf("%s: expected one api row with p99 of %vms, got %+v", name, p99Ms, rows)
+		}
+		if rows[0].Apdex != nil {
+			t.Errorf("%s: expected the missing apdex column to read back nil, got %v", name, *rows[0].Apdex)
+		}
+	}
+
+	v3 := writeParquet(t, []originalMetricRow{{Service: "api"}}, parquet.KeyValueMetadata(SchemaVersionKey, "3"))
+	if _, err := DecodeMetricRows(bytes.NewReader(v3), int64(len(v3)), WithMaxSchemaVersion(MetricSchemaVersion)); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("expected ErrSchemaTooNew for a v3 file, got %v", err)
+	}
+	if rows, err := DecodeMetricRows(bytes.NewReader(v3), int64(len(v3))); err != nil || len(rows) != 1 {
+		t.Errorf("expected a v3 file to be read as the newest known version without the check, got %v (err %v)", rows, err)
+	}
+}
+
+func TestDayKeys_FiltersByDay(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	for _, k := range []string{
+		"warehouse/m/metrics_b_2025-01-15.parquet",
+		"warehouse/m/metrics_a_2025-01-15.parquet",
+		"warehouse/m/metrics_c_2025-01-16.parquet",
+		"warehouse/m/.rollup.lock",
+	} {
+		store.Put(ctx, k, strings.NewReader("x"))
+	}
+
+	keys, err := DayKeys(ctx, store, "warehouse/m", "2025-01-15")
+	if err != nil {
+		t.Fatalf("DayKeys failed: %v", err)
+	}
+	want := []string{"warehouse/m/metrics_a_2025-01-15.parquet", "warehouse/m/metrics_b_2025-01-15.parquet"}
+	if len(keys) != 2 || keys[0] != want[0] || keys[1] != want[1] {
+		t.Errorf("expected %v, got %v", want, keys)
+	}
+}
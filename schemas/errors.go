@@ -0,0 +1,29 @@
+package schemas
+
+// DecodeError is returned by ParseRequestFact and ParseServiceEvent when the
+// input is not valid JSON for the message, e.g. a truncated or corrupt line.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return "protojson unmarshal error: " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned by ParseRequestFact and ParseServiceEvent when
+// the input decodes but breaks a schema rule, e.g. a missing event_id.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return "validation error: " + e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
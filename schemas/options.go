@@ -0,0 +1,139 @@
+package schemas
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultServiceNamePattern is the recommended service-name rule: a short,
+// lowercase, kebab-case identifier such as "auth-service". A lowercase UUID
+// starting with a letter matches it too, so UUIDs are checked separately.
+var DefaultServiceNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,63}$`)
+
+// uuidServiceName matches a whole service name shaped like a UUID (8-4-4-4-12 hex).
+var uuidServiceName = regexp.MustCompile(`^[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{12}$`)
+
+// DefaultMaxFutureSkew is how far ahead of the local clock an event_time may
+// be unless set with WithMaxFutureSkew. It tolerates clients with slightly
+// fast clocks, while a year-2049 timestamp, which no daily partition would
+// ever include, is rejected.
+const DefaultMaxFutureSkew = 24 * time.Hour
+
+// Options holds opt-in validation rules on top of the always-enforced schema constraints.
+type Options struct {
+	ServiceNamePattern *regexp.Regexp // nil disables the check
+
+	// PropertyAllowList maps an event_type to the only property keys its
+	// service events may carry. Event types not in the map are unrestricted.
+	PropertyAllowList map[string][]string
+
+	// DefaultEventTime, if set, supplies event_time for request facts that
+	// omit it instead of rejecting them.
+	DefaultEventTime func() time.Time
+
+	// MaxFutureSkew is how far in the future event_time may be. 0 means
+	// DefaultMaxFutureSkew.
+	MaxFutureSkew time.Duration
+}
+
+// Option enables an optional validation rule.
+type Option func(*Options)
+
+// WithServiceNamePattern rejects facts and events whose service does not match re,
+// catching clients that send hostnames as the service name. UUID-shaped names are
+// rejected whatever re allows.
+// Pass DefaultServiceNamePattern unless a deployment needs something different.
+func WithServiceNamePattern(re *regexp.Regexp) Option {
+	return func(o *Options) {
+		o.ServiceNamePattern = re
+	}
+}
+
+// WithPropertyAllowList rejects service events whose properties include a key
+// not listed for their event_type, keeping the events warehouse schema
+// stable. Event types missing from allow accept any keys; an empty list
+// allows no properties at all.
+func WithPropertyAllowList(allow map[string][]string) Option {
+	return func(o *Options) {
+		o.PropertyAllowList = allow
+	}
+}
+
+// WithDefaultEventTime accepts request facts without an event_time, setting
+// it to now() and event_time_defaulted to true so readers know the time is
+// approximate. Explicitly invalid timestamps are still rejected. Only
+// ingestion should use it, with the receive time.
+func WithDefaultEventTime(now func() time.Time) Option {
+	return func(o *Options) {
+		o.DefaultEventTime = now
+	}
+}
+
+// WithMaxFutureSkew rejects facts and events whose event_time is more than d
+// ahead of the local clock, instead of DefaultMaxFutureSkew.
+func WithMaxFutureSkew(d time.Duration) Option {
+	return func(o *Options) {
+		o.MaxFutureSkew = d
+	}
+}
+
+func applyOptions(opts []Option) Options {
+	var o Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o Options) maxFutureSkew() time.Duration {
+	if o.MaxFutureSkew <= 0 {
+		return DefaultMaxFutureSkew
+	}
+	return o.MaxFutureSkew
+}
+
+func (o Options) validateEventTime(t time.Time) error {
+	if ahead := time.Until(t); ahead > o.maxFutureSkew() {
+		return fmt.Errorf("event_time is too far in the future (%s ahead, max %s)", ahead.Round(time.Second), o.maxFutureSkew())
+	}
+	return nil
+}
+
+func (o Options) validateServiceName(service string) error {
+	if o.ServiceNamePattern == nil {
+		return nil
+	}
+	if uuidServiceName.MatchString(service) {
+		return fmt.Errorf("service '%s' is a UUID, not a low-cardinality identifier", service)
+	}
+	if !o.ServiceNamePattern.MatchString(service) {
+		return fmt.Errorf("service '%s' is not a low-cardinality identifier (must match %s)", service, o.ServiceNamePattern)
+	}
+	return nil
+}
+
+func (o Options) validateProperties(eventType string, properties map[string]string) error {
+	allowed, ok := o.PropertyAllowList[eventType]
+	if !ok {
+		return nil
+	}
+	var rejected []string
+	for k := range properties {
+		if !slices.Contains(allowed, k) {
+			rejected = append(rejected, k)
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	sort.Strings(rejected)
+	want := "none"
+	if len(allowed) > 0 {
+		want = strings.Join(allowed, ", ")
+	}
+	return fmt.Errorf("event_type '%s' does not allow properties %s (allowed: %s)", eventType, strings.Join(rejected, ", "), want)
+}
@@ -0,0 +1,232 @@
+package schemas
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestValidate_ServiceNamePattern(t *testing.T) {
+	strict := WithServiceNamePattern(DefaultServiceNamePattern)
+
+	tests := []struct {
+		name      string
+		service   string
+		expectErr bool
+	}{
+		{"Kebab case", "auth-service", false},
+		{"Single letter", "a", false},
+		{"UUID as service", "52380628-863e-4390-8e12-254245645511", true},
+		{"UUID starting with a letter", "abcdef12-3456-4789-abcd-ef0123456789", true},
+		{"Uppercase UUID", "ABCDEF12-3456-4789-ABCD-EF0123456789", true},
+		{"UUID-like but longer", "abcdef12-3456-4789-abcd-ef0123456789-x", false},
+		{"Hostname", "ip-10-0-1-23.ec2.internal", true},
+		{"Uppercase", "AuthService", true},
+		{"Leading digit", "1service", true},
+		{"Too long", "s" + strings.Repeat("x", 64), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fact := &RequestFact{
+				EventId:      validUUIDv7,
+				EventTime:    timestamppb.Now(),
+				Service:      tt.service,
+				Method:       "GET",
+				PathTemplate: "/users",
+				StatusCode:   200,
+			}
+			err := ValidateRequestFact(fact, strict)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("RequestFact: expected error=%v, got %v", tt.expectErr, err)
+			}
+
+			event := &ServiceEvent{
+				EventId:   validUUIDv7,
+				EventTime: timestamppb.Now(),
+				Service:   tt.service,
+				EventType: "deploy_started",
+			}
+			err = ValidateServiceEvent(event, strict)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("ServiceEvent: expected error=%v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestValidate_ServiceNamePatternIsOptIn(t *testing.T) {
+	fact := &RequestFact{
+		EventId:      validUUIDv7,
+		EventTime:    timestamppb.Now(),
+		Service:      "52380628-863e-4390-8e12-254245645511",
+		Method:       "GET",
+		PathTemplate: "/users",
+		StatusCode:   200,
+	}
+	if err := ValidateRequestFact(fact); err != nil {
+		t.Errorf("expected UUID service to pass without the option, got %v", err)
+	}
+
+	custom := WithServiceNamePattern(regexp.MustCompile(`^[a-z0-9.-]+$`))
+	fact.Service = "web-01.prod.example.com"
+	if err := ValidateRequestFact(fact, custom); err != nil {
+		t.Errorf("expected custom pattern to be honoured, got %v", err)
+	}
+
+	// No pattern lets UUIDs through once the check is on
+	fact.Service = "abcdef12-3456-4789-abcd-ef0123456789"
+	loose := WithServiceNamePattern(regexp.MustCompile(`.*`))
+	if err := ValidateRequestFact(fact, loose); err == nil || !strings.Contains(err.Error(), "is a UUID") {
+		t.Errorf("expected a UUID service to be rejected with any pattern, got %v", err)
+	}
+}
+
+func TestParseRequestFact_ServiceNamePattern(t *testing.T) {
+	data := []byte(`{"event_id":"` + validUUIDv7 + `","event_time":"2025-01-15T10:00:00Z","service":"web-01.prod.example.com","method":"GET","path_template":"/","status_code":200}`)
+	_, err := ParseRequestFact(data, WithServiceNamePattern(DefaultServiceNamePattern))
+	if err == nil || !strings.Contains(err.Error(), "low-cardinality") {
+		t.Errorf("expected service name rejection, got %v", err)
+	}
+}
+
+func TestParseRequestFact_DefaultEventTime(t *testing.T) {
+	received := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	withDefault := WithDefaultEventTime(func() time.Time { return received })
+	rest := `"service":"api","method":"GET","path_template":"/","status_code":200}`
+
+	missing := []byte(`{"event_id":"` + validUUIDv7 + `",` + rest)
+	if _, err := ParseRequestFact(missing); err == nil || !strings.Contains(err.Error(), "event_time is required") {
+		t.Errorf("expected a missing event_time to be rejected without the option, got %v", err)
+	}
+	fact, err := ParseRequestFact(missing, withDefault)
+	if err != nil {
+		t.Fatalf("expected a missing event_time to be defaulted, got %v", err)
+	}
+	if !fact.EventTime.AsTime().Equal(received) || !fact.EventTimeDefaulted {
+		t.Errorf("expected event_time %v and event_time_defaulted, got %v and %v", received, fact.EventTime.AsTime(), fact.EventTimeDefaulted)
+	}
+
+	zero := []byte(`{"event_id":"` + validUUIDv7 + `","event_time":"0001-01-01T00:00:00Z",` + rest)
+	if _, err := ParseRequestFact(zero, withDefault); err == nil || !strings.Contains(err.Error(), "event_time is invalid") {
+		t.Errorf("expected an explicit zero event_time to be rejected, got %v", err)
+	}
+
+	// A client can't mark its own timestamp as defaulted
+	spoofed := []byte(`{"event_id":"` + validUUIDv7 + `","event_time":"2025-01-15T09:59:00Z","event_time_defaulted":true,` + rest)
+	fact, err = ParseRequestFact(spoofed, withDefault)
+	if err != nil || fact.EventTimeDefaulted {
+		t.Errorf("expected a client-sent event_time_defaulted to be cleared, got %v (err %v)", fact.GetEventTimeDefaulted(), err)
+	}
+}
+
+func TestValidate_PropertyAllowList(t *testing.T) {
+	allow := WithPropertyAllowList(map[string][]string{
+		"deploy_started": {"version", "commit"},
+		"heartbeat":      {},
+	})
+
+	tests := []struct {
+		name       string
+		eventType  string
+		properties map[string]string
+		errMsg     string // empty means valid
+	}{
+		{"Allowed keys", "deploy_started", map[string]string{"version": "1.2.3", "commit": "abc123"}, ""},
+		{"Subset of allowed keys", "deploy_started", map[string]string{"version": "1.2.3"}, ""},
+		{"No properties", "deploy_started", nil, ""},
+		{"Disallowed keys", "deploy_started", map[string]string{"version": "1.2.3", "user": "x", "email": "y"}, "event_type 'deploy_started' does not allow properties email, user (allowed: version, commit)"},
+		{"Keys are case-sensitive", "deploy_started", map[string]string{"Version": "1.2.3"}, "does not allow properties Version"},
+		{"Empty list allows nothing", "heartbeat", map[string]string{"region": "eu"}, "(allowed: none)"},
+		{"Unconfigured event type", "payment_processed", map[string]string{"anything": "goes"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &ServiceEvent{
+				EventId:    validUUIDv7,
+				EventTime:  timestamppb.Now(),
+				Service:    "deploy-service",
+				EventType:  tt.eventType,
+				Properties: tt.properties,
+			}
+			err := ValidateServiceEvent(event, allow)
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Errorf("expected valid, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+
+	// Off by default
+	event := &ServiceEvent{
+		EventId:    validUUIDv7,
+		EventTime:  timestamppb.Now(),
+		Service:    "deploy-service",
+		EventType:  "deploy_started",
+		Properties: map[string]string{"user": "x"},
+	}
+	if err := ValidateServiceEvent(event); err != nil {
+		t.Errorf("expected no allow-list without the option, got %v", err)
+	}
+}
+
+func TestValidate_FutureEventTime(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		eventTime time.Time
+		opts      []Option
+		expectErr bool
+	}{
+		{"Now", now, nil, false},
+		{"One hour ahead", now.Add(time.Hour), nil, false},
+		{"Past", now.AddDate(-1, 0, 0), nil, false},
+		{"Two days ahead", now.Add(48 * time.Hour), nil, true},
+		{"Far future", time.Date(2049, 1, 1, 0, 0, 0, 0, time.UTC), nil, true},
+		{"Two days ahead, wider skew", now.Add(48 * time.Hour), []Option{WithMaxFutureSkew(72 * time.Hour)}, false},
+		{"One hour ahead, narrower skew", now.Add(time.Hour), []Option{WithMaxFutureSkew(time.Minute)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fact := &RequestFact{
+				EventId:      validUUIDv7,
+				EventTime:    timestamppb.New(tt.eventTime),
+				Service:      "auth-service",
+				Method:       "GET",
+				PathTemplate: "/users",
+				StatusCode:   200,
+			}
+			err := ValidateRequestFact(fact, tt.opts...)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("RequestFact: expected error=%v, got %v", tt.expectErr, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "event_time is too far in the future") {
+				t.Errorf("RequestFact: unexpected error %v", err)
+			}
+
+			event := &ServiceEvent{
+				EventId:   validUUIDv7,
+				EventTime: timestamppb.New(tt.eventTime),
+				Service:   "auth-service",
+				EventType: "deploy_started",
+			}
+			err = ValidateServiceEvent(event, tt.opts...)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("ServiceEvent: expected error=%v, got %v", tt.expectErr, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "event_time is too far in the future") {
+				t.Errorf("ServiceEvent: unexpected error %v", err)
+			}
+		})
+	}
+}
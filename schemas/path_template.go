@@ -0,0 +1,43 @@
+package schemas
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Placeholder styles seen in the wild, each matched against a whole path segment.
+var (
+	colonPlaceholder   = regexp.MustCompile(`^:([A-Za-z_][A-Za-z0-9_]*)$`)                  // Express: /users/:id
+	bracePlaceholder   = regexp.MustCompile(`^\{([A-Za-z_][A-Za-z0-9_]*)(?::[^{}]*)?\}$`)   // OpenAPI/ASP.NET: /users/{id}, /users/{id:int}
+	anglePlaceholder   = regexp.MustCompile(`^<(?:[A-Za-z_]+:)?([A-Za-z_][A-Za-z0-9_]*)>$`) // Flask: /users/<id>, /users/<int:id>
+	bracketPlaceholder = regexp.MustCompile(`^\[([A-Za-z_][A-Za-z0-9_]*)\]$`)               // Next.js: /users/[id]
+)
+
+// NormalizePathTemplate canonicalizes route placeholder syntax to the {name}
+// form so that equivalent templates aggregate together, e.g.
+// "/users/:id", "/users/<int:id>" and "/users/%7Bid%7D" all become "/users/{id}".
+// Segments that are not a recognised placeholder are returned unchanged.
+func NormalizePathTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = normalizeSegment(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+func normalizeSegment(seg string) string {
+	// Clients that URL-encode their templates send %7Bid%7D for {id}
+	if strings.Contains(seg, "%") {
+		if decoded, err := url.PathUnescape(seg); err == nil {
+			seg = decoded
+		}
+	}
+
+	for _, re := range []*regexp.Regexp{colonPlaceholder, bracePlaceholder, anglePlaceholder, bracketPlaceholder} {
+		if m := re.FindStringSubmatch(seg); m != nil {
+			return "{" + m[1] + "}"
+		}
+	}
+	return seg
+}
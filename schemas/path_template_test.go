@@ -0,0 +1,34 @@
+package schemas
+
+import "testing"
+
+func TestNormalizePathTemplate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"Canonical", "/users/{id}", "/users/{id}"},
+		{"Express colon", "/users/:id", "/users/{id}"},
+		{"URL-encoded braces", "/users/%7Bid%7D", "/users/{id}"},
+		{"URL-encoded lowercase", "/users/%7bid%7d", "/users/{id}"},
+		{"Flask angle", "/users/<id>", "/users/{id}"},
+		{"Flask typed converter", "/users/<int:id>", "/users/{id}"},
+		{"Next.js brackets", "/users/[id]", "/users/{id}"},
+		{"ASP.NET constraint", "/users/{id:int}", "/users/{id}"},
+		{"Multiple placeholders", "/orgs/:org_id/users/<user_id>", "/orgs/{org_id}/users/{user_id}"},
+		{"Static path untouched", "/api/v1/health", "/api/v1/health"},
+		{"Trailing slash kept", "/users/:id/", "/users/{id}/"},
+		{"Colon inside segment untouched", "/v1/items:batchGet", "/v1/items:batchGet"},
+		{"Invalid escape untouched", "/files/%zz", "/files/%zz"},
+		{"Root", "/", "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizePathTemplate(tt.input); got != tt.want {
+				t.Errorf("NormalizePathTemplate(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
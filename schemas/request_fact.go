@@ -7,28 +7,30 @@ import (
 	"github.com/google/uuid"
 	gravixv1 "github.com/lgreene/gravix-dashboards/gen/gravix/v1"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // RequestFact aliases the generated Protobuf type for convenience and to avoid breaking existing code.
 type RequestFact = gravixv1.RequestFact
 
 // ParseRequestFact decodes and validates a raw JSON byte slice into a Protobuf message.
-func ParseRequestFact(data []byte) (*RequestFact, error) {
+// Errors are a *DecodeError or a *ValidationError.
+func ParseRequestFact(data []byte, opts ...Option) (*RequestFact, error) {
 	var fact RequestFact
 	err := protojson.Unmarshal(data, &fact)
 	if err != nil {
-		return nil, fmt.Errorf("protojson unmarshal error: %w", err)
+		return nil, &DecodeError{Err: err}
 	}
 
-	if err := ValidateRequestFact(&fact); err != nil {
-		return nil, fmt.Errorf("validation error: %w", err)
+	if err := ValidateRequestFact(&fact, opts...); err != nil {
+		return nil, &ValidationError{Err: err}
 	}
 
 	return &fact, nil
 }
 
 // ValidateRequestFact enforces business rules and schema constraints on the Protobuf message.
-func ValidateRequestFact(f *RequestFact) error {
+func ValidateRequestFact(f *RequestFact, opts ...Option) error {
 	// Constraint: EventID must be present and valid UUIDv7
 	if f.EventId == "" {
 		return fmt.Errorf("event_id is required")
@@ -41,7 +43,16 @@ func ValidateRequestFact(f *RequestFact) error {
 		return fmt.Errorf("event_id must be UUIDv7 (got v%d)", uid.Version())
 	}
 
-	// Constraint: EventTime required
+	o := applyOptions(opts)
+
+	// Constraint: EventTime required, unless ingestion fills it in
+	if o.DefaultEventTime != nil {
+		// Only ingestion sets event_time_defaulted
+		f.EventTimeDefaulted = f.EventTime == nil
+		if f.EventTimeDefaulted {
+			f.EventTime = timestamppb.New(o.DefaultEventTime())
+		}
+	}
 	if f.EventTime == nil {
 		return fmt.Errorf("event_time is required")
 	}
@@ -49,11 +60,17 @@ func ValidateRequestFact(f *RequestFact) error {
 	if t.IsZero() {
 		return fmt.Errorf("event_time is invalid")
 	}
+	if err := o.validateEventTime(t); err != nil {
+		return err
+	}
 
 	// Constraint: Service required
 	if f.Service == "" {
 		return fmt.Errorf("service is required")
 	}
+	if err := o.validateServiceName(f.Service); err != nil {
+		return err
+	}
 
 	// Constraint: Method required
 	if f.Method == "" {
@@ -1,9 +1,12 @@
 package schemas
 
 import (
+	"errors"
 	"strings"
 	"testing"
+	"time"
 
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -305,3 +308,72 @@ func TestRequestFact_Validate(t *testing.T) {
 		})
 	}
 }
+
+// eventTimePrecisionCases are event_time strings whose full precision must
+// survive parsing. Sub-second ordering and any future sub-minute buckets
+// depend on it.
+var eventTimePrecisionCases = []struct {
+	name      string
+	eventTime string
+	want      time.Time
+}{
+	{"Nanoseconds", "2023-10-27T10:05:00.123456789Z", time.Date(2023, 10, 27, 10, 5, 0, 123456789, time.UTC)},
+	{"Microseconds", "2023-10-27T10:05:00.123456Z", time.Date(2023, 10, 27, 10, 5, 0, 123456000, time.UTC)},
+	{"Milliseconds", "2023-10-27T10:05:00.001Z", time.Date(2023, 10, 27, 10, 5, 0, 1000000, time.UTC)},
+	{"Last Nanosecond", "2023-10-27T10:05:59.999999999Z", time.Date(2023, 10, 27, 10, 5, 59, 999999999, time.UTC)},
+	{"Offset", "2023-10-27T12:05:00.000000001+02:00", time.Date(2023, 10, 27, 10, 5, 0, 1, time.UTC)},
+}
+
+func TestParseRequestFact_EventTimePrecision(t *testing.T) {
+	for _, tt := range eventTimePrecisionCases {
+		t.Run(tt.name, func(t *testing.T) {
+			line := `{"event_id":"` + validUUIDv7 + `","event_time":"` + tt.eventTime + `","service":"s","method":"GET","path_template":"/p","status_code":200,"latency_ms":1}`
+			fact, err := ParseRequestFact([]byte(line))
+			if err != nil {
+				t.Fatalf("ParseRequestFact failed: %v", err)
+			}
+			if got := fact.EventTime.AsTime(); !got.Equal(tt.want) {
+				t.Errorf("event_time = %s, want %s", got.Format(time.RFC3339Nano), tt.want.Format(time.RFC3339Nano))
+			}
+
+			// Ingestion writes the parsed fact back out, and the rollups parse it again
+			data, err := protojson.Marshal(fact)
+			if err != nil {
+				t.Fatalf("failed to marshal fact: %v", err)
+			}
+			again, err := ParseRequestFact(data)
+			if err != nil {
+				t.Fatalf("ParseRequestFact of %s failed: %v", data, err)
+			}
+			if got := again.EventTime.AsTime(); !got.Equal(tt.want) {
+				t.Errorf("event_time after round trip = %s, want %s", got.Format(time.RFC3339Nano), tt.want.Format(time.RFC3339Nano))
+			}
+		})
+	}
+}
+
+func TestParseRequestFact_ErrorClass(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		decode     bool
+		validation bool
+	}{
+		{"truncated", `{"event_id":"` + validUUIDv7, true, false},
+		{"unknown field", `{"user_id":"123"}`, true, false},
+		{"missing event_time", `{"event_id":"` + validUUIDv7 + `","service":"s","method":"GET","path_template":"/p","status_code":200,"latency_ms":1}`, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRequestFact([]byte(tt.line))
+			var decodeErr *DecodeError
+			var validationErr *ValidationError
+			if got := errors.As(err, &decodeErr); got != tt.decode {
+				t.Errorf("DecodeError = %v, want %v (err %v)", got, tt.decode, err)
+			}
+			if got := errors.As(err, &validationErr); got != tt.validation {
+				t.Errorf("ValidationError = %v, want %v (err %v)", got, tt.validation, err)
+			}
+		})
+	}
+}
@@ -13,22 +13,23 @@ import (
 type ServiceEvent = gravixv1.ServiceEvent
 
 // ParseServiceEvent decodes and validates a raw JSON byte slice into a Protobuf message.
-func ParseServiceEvent(data []byte) (*ServiceEvent, error) {
+// Errors are a *DecodeError or a *ValidationError.
+func ParseServiceEvent(data []byte, opts ...Option) (*ServiceEvent, error) {
 	var event ServiceEvent
 	err := protojson.Unmarshal(data, &event)
 	if err != nil {
-		return nil, fmt.Errorf("protojson unmarshal error: %w", err)
+		return nil, &DecodeError{Err: err}
 	}
 
-	if err := ValidateServiceEvent(&event); err != nil {
-		return nil, fmt.Errorf("validation error: %w", err)
+	if err := ValidateServiceEvent(&event, opts...); err != nil {
+		return nil, &ValidationError{Err: err}
 	}
 
 	return &event, nil
 }
 
 // ValidateServiceEvent enforces schema constraints on the Protobuf message.
-func ValidateServiceEvent(e *ServiceEvent) error {
+func ValidateServiceEvent(e *ServiceEvent, opts ...Option) error {
 	// Constraint: EventID must be present and valid UUIDv7
 	if e.EventId == "" {
 		return fmt.Errorf("event_id is required")
@@ -44,9 +45,16 @@ func ValidateServiceEvent(e *ServiceEvent) error {
 	if e.EventTime == nil {
 		return fmt.Errorf("event_time is required")
 	}
+	o := applyOptions(opts)
+	if err := o.validateEventTime(e.EventTime.AsTime()); err != nil {
+		return err
+	}
 	if e.Service == "" {
 		return fmt.Errorf("service is required")
 	}
+	if err := o.validateServiceName(e.Service); err != nil {
+		return err
+	}
 	if e.EventType == "" {
 		return fmt.Errorf("event_type is required")
 	}
@@ -55,6 +63,9 @@ func ValidateServiceEvent(e *ServiceEvent) error {
 	if !isSnakeCase(e.EventType) {
 		return fmt.Errorf("event_type '%s' must be snake_case", e.EventType)
 	}
+	if err := o.validateProperties(e.EventType, e.Properties); err != nil {
+		return err
+	}
 
 	// Constraint: Flat Properties & No Large Payloads
 	const MAX_PROP_VALUE_LEN = 1024
@@ -1,9 +1,12 @@
 package schemas
 
 import (
+	"errors"
 	"strings"
 	"testing"
+	"time"
 
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -278,3 +281,56 @@ func TestParseServiceEvent_Immutability_Check(t *testing.T) {
 	// The key is that the parser validation runs ONCE.
 	// If a user modifies the struct later, they break the contract, but the *ingestion* path is safe.
 }
+
+func TestParseServiceEvent_EventTimePrecision(t *testing.T) {
+	for _, tt := range eventTimePrecisionCases {
+		t.Run(tt.name, func(t *testing.T) {
+			line := `{"event_id":"` + validUUIDv7 + `","event_time":"` + tt.eventTime + `","service":"s","event_type":"deploy_started"}`
+			event, err := ParseServiceEvent([]byte(line))
+			if err != nil {
+				t.Fatalf("ParseServiceEvent failed: %v", err)
+			}
+			if got := event.EventTime.AsTime(); !got.Equal(tt.want) {
+				t.Errorf("event_time = %s, want %s", got.Format(time.RFC3339Nano), tt.want.Format(time.RFC3339Nano))
+			}
+
+			data, err := protojson.Marshal(event)
+			if err != nil {
+				t.Fatalf("failed to marshal event: %v", err)
+			}
+			again, err := ParseServiceEvent(data)
+			if err != nil {
+				t.Fatalf("ParseServiceEvent of %s failed: %v", data, err)
+			}
+			if got := again.EventTime.AsTime(); !got.Equal(tt.want) {
+				t.Errorf("event_time after round trip = %s, want %s", got.Format(time.RFC3339Nano), tt.want.Format(time.RFC3339Nano))
+			}
+		})
+	}
+}
+
+func TestParseServiceEvent_ErrorClass(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		decode     bool
+		validation bool
+	}{
+		{"truncated", `{"event_id":"` + validUUIDv7, true, false},
+		{"unknown field", `{"user_id":"123"}`, true, false},
+		{"missing event_time", `{"event_id":"` + validUUIDv7 + `","service":"s","event_type":"user_signup"}`, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseServiceEvent([]byte(tt.line))
+			var decodeErr *DecodeError
+			var validationErr *ValidationError
+			if got := errors.As(err, &decodeErr); got != tt.decode {
+				t.Errorf("DecodeError = %v, want %v (err %v)", got, tt.decode, err)
+			}
+			if got := errors.As(err, &validationErr); got != tt.validation {
+				t.Errorf("ValidationError = %v, want %v (err %v)", got, tt.validation, err)
+			}
+		})
+	}
+}
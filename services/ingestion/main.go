@@ -1,17 +1,32 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"maps"
+	"math/rand/v2"
+	"mime"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,17 +34,24 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lgreene/gravix-dashboards/pkg/batch"
 	"github.com/lgreene/gravix-dashboards/pkg/storage"
 	"github.com/lgreene/gravix-dashboards/schemas"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
 const maxBodyBytes = 1 << 20 // 1 MB max request body
 
-// writeErrorJSON writes a structured JSON error response.
-func writeErrorJSON(w http.ResponseWriter, code int, errMsg string) {
+// writeError writes an error response: structured JSON by default, or the bare
+// message as text/plain for clients (simple probes) that ask for it.
+func writeError(w http.ResponseWriter, r *http.Request, code int, errMsg string) {
+	if wantsPlainText(r) {
+		http.Error(w, errMsg, code)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -38,6 +60,114 @@ func writeErrorJSON(w http.ResponseWriter, code int, errMsg string) {
 	})
 }
 
+// sinkWriteStatus picks the status for a failed sink write: 503 (with a short
+// Retry-After when the write was shed during a rotation) when the sink refused
+// it but retrying later can succeed, 500 otherwise.
+func sinkWriteStatus(w http.ResponseWriter, err error) int {
+	switch {
+	case errors.Is(err, ErrSinkRotating):
+		w.Header().Set("Retry-After", "1")
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrTooManyActiveFiles), errors.Is(err, ErrSinkClosed):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// wantsPlainText reports whether the Accept header ranks text/plain above
+// application/json. Wildcards are ignored, so JSON stays the default unless
+// text/plain is asked for by name.
+func wantsPlainText(r *http.Request) bool {
+	var textQ, jsonQ float64
+	for _, part := range strings.Split(strings.Join(r.Header.Values("Accept"), ","), ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case "text/plain":
+			textQ = q
+		case "application/json":
+			jsonQ = q
+		}
+	}
+	return textQ > jsonQ
+}
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip, by name
+// or through *, with a non-zero q.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(strings.Join(r.Header.Values("Accept-Encoding"), ","), ",") {
+		coding, params, err := mime.ParseMediaType(part)
+		if err != nil || (coding != "gzip" && coding != "*") {
+			continue
+		}
+		if v, ok := params["q"]; ok {
+			if q, err := strconv.ParseFloat(v, 64); err != nil || q == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter compresses the body once one is written. The status is
+// held back until then, so a response without a body, such as a 201, goes out
+// unencoded.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status int
+	gz     *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if w.gz == nil {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.ResponseWriter.WriteHeader(cmp.Or(w.status, http.StatusOK))
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	return w.gz.Write(p)
+}
+
+// finish flushes the compressed body, or sends the held-back status of an
+// empty response.
+func (w *gzipResponseWriter) finish() {
+	if w.gz != nil {
+		w.gz.Close()
+	} else if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// gzipMiddleware gzips the response body for clients that accept it. Batch
+// responses can list many errors, so they are worth compressing.
+func gzipMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.finish()
+		next(gw, r)
+	}
+}
+
 var (
 	ingestionRequestsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -54,6 +184,14 @@ var (
 		},
 		[]string{"topic"},
 	)
+	ingestionRequestDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "ingestion_request_duration_seconds",
+			Help:    "Time to handle an ingestion request, with the caller's trace ID as an exemplar when sent.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"path"},
+	)
 	ingestionFsyncDurationSeconds = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "ingestion_fsync_duration_seconds",
@@ -62,13 +200,372 @@ var (
 		},
 		[]string{"topic"},
 	)
+	ingestionPersistedRecordsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingestion_persisted_records_total",
+			Help: "Total number of records durably written to the buffer, by topic.",
+		},
+		[]string{"topic"},
+	)
+	ingestionClockSkewSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "ingestion_clock_skew_seconds",
+			Help:    "Distance between a request fact's event_time and the server clock on receipt, by direction (future or past).",
+			Buckets: []float64{1, 10, 60, 300, 900, 3600, 6 * 3600, 24 * 3600, 7 * 24 * 3600},
+		},
+		[]string{"direction"},
+	)
+	ingestionFactsSampledTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingestion_facts_sampled_total",
+			Help: "Request facts seen by the sampler on /api/v1/facts, by decision (kept or dropped).",
+		},
+		[]string{"decision"},
+	)
+	ingestionTailDroppedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ingestion_tail_dropped_total",
+			Help: "Streams on /api/v1/events/tail disconnected for falling too far behind.",
+		},
+	)
+	ingestionWritesShedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingestion_writes_shed_total",
+			Help: "Writes refused with 503 because their buffer partition was still rotating, by topic.",
+		},
+		[]string{"topic"},
+	)
+	ingestionOldestPendingBatchSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ingestion_oldest_pending_batch_seconds",
+			Help: "Age of the oldest rotated buffer file not yet uploaded, by topic; 0 when none is pending. Updated on each rotation.",
+		},
+		[]string{"topic"},
+	)
 )
 
-func init() {
-	prometheus.MustRegister(ingestionRequestsTotal)
-	prometheus.MustRegister(ingestionBatchSizeBytes)
-	prometheus.MustRegister(prometheus.NewBuildInfoCollector())
-	prometheus.MustRegister(ingestionFsyncDurationSeconds)
+// registerMetrics registers the ingestion metrics with reg. main wraps the
+// default registerer so -instance-label is added to every one of them.
+func registerMetrics(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		ingestionRequestsTotal,
+		ingestionBatchSizeBytes,
+		ingestionRequestDurationSeconds,
+		prometheus.NewBuildInfoCollector(),
+		ingestionFsyncDurationSeconds,
+		ingestionPersistedRecordsTotal,
+		ingestionFactsSampledTotal,
+		ingestionClockSkewSeconds,
+		ingestionWritesShedTotal,
+		ingestionTailDroppedTotal,
+		ingestionOldestPendingBatchSeconds,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditTopicPattern keeps -audit-topic a single buffer directory and key segment.
+var auditTopicPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// labelNamePattern is Prometheus's rule for label names.
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseInstanceLabels parses comma-separated name=value pairs, e.g.
+// "region=eu-west-1,cluster=b", into constant labels for the ingestion
+// metrics. An empty list adds no labels.
+func ParseInstanceLabels(list string) (prometheus.Labels, error) {
+	labels := prometheus.Labels{}
+	for _, pair := range strings.Split(list, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid instance label %q (want name=value)", pair)
+		}
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("invalid instance label name %q", name)
+		}
+		if _, dup := labels[name]; dup {
+			return nil, fmt.Errorf("instance label %q given twice", name)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+// HandlerConfig holds the optional behaviours of the ingestion handlers.
+// The zero value accepts and persists everything.
+type HandlerConfig struct {
+	// SampleRate is the fraction of single facts persisted by handleFacts.
+	// Values <= 0 or >= 1 disable sampling.
+	SampleRate float64
+
+	// SchemaOptions enables opt-in validation rules for every fact and event.
+	SchemaOptions []schemas.Option
+
+	// MaxBatchLines caps the number of lines a batch endpoint accepts in one
+	// request; larger batches are rejected before any line is processed.
+	// Zero means no limit.
+	MaxBatchLines int
+
+	// MaxBatchErrors caps the per-line error messages in a batch response;
+	// rejections beyond it are only counted. Zero means defaultMaxBatchErrors.
+	MaxBatchErrors int
+
+	// Redaction scrubs configured service event properties before they are
+	// persisted. The zero value keeps every property.
+	Redaction RedactionPolicy
+
+	// Rejections, if set, keeps the most recent validation failures for
+	// /admin/recent-rejections.
+	Rejections *RejectionLog
+
+	// ClockSkew decides what happens to facts whose event_time is far from
+	// the server clock. The zero value only measures the skew.
+	ClockSkew ClockSkewPolicy
+
+	// Tail, if set, receives every persisted service event for
+	// /api/v1/events/tail.
+	Tail *EventTail
+
+	// NormalizeMethod uppercases each fact's method before it is persisted,
+	// so "get" and "GET" aggregate together. Otherwise methods are kept as sent.
+	NormalizeMethod bool
+
+	// DefaultEventTime is set when SchemaOptions include
+	// schemas.WithDefaultEventTime. Otherwise a client-sent
+	// event_time_defaulted is cleared, as only ingestion may set it.
+	DefaultEventTime bool
+}
+
+// normalize applies the lenient rewrites configured for facts.
+func (c HandlerConfig) normalize(fact *schemas.RequestFact) {
+	if c.NormalizeMethod {
+		fact.Method = strings.ToUpper(fact.Method)
+	}
+	if !c.DefaultEventTime {
+		fact.EventTimeDefaulted = false
+	}
+}
+
+// ClockSkewPolicy handles request facts whose event_time is further than max
+// from the server clock, e.g. from a client with a drifting clock. Every
+// fact's skew is observed in ingestion_clock_skew_seconds whatever the action.
+type ClockSkewPolicy struct {
+	max    time.Duration
+	action string // "accept", "tag" or "reject"
+}
+
+// ParseClockSkewPolicy builds a policy from a -max-clock-skew and a
+// -clock-skew-action of "accept" (only measure), "tag" (set skew_ms on the
+// persisted fact) or "reject" (fail validation with "clock skew").
+func ParseClockSkewPolicy(max time.Duration, action string) (ClockSkewPolicy, error) {
+	switch action {
+	case "accept", "tag", "reject":
+	default:
+		return ClockSkewPolicy{}, fmt.Errorf("invalid clock skew action %q (want accept, tag or reject)", action)
+	}
+	if max <= 0 {
+		return ClockSkewPolicy{}, fmt.Errorf("max clock skew must be positive, got %v", max)
+	}
+	return ClockSkewPolicy{max: max, action: action}, nil
+}
+
+// apply observes the skew of fact received at now and tags it if the policy
+// says so. It returns an error if the fact must be rejected.
+func (p ClockSkewPolicy) apply(fact *schemas.RequestFact, now time.Time) error {
+	fact.SkewMs = 0 // Only ingestion sets skew_ms
+	skew := fact.EventTime.AsTime().Sub(now)
+	if skew >= 0 {
+		ingestionClockSkewSeconds.WithLabelValues("future").Observe(skew.Seconds())
+	} else {
+		ingestionClockSkewSeconds.WithLabelValues("past").Observe(-skew.Seconds())
+	}
+	if p.max <= 0 || (skew <= p.max && skew >= -p.max) {
+		return nil
+	}
+	switch p.action {
+	case "tag":
+		fact.SkewMs = skew.Milliseconds()
+	case "reject":
+		return fmt.Errorf("clock skew: event_time is %v from server time (max %v)", skew.Round(time.Millisecond), p.max)
+	}
+	return nil
+}
+
+// RedactionPolicy lists service event property keys that must not reach
+// durable storage in the clear. Matching is case-insensitive.
+type RedactionPolicy struct {
+	keys map[string]struct{}
+	drop bool // remove matching properties instead of hashing their values
+}
+
+// ParseRedactionPolicy builds a policy from a comma-separated key list and a
+// mode of "hash" (replace the value with its hex SHA-256) or "drop".
+func ParseRedactionPolicy(keys, mode string) (RedactionPolicy, error) {
+	var p RedactionPolicy
+	switch mode {
+	case "hash":
+	case "drop":
+		p.drop = true
+	default:
+		return RedactionPolicy{}, fmt.Errorf("invalid redaction mode %q (want hash or drop)", mode)
+	}
+	for _, k := range strings.Split(keys, ",") {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			if p.keys == nil {
+				p.keys = make(map[string]struct{})
+			}
+			p.keys[k] = struct{}{}
+		}
+	}
+	return p, nil
+}
+
+// apply redacts matching properties in place.
+func (p RedactionPolicy) apply(props map[string]string) {
+	if len(p.keys) == 0 {
+		return
+	}
+	for k, v := range props {
+		if _, ok := p.keys[strings.ToLower(k)]; !ok {
+			continue
+		}
+		if p.drop {
+			delete(props, k)
+			continue
+		}
+		sum := sha256.Sum256([]byte(v))
+		props[k] = hex.EncodeToString(sum[:])
+	}
+}
+
+// LoadPropertyAllowList reads a JSON object mapping event_type to the property
+// keys its service events may carry, e.g. {"deploy_started": ["version"]},
+// for schemas.WithPropertyAllowList.
+func LoadPropertyAllowList(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var allow map[string][]string
+	if err := json.Unmarshal(data, &allow); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for eventType, keys := range allow {
+		if keys == nil {
+			return nil, fmt.Errorf("%s: event_type %q has no key list (use [] to allow no properties)", path, eventType)
+		}
+	}
+	return allow, nil
+}
+
+// maxRejectedPayloadBytes bounds how much of each rejected payload is kept.
+const maxRejectedPayloadBytes = 4096
+
+// Rejection is one payload that failed validation.
+type Rejection struct {
+	Time      time.Time `json:"time"`
+	Path      string    `json:"path"`
+	Error     string    `json:"error"`
+	Payload   string    `json:"payload"`
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// RejectionLog is a fixed-size ring buffer of recent rejections. It lives
+// only in memory and is meant for debugging clients, not as a dead-letter
+// queue. A nil *RejectionLog records nothing.
+type RejectionLog struct {
+	mu      sync.Mutex
+	entries []Rejection
+	next    int
+	full    bool
+}
+
+// NewRejectionLog keeps the last size rejections.
+func NewRejectionLog(size int) *RejectionLog {
+	return &RejectionLog{entries: make([]Rejection, size)}
+}
+
+// record stores a rejection, overwriting the oldest once the log is full.
+func (l *RejectionLog) record(path string, payload []byte, err error) {
+	if l == nil || len(l.entries) == 0 {
+		return
+	}
+	r := Rejection{Time: time.Now().UTC(), Path: path, Error: err.Error()}
+	if len(payload) > maxRejectedPayloadBytes {
+		payload = payload[:maxRejectedPayloadBytes]
+		r.Truncated = true
+	}
+	r.Payload = string(payload)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = r
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Recent returns the stored rejections, newest first.
+func (l *RejectionLog) Recent() []Rejection {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+	out := make([]Rejection, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return out
+}
+
+// handleRecentRejections serves the rejection log as JSON.
+func handleRecentRejections(l *RejectionLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, r, http.StatusMethodNotAllowed, "only GET is accepted")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"capacity":   len(l.entries),
+			"rejections": l.Recent(),
+		})
+	}
+}
+
+// defaultMaxBatchErrors is the number of error messages a batch response
+// lists when HandlerConfig.MaxBatchErrors is not set.
+const defaultMaxBatchErrors = 100
+
+// maxBatchErrors returns the configured error message cap, or the default.
+func (c HandlerConfig) maxBatchErrors() int {
+	if c.MaxBatchErrors <= 0 {
+		return defaultMaxBatchErrors
+	}
+	return c.MaxBatchErrors
+}
+
+// sampledOut reports whether a fact should be dropped by the sampler.
+func (c HandlerConfig) sampledOut() bool {
+	if c.SampleRate <= 0 || c.SampleRate >= 1 {
+		return false
+	}
+	if rand.Float64() < c.SampleRate {
+		ingestionFactsSampledTotal.WithLabelValues("kept").Inc()
+		return false
+	}
+	ingestionFactsSampledTotal.WithLabelValues("dropped").Inc()
+	return true
 }
 
 // RateLimiter implements a simple token-bucket rate limiter.
@@ -115,150 +612,853 @@ func (rl *RateLimiter) Allow() bool {
 	}
 }
 
+// RateLimit is the rate (requests per second) and burst of one endpoint's
+// token bucket.
+type RateLimit struct {
+	Rate, Burst int64
+}
+
+// endpointLimiters builds a limiter for each rate-limited path, so a burst on
+// one endpoint can't use up the tokens of another. The batch endpoints share
+// the batch limits, and the events tail the events limits, but each path
+// still gets its own bucket.
+func endpointLimiters(facts, batch, events RateLimit) map[string]*RateLimiter {
+	return map[string]*RateLimiter{
+		"/api/v1/facts":        NewRateLimiter(facts.Rate, facts.Burst),
+		"/api/v1/facts/batch":  NewRateLimiter(batch.Rate, batch.Burst),
+		"/api/v1/ingest/batch": NewRateLimiter(batch.Rate, batch.Burst),
+		"/api/v1/events/batch": NewRateLimiter(batch.Rate, batch.Burst),
+		"/api/v1/events":       NewRateLimiter(events.Rate, events.Burst),
+		"/api/v1/events/tail":  NewRateLimiter(events.Rate, events.Burst),
+	}
+}
+
 func rateLimitMiddleware(rl *RateLimiter, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !rl.Allow() {
-			writeErrorJSON(w, http.StatusTooManyRequests, "rate limit exceeded, try again later")
+			writeError(w, r, http.StatusTooManyRequests, "rate limit exceeded, try again later")
 			return
 		}
 		next(w, r)
 	}
 }
 
-// DurableSink provides fsync-backed appends and async background uploads.
-type DurableSink struct {
-	bufferDir string              // e.g. /tmp/buffer/
-	store     storage.ObjectStore // The abstracted storage (Local or S3)
+// tailBufferSize is how many events a /api/v1/events/tail stream may fall
+// behind before it is dropped.
+const tailBufferSize = 256
 
-	activeFiles map[string]*os.File
+// tailKeepAlive is how often an idle tail stream gets an SSE comment, so
+// proxies in between don't close it.
+const tailKeepAlive = 15 * time.Second
+
+// tailSubscriber is one /api/v1/events/tail stream.
+type tailSubscriber struct {
+	events   chan []byte
+	services []string // service prefixes of the subscriber's API key; nil for any
+}
+
+// EventTail fans accepted service events out to /api/v1/events/tail streams.
+// Publishing never blocks a write: a stream whose buffer is full is dropped
+// and counted in ingestion_tail_dropped_total. A nil *EventTail publishes
+// nothing.
+type EventTail struct {
 	mu          sync.Mutex
+	subscribers map[*tailSubscriber]struct{}
+	max         int
+	closed      bool
+}
 
-	ctx    context.Context
-	cancel context.CancelFunc
+// NewEventTail allows up to maxSubscribers concurrent streams.
+func NewEventTail(maxSubscribers int) *EventTail {
+	return &EventTail{subscribers: make(map[*tailSubscriber]struct{}), max: maxSubscribers}
 }
 
-func NewDurableSink(bufferDir string, store storage.ObjectStore) (*DurableSink, error) {
-	if err := os.MkdirAll(bufferDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create buffer dir: %w", err)
+// subscribe registers a stream for events of the given services, or reports
+// false if the limit is reached or the tail is closed.
+func (t *EventTail) subscribe(services []string) (*tailSubscriber, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed || len(t.subscribers) >= t.max {
+		return nil, false
 	}
+	s := &tailSubscriber{events: make(chan []byte, tailBufferSize), services: services}
+	t.subscribers[s] = struct{}{}
+	return s, true
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	ds := &DurableSink{
-		bufferDir:   bufferDir,
-		store:       store,
-		activeFiles: make(map[string]*os.File),
-		ctx:         ctx,
-		cancel:      cancel,
+// unsubscribe removes s, closing its channel unless that already happened.
+func (t *EventTail) unsubscribe(s *tailSubscriber) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.subscribers[s]; ok {
+		delete(t.subscribers, s)
+		close(s.events)
 	}
+}
 
-	// Startup: Check for any previously rotated but not uploaded files
-	go ds.startupScan()
-
-	// Background: File Rotation & Upload Loop
-	go ds.backgroundRotationLoop()
-
-	return ds, nil
+// publish offers an accepted event to every stream allowed to see service.
+func (t *EventTail) publish(service string, data []byte) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for s := range t.subscribers {
+		if !serviceAllowed(s.services, service) {
+			continue
+		}
+		select {
+		case s.events <- data:
+		default:
+			delete(t.subscribers, s)
+			close(s.events)
+			ingestionTailDroppedTotal.Inc()
+		}
+	}
 }
 
-// Write appends data to the active buffer file and fsyncs.
-// Topic is used as directory/prefix.
-func (ds *DurableSink) Write(topic string, data []byte) error {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
+// Close ends every stream and refuses new ones, so open streams don't hold
+// up a graceful shutdown.
+func (t *EventTail) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	for s := range t.subscribers {
+		delete(t.subscribers, s)
+		close(s.events)
+	}
+}
 
-	f, ok := ds.activeFiles[topic]
-	if !ok {
-		// Ensure topic dir exists in buffer
-		topicDir := filepath.Join(ds.bufferDir, topic)
-		if err := os.MkdirAll(topicDir, 0755); err != nil {
-			return fmt.Errorf("failed to create topic buffer dir: %w", err)
+// handleEventsTail streams accepted service events as Server-Sent Events, one
+// "data:" line of event JSON each, as persisted (after redaction). A key bound
+// to service prefixes only sees those services' events.
+func handleEventsTail(tail *EventTail) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, r, http.StatusMethodNotAllowed, "only GET is accepted")
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, r, http.StatusInternalServerError, "streaming is not supported")
+			return
 		}
+		services, _ := r.Context().Value(allowedServicesKey{}).([]string)
+		sub, ok := tail.subscribe(services)
+		if !ok {
+			writeError(w, r, http.StatusServiceUnavailable, "too many tail streams open")
+			return
+		}
+		defer tail.unsubscribe(sub)
 
-		// Open current.jsonl in append mode
-		path := filepath.Join(topicDir, "current.jsonl")
-		var err error
-		f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return fmt.Errorf("failed to open buffer file %s: %w", path, err)
+		// The stream outlives the server's WriteTimeout; ignored where unsupported
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(tailKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case data, ok := <-sub.events:
+				if !ok {
+					// Dropped for falling behind, or the server is shutting down
+					fmt.Fprint(w, ": closed\n\n")
+					flusher.Flush()
+					return
+				}
+				fmt.Fprintf(w, "data: %s\n\n", data)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+			}
+			flusher.Flush()
 		}
-		ds.activeFiles[topic] = f
 	}
+}
 
-	// Append Data + Newline
-	if _, err := f.Write(data); err != nil {
-		return fmt.Errorf("write error: %w", err)
+// AuditRecord is one call to an /admin endpoint.
+type AuditRecord struct {
+	EventTime time.Time `json:"event_time"`
+	Action    string    `json:"action"`
+	Method    string    `json:"method"`
+	ClientIP  string    `json:"client_ip"`
+	KeyIndex  int       `json:"key_index"` // position of the caller's API key in the configured list; -1 if none matched or auth is disabled
+	Status    int       `json:"status"`
+	Outcome   string    `json:"outcome"` // success, denied (401/403) or failed
+}
+
+// AuditLog records every /admin call in the service log and, when topic is
+// set, also writes it to the sink, so the trail is uploaded with the raw data
+// and outlives the process.
+type AuditLog struct {
+	sink  *DurableSink
+	topic string
+	now   func() time.Time
+}
+
+// NewAuditLog writes audit records to topic on sink. An empty topic only logs them.
+func NewAuditLog(sink *DurableSink, topic string) *AuditLog {
+	return &AuditLog{sink: sink, topic: topic, now: time.Now}
+}
+
+func (a *AuditLog) record(rec AuditRecord) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("Failed to encode audit record for %s: %v", rec.Action, err)
+		return
 	}
-	if _, err := f.Write([]byte("\n")); err != nil {
-		return fmt.Errorf("newline write error: %w", err)
+	log.Printf("Audit: %s", data)
+	if a.topic == "" {
+		return
 	}
-
-	// CRITICAL: Fsync for Durability
-	syncStart := time.Now()
-	if err := f.Sync(); err != nil {
-		return fmt.Errorf("fsync error: %w", err)
+	if err := a.sink.Write(a.topic, data); err != nil {
+		log.Printf("Failed to write audit record to %s: %v", a.topic, err)
 	}
-	ingestionFsyncDurationSeconds.WithLabelValues(topic).Observe(time.Since(syncStart).Seconds())
+}
 
-	return nil
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
 }
 
-func (ds *DurableSink) Close() error {
-	ds.cancel()
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
-	for _, f := range ds.activeFiles {
-		f.Close()
-	}
-	return nil
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
 }
 
-// backgroundRotationLoop runs every minute to rotate active files
-func (ds *DurableSink) backgroundRotationLoop() {
-	ticker := time.NewTicker(60 * time.Second)
-	defer ticker.Stop()
+// auditMiddleware records an AuditRecord for every call to next. It wraps
+// authMiddleware, so calls rejected for a bad key are recorded too.
+func auditMiddleware(action string, audit *AuditLog, keys *APIKeys, proxies TrustedProxies, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
 
-	for {
-		select {
-		case <-ds.ctx.Done():
-			return
-		case <-ticker.C:
-			ds.rotateAll()
+		keyIndex := -1
+		if keys.Enabled() {
+			keyIndex, _, _ = keys.Lookup(r.Header.Get("X-API-Key"))
 		}
+		outcome := "success"
+		switch {
+		case rec.status == http.StatusUnauthorized || rec.status == http.StatusForbidden:
+			outcome = "denied"
+		case rec.status >= 400:
+			outcome = "failed"
+		}
+		audit.record(AuditRecord{
+			EventTime: audit.now().UTC(),
+			Action:    action,
+			Method:    r.Method,
+			ClientIP:  proxies.clientIP(r),
+			KeyIndex:  keyIndex,
+			Status:    rec.status,
+			Outcome:   outcome,
+		})
 	}
 }
 
-// rotateAll closes current files, renames them, and triggers upload
+// durationMiddleware records how long next takes. When the caller sends a W3C
+// traceparent header, its trace ID is attached as an exemplar so a latency
+// spike in Grafana links to the caller's trace. Gravix itself collects no spans.
+func durationMiddleware(path string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next(w, r)
+		elapsed := time.Since(start).Seconds()
+
+		obs := ingestionRequestDurationSeconds.WithLabelValues(path)
+		if traceID, ok := traceIDFromRequest(r); ok {
+			obs.(prometheus.ExemplarObserver).ObserveWithExemplar(elapsed, prometheus.Labels{"trace_id": traceID})
+			return
+		}
+		obs.Observe(elapsed)
+	}
+}
+
+// traceIDFromRequest extracts the trace ID from a W3C traceparent header
+// ("00-<32 hex trace id>-<16 hex parent id>-<2 hex flags>").
+func traceIDFromRequest(r *http.Request) (string, bool) {
+	parts := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 {
+		return "", false
+	}
+	traceID := parts[1]
+	if _, err := hex.DecodeString(traceID); err != nil || traceID != strings.ToLower(traceID) || traceID == strings.Repeat("0", 32) {
+		return "", false
+	}
+	return traceID, true
+}
+
+// DurableSink provides fsync-backed appends and async background uploads.
+type DurableSink struct {
+	bufferDir string              // e.g. /tmp/buffer/
+	store     storage.ObjectStore // The abstracted storage (Local or S3)
+
+	// activeFiles is keyed by buffer partition: the topic, or <topic>/<event-day>
+	// when partitioning by event day.
+	activeFiles map[string]*os.File
+	activeBytes map[string]int64 // size of each active file, for maxBatchBytes
+	mu          sync.Mutex
+	closed      bool // set by Close; Write refuses records after it
+
+	// rotating holds a channel per partition that is being renamed for upload,
+	// closed when the rotation finishes. Writes to it wait up to rotationWait.
+	rotating     map[string]chan struct{}
+	rotationWait time.Duration
+	after        func(time.Duration) <-chan time.Time
+
+	partitionByEventDay bool
+	batchFooter         bool
+
+	dirMode  os.FileMode // buffer directories (default 0755)
+	fileMode os.FileMode // buffer files (default 0644)
+
+	maxActiveFiles int   // cap on len(activeFiles); 0 means unlimited
+	maxBatchBytes  int64 // rotate a partition once its file reaches this size; 0 means only on the timer
+
+	rotationInterval time.Duration // time between rotations (default 60s)
+	rotationJitter   time.Duration // each cycle waits rotationInterval ± up to this much
+
+	usePendingIndex bool
+	index           *pendingIndex // nil unless usePendingIndex
+
+	startupUploads    int           // concurrent uploads in startupScan (default 4)
+	startupUploadPace time.Duration // pause after each startupScan upload
+
+	uploads      sync.WaitGroup // uploads started by rotateTopic
+	closeTimeout time.Duration  // how long Close waits for its final uploads (default 10s)
+
+	stopLoop     chan struct{} // closed to stop backgroundRotationLoop
+	stopLoopOnce sync.Once
+	loopDone     chan struct{} // closed when backgroundRotationLoop returns
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// SinkOption configures optional DurableSink behaviour.
+type SinkOption func(*DurableSink)
+
+// WithEventDayPartitioning buffers each record under <topic>/<YYYY-MM-DD>/ by
+// its event_time, so rotation uploads it under the event's day rather than the
+// upload day. This costs a JSON decode of every record on the write path.
+func WithEventDayPartitioning() SinkOption {
+	return func(ds *DurableSink) {
+		ds.partitionByEventDay = true
+	}
+}
+
+// WithBatchFooter appends a {"__meta":"batch_footer",...} line with the record
+// count and SHA-256 to every rotated batch so the rollups can detect truncation.
+func WithBatchFooter() SinkOption {
+	return func(ds *DurableSink) {
+		ds.batchFooter = true
+	}
+}
+
+// WithPermissions sets the modes of the buffer directories and files the sink
+// creates. They are applied with chmod after creation, so the process umask
+// can't narrow or widen them.
+func WithPermissions(dirMode, fileMode os.FileMode) SinkOption {
+	return func(ds *DurableSink) {
+		ds.dirMode = dirMode.Perm()
+		ds.fileMode = fileMode.Perm()
+	}
+}
+
+// ParseFileMode parses an octal permission mode such as 0750 for
+// -buffer-dir-mode and -buffer-file-mode.
+func ParseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(strings.TrimPrefix(s, "0o"), 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("want an octal mode between 0000 and 0777, got %q", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// mkdirAll creates dir and any missing parents like os.MkdirAll, then chmods
+// each directory it created to mode. Existing directories are left alone.
+func mkdirAll(dir string, mode os.FileMode) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	for _, d := range missing {
+		if err := os.Chmod(d, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithMaxActiveFiles caps how many buffer files (one per topic, or per
+// <topic>/<event-day>) the sink keeps open between rotations. A Write that
+// would open one more fails with ErrTooManyActiveFiles. 0 means no cap.
+func WithMaxActiveFiles(n int) SinkOption {
+	return func(ds *DurableSink) {
+		ds.maxActiveFiles = max(n, 0)
+	}
+}
+
+// WithMaxBatchBytes rotates a partition as soon as a write takes its buffer
+// file to n bytes, without waiting for the timer, so a busy topic doesn't
+// build a huge batch. n <= 0 leaves rotation to the timer alone.
+func WithMaxBatchBytes(n int64) SinkOption {
+	return func(ds *DurableSink) {
+		ds.maxBatchBytes = max(n, 0)
+	}
+}
+
+// WithPendingIndex keeps an append-only index of rotated batches awaiting
+// upload in the buffer root, so startupScan reads it instead of walking the
+// whole buffer. The walk is still used when the index is missing or corrupt.
+func WithPendingIndex() SinkOption {
+	return func(ds *DurableSink) {
+		ds.usePendingIndex = true
+	}
+}
+
+// WithStartupUploads bounds how many leftover batches startupScan uploads at
+// once, and so how many it has open, and pauses each upload slot for pace
+// after every upload so a large backlog doesn't flood the object store.
+func WithStartupUploads(concurrency int, pace time.Duration) SinkOption {
+	return func(ds *DurableSink) {
+		ds.startupUploads = max(concurrency, 1)
+		ds.startupUploadPace = max(pace, 0)
+	}
+}
+
+// WithRotation sets the time between background rotations and a per-cycle
+// jitter, so a fleet of sinks doesn't upload in lockstep. jitter is capped
+// below interval.
+func WithRotation(interval, jitter time.Duration) SinkOption {
+	return func(ds *DurableSink) {
+		if interval <= 0 {
+			return
+		}
+		ds.rotationInterval = interval
+		ds.rotationJitter = min(jitter, interval-1)
+	}
+}
+
+// WithCloseTimeout bounds how long Close waits for the uploads of its final
+// rotation, so shutdown can't hang on an unreachable store.
+func WithCloseTimeout(d time.Duration) SinkOption {
+	return func(ds *DurableSink) {
+		if d > 0 {
+			ds.closeTimeout = d
+		}
+	}
+}
+
+func NewDurableSink(bufferDir string, store storage.ObjectStore, opts ...SinkOption) (*DurableSink, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ds := &DurableSink{
+		bufferDir:   bufferDir,
+		store:       store,
+		activeFiles: make(map[string]*os.File),
+		activeBytes: make(map[string]int64),
+		rotating:    make(map[string]chan struct{}),
+		stopLoop:    make(chan struct{}),
+		loopDone:    make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+
+		rotationInterval: 60 * time.Second,
+		rotationWait:     defaultRotationWait,
+		after:            time.After,
+
+		startupUploads: defaultStartupUploads,
+		closeTimeout:   defaultCloseTimeout,
+		maxBatchBytes:  defaultMaxBatchBytes,
+
+		dirMode:  0755,
+		fileMode: 0644,
+	}
+	for _, opt := range opts {
+		opt(ds)
+	}
+
+	if err := mkdirAll(bufferDir, ds.dirMode); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create buffer dir: %w", err)
+	}
+
+	indexPath := filepath.Join(bufferDir, pendingIndexName)
+	if ds.usePendingIndex {
+		idx, err := openPendingIndex(bufferDir, ds.fileMode)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to open pending index: %w", err)
+		}
+		ds.index = idx
+	} else if err := os.Remove(indexPath); err == nil {
+		// Batches rotated from now on won't be listed, so a later run with the
+		// index must fall back to a full walk rather than trust this one
+		log.Printf("Removed stale pending index %s", indexPath)
+	}
+
+	// Startup: Check for any previously rotated but not uploaded files
+	go ds.startupScan()
+
+	// Background: File Rotation & Upload Loop
+	go ds.backgroundRotationLoop()
+
+	return ds, nil
+}
+
+// defaultStartupUploads is how many leftover batches startupScan uploads at
+// once unless set with WithStartupUploads.
+const defaultStartupUploads = 4
+
+// defaultMaxBatchBytes is the buffer file size that triggers a rotation unless
+// set with WithMaxBatchBytes.
+const defaultMaxBatchBytes = 32 << 20
+
+// defaultCloseTimeout is how long Close waits for its final uploads unless
+// set with WithCloseTimeout.
+const defaultCloseTimeout = 10 * time.Second
+
+// defaultRotationWait bounds how long a write waits for its partition to
+// finish rotating before it is refused with ErrSinkRotating.
+const defaultRotationWait = time.Second
+
+// ErrSinkRotating is returned by Write when the record's partition was still
+// being rotated after rotationWait. Nothing was written, so it is safe to retry.
+var ErrSinkRotating = errors.New("buffer partition is rotating")
+
+// ErrTooManyActiveFiles is returned by Write when the record needs a new
+// buffer file and the sink already has maxActiveFiles open. Nothing was
+// written; files are released at the next rotation.
+var ErrTooManyActiveFiles = errors.New("too many active buffer files")
+
+// ErrSinkClosed is returned by Write once Close has started. Nothing was
+// written.
+var ErrSinkClosed = errors.New("sink is closed")
+
+// Write appends data to the active buffer file and fsyncs.
+// Topic is used as directory/prefix.
+func (ds *DurableSink) Write(topic string, data []byte) error {
+	partition := topic
+	if ds.partitionByEventDay {
+		// Records without a parseable event_time fall back to the unpartitioned topic dir
+		if day, ok := eventDay(data); ok {
+			partition = filepath.Join(topic, day)
+		}
+	}
+
+	// Raw batches are newline-framed and read as JSON lines by the rollups and
+	// Trino. protojson escapes newlines inside strings, so this only trips if a
+	// caller ever hands in multi-line JSON; refuse it rather than split a record.
+	if bytes.IndexByte(data, '\n') >= 0 {
+		return fmt.Errorf("record for %s contains a newline", topic)
+	}
+
+	var timeout <-chan time.Time
+	ds.mu.Lock()
+	for {
+		done, ok := ds.rotating[partition]
+		if !ok {
+			break
+		}
+		ds.mu.Unlock()
+		if timeout == nil {
+			timeout = ds.after(ds.rotationWait)
+		}
+		select {
+		case <-done:
+		case <-timeout:
+			ingestionWritesShedTotal.WithLabelValues(topic).Inc()
+			return fmt.Errorf("%w: %s", ErrSinkRotating, partition)
+		}
+		ds.mu.Lock()
+	}
+	defer ds.mu.Unlock()
+
+	// Checked under mu, so a write either lands before Close's rotateAll or is
+	// refused, and never opens a file or starts an upload Close won't wait for
+	if ds.closed {
+		return ErrSinkClosed
+	}
+
+	f, ok := ds.activeFiles[partition]
+	if !ok {
+		if ds.maxActiveFiles > 0 && len(ds.activeFiles) >= ds.maxActiveFiles {
+			return fmt.Errorf("%w (%d open): %s", ErrTooManyActiveFiles, len(ds.activeFiles), partition)
+		}
+
+		// Ensure partition dir exists in buffer
+		partitionDir := filepath.Join(ds.bufferDir, partition)
+		if err := mkdirAll(partitionDir, ds.dirMode); err != nil {
+			return fmt.Errorf("failed to create topic buffer dir: %w", err)
+		}
+
+		// Open current.jsonl in append mode
+		path := filepath.Join(partitionDir, "current.jsonl")
+		var err error
+		f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, ds.fileMode)
+		if err != nil {
+			return fmt.Errorf("failed to open buffer file %s: %w", path, err)
+		}
+		if err := f.Chmod(ds.fileMode); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to set mode of buffer file %s: %w", path, err)
+		}
+		// A file left over from before a restart already counts towards the limit
+		var size int64
+		if info, err := f.Stat(); err == nil {
+			size = info.Size()
+		}
+		ds.activeFiles[partition] = f
+		ds.activeBytes[partition] = size
+	}
+
+	// Append Data + Newline
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("write error: %w", err)
+	}
+	if _, err := f.Write([]byte("\n")); err != nil {
+		return fmt.Errorf("newline write error: %w", err)
+	}
+
+	// CRITICAL: Fsync for Durability
+	syncStart := time.Now()
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("fsync error: %w", err)
+	}
+	ingestionFsyncDurationSeconds.WithLabelValues(topic).Observe(time.Since(syncStart).Seconds())
+	ingestionPersistedRecordsTotal.WithLabelValues(topic).Inc()
+
+	ds.activeBytes[partition] += int64(len(data)) + 1
+	if ds.maxBatchBytes > 0 && ds.activeBytes[partition] >= ds.maxBatchBytes {
+		// Detach now, so later writes start a new file, but leave the footer
+		// and rename to a goroutine rather than this request
+		done, _ := ds.detachLocked(partition)
+		ds.uploads.Add(1)
+		go func() {
+			defer ds.uploads.Done()
+			ds.finishRotation(partition, done)
+		}()
+	}
+	return nil
+}
+
+// Close rotates every active file and waits up to closeTimeout for the
+// uploads, so the last partial batches reach the store before shutdown. An
+// upload still running then is cancelled; its batch stays in the buffer for
+// the next startup scan.
+func (ds *DurableSink) Close() error {
+	// Stop the timer's rotations first, so no upload starts while we wait
+	ds.stopLoopOnce.Do(func() { close(ds.stopLoop) })
+	<-ds.loopDone
+
+	ds.mu.Lock()
+	ds.closed = true
+	ds.mu.Unlock()
+	ds.rotateAll()
+	done := make(chan struct{})
+	go func() {
+		ds.uploads.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(ds.closeTimeout):
+		log.Printf("Uploads still running after %v; leaving their batches for the next startup", ds.closeTimeout)
+	}
+
+	ds.cancel()
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for _, f := range ds.activeFiles {
+		f.Close()
+	}
+	return nil
+}
+
+// backgroundRotationLoop rotates active files every rotationInterval. The
+// first rotation happens at a random point within the interval, so sinks
+// started together (e.g. a rolling deploy) spread their uploads out.
+func (ds *DurableSink) backgroundRotationLoop() {
+	defer close(ds.loopDone)
+	timer := time.NewTimer(ds.rotationDelay(true))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ds.stopLoop:
+			return
+		case <-ds.ctx.Done():
+			return
+		case <-timer.C:
+			ds.rotateAll()
+			ds.updatePendingAges()
+			timer.Reset(ds.rotationDelay(false))
+		}
+	}
+}
+
+// rotationDelay returns the wait before the next rotation: a uniform offset in
+// [0, interval) for the first one, then interval ± rotationJitter.
+func (ds *DurableSink) rotationDelay(first bool) time.Duration {
+	if first {
+		return rand.N(ds.rotationInterval)
+	}
+	if ds.rotationJitter <= 0 {
+		return ds.rotationInterval
+	}
+	return ds.rotationInterval - ds.rotationJitter + rand.N(2*ds.rotationJitter+1)
+}
+
+// rotateAll closes current files, renames them, and triggers upload
 func (ds *DurableSink) rotateAll() {
 	ds.mu.Lock()
 	// Copy topic list to avoid holding lock during upload if possible,
 	// but we need to rotate safely.
-	topics := make([]string, 0, len(ds.activeFiles))
-	for t := range ds.activeFiles {
-		topics = append(topics, t)
+	partitions := make([]string, 0, len(ds.activeFiles))
+	for p := range ds.activeFiles {
+		partitions = append(partitions, p)
 	}
 	ds.mu.Unlock()
 
+	for _, partition := range partitions {
+		ds.rotateTopic(partition)
+	}
+}
+
+// maxPendingScan bounds the buffer entries one updatePendingAges pass looks
+// at, so a buffer that has piled up files can't make it expensive.
+const maxPendingScan = 10000
+
+// updatePendingAges sets ingestion_oldest_pending_batch_seconds for every
+// topic in the buffer from the modification time of its rotated batch files.
+// It only reads the topic directories and, with event-day partitioning, the
+// day directories below them.
+func (ds *DurableSink) updatePendingAges() {
+	topics, err := os.ReadDir(ds.bufferDir)
+	if err != nil {
+		log.Printf("Error scanning buffer for pending batches: %v", err)
+		return
+	}
+	now := time.Now()
+	scanned := 0
 	for _, topic := range topics {
-		ds.rotateTopic(topic)
+		if !topic.IsDir() {
+			continue
+		}
+		topicDir := filepath.Join(ds.bufferDir, topic.Name())
+		oldest, days := oldestBatch(topicDir, &scanned)
+		for _, day := range days {
+			if t, _ := oldestBatch(filepath.Join(topicDir, day), &scanned); !t.IsZero() && (oldest.IsZero() || t.Before(oldest)) {
+				oldest = t
+			}
+		}
+		age := 0.0
+		if !oldest.IsZero() {
+			age = now.Sub(oldest).Seconds()
+		}
+		ingestionOldestPendingBatchSeconds.WithLabelValues(topic.Name()).Set(age)
 	}
+	if scanned > maxPendingScan {
+		log.Printf("WARNING: buffer holds more than %d entries; pending batch ages only cover the first %d", maxPendingScan, maxPendingScan)
+	}
+}
+
+// oldestBatch returns the modification time of the oldest rotated batch file
+// in dir (zero if there is none) and the names of the event-day directories
+// in it. Entries read count against *scanned, and nothing more is read once it
+// passes maxPendingScan.
+func oldestBatch(dir string, scanned *int) (time.Time, []string) {
+	var oldest time.Time
+	var days []string
+	if *scanned > maxPendingScan {
+		return oldest, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return oldest, nil
+	}
+	for _, e := range entries {
+		if *scanned++; *scanned > maxPendingScan {
+			break
+		}
+		if e.IsDir() {
+			if isDay(e.Name()) {
+				days = append(days, e.Name())
+			}
+			continue
+		}
+		if !strings.HasPrefix(e.Name(), "batch_") {
+			continue // current.jsonl is still being written
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // uploaded since ReadDir
+		}
+		if oldest.IsZero() || info.ModTime().Before(oldest) {
+			oldest = info.ModTime()
+		}
+	}
+	return oldest, days
 }
 
-// rotateTopic performs safe rotation
-func (ds *DurableSink) rotateTopic(topic string) {
+// rotateTopic performs safe rotation of a buffer partition (a topic, or <topic>/<event-day>).
+// The footer and rename run outside ds.mu, with the partition marked as
+// rotating so writes to other partitions aren't held up behind them.
+func (ds *DurableSink) rotateTopic(partition string) {
 	ds.mu.Lock()
-	defer ds.mu.Unlock()
+	done, ok := ds.detachLocked(partition)
+	ds.mu.Unlock()
+	if ok {
+		ds.finishRotation(partition, done)
+	}
+}
 
-	f, ok := ds.activeFiles[topic]
+// detachLocked closes the partition's active file and marks the partition as
+// rotating, returning the channel to close once finishRotation is done. It
+// reports false if the partition has no active file. ds.mu must be held.
+func (ds *DurableSink) detachLocked(partition string) (chan struct{}, bool) {
+	f, ok := ds.activeFiles[partition]
 	if !ok {
-		return
+		return nil, false
 	}
 
 	// 1. Close current
 	f.Close()
-	delete(ds.activeFiles, topic)
+	delete(ds.activeFiles, partition)
+	delete(ds.activeBytes, partition)
+	done := make(chan struct{})
+	ds.rotating[partition] = done
+	return done, true
+}
+
+// finishRotation renames a detached current.jsonl to a batch and starts its
+// upload, then lets writes to the partition continue.
+func (ds *DurableSink) finishRotation(partition string, done chan struct{}) {
+	defer func() {
+		ds.mu.Lock()
+		delete(ds.rotating, partition)
+		ds.mu.Unlock()
+		close(done)
+	}()
 
 	// 2. Rename to batch_<ts>_<uuid>.jsonl
-	topicDir := filepath.Join(ds.bufferDir, topic)
+	topicDir := filepath.Join(ds.bufferDir, partition)
 	currentPath := filepath.Join(topicDir, "current.jsonl")
 
 	// Check if file has data (size > 0)
@@ -267,18 +1467,109 @@ func (ds *DurableSink) rotateTopic(topic string) {
 		return // Empty file, skip rotation
 	}
 
+	if ds.batchFooter {
+		if err := appendBatchFooter(currentPath); err != nil {
+			// Still rotate: the batch is intact, it just can't be verified downstream
+			log.Printf("Error appending batch footer to %s: %v", currentPath, err)
+		}
+	}
+
 	timestamp := time.Now().UTC().Format("20060102150405")
 	fileID := uuid.New().String()
 	batchName := fmt.Sprintf("batch_%s_%s.jsonl", timestamp, fileID)
 	batchPath := filepath.Join(topicDir, batchName)
 
+	// List the batch before it exists, so a crash can't leave an unlisted one.
+	// current.jsonl is left in place and rotated next time if this fails.
+	if err := ds.index.add(batchPath); err != nil {
+		log.Printf("Error adding %s to pending index: %v", batchPath, err)
+		return
+	}
+
 	if err := os.Rename(currentPath, batchPath); err != nil {
 		log.Printf("Error rotating file %s: %v", currentPath, err)
 		return
 	}
 
-	// 3. Trigger Upload (Async from the lock, but we call it here for MVP simplicity)
-	go ds.uploadFile(topic, batchPath, time.Now().UTC())
+	// 3. Trigger Upload
+	topic, day := splitPartition(partition)
+	ds.uploads.Add(1)
+	go func() {
+		defer ds.uploads.Done()
+		ds.uploadFile(topic, batchPath, partitionTime(day, time.Now().UTC()))
+	}()
+}
+
+// appendBatchFooter checksums every line of the file at path and appends a batch footer line.
+func appendBatchFooter(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sum := batch.NewChecksum()
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			sum.Add(bytes.TrimSuffix(line, []byte("\n")))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read error: %w", err)
+		}
+	}
+
+	footer, err := json.Marshal(sum.Footer())
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(footer, '\n')); err != nil {
+		return fmt.Errorf("write error: %w", err)
+	}
+	return f.Sync()
+}
+
+// eventDay extracts the UTC day (YYYY-MM-DD) of a record's event_time.
+func eventDay(data []byte) (string, bool) {
+	var probe struct {
+		EventTime string `json:"event_time"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil || probe.EventTime == "" {
+		return "", false
+	}
+	t, err := time.Parse(time.RFC3339Nano, probe.EventTime)
+	if err != nil {
+		return "", false
+	}
+	return t.UTC().Format("2006-01-02"), true
+}
+
+// splitPartition splits a buffer partition into its topic and event day (empty if unpartitioned).
+func splitPartition(partition string) (topic, day string) {
+	dir, base := filepath.Split(partition)
+	if dir != "" && isDay(base) {
+		return filepath.Clean(dir), base
+	}
+	return partition, ""
+}
+
+// partitionTime returns the time used to build an upload key: t itself, or t's
+// hour on the event day when the batch belongs to a day partition.
+func partitionTime(day string, t time.Time) time.Time {
+	d, err := time.Parse("2006-01-02", day)
+	if err != nil {
+		return t
+	}
+	return time.Date(d.Year(), d.Month(), d.Day(), t.Hour(), 0, 0, 0, time.UTC)
+}
+
+func isDay(s string) bool {
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
 }
 
 // uploadFile uploads the local batch to the object store
@@ -290,59 +1581,459 @@ func (ds *DurableSink) uploadFile(topic, sourcePath string, t time.Time) {
 
 	f, err := os.Open(sourcePath)
 	if err != nil {
-		log.Printf("Error opening source file %s: %v", sourcePath, err)
-		return
+		log.Printf("Error opening source file %s: %v", sourcePath, err)
+		return
+	}
+	defer f.Close()
+
+	if err := ds.store.Put(ds.ctx, destKey, f); err != nil {
+		log.Printf("Error uploading %s to storage (file preserved for retry): %v", sourcePath, err)
+		return // Do NOT delete the local file — it will be retried on next startup scan
+	}
+
+	// Upload succeeded — safe to delete the local batch
+	if err := os.Remove(sourcePath); err != nil {
+		log.Printf("Warning: uploaded %s but failed to remove local file: %v", sourcePath, err)
+	} else if err := ds.index.remove(sourcePath); err != nil {
+		log.Printf("Warning: uploaded %s but failed to update pending index: %v", sourcePath, err)
+	}
+	log.Printf("Uploaded %s to storage key %s", sourcePath, destKey)
+}
+
+// startupScan checks for any leftover batch files in buffer and uploads them,
+// startupUploads at a time. With an intact pending index only the batches it
+// lists are considered.
+func (ds *DurableSink) startupScan() {
+	orphans := make(chan string)
+	var wg sync.WaitGroup
+	for range max(ds.startupUploads, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range orphans {
+				// uploadFile closes the batch before it returns, so each
+				// worker holds at most one file open
+				ds.uploadOrphan(path)
+				if ds.startupUploadPace > 0 {
+					select {
+					case <-time.After(ds.startupUploadPace):
+					case <-ds.ctx.Done():
+					}
+				}
+			}
+		}()
+	}
+	ds.findOrphans(orphans)
+	close(orphans)
+	wg.Wait()
+}
+
+// findOrphans sends the path of every leftover batch file to orphans until
+// the sink is closed.
+func (ds *DurableSink) findOrphans(orphans chan<- string) {
+	send := func(path string) bool {
+		select {
+		case orphans <- path:
+			return true
+		case <-ds.ctx.Done():
+			return false
+		}
+	}
+
+	if ds.index != nil {
+		if paths, ok := ds.index.recovered(); ok {
+			for _, path := range paths {
+				if !send(path) {
+					return
+				}
+			}
+			return
+		}
+		log.Printf("Pending index missing or unreadable; walking %s", ds.bufferDir)
+	}
+
+	// Walk buffer dir
+	err := filepath.Walk(ds.bufferDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if filepath.Base(path) == "current.jsonl" {
+			return nil
+		} // Ignore active file
+		if filepath.Dir(path) == filepath.Clean(ds.bufferDir) && strings.HasPrefix(filepath.Base(path), pendingIndexName) {
+			return nil // the index itself, or its compaction temp file
+		}
+		// List it so it is still found from the index if this upload fails
+		if err := ds.index.add(path); err != nil {
+			log.Printf("Error adding %s to pending index: %v", path, err)
+		}
+
+		// Found a batch file!
+		if !send(path) {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Startup scan error: %v", err)
+	}
+}
+
+// uploadOrphan uploads a leftover batch, or drops it from the pending index
+// if the file no longer exists.
+func (ds *DurableSink) uploadOrphan(path string) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		// Crashed after listing it but before the rename, or after the upload
+		if err := ds.index.remove(path); err != nil {
+			log.Printf("Error updating pending index: %v", err)
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking orphaned batch file %s: %v", path, err)
+		return
+	}
+	// Infer topic (and event day, if partitioned) from the dir relative to the buffer root
+	rel, err := filepath.Rel(ds.bufferDir, filepath.Dir(path))
+	if err != nil {
+		log.Printf("Error checking orphaned batch file %s: %v", path, err)
+		return
+	}
+	topic, day := splitPartition(rel)
+
+	log.Printf("Found orphaned batch file: %s", path)
+	// Upload using file mod time as heuristic
+	ds.uploadFile(topic, path, partitionTime(day, info.ModTime().UTC()))
+}
+
+// pendingIndexName is the pending index file in the buffer root. The walk in
+// startupScan skips it, and the buffer tools only look at batch_*.jsonl files.
+const pendingIndexName = "pending_batches.idx"
+
+// pendingIndexCompactAfter is how many lines the pending index may grow to
+// before it is rewritten with only the batches still pending.
+const pendingIndexCompactAfter = 1000
+
+// pendingIndex is an append-only list of rotated batches that haven't been
+// uploaded. Each line is "+ <path>" when a batch is about to be renamed into
+// place, or "- <path>" once it is uploaded and removed, with the path relative
+// to the buffer root. Additions are fsynced before the rename, so every batch
+// file on disk is listed. A listed path that no longer exists is harmless.
+type pendingIndex struct {
+	root string
+	mode os.FileMode
+
+	mu      sync.Mutex
+	f       *os.File
+	pending map[string]bool
+	lines   int // lines in f
+
+	loaded  []string // paths pending at open, for startupScan
+	trusted bool     // the index existed and parsed at open
+}
+
+// openPendingIndex reads the pending index under root and rewrites it with
+// only the batches still pending. A missing or corrupt index is replaced by an
+// empty one and reported as untrusted by recovered.
+func openPendingIndex(root string, mode os.FileMode) (*pendingIndex, error) {
+	idx := &pendingIndex{root: root, mode: mode, pending: make(map[string]bool)}
+	data, err := os.ReadFile(idx.path())
+	switch {
+	case err == nil:
+		idx.trusted = idx.parse(data)
+		if !idx.trusted {
+			log.Printf("Pending index %s is corrupt; ignoring it", idx.path())
+			clear(idx.pending)
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	for rel := range idx.pending {
+		idx.loaded = append(idx.loaded, filepath.Join(root, rel))
+	}
+	slices.Sort(idx.loaded)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.compact(); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// parse replays the index lines in data into idx.pending. A final line
+// without a newline was torn by a crash mid-append and is ignored: its rename
+// never happened, or its upload was already done.
+func (idx *pendingIndex) parse(data []byte) bool {
+	if i := bytes.LastIndexByte(data, '\n'); i < len(data)-1 {
+		data = data[:i+1]
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		op, rel, ok := strings.Cut(line, " ")
+		if !ok || !filepath.IsLocal(rel) {
+			return false
+		}
+		switch op {
+		case "+":
+			idx.pending[rel] = true
+		case "-":
+			delete(idx.pending, rel)
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (idx *pendingIndex) path() string {
+	return filepath.Join(idx.root, pendingIndexName)
+}
+
+// recovered returns the batches the index listed when it was opened, and
+// whether it can be trusted to list every batch in the buffer.
+func (idx *pendingIndex) recovered() ([]string, bool) {
+	return idx.loaded, idx.trusted
+}
+
+// add lists the batch at path as pending. It is a no-op on a nil index.
+func (idx *pendingIndex) add(path string) error {
+	return idx.append("+", path, true)
+}
+
+// remove drops the batch at path from the index. It is a no-op on a nil index.
+// It isn't fsynced: a lost removal only lists a file that no longer exists.
+func (idx *pendingIndex) remove(path string) error {
+	return idx.append("-", path, false)
+}
+
+func (idx *pendingIndex) append(op, path string, sync bool) error {
+	if idx == nil {
+		return nil
+	}
+	rel, err := filepath.Rel(idx.root, path)
+	if err != nil {
+		return err
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if op == "+" {
+		idx.pending[rel] = true
+	} else {
+		delete(idx.pending, rel)
+	}
+	if _, err := fmt.Fprintf(idx.f, "%s %s\n", op, rel); err != nil {
+		return err
+	}
+	idx.lines++
+	if sync {
+		if err := idx.f.Sync(); err != nil {
+			return err
+		}
+	}
+	if idx.lines > pendingIndexCompactAfter && idx.lines > 2*len(idx.pending) {
+		return idx.compact()
+	}
+	return nil
+}
+
+// compact atomically replaces the index with one "+" line per pending batch
+// and reopens it for appending. idx.mu must be held.
+func (idx *pendingIndex) compact() error {
+	rels := slices.Sorted(maps.Keys(idx.pending))
+	var buf bytes.Buffer
+	for _, rel := range rels {
+		fmt.Fprintf(&buf, "+ %s\n", rel)
+	}
+	tmp := idx.path() + ".tmp"
+	if err := writeFileSync(tmp, buf.Bytes(), idx.mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, idx.path()); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(idx.path(), os.O_WRONLY|os.O_APPEND, idx.mode)
+	if err != nil {
+		return err
+	}
+	if idx.f != nil {
+		idx.f.Close()
+	}
+	idx.f = f
+	idx.lines = len(rels)
+	return nil
+}
+
+// writeFileSync writes data to path like os.WriteFile and fsyncs it.
+func writeFileSync(path string, data []byte, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func main() {
+	port := flag.Int("port", 8080, "HTTP port")
+	baseDir := flag.String("base-dir", "./data", "Base directory for buffer and raw storage")
+	sampleRate := flag.Float64("sample-rate", 1, "Fraction of single facts (/api/v1/facts) to persist; 1 disables sampling")
+	maxBatchLines := flag.Int("max-batch-lines", 10000, "Reject batch requests with more lines than this; 0 disables the limit")
+	maxBatchErrors := flag.Int("max-batch-errors", defaultMaxBatchErrors, "Most per-line error messages listed in a batch response; further rejections are only counted")
+	redactProperties := flag.String("redact-properties", "", "Comma-separated service event property keys to redact before persisting (case-insensitive)")
+	redactMode := flag.String("redact-mode", "hash", "How -redact-properties are redacted: hash (SHA-256 of the value) or drop")
+	validateServiceNames := flag.Bool("validate-service-names", false, "Reject facts and events whose service is not a low-cardinality identifier")
+	serviceNamePattern := flag.String("service-name-pattern", schemas.DefaultServiceNamePattern.String(), "Pattern service names must match with -validate-service-names")
+	trustedProxies := flag.String("trusted-proxies", os.Getenv("TRUSTED_PROXIES"), "Comma-separated CIDRs of proxies whose X-Forwarded-For is trusted (env TRUSTED_PROXIES)")
+	batchFooter := flag.Bool("batch-footer", false, "Append a record-count/SHA-256 footer line to every rotated batch")
+	verifyStore := flag.Bool("verify-store", false, "Check that the object store is reachable and writable at startup and exit if not")
+	apiKeyFile := flag.String("api-key-file", "", "File with one accepted API key per line, reloaded when it changes; overrides API_KEY")
+	rotationInterval := flag.Duration("rotation-interval", 60*time.Second, "Time between buffer rotations (and uploads)")
+	rotationJitter := flag.Duration("rotation-jitter", 0, "Randomize each rotation by up to ± this much to spread uploads across a fleet")
+	recentRejections := flag.Int("recent-rejections", 100, "Number of recent validation rejections kept in memory for /admin/recent-rejections; 0 disables it")
+	partitionByDay := flag.Bool("partition-by-event-day", false, "Buffer and upload records under their event_time day instead of the upload day")
+	instanceLabel := flag.String("instance-label", os.Getenv("INSTANCE_LABEL"), "Comma-separated name=value labels added to every ingestion metric, e.g. region=eu-west-1 (env INSTANCE_LABEL)")
+	maxClockSkew := flag.Duration("max-clock-skew", 5*time.Minute, "Facts whose event_time is further than this from server time get -clock-skew-action")
+	clockSkewAction := flag.String("clock-skew-action", "accept", "What to do with facts beyond -max-clock-skew: accept (only measure), tag (set skew_ms) or reject")
+	maxFutureSkew := flag.Duration("max-future-skew", schemas.DefaultMaxFutureSkew, "Reject facts and events whose event_time is more than this far in the future")
+	defaultEventTime := flag.Bool("default-event-time", false, "Set a missing fact event_time to the receive time and mark the fact event_time_defaulted, instead of rejecting it")
+	propertyAllowList := flag.String("event-property-allowlist", "", "JSON file mapping event_type to its allowed property keys; events of listed types with other keys are rejected")
+	normalizeMethod := flag.Bool("normalize-method", false, "Uppercase each fact's method (get -> GET) before persisting it")
+	bufferDirMode := flag.String("buffer-dir-mode", os.Getenv("BUFFER_DIR_MODE"), "Octal mode of the buffer directories, applied regardless of umask (default 0755, env BUFFER_DIR_MODE)")
+	bufferFileMode := flag.String("buffer-file-mode", os.Getenv("BUFFER_FILE_MODE"), "Octal mode of the buffer files, applied regardless of umask (default 0644, env BUFFER_FILE_MODE)")
+	maxBatchBytes := flag.Int64("max-batch-bytes", defaultMaxBatchBytes, "Rotate a buffer file as soon as it reaches this many bytes, without waiting for -rotation-interval; 0 disables")
+	maxActiveFiles := flag.Int("max-active-files", 0, "Maximum buffer files open at once (one per topic, or per topic and event day); writes needing another get 503. 0 means no limit")
+	tailSubscribers := flag.Int("tail-subscribers", 4, "Maximum concurrent /api/v1/events/tail streams; 0 disables the endpoint")
+	mixedBatch := flag.Bool("mixed-batch", false, "Serve /api/v1/ingest/batch, which takes facts and events in one JSONL body")
+	startupUploads := flag.Int("startup-upload-concurrency", defaultStartupUploads, "Leftover batches uploaded (and open) at once by the startup scan")
+	startupUploadPace := flag.Duration("startup-upload-pace", 0, "Pause after each startup scan upload, per concurrent upload, to spread a large backlog out")
+	closeTimeout := flag.Duration("shutdown-flush-timeout", defaultCloseTimeout, "On shutdown, how long to wait for the final partial batches to upload before leaving them in the buffer")
+	pendingIndex := flag.Bool("pending-index", false, "Keep an index of rotated batches awaiting upload so startup needn't walk the whole buffer")
+	factsRate := flag.Int64("facts-rate", 100, "Requests per second allowed on /api/v1/facts")
+	factsBurst := flag.Int64("facts-burst", 200, "Burst of requests allowed on /api/v1/facts")
+	batchRate := flag.Int64("batch-rate", 100, "Requests per second allowed on /api/v1/facts/batch, and separately on /api/v1/events/batch and /api/v1/ingest/batch")
+	batchBurst := flag.Int64("batch-burst", 200, "Burst of requests allowed on /api/v1/facts/batch, and separately on /api/v1/events/batch and /api/v1/ingest/batch")
+	eventsRate := flag.Int64("events-rate", 100, "Requests per second allowed on /api/v1/events, and separately on /api/v1/events/tail")
+	eventsBurst := flag.Int64("events-burst", 200, "Burst of requests allowed on /api/v1/events, and separately on /api/v1/events/tail")
+	auditTopic := flag.String("audit-topic", "", "Also write an audit record of every /admin call to this buffer topic, e.g. admin_audit (default: service log only)")
+	flag.Parse()
+
+	instanceLabels, err := ParseInstanceLabels(*instanceLabel)
+	if err != nil {
+		log.Fatalf("Invalid -instance-label: %v", err)
+	}
+	if err := registerMetrics(prometheus.WrapRegistererWith(instanceLabels, prometheus.DefaultRegisterer)); err != nil {
+		log.Fatalf("Failed to register metrics with -instance-label %s: %v", *instanceLabel, err)
+	}
+	if len(instanceLabels) > 0 {
+		log.Printf("Labelling ingestion metrics with %s", *instanceLabel)
+	}
+
+	if *sampleRate <= 0 || *sampleRate > 1 {
+		log.Fatalf("-sample-rate must be in (0, 1], got %v", *sampleRate)
+	}
+	if *sampleRate < 1 {
+		log.Printf("Sampling enabled: persisting %.2f%% of single facts", *sampleRate*100)
+	}
+	if *rotationInterval <= 0 {
+		log.Fatalf("-rotation-interval must be positive, got %v", *rotationInterval)
+	}
+	if *rotationJitter < 0 || *rotationJitter >= *rotationInterval {
+		log.Fatalf("-rotation-jitter must be in [0, -rotation-interval), got %v", *rotationJitter)
+	}
+	if *maxBatchErrors < 1 {
+		log.Fatalf("-max-batch-errors must be >= 1, got %d", *maxBatchErrors)
+	}
+	if *maxBatchLines < 0 {
+		log.Fatalf("-max-batch-lines must be >= 0, got %d", *maxBatchLines)
+	}
+	if *recentRejections < 0 {
+		log.Fatalf("-recent-rejections must be >= 0, got %d", *recentRejections)
+	}
+	if *auditTopic != "" && (!auditTopicPattern.MatchString(*auditTopic) || *auditTopic == "request_facts" || *auditTopic == "service_events") {
+		log.Fatalf("-audit-topic must be a lowercase name like admin_audit and not a data topic, got %q", *auditTopic)
+	}
+	cfg := HandlerConfig{SampleRate: *sampleRate, MaxBatchLines: *maxBatchLines, MaxBatchErrors: *maxBatchErrors, NormalizeMethod: *normalizeMethod}
+	if *recentRejections > 0 {
+		cfg.Rejections = NewRejectionLog(*recentRejections)
+	}
+	if *tailSubscribers < 0 {
+		log.Fatalf("-tail-subscribers must be >= 0, got %d", *tailSubscribers)
+	}
+	if *tailSubscribers > 0 {
+		cfg.Tail = NewEventTail(*tailSubscribers)
+	}
+	redaction, err := ParseRedactionPolicy(*redactProperties, *redactMode)
+	if err != nil {
+		log.Fatalf("Invalid -redact-mode: %v", err)
 	}
-	defer f.Close()
-
-	if err := ds.store.Put(ds.ctx, destKey, f); err != nil {
-		log.Printf("Error uploading %s to storage (file preserved for retry): %v", sourcePath, err)
-		return // Do NOT delete the local file — it will be retried on next startup scan
+	cfg.Redaction = redaction
+	cfg.ClockSkew, err = ParseClockSkewPolicy(*maxClockSkew, *clockSkewAction)
+	if err != nil {
+		log.Fatalf("Invalid clock skew settings: %v", err)
 	}
-
-	// Upload succeeded — safe to delete the local batch
-	if err := os.Remove(sourcePath); err != nil {
-		log.Printf("Warning: uploaded %s but failed to remove local file: %v", sourcePath, err)
+	if *clockSkewAction != "accept" {
+		log.Printf("Facts skewed by more than %v from server time are handled with action %s", *maxClockSkew, *clockSkewAction)
 	}
-	log.Printf("Uploaded %s to storage key %s", sourcePath, destKey)
-}
-
-// startupScan checks for any leftover batch files in buffer and uploads them
-func (ds *DurableSink) startupScan() {
-	// Walk buffer dir
-	err := filepath.Walk(ds.bufferDir, func(path string, info os.FileInfo, err error) error {
+	if len(redaction.keys) > 0 {
+		log.Printf("Redacting service event properties %s (mode %s)", *redactProperties, *redactMode)
+	}
+	if *validateServiceNames {
+		re, err := regexp.Compile(*serviceNamePattern)
 		if err != nil {
-			return err
+			log.Fatalf("Invalid -service-name-pattern: %v", err)
 		}
-		if info.IsDir() {
-			return nil
+		log.Printf("Service name validation enabled (pattern %s)", re)
+		cfg.SchemaOptions = append(cfg.SchemaOptions, schemas.WithServiceNamePattern(re))
+	}
+	if *maxFutureSkew <= 0 {
+		log.Fatalf("-max-future-skew must be positive, got %v", *maxFutureSkew)
+	}
+	cfg.SchemaOptions = append(cfg.SchemaOptions, schemas.WithMaxFutureSkew(*maxFutureSkew))
+	if *defaultEventTime {
+		log.Printf("Facts without event_time get the receive time")
+		cfg.SchemaOptions = append(cfg.SchemaOptions, schemas.WithDefaultEventTime(time.Now))
+		cfg.DefaultEventTime = true
+	}
+	if *propertyAllowList != "" {
+		allow, err := LoadPropertyAllowList(*propertyAllowList)
+		if err != nil {
+			log.Fatalf("Invalid -event-property-allowlist: %v", err)
 		}
-		if filepath.Base(path) == "current.jsonl" {
-			return nil
-		} // Ignore active file
-
-		// Found a batch file!
-		// Infer topic from parent dir name
-		dir := filepath.Dir(path)
-		topic := filepath.Base(dir)
+		log.Printf("Restricting service event properties for %d event types", len(allow))
+		cfg.SchemaOptions = append(cfg.SchemaOptions, schemas.WithPropertyAllowList(allow))
+	}
 
-		log.Printf("Found orphaned batch file: %s", path)
-		// Upload using file mod time as heuristic
-		ds.uploadFile(topic, path, info.ModTime().UTC())
-		return nil
-	})
+	proxies, err := ParseTrustedProxies(*trustedProxies)
 	if err != nil {
-		log.Printf("Startup scan error: %v", err)
+		log.Fatalf("Invalid -trusted-proxies: %v", err)
 	}
-}
 
-func main() {
-	port := flag.Int("port", 8080, "HTTP port")
-	baseDir := flag.String("base-dir", "./data", "Base directory for buffer and raw storage")
-	flag.Parse()
-
-	apiKey := os.Getenv("API_KEY")
-	if apiKey == "" {
+	apiKeys := NewAPIKeys(strings.Split(trimAPIKey(os.Getenv("API_KEY"), "API_KEY"), ",")...)
+	if *apiKeyFile != "" {
+		keys, err := LoadAPIKeyFile(*apiKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load -api-key-file: %v", err)
+		}
+		apiKeys.Set(keys)
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		go apiKeys.WatchFile(watchCtx, *apiKeyFile, 10*time.Second)
+		log.Printf("API Key authentication enabled (%d keys from %s, reloaded on change).", len(keys), *apiKeyFile)
+	} else if !apiKeys.Enabled() {
 		log.Println("WARNING: API_KEY environment variable not set. Authentication disabled.")
 	} else {
 		log.Println("API Key authentication enabled.")
@@ -351,46 +2042,107 @@ func main() {
 	bufferDir := filepath.Join(*baseDir, "buffer")
 	rawDir := filepath.Join(*baseDir, "raw")
 
-	var store storage.ObjectStore
-	if os.Getenv("S3_ENDPOINT") != "" {
-		log.Println("Initializing S3/MinIO Storage...")
-		var err error
-		store, err = storage.NewS3Store(
-			context.Background(),
-			os.Getenv("S3_ENDPOINT"),
-			os.Getenv("S3_REGION"),
-			os.Getenv("S3_BUCKET"),
-			os.Getenv("S3_ACCESS_KEY"),
-			os.Getenv("S3_SECRET_KEY"),
-		)
-		if err != nil {
-			log.Fatalf("Failed to initialize S3 store: %v", err)
-		}
-	} else {
-		log.Printf("Initializing Local Storage at %s...", rawDir)
-		var err error
-		store, err = storage.NewLocalStore(rawDir)
+	store, err := storage.FromEnv(context.Background(), rawDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize store: %v", err)
+	}
+
+	if *verifyStore {
+		verifyCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := storage.Verify(verifyCtx, store)
+		cancel()
 		if err != nil {
-			log.Fatalf("Failed to initialize local store: %v", err)
+			log.Fatalf("Object store verification failed: %v", err)
 		}
+		log.Println("Object store verified.")
 	}
 
 	log.Printf("Initializing Durable Sink (Buffer: %s)...", bufferDir)
-	sink, err := NewDurableSink(bufferDir, store)
+	var sinkOpts []SinkOption
+	if *partitionByDay {
+		log.Println("Partitioning buffer by event day.")
+		sinkOpts = append(sinkOpts, WithEventDayPartitioning())
+	}
+	if *batchFooter {
+		sinkOpts = append(sinkOpts, WithBatchFooter())
+	}
+	if *pendingIndex {
+		sinkOpts = append(sinkOpts, WithPendingIndex())
+	}
+	if *startupUploads < 1 || *startupUploadPace < 0 {
+		log.Fatalf("-startup-upload-concurrency must be >= 1 and -startup-upload-pace >= 0, got %d and %s", *startupUploads, *startupUploadPace)
+	}
+	sinkOpts = append(sinkOpts, WithStartupUploads(*startupUploads, *startupUploadPace))
+	sinkOpts = append(sinkOpts, WithRotation(*rotationInterval, *rotationJitter))
+	if *closeTimeout <= 0 {
+		log.Fatalf("-shutdown-flush-timeout must be positive, got %v", *closeTimeout)
+	}
+	sinkOpts = append(sinkOpts, WithCloseTimeout(*closeTimeout))
+	if *maxBatchBytes < 0 {
+		log.Fatalf("-max-batch-bytes must be >= 0, got %d", *maxBatchBytes)
+	}
+	sinkOpts = append(sinkOpts, WithMaxBatchBytes(*maxBatchBytes))
+	if *maxActiveFiles < 0 {
+		log.Fatalf("-max-active-files must be >= 0, got %d", *maxActiveFiles)
+	}
+	sinkOpts = append(sinkOpts, WithMaxActiveFiles(*maxActiveFiles))
+	dirMode, fileMode := os.FileMode(0755), os.FileMode(0644)
+	if *bufferDirMode != "" {
+		if dirMode, err = ParseFileMode(*bufferDirMode); err != nil {
+			log.Fatalf("Invalid -buffer-dir-mode: %v", err)
+		}
+	}
+	if *bufferFileMode != "" {
+		if fileMode, err = ParseFileMode(*bufferFileMode); err != nil {
+			log.Fatalf("Invalid -buffer-file-mode: %v", err)
+		}
+	}
+	// The sink itself must still be able to create, append to and footer its files
+	if dirMode&0700 != 0700 || fileMode&0600 != 0600 {
+		log.Fatalf("Buffer modes must give the owner rwx on directories and rw on files, got %04o and %04o", dirMode, fileMode)
+	}
+	sinkOpts = append(sinkOpts, WithPermissions(dirMode, fileMode))
+	sink, err := NewDurableSink(bufferDir, store, sinkOpts...)
 	if err != nil {
 		log.Fatalf("Failed to create sink: %v", err)
 	}
 	defer sink.Close()
 
-	// Rate limiter: 100 requests/sec with burst of 200
-	rl := NewRateLimiter(100, 200)
+	// One token bucket per endpoint, so a burst on one can't starve the others
+	factsLimit := RateLimit{Rate: *factsRate, Burst: *factsBurst}
+	batchLimit := RateLimit{Rate: *batchRate, Burst: *batchBurst}
+	eventsLimit := RateLimit{Rate: *eventsRate, Burst: *eventsBurst}
+	for name, l := range map[string]RateLimit{"facts": factsLimit, "batch": batchLimit, "events": eventsLimit} {
+		if l.Rate <= 0 || l.Burst <= 0 {
+			log.Fatalf("-%s-rate and -%s-burst must be > 0, got %d and %d", name, name, l.Rate, l.Burst)
+		}
+	}
+	limiters := endpointLimiters(factsLimit, batchLimit, eventsLimit)
 
 	// Wrap handlers with rate limiting + auth middleware
-	http.Handle("/api/v1/facts", rateLimitMiddleware(rl, authMiddleware(apiKey, handleFacts(sink))))
-	http.Handle("/api/v1/facts/batch", rateLimitMiddleware(rl, authMiddleware(apiKey, handleBatchFacts(sink))))
-	http.Handle("/api/v1/events", rateLimitMiddleware(rl, authMiddleware(apiKey, handleEvents(sink))))
+	http.Handle("/api/v1/facts", durationMiddleware("/api/v1/facts", rateLimitMiddleware(limiters["/api/v1/facts"], authMiddleware(apiKeys, proxies, handleFacts(sink, cfg)))))
+	http.Handle("/api/v1/facts/batch", durationMiddleware("/api/v1/facts/batch", rateLimitMiddleware(limiters["/api/v1/facts/batch"], authMiddleware(apiKeys, proxies, gzipMiddleware(handleBatchFacts(sink, cfg))))))
+	http.Handle("/api/v1/events", durationMiddleware("/api/v1/events", rateLimitMiddleware(limiters["/api/v1/events"], authMiddleware(apiKeys, proxies, handleEvents(sink, cfg)))))
+	http.Handle("/api/v1/events/batch", durationMiddleware("/api/v1/events/batch", rateLimitMiddleware(limiters["/api/v1/events/batch"], authMiddleware(apiKeys, proxies, gzipMiddleware(handleEventsBatch(sink, cfg))))))
+
+	if *mixedBatch {
+		http.Handle("/api/v1/ingest/batch", durationMiddleware("/api/v1/ingest/batch", rateLimitMiddleware(limiters["/api/v1/ingest/batch"], authMiddleware(apiKeys, proxies, gzipMiddleware(handleMixedBatch(sink, cfg))))))
+	}
+
+	if cfg.Tail != nil {
+		// No durationMiddleware: streams stay open far longer than any request
+		http.Handle("/api/v1/events/tail", rateLimitMiddleware(limiters["/api/v1/events/tail"], authMiddleware(apiKeys, proxies, handleEventsTail(cfg.Tail))))
+	}
+
+	audit := NewAuditLog(sink, *auditTopic)
+	if cfg.Rejections != nil {
+		http.Handle("/admin/recent-rejections", auditMiddleware("recent_rejections", audit, apiKeys, proxies,
+			authMiddleware(apiKeys, proxies, handleRecentRejections(cfg.Rejections))))
+	}
 
-	http.Handle("/metrics", promhttp.Handler())
+	// Exemplars are only exposed in the OpenMetrics format, which Prometheus negotiates
+	http.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
 
 	http.HandleFunc("/live", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -415,12 +2167,17 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	if cfg.Tail != nil {
+		srv.RegisterOnShutdown(cfg.Tail.Close)
+	}
 
 	// Graceful shutdown: listen for SIGINT/SIGTERM
 	shutdownCh := make(chan os.Signal, 1)
 	signal.Notify(shutdownCh, os.Interrupt, syscall.SIGTERM)
 
+	drained := make(chan struct{})
 	go func() {
+		defer close(drained)
 		sig := <-shutdownCh
 		log.Printf("Received %v, draining connections (10s)...", sig)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -434,68 +2191,420 @@ func main() {
 	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
-	log.Println("Server stopped gracefully.")
+	// ListenAndServe returns as soon as Shutdown starts; wait for in-flight
+	// requests so their writes are in the buffer before the sink flushes it
+	<-drained
+	log.Println("Server stopped gracefully, flushing buffer...")
+}
+
+// TrustedProxies lists the networks whose X-Forwarded-For entries are believed.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses a comma-separated list of CIDRs or bare IPs.
+func ParseTrustedProxies(list string) (TrustedProxies, error) {
+	var tp TrustedProxies
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			tp = append(tp, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		tp = append(tp, prefix.Masked())
+	}
+	return tp, nil
+}
+
+func (tp TrustedProxies) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range tp {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client that sent r. X-Forwarded-For is
+// only consulted when the direct peer is a trusted proxy, and then the
+// rightmost entry that is not itself a trusted proxy wins: everything to its
+// left was supplied by the client and may be spoofed.
+func (tp TrustedProxies) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !tp.contains(peer) {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break // Malformed hop: don't trust anything further left
+		}
+		client = addr
+		if !tp.contains(addr) {
+			break
+		}
+	}
+	return client.Unmap().String()
+}
+
+// APIKeys is the set of accepted API keys. It can be swapped atomically while
+// requests are being served, so keys can be rotated without a restart.
+//
+// Each entry is a key, optionally followed by whitespace and a comma-separated
+// list of service name prefixes. A key with prefixes may only submit facts and
+// events for services starting with one of them, so one tenant can't write
+// into another's dashboards; a bare key may submit any service.
+type APIKeys struct {
+	keys atomic.Pointer[keySet]
+}
+
+// keySet is one generation of accepted keys.
+type keySet struct {
+	entries  []string   // as configured, to detect unchanged reloads
+	keys     []string   // the keys alone
+	services [][]string // allowed service prefixes per key; nil means any
+}
+
+// NewAPIKeys returns a key set accepting keys. Empty keys are ignored; with no
+// keys left, authentication is disabled.
+func NewAPIKeys(keys ...string) *APIKeys {
+	k := &APIKeys{}
+	k.Set(keys)
+	return k
+}
+
+// Set replaces the accepted keys. Entries that fail parseAPIKeyEntry are
+// logged and skipped; LoadAPIKeyFile rejects them before they get here.
+func (k *APIKeys) Set(entries []string) {
+	set := &keySet{}
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		key, services, err := parseAPIKeyEntry(entry)
+		if err != nil {
+			log.Printf("WARNING: ignoring API key entry: %v", err)
+			continue
+		}
+		set.entries = append(set.entries, entry)
+		set.keys = append(set.keys, key)
+		set.services = append(set.services, services)
+	}
+	k.keys.Store(set)
+}
+
+// parseAPIKeyEntry splits an entry into its key and service prefixes. The
+// error never includes the key.
+func parseAPIKeyEntry(entry string) (string, []string, error) {
+	fields := strings.Fields(entry)
+	switch len(fields) {
+	case 1:
+		return fields[0], nil, nil
+	case 2:
+		var services []string
+		for _, prefix := range strings.Split(fields[1], ",") {
+			if prefix == "" {
+				return "", nil, fmt.Errorf("empty service prefix in %q", fields[1])
+			}
+			services = append(services, prefix)
+		}
+		return fields[0], services, nil
+	default:
+		return "", nil, fmt.Errorf("want a key and at most one comma-separated list of service prefixes, got %d fields", len(fields))
+	}
+}
+
+// Enabled reports whether any key is configured.
+func (k *APIKeys) Enabled() bool {
+	return len(k.keys.Load().keys) > 0
+}
+
+// Valid reports whether candidate matches one of the accepted keys.
+func (k *APIKeys) Valid(candidate string) bool {
+	_, _, ok := k.Lookup(candidate)
+	return ok
+}
+
+// Lookup reports whether candidate matches one of the accepted keys, and
+// returns its position in the configured list and the service prefixes it is
+// bound to (nil for any service).
+func (k *APIKeys) Lookup(candidate string) (int, []string, bool) {
+	set := k.keys.Load()
+	index := -1
+	var services []string
+	for i, key := range set.keys {
+		// Compare against every key so timing doesn't reveal which one matched
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			index, services = i, set.services[i]
+		}
+	}
+	return index, services, index >= 0
+}
+
+// allowedServicesKey is the request context key under which authMiddleware
+// stores the service prefixes of a bound API key.
+type allowedServicesKey struct{}
+
+// checkService returns an error if the request's API key is bound to service
+// prefixes and service matches none of them.
+func checkService(r *http.Request, service string) error {
+	prefixes, _ := r.Context().Value(allowedServicesKey{}).([]string)
+	if serviceAllowed(prefixes, service) {
+		return nil
+	}
+	return fmt.Errorf("service %q is not permitted for this API key", service)
+}
+
+// serviceAllowed reports whether service starts with one of prefixes. nil
+// prefixes allow any service.
+func serviceAllowed(prefixes []string, service string) bool {
+	if prefixes == nil {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(service, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// trimAPIKey strips surrounding whitespace from a configured key. Secret
+// mounts often add a trailing newline, which would otherwise make the key
+// silently never match, so the trim is logged (without the key itself).
+func trimAPIKey(key, source string) string {
+	trimmed := strings.TrimSpace(key)
+	if trimmed != key && trimmed != "" {
+		log.Printf("WARNING: API key from %s has leading or trailing whitespace; using the trimmed value", source)
+	}
+	return trimmed
+}
+
+// LoadAPIKeyFile reads one key per line, skipping blank lines and # comments.
+// A key may be followed by the service prefixes it is bound to (see APIKeys).
+func LoadAPIKeyFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = trimAPIKey(line, fmt.Sprintf("%s line %d", path, i+1))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, err := parseAPIKeyEntry(line); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, i+1, err)
+		}
+		keys = append(keys, line)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys in %s", path)
+	}
+	return keys, nil
+}
+
+// WatchFile stats path every interval and reloads the keys when its size or
+// modification time changes (the first tick always reloads). A file that can't
+// be read or has no keys is logged and the previous keys stay in effect. It
+// returns when ctx is cancelled.
+func (k *APIKeys) WatchFile(ctx context.Context, path string, interval time.Duration) {
+	var lastMod time.Time
+	lastSize := int64(-1)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Printf("Failed to stat API key file %s: %v", path, err)
+			continue
+		}
+		if info.ModTime().Equal(lastMod) && info.Size() == lastSize {
+			continue
+		}
+		keys, err := LoadAPIKeyFile(path)
+		if err != nil {
+			log.Printf("Failed to reload API key file, keeping previous keys: %v", err)
+			continue
+		}
+		lastMod, lastSize = info.ModTime(), info.Size()
+		if slices.Equal(keys, k.keys.Load().entries) {
+			continue
+		}
+		k.Set(keys)
+		log.Printf("Reloaded %d API keys from %s", len(keys), path)
+	}
 }
 
-// authMiddleware checks for X-API-Key header if apiKey is configured
-func authMiddleware(apiKey string, next http.HandlerFunc) http.HandlerFunc {
+// authMiddleware checks the X-API-Key header if any keys are configured, and
+// passes the service prefixes of a bound key on to checkService.
+func authMiddleware(keys *APIKeys, proxies TrustedProxies, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if apiKey != "" {
-			reqKey := r.Header.Get("X-API-Key")
-			if subtle.ConstantTimeCompare([]byte(reqKey), []byte(apiKey)) != 1 {
-				writeErrorJSON(w, http.StatusUnauthorized, "invalid or missing X-API-Key header")
+		if keys.Enabled() {
+			_, services, ok := keys.Lookup(r.Header.Get("X-API-Key"))
+			if !ok {
+				log.Printf("Rejected request to %s from %s: invalid or missing API key", r.URL.Path, proxies.clientIP(r))
+				writeError(w, r, http.StatusUnauthorized, "invalid or missing X-API-Key header")
 				return
 			}
+			if services != nil {
+				r = r.WithContext(context.WithValue(r.Context(), allowedServicesKey{}, services))
+			}
 		}
 		next(w, r)
 	}
 }
 
+// requirePost checks the request is a POST.
+// HEAD probes get 200 with the response headers and no body, without touching
+// the sink; other methods get 405. Returns true only for POST.
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Allow", "POST, HEAD")
+	switch r.Method {
+	case http.MethodPost:
+		return true
+	case http.MethodHead:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "only POST is accepted")
+	}
+	return false
+}
+
+// readBody reads the request body, decompressing it first if it was sent with
+// Content-Encoding: gzip. maxBodyBytes caps the decompressed size, so a small
+// gzip bomb can't expand past it in memory. On failure it writes the error
+// response (413 too large, 400 malformed gzip, 415 other encodings) and
+// returns false.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	defer r.Body.Close()
+
+	var reader io.Reader = r.Body
+	gzipped := false
+	switch enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); enc {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gzipped = true
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeBodyError(w, r, err, gzipped)
+			return nil, false
+		}
+		defer zr.Close()
+		reader = io.LimitReader(zr, maxBodyBytes+1)
+	default:
+		writeError(w, r, http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported Content-Encoding %q (only gzip is accepted)", enc))
+		return nil, false
+	}
+
+	body, err := io.ReadAll(reader)
+	if err == nil && len(body) > maxBodyBytes {
+		err = &http.MaxBytesError{Limit: maxBodyBytes}
+	}
+	if err != nil {
+		writeBodyError(w, r, err, gzipped)
+		return nil, false
+	}
+	return body, true
+}
+
+// writeBodyError answers a failed body read. Besides the size limit, only a
+// gzip body can fail in a way that is the client's fault.
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error, gzipped bool) {
+	var tooLarge *http.MaxBytesError
+	if gzipped && !errors.As(err, &tooLarge) {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("malformed gzip body: %v", err))
+		return
+	}
+	writeError(w, r, http.StatusRequestEntityTooLarge, "request body too large (max 1MB)")
+}
+
 // requireJSON checks Content-Type header contains application/json.
 // Returns true if valid, false (and writes 415 response) if invalid.
 func requireJSON(w http.ResponseWriter, r *http.Request) bool {
 	ct := r.Header.Get("Content-Type")
 	if ct == "" || !strings.Contains(ct, "application/json") {
-		writeErrorJSON(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		writeError(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
 		return false
 	}
 	return true
 }
 
-func handleFacts(sink *DurableSink) http.HandlerFunc {
+func handleFacts(sink *DurableSink, cfg HandlerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			writeErrorJSON(w, http.StatusMethodNotAllowed, "only POST is accepted")
+		if !requirePost(w, r) {
 			return
 		}
 		if !requireJSON(w, r) {
 			return
 		}
-		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			writeErrorJSON(w, http.StatusRequestEntityTooLarge, "request body too large (max 1MB)")
+		body, ok := readBody(w, r)
+		if !ok {
 			return
 		}
-		defer r.Body.Close()
 
-		fact, err := schemas.ParseRequestFact(body)
+		fact, err := schemas.ParseRequestFact(body, cfg.SchemaOptions...)
+		if err == nil {
+			cfg.normalize(fact)
+			err = cfg.ClockSkew.apply(fact, time.Now())
+		}
 		if err != nil {
-			writeErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("invalid RequestFact: %v", err))
+			cfg.Rejections.record("/api/v1/facts", body, err)
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid RequestFact: %v", err))
+			return
+		}
+		if err := checkService(r, fact.Service); err != nil {
+			cfg.Rejections.record("/api/v1/facts", body, err)
+			writeError(w, r, http.StatusForbidden, err.Error())
+			return
+		}
+
+		// Sampled-out facts are still acknowledged so clients don't retry them
+		if cfg.sampledOut() {
+			ingestionRequestsTotal.WithLabelValues("/api/v1/facts", "201").Inc()
+			w.WriteHeader(http.StatusCreated)
 			return
 		}
 
 		marshalOpts := protojson.MarshalOptions{UseProtoNames: true}
 		cleanData, err := marshalOpts.Marshal(fact)
 		if err != nil {
-			writeErrorJSON(w, http.StatusInternalServerError, "failed to marshal fact")
+			writeError(w, r, http.StatusInternalServerError, "failed to marshal fact")
 			return
 		}
 
 		if err := sink.Write("request_facts", cleanData); err != nil {
 			log.Printf("Sink write error: %v", err)
-			ingestionRequestsTotal.WithLabelValues("/api/v1/facts", "500").Inc()
-			writeErrorJSON(w, http.StatusInternalServerError, "failed to persist fact")
+			code := sinkWriteStatus(w, err)
+			ingestionRequestsTotal.WithLabelValues("/api/v1/facts", strconv.Itoa(code)).Inc()
+			writeError(w, r, code, "failed to persist fact")
 			return
 		}
 
@@ -506,90 +2615,269 @@ func handleFacts(sink *DurableSink) http.HandlerFunc {
 }
 
 // handleBatchFacts handles JSONL (newline-delimited JSON) payloads with multiple facts per request.
-func handleBatchFacts(sink *DurableSink) http.HandlerFunc {
+func handleBatchFacts(sink *DurableSink, cfg HandlerConfig) http.HandlerFunc {
+	return handleJSONLBatch(sink, cfg, "/api/v1/facts/batch", "failed to persist facts", func(line []byte) (batchLine, error) {
+		parsed := batchLine{kind: "fact", topic: "request_facts"}
+		fact, err := schemas.ParseRequestFact(line, cfg.SchemaOptions...)
+		if err != nil {
+			return parsed, err
+		}
+		cfg.normalize(fact)
+		parsed.service, parsed.msg = fact.Service, fact
+		return parsed, cfg.ClockSkew.apply(fact, time.Now())
+	}, nil)
+}
+
+// batchLine is one parsed line of a JSONL batch.
+type batchLine struct {
+	kind    string                // "fact" or "event", for the per-kind counts; "" if unknown
+	topic   string                // sink topic msg is written to
+	service string                // checked with checkService
+	msg     proto.Message         // persisted as protojson
+	event   *schemas.ServiceEvent // set for events, which are also published to the tail
+}
+
+// handleJSONLBatch serves a JSONL batch endpoint at path. parse turns each
+// line into a batchLine; an error rejects only that line, counted under the
+// kind parse returned. Valid lines are written in order, and a failed write
+// aborts the rest with writeBatchFailure. respond, if set, adds fields from
+// the per-kind counts to the response.
+func handleJSONLBatch(sink *DurableSink, cfg HandlerConfig, path, failMsg string, parse func(line []byte) (batchLine, error), respond func(resp map[string]interface{}, counts map[string]*mixedKindCounts)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			writeErrorJSON(w, http.StatusMethodNotAllowed, "only POST is accepted")
+		if !requirePost(w, r) {
 			return
 		}
 		if !requireJSON(w, r) {
 			return
 		}
-		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			writeErrorJSON(w, http.StatusRequestEntityTooLarge, "request body too large (max 1MB)")
+		body, ok := readBody(w, r)
+		if !ok {
 			return
 		}
-		defer r.Body.Close()
 
 		lines := splitJSONL(body)
 		if len(lines) == 0 {
-			writeErrorJSON(w, http.StatusBadRequest, "empty request body")
+			writeError(w, r, http.StatusBadRequest, "empty request body")
+			return
+		}
+		if cfg.MaxBatchLines > 0 && len(lines) > cfg.MaxBatchLines {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("batch has %d lines (max %d)", len(lines), cfg.MaxBatchLines))
 			return
 		}
 
 		accepted := 0
-		var errors []string
+		lineErrors := batchErrors{max: cfg.maxBatchErrors()}
+		counts := map[string]*mixedKindCounts{"fact": {}, "event": {}}
+		topicBytes := map[string]int{}
 		marshalOpts := protojson.MarshalOptions{UseProtoNames: true}
+		reject := func(i int, line []byte, kind string, err error) {
+			cfg.Rejections.record(path, line, err)
+			lineErrors.add(fmt.Sprintf("line %d: %v", i+1, err))
+			if c := counts[kind]; c != nil {
+				c.Rejected++
+			}
+		}
 
 		for i, line := range lines {
-			if len(line) == 0 {
-				continue
+			parsed, err := parse(line)
+			if err == nil {
+				// Only the offending lines are dropped, like invalid ones
+				err = checkService(r, parsed.service)
 			}
-
-			fact, err := schemas.ParseRequestFact(line)
 			if err != nil {
-				errors = append(errors, fmt.Sprintf("line %d: %v", i+1, err))
+				reject(i, line, parsed.kind, err)
 				continue
 			}
 
-			cleanData, err := marshalOpts.Marshal(fact)
+			cleanData, err := marshalOpts.Marshal(parsed.msg)
 			if err != nil {
-				errors = append(errors, fmt.Sprintf("line %d: marshal error", i+1))
+				reject(i, line, parsed.kind, fmt.Errorf("marshal error"))
 				continue
 			}
 
-			if err := sink.Write("request_facts", cleanData); err != nil {
-				log.Printf("Sink write error (batch line %d): %v", i+1, err)
-				writeErrorJSON(w, http.StatusInternalServerError, "failed to persist facts")
+			if err := sink.Write(parsed.topic, cleanData); err != nil {
+				log.Printf("Sink write error (%s line %d, %d already persisted): %v", path, i+1, accepted, err)
+				writeBatchFailure(w, path, failMsg, err, accepted, lineErrors.count(), i+1)
 				return
 			}
+			if parsed.event != nil {
+				cfg.Tail.publish(parsed.event.Service, cleanData)
+			}
+			topicBytes[parsed.topic] += len(cleanData)
+			if c := counts[parsed.kind]; c != nil {
+				c.Accepted++
+			}
 			accepted++
 		}
 
-		ingestionRequestsTotal.WithLabelValues("/api/v1/facts/batch", "200").Inc()
-		ingestionBatchSizeBytes.WithLabelValues("request_facts").Observe(float64(len(body)))
+		ingestionRequestsTotal.WithLabelValues(path, "200").Inc()
+		for topic, n := range topicBytes {
+			ingestionBatchSizeBytes.WithLabelValues(topic).Observe(float64(n))
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		resp := map[string]interface{}{
-			"accepted": accepted,
-			"rejected": len(errors),
+			"accepted":  accepted,
+			"persisted": accepted,
+			"rejected":  lineErrors.count(),
+			// Rejected lines are the client's to fix; a server error aborts with writeBatchFailure
+			"error_kind": "none",
 		}
-		if len(errors) > 0 {
-			resp["errors"] = errors
+		if respond != nil {
+			respond(resp, counts)
 		}
+		lineErrors.addTo(resp)
 		json.NewEncoder(w).Encode(resp)
 	}
 }
 
-// splitJSONL splits a byte slice on newlines, returning non-empty lines.
-func splitJSONL(data []byte) [][]byte {
-	var lines [][]byte
-	start := 0
-	for i := 0; i < len(data); i++ {
-		if data[i] == '\n' {
-			line := data[start:i]
-			if len(line) > 0 {
-				lines = append(lines, line)
+// sinkErrorReason is the machine-readable reason for a failed sink write in a
+// batch response: rotating, too_many_active_files or write_failed.
+func sinkErrorReason(err error) string {
+	switch {
+	case errors.Is(err, ErrSinkRotating):
+		return "rotating"
+	case errors.Is(err, ErrTooManyActiveFiles):
+		return "too_many_active_files"
+	}
+	return "write_failed"
+}
+
+// writeBatchFailure answers a batch request whose line failedAt could not be
+// persisted. The lines before it are durable: persisted of them were stored
+// and rejected were invalid, so the client resends from failedAt on.
+func writeBatchFailure(w http.ResponseWriter, path, msg string, err error, persisted, rejected, failedAt int) {
+	code := sinkWriteStatus(w, err)
+	ingestionRequestsTotal.WithLabelValues(path, strconv.Itoa(code)).Inc()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":          msg,
+		"error_kind":     "server",
+		"reason":         sinkErrorReason(err),
+		"code":           code,
+		"accepted":       persisted,
+		"persisted":      persisted,
+		"rejected":       rejected,
+		"failed_at_line": failedAt,
+	})
+}
+
+// mixedKindCounts is the per-kind part of a /api/v1/ingest/batch response.
+type mixedKindCounts struct {
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+}
+
+// lineKind reads the optional "kind" discriminator of a mixed batch line
+// ("fact" or "event") and returns the line without it, since the schemas
+// reject unknown fields. Lines that aren't JSON objects are returned as is for
+// the schema parsers to reject.
+func lineKind(line []byte) (string, []byte, error) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(line, &fields) != nil {
+		return "", line, nil
+	}
+	raw, ok := fields["kind"]
+	if !ok {
+		return "", line, nil
+	}
+	var kind string
+	if err := json.Unmarshal(raw, &kind); err != nil || (kind != "fact" && kind != "event") {
+		return "", nil, fmt.Errorf(`kind must be "fact" or "event", got %s`, raw)
+	}
+	delete(fields, "kind")
+	stripped, err := json.Marshal(fields)
+	return kind, stripped, err
+}
+
+// handleMixedBatch handles JSONL payloads whose lines are request facts or
+// service events. A line's "kind" decides its type; without one, a line is a
+// fact if it parses as one and an event otherwise, so it is never persisted
+// twice. Each line gets the same checks as on its own endpoint.
+func handleMixedBatch(sink *DurableSink, cfg HandlerConfig) http.HandlerFunc {
+	parse := func(line []byte) (batchLine, error) {
+		kind, payload, err := lineKind(line)
+		if err != nil {
+			return batchLine{}, err
+		}
+
+		var fact *schemas.RequestFact
+		var event *schemas.ServiceEvent
+		switch kind {
+		case "fact":
+			fact, err = schemas.ParseRequestFact(payload, cfg.SchemaOptions...)
+		case "event":
+			event, err = schemas.ParseServiceEvent(payload, cfg.SchemaOptions...)
+		default:
+			var factErr error
+			if fact, factErr = schemas.ParseRequestFact(payload, cfg.SchemaOptions...); factErr != nil {
+				if event, err = schemas.ParseServiceEvent(payload, cfg.SchemaOptions...); err != nil {
+					err = fmt.Errorf("neither a RequestFact (%v) nor a ServiceEvent (%v)", factErr, err)
+				}
 			}
-			start = i + 1
 		}
+
+		// A line of no known type is only in the total
+		parsed := batchLine{kind: kind}
+		switch {
+		case fact != nil:
+			cfg.normalize(fact)
+			err = cfg.ClockSkew.apply(fact, time.Now())
+			parsed = batchLine{kind: "fact", topic: "request_facts", service: fact.Service, msg: fact}
+		case event != nil:
+			cfg.Redaction.apply(event.Properties)
+			parsed = batchLine{kind: "event", topic: "service_events", service: event.Service, msg: event, event: event}
+		}
+		return parsed, err
+	}
+	return handleJSONLBatch(sink, cfg, "/api/v1/ingest/batch", "failed to persist batch", parse, func(resp map[string]interface{}, counts map[string]*mixedKindCounts) {
+		resp["facts"] = *counts["fact"]
+		resp["events"] = *counts["event"]
+	})
+}
+
+// batchErrors collects the per-line error messages of a batch response. It
+// keeps the first max messages and only counts the rest, so a body of invalid
+// lines can't build an unbounded response.
+type batchErrors struct {
+	max       int
+	messages  []string
+	truncated int
+}
+
+func (e *batchErrors) add(msg string) {
+	if len(e.messages) < e.max {
+		e.messages = append(e.messages, msg)
+		return
+	}
+	e.truncated++
+}
+
+// count returns the number of errors added, listed or not.
+func (e *batchErrors) count() int {
+	return len(e.messages) + e.truncated
+}
+
+// addTo sets "errors", and "truncated_errors" if any were dropped, on a batch response.
+func (e *batchErrors) addTo(resp map[string]interface{}) {
+	if len(e.messages) > 0 {
+		resp["errors"] = e.messages
+	}
+	if e.truncated > 0 {
+		resp["truncated_errors"] = e.truncated
 	}
-	// Last line (may not end with newline)
-	if start < len(data) {
-		line := data[start:]
+}
+
+// splitJSONL splits a byte slice on newlines, returning non-empty lines.
+// Lines may end in "\r\n" as well as "\n"; the "\r" is dropped, like
+// bufio.ScanLines does in the rollups, so CRLF bodies from Windows clients
+// split into the same lines and a blank "\r" line is skipped.
+func splitJSONL(data []byte) [][]byte {
+	var lines [][]byte
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		line = bytes.TrimSuffix(line, []byte{'\r'})
 		if len(line) > 0 {
 			lines = append(lines, line)
 		}
@@ -597,45 +2885,66 @@ func splitJSONL(data []byte) [][]byte {
 	return lines
 }
 
-func handleEvents(sink *DurableSink) http.HandlerFunc {
+func handleEvents(sink *DurableSink, cfg HandlerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			writeErrorJSON(w, http.StatusMethodNotAllowed, "only POST is accepted")
+		if !requirePost(w, r) {
 			return
 		}
 		if !requireJSON(w, r) {
 			return
 		}
-		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			writeErrorJSON(w, http.StatusRequestEntityTooLarge, "request body too large (max 1MB)")
+		body, ok := readBody(w, r)
+		if !ok {
 			return
 		}
-		defer r.Body.Close()
 
-		event, err := schemas.ParseServiceEvent(body)
+		event, err := schemas.ParseServiceEvent(body, cfg.SchemaOptions...)
 		if err != nil {
-			writeErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("invalid ServiceEvent: %v", err))
+			cfg.Rejections.record("/api/v1/events", body, err)
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid ServiceEvent: %v", err))
+			return
+		}
+		if err := checkService(r, event.Service); err != nil {
+			cfg.Rejections.record("/api/v1/events", body, err)
+			writeError(w, r, http.StatusForbidden, err.Error())
 			return
 		}
+		cfg.Redaction.apply(event.Properties)
 
 		marshalOpts := protojson.MarshalOptions{UseProtoNames: true}
 		cleanData, err := marshalOpts.Marshal(event)
 		if err != nil {
-			writeErrorJSON(w, http.StatusInternalServerError, "failed to marshal event")
+			writeError(w, r, http.StatusInternalServerError, "failed to marshal event")
 			return
 		}
 
 		if err := sink.Write("service_events", cleanData); err != nil {
 			log.Printf("Sink write error: %v", err)
-			ingestionRequestsTotal.WithLabelValues("/api/v1/events", "500").Inc()
-			writeErrorJSON(w, http.StatusInternalServerError, "failed to persist event")
+			code := sinkWriteStatus(w, err)
+			ingestionRequestsTotal.WithLabelValues("/api/v1/events", strconv.Itoa(code)).Inc()
+			writeError(w, r, code, "failed to persist event")
 			return
 		}
 
+		cfg.Tail.publish(event.Service, cleanData)
 		ingestionRequestsTotal.WithLabelValues("/api/v1/events", "201").Inc()
 		ingestionBatchSizeBytes.WithLabelValues("service_events").Observe(float64(len(cleanData)))
 		w.WriteHeader(http.StatusCreated)
 	}
 }
+
+// handleEventsBatch is handleBatchFacts for ServiceEvents: one event per
+// line, invalid lines rejected individually, valid ones written to
+// service_events.
+func handleEventsBatch(sink *DurableSink, cfg HandlerConfig) http.HandlerFunc {
+	return handleJSONLBatch(sink, cfg, "/api/v1/events/batch", "failed to persist events", func(line []byte) (batchLine, error) {
+		parsed := batchLine{kind: "event", topic: "service_events"}
+		event, err := schemas.ParseServiceEvent(line, cfg.SchemaOptions...)
+		if err != nil {
+			return parsed, err
+		}
+		cfg.Redaction.apply(event.Properties)
+		parsed.service, parsed.msg, parsed.event = event.Service, event, event
+		return parsed, nil
+	}, nil)
+}
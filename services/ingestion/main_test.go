@@ -1,23 +1,34 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/google/uuid"
+	"github.com/lgreene/gravix-dashboards/pkg/batch"
 	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/lgreene/gravix-dashboards/schemas"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"google.golang.org/protobuf/encoding/protojson"
 
 	gravixv1 "github.com/lgreene/gravix-dashboards/gen/gravix/v1"
@@ -26,7 +37,7 @@ import (
 // failingStore is a mock ObjectStore where Put always returns an error.
 type failingStore struct{}
 
-func (f *failingStore) Put(_ context.Context, _ string, _ io.Reader) error {
+func (f *failingStore) Put(_ context.Context, _ string, _ io.Reader, _ ...storage.PutOption) error {
 	return errors.New("simulated S3 upload failure")
 }
 
@@ -46,6 +57,14 @@ func (f *failingStore) Exists(_ context.Context, _ string) (bool, error) {
 	return false, errors.New("not implemented")
 }
 
+func (f *failingStore) DeleteBatch(_ context.Context, _ []string) error {
+	return errors.New("not implemented")
+}
+
+func (f *failingStore) Stat(_ context.Context, _ string) (storage.ObjectInfo, error) {
+	return storage.ObjectInfo{}, errors.New("not implemented")
+}
+
 // newUUIDv7 generates a fresh UUIDv7 string for test data.
 func newUUIDv7(t *testing.T) string {
 	t.Helper()
@@ -113,7 +132,7 @@ func setupSink(t *testing.T) *DurableSink {
 
 func TestHandleFacts_ValidPost(t *testing.T) {
 	sink := setupSink(t)
-	handler := handleFacts(sink)
+	handler := handleFacts(sink, HandlerConfig{})
 
 	body := validFactJSON(t)
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/facts", strings.NewReader(body))
@@ -128,7 +147,7 @@ func TestHandleFacts_ValidPost(t *testing.T) {
 
 func TestHandleFacts_InvalidJSON(t *testing.T) {
 	sink := setupSink(t)
-	handler := handleFacts(sink)
+	handler := handleFacts(sink, HandlerConfig{})
 
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/facts", strings.NewReader(`{"bad json`))
 	req.Header.Set("Content-Type", "application/json")
@@ -149,7 +168,7 @@ func TestHandleFacts_InvalidJSON(t *testing.T) {
 
 func TestHandleFacts_MissingContentType(t *testing.T) {
 	sink := setupSink(t)
-	handler := handleFacts(sink)
+	handler := handleFacts(sink, HandlerConfig{})
 
 	body := validFactJSON(t)
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/facts", strings.NewReader(body))
@@ -164,7 +183,7 @@ func TestHandleFacts_MissingContentType(t *testing.T) {
 
 func TestHandleFacts_WrongContentType(t *testing.T) {
 	sink := setupSink(t)
-	handler := handleFacts(sink)
+	handler := handleFacts(sink, HandlerConfig{})
 
 	body := validFactJSON(t)
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/facts", strings.NewReader(body))
@@ -179,7 +198,7 @@ func TestHandleFacts_WrongContentType(t *testing.T) {
 
 func TestHandleFacts_MethodNotAllowed(t *testing.T) {
 	sink := setupSink(t)
-	handler := handleFacts(sink)
+	handler := handleFacts(sink, HandlerConfig{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/facts", nil)
 	rr := httptest.NewRecorder()
@@ -190,9 +209,42 @@ func TestHandleFacts_MethodNotAllowed(t *testing.T) {
 	}
 }
 
+func TestHandlers_HeadProbe(t *testing.T) {
+	sink := setupSink(t)
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/facts":       handleFacts(sink, HandlerConfig{}),
+		"/api/v1/facts/batch": handleBatchFacts(sink, HandlerConfig{}),
+		"/api/v1/events":      handleEvents(sink, HandlerConfig{}),
+	}
+	for path, handler := range handlers {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodHead, path, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("HEAD %s: expected 200, got %d", path, rr.Code)
+		}
+		if rr.Body.Len() != 0 {
+			t.Errorf("HEAD %s: expected no body, got %q", path, rr.Body.String())
+		}
+		if got := rr.Header().Get("Allow"); got != "POST, HEAD" {
+			t.Errorf("HEAD %s: expected Allow: POST, HEAD, got %q", path, got)
+		}
+
+		rr = httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s: expected 405, got %d", path, rr.Code)
+		}
+	}
+
+	// Probes must not write anything
+	if entries, _ := os.ReadDir(sink.bufferDir); len(entries) != 0 {
+		t.Errorf("expected an untouched buffer after probes, got %d entries", len(entries))
+	}
+}
+
 func TestHandleEvents_ValidPost(t *testing.T) {
 	sink := setupSink(t)
-	handler := handleEvents(sink)
+	handler := handleEvents(sink, HandlerConfig{})
 
 	body := validEventJSON(t)
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/events", strings.NewReader(body))
@@ -207,7 +259,7 @@ func TestHandleEvents_ValidPost(t *testing.T) {
 
 func TestHandleEvents_InvalidJSON(t *testing.T) {
 	sink := setupSink(t)
-	handler := handleEvents(sink)
+	handler := handleEvents(sink, HandlerConfig{})
 
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/events", strings.NewReader(`not json`))
 	req.Header.Set("Content-Type", "application/json")
@@ -221,7 +273,7 @@ func TestHandleEvents_InvalidJSON(t *testing.T) {
 
 func TestHandleEvents_MissingContentType(t *testing.T) {
 	sink := setupSink(t)
-	handler := handleEvents(sink)
+	handler := handleEvents(sink, HandlerConfig{})
 
 	body := validEventJSON(t)
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/events", strings.NewReader(body))
@@ -240,7 +292,7 @@ func TestAuthMiddleware_NoKeyConfigured(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	handler := authMiddleware("", next)
+	handler := authMiddleware(NewAPIKeys(), nil, next)
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	rr := httptest.NewRecorder()
 	handler(rr, req)
@@ -260,7 +312,7 @@ func TestAuthMiddleware_ValidKey(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	handler := authMiddleware("secret-key", next)
+	handler := authMiddleware(NewAPIKeys("secret-key"), nil, next)
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	req.Header.Set("X-API-Key", "secret-key")
 	rr := httptest.NewRecorder()
@@ -277,7 +329,7 @@ func TestAuthMiddleware_InvalidKey(t *testing.T) {
 		called = true
 	})
 
-	handler := authMiddleware("secret-key", next)
+	handler := authMiddleware(NewAPIKeys("secret-key"), nil, next)
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	req.Header.Set("X-API-Key", "wrong-key")
 	rr := httptest.NewRecorder()
@@ -300,7 +352,7 @@ func TestAuthMiddleware_MissingKey(t *testing.T) {
 		t.Error("handler should NOT be called with missing key")
 	})
 
-	handler := authMiddleware("secret-key", next)
+	handler := authMiddleware(NewAPIKeys("secret-key"), nil, next)
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	rr := httptest.NewRecorder()
 	handler(rr, req)
@@ -310,9 +362,183 @@ func TestAuthMiddleware_MissingKey(t *testing.T) {
 	}
 }
 
+func TestAPIKeys_MultipleKeys(t *testing.T) {
+	keys := NewAPIKeys("old-key", "", "new-key")
+	for _, k := range []string{"old-key", "new-key"} {
+		if !keys.Valid(k) {
+			t.Errorf("expected %q to be accepted", k)
+		}
+	}
+	for _, k := range []string{"", "other-key", "old-key,new-key"} {
+		if keys.Valid(k) {
+			t.Errorf("expected %q to be rejected", k)
+		}
+	}
+}
+
+func TestAuthMiddleware_TrimsConfiguredKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-key")
+	// Mounted secrets typically end with a newline, sometimes CRLF
+	if err := os.WriteFile(path, []byte("file-key\r\n"), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	fromFile, err := LoadAPIKeyFile(path)
+	if err != nil {
+		t.Fatalf("LoadAPIKeyFile failed: %v", err)
+	}
+
+	keys := NewAPIKeys(append(fromFile, trimAPIKey("env-key\n", "API_KEY"))...)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := authMiddleware(keys, nil, next)
+
+	for _, header := range []string{"env-key", "file-key"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", header)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected clean header %q to authenticate against a key with trailing whitespace, got %d", header, rr.Code)
+		}
+	}
+}
+
+func TestAuthMiddleware_ServiceBinding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-keys")
+	if err := os.WriteFile(path, []byte("tenant-key checkout-,cart\nadmin-key\n"), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	entries, err := LoadAPIKeyFile(path)
+	if err != nil {
+		t.Fatalf("LoadAPIKeyFile failed: %v", err)
+	}
+	keys := NewAPIKeys(entries...)
+	sink := setupSink(t)
+	facts := authMiddleware(keys, nil, handleFacts(sink, HandlerConfig{}))
+	events := authMiddleware(keys, nil, handleEvents(sink, HandlerConfig{}))
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		key     string
+		body    string
+		want    int
+	}{
+		{"bound key, permitted prefix", facts, "tenant-key", strings.Replace(validFactJSON(t), "test-service", "checkout-api", 1), http.StatusCreated},
+		{"bound key, second prefix", facts, "tenant-key", strings.Replace(validFactJSON(t), "test-service", "cart", 1), http.StatusCreated},
+		{"bound key, other service", facts, "tenant-key", validFactJSON(t), http.StatusForbidden},
+		{"bound key, other service event", events, "tenant-key", validEventJSON(t), http.StatusForbidden},
+		{"unbound key, any service", facts, "admin-key", validFactJSON(t), http.StatusCreated},
+		{"unbound key, any service event", events, "admin-key", validEventJSON(t), http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-API-Key", tt.key)
+			rr := httptest.NewRecorder()
+			tt.handler(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleBatchFacts_ServiceBindingRejectsOnlyForbiddenLines(t *testing.T) {
+	sink := setupSink(t)
+	handler := authMiddleware(NewAPIKeys("tenant-key checkout-"), nil, handleBatchFacts(sink, HandlerConfig{}))
+
+	body := strings.Replace(validFactJSON(t), "test-service", "checkout-api", 1) + "\n" + validFactJSON(t) + "\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/facts/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "tenant-key")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	var resp map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if rr.Code != http.StatusOK || fmt.Sprint(resp["accepted"]) != "1" || fmt.Sprint(resp["rejected"]) != "1" {
+		t.Errorf("expected 1 accepted and 1 rejected, got %d %v", rr.Code, resp)
+	}
+	if errs := fmt.Sprint(resp["errors"]); !strings.Contains(errs, "line 2") || !strings.Contains(errs, "not permitted") {
+		t.Errorf("expected line 2 to be rejected as not permitted, got %s", errs)
+	}
+}
+
+func TestLoadAPIKeyFile_RejectsMalformedBinding(t *testing.T) {
+	for _, content := range []string{"key a b\n", "key checkout-,\n"} {
+		path := filepath.Join(t.TempDir(), "api-keys")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write key file: %v", err)
+		}
+		if _, err := LoadAPIKeyFile(path); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("expected an error naming line 1 for %q, got %v", content, err)
+		}
+	}
+}
+
+func TestAPIKeys_WatchFileReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-keys")
+	if err := os.WriteFile(path, []byte("# rotated 2025-01\nold-key\n"), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	initial, err := LoadAPIKeyFile(path)
+	if err != nil {
+		t.Fatalf("LoadAPIKeyFile failed: %v", err)
+	}
+	keys := NewAPIKeys(initial...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go keys.WatchFile(ctx, path, 10*time.Millisecond)
+
+	// Rotation step 1: add the new key alongside the old one
+	if err := os.WriteFile(path, []byte("old-key\nnew-key\n"), 0600); err != nil {
+		t.Fatalf("failed to rewrite key file: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	waitFor(t, func() bool { return keys.Valid("new-key") })
+	if !keys.Valid("old-key") {
+		t.Error("old key should still be accepted while both are listed")
+	}
+
+	// An empty file is ignored rather than disabling auth
+	os.WriteFile(path, nil, 0600)
+	later = later.Add(time.Minute)
+	os.Chtimes(path, later, later)
+	time.Sleep(50 * time.Millisecond)
+	if !keys.Enabled() || !keys.Valid("new-key") {
+		t.Error("expected previous keys to stay in effect after an empty reload")
+	}
+
+	// Rotation step 2: drop the old key
+	os.WriteFile(path, []byte("new-key\n"), 0600)
+	later = later.Add(time.Minute)
+	os.Chtimes(path, later, later)
+	waitFor(t, func() bool { return !keys.Valid("old-key") })
+	if !keys.Valid("new-key") {
+		t.Error("new key should be accepted after the old one is removed")
+	}
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 1s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
 func TestWriteErrorJSON(t *testing.T) {
 	rr := httptest.NewRecorder()
-	writeErrorJSON(rr, http.StatusBadRequest, "test error")
+	writeError(rr, httptest.NewRequest(http.MethodPost, "/api/v1/facts", nil), http.StatusBadRequest, "test error")
 
 	if rr.Code != http.StatusBadRequest {
 		t.Errorf("expected 400, got %d", rr.Code)
@@ -335,9 +561,60 @@ func TestWriteErrorJSON(t *testing.T) {
 	}
 }
 
+func TestWriteError_Accept(t *testing.T) {
+	tests := []struct {
+		accept    string
+		wantPlain bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"*/*", false},
+		{"text/*", false},
+		{"text/plain", true},
+		{"text/plain; charset=utf-8", true},
+		{"text/plain, */*;q=0.8", true},
+		{"application/json, text/plain", false},
+		{"text/plain;q=0.9, application/json", false},
+		{"application/json;q=0.5, text/plain", true},
+		{"text/plain;q=0", false},
+		{"text/plain;q=bogus", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/facts", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			writeError(rr, req, http.StatusTooManyRequests, "rate limit exceeded")
+
+			if rr.Code != http.StatusTooManyRequests {
+				t.Errorf("expected 429, got %d", rr.Code)
+			}
+			ct := rr.Header().Get("Content-Type")
+			if tt.wantPlain {
+				if !strings.HasPrefix(ct, "text/plain") {
+					t.Errorf("expected text/plain, got %s", ct)
+				}
+				if rr.Body.String() != "rate limit exceeded\n" {
+					t.Errorf("expected the bare message, got %q", rr.Body.String())
+				}
+				return
+			}
+			if ct != "application/json" {
+				t.Errorf("expected application/json, got %s", ct)
+			}
+			var resp map[string]interface{}
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || resp["error"] != "rate limit exceeded" {
+				t.Errorf("expected a JSON error body, got %q", rr.Body.String())
+			}
+		})
+	}
+}
+
 func TestHandleBatchFacts_ValidBatch(t *testing.T) {
 	sink := setupSink(t)
-	handler := handleBatchFacts(sink)
+	handler := handleBatchFacts(sink, HandlerConfig{})
 
 	line1 := validFactJSON(t)
 	line2 := validFactJSON(t)
@@ -362,11 +639,14 @@ func TestHandleBatchFacts_ValidBatch(t *testing.T) {
 	if fmt.Sprintf("%v", resp["rejected"]) != "0" {
 		t.Errorf("expected 0 rejected, got %v", resp["rejected"])
 	}
+	if resp["error_kind"] != "none" {
+		t.Errorf("expected error_kind none, got %v", resp["error_kind"])
+	}
 }
 
 func TestHandleBatchFacts_MixedValid(t *testing.T) {
 	sink := setupSink(t)
-	handler := handleBatchFacts(sink)
+	handler := handleBatchFacts(sink, HandlerConfig{})
 
 	validLine := validFactJSON(t)
 	body := validLine + "\n{bad json}\n"
@@ -392,7 +672,7 @@ func TestHandleBatchFacts_MixedValid(t *testing.T) {
 
 func TestHandleBatchFacts_EmptyBody(t *testing.T) {
 	sink := setupSink(t)
-	handler := handleBatchFacts(sink)
+	handler := handleBatchFacts(sink, HandlerConfig{})
 
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/facts/batch", strings.NewReader(""))
 	req.Header.Set("Content-Type", "application/json")
@@ -404,6 +684,146 @@ func TestHandleBatchFacts_EmptyBody(t *testing.T) {
 	}
 }
 
+func TestHandleBatchFacts_MaxLines(t *testing.T) {
+	sink := setupSink(t)
+	handler := handleBatchFacts(sink, HandlerConfig{MaxBatchLines: 3})
+
+	rr := httptest.NewRecorder()
+	handler(rr, jsonRequest("/api/v1/facts/batch", strings.Repeat("{}\n", 4)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a batch over the line limit, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "max 3") {
+		t.Errorf("expected the limit in the error, got %s", rr.Body.String())
+	}
+
+	// Exactly at the limit is processed normally, blank lines not counted
+	rr = httptest.NewRecorder()
+	body := validFactJSON(t) + "\n\n" + validFactJSON(t) + "\n{}\n"
+	handler(rr, jsonRequest("/api/v1/facts/batch", body))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 at the line limit, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if fmt.Sprintf("%v", resp["accepted"]) != "2" {
+		t.Errorf("expected 2 accepted, got %v", resp["accepted"])
+	}
+}
+
+func TestHandleBatchFacts_PartialPersistReportsFailurePoint(t *testing.T) {
+	bufDir := t.TempDir()
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	sink, err := NewDurableSink(bufDir, store, WithEventDayPartitioning())
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.Close()
+
+	// A directory where the 2025-01-16 buffer file should go makes that write
+	// fail (startupScan skips directories, so it is left alone)
+	os.MkdirAll(filepath.Join(bufDir, "request_facts", "2025-01-16", "current.jsonl"), 0755)
+
+	factAt := func(ts time.Time) string {
+		data, _ := protojson.Marshal(&gravixv1.RequestFact{
+			EventId:      newUUIDv7(t),
+			EventTime:    timestamppb.New(ts),
+			Service:      "test-service",
+			Method:       "GET",
+			PathTemplate: "/api/test",
+			StatusCode:   200,
+			LatencyMs:    10,
+		})
+		return string(data)
+	}
+	day1 := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	body := strings.Join([]string{
+		factAt(day1),
+		"{bad json}",
+		factAt(day1.Add(time.Minute)),
+		factAt(day1.Add(24 * time.Hour)),
+		factAt(day1.Add(2 * time.Minute)),
+	}, "\n")
+
+	rr := httptest.NewRecorder()
+	handleBatchFacts(sink, HandlerConfig{})(rr, jsonRequest("/api/v1/facts/batch", body))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+	if fmt.Sprint(resp["persisted"]) != "2" || fmt.Sprint(resp["failed_at_line"]) != "4" {
+		t.Errorf("expected persisted=2 failed_at_line=4, got %v", resp)
+	}
+	if resp["error_kind"] != "server" || resp["reason"] != "write_failed" ||
+		fmt.Sprint(resp["accepted"]) != "2" || fmt.Sprint(resp["rejected"]) != "1" {
+		t.Errorf("expected error_kind=server reason=write_failed accepted=2 rejected=1, got %v", resp)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(bufDir, "request_facts", "2025-01-15", "current.jsonl"))
+	if n := strings.Count(string(data), "\n"); n != 2 {
+		t.Errorf("expected exactly the 2 reported lines in the buffer, got %d", n)
+	}
+}
+
+func TestTraceIDFromRequest(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+		ok     bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"", "", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", false}, // invalid all-zero id
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "", false}, // must be lowercase
+		{"00-4bf92f3577b34da6-00f067aa0ba902b7-01", "", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", false}, // forbidden version
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("traceparent", tt.header)
+		got, ok := traceIDFromRequest(req)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("traceIDFromRequest(%q) = %q, %v; want %q, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDurationMiddleware_AttachesTraceExemplar(t *testing.T) {
+	const path = "/test/exemplar"
+	ingestionRequestDurationSeconds.DeleteLabelValues(path)
+	handler := durationMiddleware(path, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler(httptest.NewRecorder(), req)
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+
+	var m dto.Metric
+	if err := ingestionRequestDurationSeconds.WithLabelValues(path).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("failed to read histogram: %v", err)
+	}
+	if got := m.GetHistogram().GetSampleCount(); got != 2 {
+		t.Errorf("expected 2 observations, got %d", got)
+	}
+	var traceIDs []string
+	for _, b := range m.GetHistogram().GetBucket() {
+		for _, l := range b.GetExemplar().GetLabel() {
+			traceIDs = append(traceIDs, l.GetValue())
+		}
+	}
+	if len(traceIDs) != 1 || traceIDs[0] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected one exemplar with the request's trace ID, got %v", traceIDs)
+	}
+}
+
 func TestRateLimiter_AllowAndDeny(t *testing.T) {
 	rl := NewRateLimiter(10, 5) // 10/sec, burst of 5
 
@@ -420,6 +840,30 @@ func TestRateLimiter_AllowAndDeny(t *testing.T) {
 	}
 }
 
+func TestEndpointLimiters_Independent(t *testing.T) {
+	limiters := endpointLimiters(RateLimit{Rate: 1, Burst: 1}, RateLimit{Rate: 1, Burst: 2}, RateLimit{Rate: 1, Burst: 1})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	call := func(path string) int {
+		rr := httptest.NewRecorder()
+		rateLimitMiddleware(limiters[path], ok)(rr, httptest.NewRequest(http.MethodPost, path, nil))
+		return rr.Code
+	}
+
+	// Use up the facts bucket
+	call("/api/v1/facts")
+	if code := call("/api/v1/facts"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the facts limit to be exhausted, got %d", code)
+	}
+	for _, path := range []string{"/api/v1/facts/batch", "/api/v1/facts/batch", "/api/v1/ingest/batch", "/api/v1/events/batch", "/api/v1/events", "/api/v1/events/tail"} {
+		if code := call(path); code != http.StatusOK {
+			t.Errorf("%s: expected 200 while facts are limited, got %d", path, code)
+		}
+	}
+	if code := call("/api/v1/events"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the events limit to be exhausted, got %d", code)
+	}
+}
+
 func TestRateLimitMiddleware_BlocksWhenExhausted(t *testing.T) {
 	rl := NewRateLimiter(1, 1)
 
@@ -467,6 +911,46 @@ func TestSplitJSONL_EmptyLines(t *testing.T) {
 	}
 }
 
+func TestSplitJSONL_CRLF(t *testing.T) {
+	input := []byte("{\"a\":1}\r\n\r\n{\"b\":2}\r\n{\"c\":3}")
+	lines := splitJSONL(input)
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 non-empty lines, got %d: %q", len(lines), lines)
+	}
+	for _, line := range lines {
+		if bytes.ContainsRune(line, '\r') {
+			t.Errorf("expected the carriage return to be stripped, got %q", line)
+		}
+	}
+}
+
+func TestHandleBatchFacts_CRLF(t *testing.T) {
+	sink := setupSink(t)
+	rejections := NewRejectionLog(1)
+	handler := handleBatchFacts(sink, HandlerConfig{Rejections: rejections})
+
+	body := validFactJSON(t) + "\r\n\r\n" + validFactJSON(t) + "\r\n{bad json}\r\n"
+	rr := httptest.NewRecorder()
+	handler(rr, jsonRequest("/api/v1/facts/batch", body))
+
+	var resp map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if fmt.Sprint(resp["accepted"]) != "2" || fmt.Sprint(resp["rejected"]) != "1" || !strings.Contains(fmt.Sprint(resp["errors"]), "line 3:") {
+		t.Errorf("expected 2 accepted and line 3 rejected, got %v", resp)
+	}
+	if got := rejections.Recent(); len(got) != 1 || got[0].Payload != "{bad json}" {
+		t.Errorf("expected the rejected line without its carriage return, got %+v", got)
+	}
+
+	persisted, err := os.ReadFile(filepath.Join(sink.bufferDir, "request_facts", "current.jsonl"))
+	if err != nil {
+		t.Fatalf("failed to read buffer: %v", err)
+	}
+	if bytes.ContainsRune(persisted, '\r') || bytes.Count(persisted, []byte{'\n'}) != 2 {
+		t.Errorf("expected 2 LF-terminated records without carriage returns, got %q", persisted)
+	}
+}
+
 // TestUploadFailure_PreservesLocalFile is a regression test for the S3 upload
 // data-loss bug. When store.Put() fails, the local batch file MUST be preserved
 // so it can be retried later (e.g. on the next startupScan).
@@ -503,3 +987,1825 @@ func TestUploadFailure_PreservesLocalFile(t *testing.T) {
 		t.Fatal("REGRESSION: local batch file was deleted after upload failure — data loss bug!")
 	}
 }
+
+func TestHandleFacts_SampledOutStillReturns201(t *testing.T) {
+	sink := setupSink(t)
+	// A rate this small drops effectively every fact
+	handler := handleFacts(sink, HandlerConfig{SampleRate: 1e-12})
+
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/facts", strings.NewReader(validFactJSON(t)))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected 201 for sampled-out fact, got %d", rr.Code)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(sink.bufferDir, "request_facts", "current.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("expected no facts to be buffered, stat err = %v", err)
+	}
+}
+
+func TestHandleFacts_SamplingStillValidates(t *testing.T) {
+	sink := setupSink(t)
+	handler := handleFacts(sink, HandlerConfig{SampleRate: 1e-12})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/facts", strings.NewReader(`{"bad": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid fact even when sampling, got %d", rr.Code)
+	}
+}
+
+func TestDurableSink_PartitionByEventDay(t *testing.T) {
+	bufDir := t.TempDir()
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local store: %v", err)
+	}
+	sink, err := NewDurableSink(bufDir, store, WithEventDayPartitioning())
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	t.Cleanup(func() { sink.Close() })
+
+	lateNight := `{"event_id":"a","event_time":"2025-01-15T23:59:58Z"}`
+	afterMidnight := `{"event_id":"b","event_time":"2025-01-16T00:00:01.5Z"}`
+	noTime := `{"event_id":"c"}`
+	for _, rec := range []string{lateNight, afterMidnight, noTime} {
+		if err := sink.Write("request_facts", []byte(rec)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	for _, dir := range []string{"request_facts/2025-01-15", "request_facts/2025-01-16", "request_facts"} {
+		if _, err := os.Stat(filepath.Join(bufDir, dir, "current.jsonl")); err != nil {
+			t.Errorf("expected buffer file in %s: %v", dir, err)
+		}
+	}
+
+	sink.rotateAll()
+
+	// Uploads run asynchronously after rotation
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		day15, _ := store.List(context.Background(), "raw/request_facts/2025-01-15/")
+		day16, _ := store.List(context.Background(), "raw/request_facts/2025-01-16/")
+		if len(day15) == 1 && len(day16) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected one upload per event day, got %v and %v", day15, day16)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSplitPartition(t *testing.T) {
+	tests := []struct {
+		partition, topic, day string
+	}{
+		{"request_facts", "request_facts", ""},
+		{"request_facts/2025-01-15", "request_facts", "2025-01-15"},
+		{"service_events/not-a-day", "service_events/not-a-day", ""},
+	}
+	for _, tt := range tests {
+		topic, day := splitPartition(tt.partition)
+		if topic != tt.topic || day != tt.day {
+			t.Errorf("splitPartition(%q) = (%q, %q), want (%q, %q)", tt.partition, topic, day, tt.topic, tt.day)
+		}
+	}
+}
+
+func TestDurableSink_NewlineFraming(t *testing.T) {
+	sink := setupSink(t)
+	if err := sink.Write("service_events", []byte("{\n\"service\": \"x\"\n}")); err == nil {
+		t.Error("expected multi-line JSON to be rejected")
+	}
+
+	// A newline inside a value is escaped by protojson, so the record stays on one line
+	event := &gravixv1.ServiceEvent{
+		EventId:    newUUIDv7(t),
+		EventTime:  timestamppb.New(time.Now().UTC()),
+		Service:    "test-service",
+		EventType:  "deploy_start",
+		Properties: map[string]string{"note": "line one\nline two\r\n"},
+	}
+	data, _ := protojson.Marshal(event)
+	rr := httptest.NewRecorder()
+	handleEvents(sink, HandlerConfig{})(rr, jsonRequest("/api/v1/events", string(data)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	persisted, err := os.ReadFile(filepath.Join(sink.bufferDir, "service_events", "current.jsonl"))
+	if err != nil {
+		t.Fatalf("failed to read buffer: %v", err)
+	}
+	lines := splitJSONL(persisted)
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 buffered line, got %d: %q", len(lines), persisted)
+	}
+	var stored gravixv1.ServiceEvent
+	if err := protojson.Unmarshal(lines[0], &stored); err != nil {
+		t.Fatalf("buffered line is not a valid event: %v", err)
+	}
+	if stored.Properties["note"] != "line one\nline two\r\n" {
+		t.Errorf("expected the newline to round-trip, got %q", stored.Properties["note"])
+	}
+}
+
+func TestDurableSink_CountsPersistedRecordsPerTopic(t *testing.T) {
+	sink := setupSink(t)
+	before := persistedRecords(t, "request_facts")
+
+	// Facts from both the single and the batch endpoint land in the same topic
+	handleFacts(sink, HandlerConfig{})(httptest.NewRecorder(), jsonRequest("/api/v1/facts", validFactJSON(t)))
+	handleBatchFacts(sink, HandlerConfig{})(httptest.NewRecorder(), jsonRequest("/api/v1/facts/batch", validFactJSON(t)+"\n"+validFactJSON(t)))
+
+	after := persistedRecords(t, "request_facts")
+	if after-before != 3 {
+		t.Errorf("expected 3 persisted request_facts records, got %v", after-before)
+	}
+}
+
+func persistedRecords(t *testing.T, topic string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := ingestionPersistedRecordsTotal.WithLabelValues(topic).Write(&m); err != nil {
+		t.Fatalf("failed to read counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func jsonRequest(path, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tp, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.7,,fd00::/8")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies failed: %v", err)
+	}
+	if len(tp) != 3 {
+		t.Fatalf("expected 3 prefixes, got %v", tp)
+	}
+	if _, err := ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+	if _, err := ParseTrustedProxies("not-an-ip"); err == nil {
+		t.Error("expected error for invalid IP")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		want       string
+	}{
+		{"No XFF", "203.0.113.5:4321", nil, "203.0.113.5"},
+		{"Untrusted peer spoofing XFF", "203.0.113.5:4321", []string{"1.2.3.4"}, "203.0.113.5"},
+		{"Trusted proxy", "10.0.0.1:80", []string{"198.51.100.9"}, "198.51.100.9"},
+		{"Spoofed entry left of real client", "10.0.0.1:80", []string{"1.2.3.4, 198.51.100.9"}, "198.51.100.9"},
+		{"Chain of trusted proxies", "10.0.0.1:80", []string{"198.51.100.9, 10.0.0.2, 10.0.0.3"}, "198.51.100.9"},
+		{"Multiple XFF headers", "10.0.0.1:80", []string{"198.51.100.9", "10.0.0.2"}, "198.51.100.9"},
+		{"Malformed hop stops the walk", "10.0.0.1:80", []string{"198.51.100.9, garbage"}, "10.0.0.1"},
+		{"All hops trusted", "10.0.0.1:80", []string{"10.0.0.2"}, "10.0.0.2"},
+		{"Trusted proxy without XFF", "10.0.0.1:80", nil, "10.0.0.1"},
+		{"IPv4-mapped IPv6 peer", "[::ffff:10.0.0.1]:80", []string{"198.51.100.9"}, "198.51.100.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := proxies.clientIP(req); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIP_NoTrustedProxiesIgnoresXFF(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:80"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	if got := TrustedProxies(nil).clientIP(req); got != "10.0.0.1" {
+		t.Errorf("expected RemoteAddr when no proxies are trusted, got %q", got)
+	}
+}
+
+func TestAppendBatchFooter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "current.jsonl")
+	records := []string{`{"event_id":"a"}`, `{"event_id":"b"}`, `{"event_id":"c"}`}
+	if err := os.WriteFile(path, []byte(strings.Join(records, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := appendBatchFooter(path); err != nil {
+		t.Fatalf("appendBatchFooter failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	lines := splitJSONL(data)
+	if len(lines) != 4 {
+		t.Fatalf("expected 3 records + footer, got %d lines", len(lines))
+	}
+	footer, ok := batch.ParseFooter(lines[3])
+	if !ok {
+		t.Fatalf("last line is not a footer: %s", lines[3])
+	}
+	sum := batch.NewChecksum()
+	for _, l := range lines[:3] {
+		sum.Add(l)
+	}
+	if err := sum.Verify(footer); err != nil {
+		t.Errorf("footer does not match content: %v", err)
+	}
+}
+
+func TestDurableSink_RotationDelayJitter(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	sink, err := NewDurableSink(t.TempDir(), store, WithRotation(time.Hour, 10*time.Minute))
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.Close()
+
+	firstSeen := make(map[time.Duration]bool)
+	for i := 0; i < 1000; i++ {
+		if d := sink.rotationDelay(true); d < 0 || d >= time.Hour {
+			t.Fatalf("first delay %v outside [0, 1h)", d)
+		} else {
+			firstSeen[d/(10*time.Minute)] = true
+		}
+		if d := sink.rotationDelay(false); d < 50*time.Minute || d > 70*time.Minute {
+			t.Fatalf("cycle delay %v outside 1h ± 10m", d)
+		}
+	}
+	if len(firstSeen) < 6 {
+		t.Errorf("expected startup offsets spread over the whole interval, got buckets %v", firstSeen)
+	}
+
+	// Without jitter every cycle waits exactly the interval
+	steady, err := NewDurableSink(t.TempDir(), store, WithRotation(time.Hour, 0))
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer steady.Close()
+	if d := steady.rotationDelay(false); d != time.Hour {
+		t.Errorf("expected 1h without jitter, got %v", d)
+	}
+}
+
+func TestDurableSink_RotatesOnInterval(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	sink, err := NewDurableSink(t.TempDir(), store, WithRotation(20*time.Millisecond, 5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write("request_facts", []byte(`{"a":1}`)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	waitFor(t, func() bool {
+		keys, _ := store.List(context.Background(), "raw/request_facts")
+		return len(keys) == 1
+	})
+}
+
+func TestDurableSink_ShedsWritesDuringRotation(t *testing.T) {
+	sink := setupSink(t)
+	done := make(chan struct{})
+	sink.mu.Lock()
+	sink.rotating["request_facts"] = done
+	sink.mu.Unlock()
+
+	// The rotation wait expires immediately
+	sink.after = func(time.Duration) <-chan time.Time {
+		expired := make(chan time.Time, 1)
+		expired <- time.Now()
+		return expired
+	}
+
+	rr := httptest.NewRecorder()
+	handleFacts(sink, HandlerConfig{})(rr, jsonRequest("/api/v1/facts", validFactJSON(t)))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("expected Retry-After 1, got %q", got)
+	}
+
+	rr = httptest.NewRecorder()
+	handleBatchFacts(sink, HandlerConfig{})(rr, jsonRequest("/api/v1/facts/batch", validFactJSON(t)))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected 503 with Retry-After from batch, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Other partitions are unaffected
+	if err := sink.Write("service_events", []byte(`{"a":1}`)); err != nil {
+		t.Errorf("Write to another topic failed: %v", err)
+	}
+
+	// Once the rotation finishes, a waiting write goes through
+	sink.after = func(time.Duration) <-chan time.Time { return nil }
+	errc := make(chan error, 1)
+	go func() { errc <- sink.Write("request_facts", []byte(`{"a":1}`)) }()
+	sink.mu.Lock()
+	delete(sink.rotating, "request_facts")
+	sink.mu.Unlock()
+	close(done)
+	if err := <-errc; err != nil {
+		t.Errorf("Write after rotation failed: %v", err)
+	}
+}
+
+func TestDurableSink_WriteErrorsAre500(t *testing.T) {
+	rr := httptest.NewRecorder()
+	if code := sinkWriteStatus(rr, errors.New("disk full")); code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", code)
+	}
+	if rr.Header().Get("Retry-After") != "" {
+		t.Error("expected no Retry-After for a non-rotation error")
+	}
+}
+
+func TestDurableSink_AppliesPermissions(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	// Group-writable modes a typical 022 umask would otherwise narrow
+	bufDir := filepath.Join(t.TempDir(), "buffer")
+	sink, err := NewDurableSink(bufDir, store, WithEventDayPartitioning(), WithPermissions(0770, 0660))
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write("request_facts", []byte(`{"event_time":"2025-01-15T10:30:00Z"}`)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	for path, want := range map[string]os.FileMode{
+		bufDir:                                 0770,
+		filepath.Join(bufDir, "request_facts"): 0770,
+		filepath.Join(bufDir, "request_facts", "2025-01-15"):                  0770,
+		filepath.Join(bufDir, "request_facts", "2025-01-15", "current.jsonl"): 0660,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat %s: %v", path, err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s: expected mode %04o, got %04o", path, want, got)
+		}
+	}
+}
+
+func TestParseFileMode(t *testing.T) {
+	for in, want := range map[string]os.FileMode{"0750": 0750, "640": 0640, "0o700": 0700} {
+		if got, err := ParseFileMode(in); err != nil || got != want {
+			t.Errorf("ParseFileMode(%q) = %04o, %v; want %04o", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "0800", "01777", "rwxr-x---"} {
+		if _, err := ParseFileMode(in); err == nil {
+			t.Errorf("expected ParseFileMode(%q) to fail", in)
+		}
+	}
+}
+
+func TestEventTail_StreamsAcceptedEvents(t *testing.T) {
+	sink := setupSink(t)
+	tail := NewEventTail(1)
+	srv := httptest.NewServer(authMiddleware(NewAPIKeys(), TrustedProxies{}, handleEventsTail(tail)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Only one stream is allowed
+	rr := httptest.NewRecorder()
+	handleEventsTail(tail)(rr, httptest.NewRequest(http.MethodGet, "/api/v1/events/tail", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 past the stream limit, got %d", rr.Code)
+	}
+
+	event := &gravixv1.ServiceEvent{
+		EventId:   newUUIDv7(t),
+		EventTime: timestamppb.New(time.Now().UTC()),
+		Service:   "test-service",
+		EventType: "deploy_started",
+	}
+	data, _ := protojson.Marshal(event)
+	rr = httptest.NewRecorder()
+	handleEvents(sink, HandlerConfig{Tail: tail})(rr, jsonRequest("/api/v1/events", string(data)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read the stream: %v", err)
+	}
+	payload, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+	if !ok {
+		t.Fatalf("expected a data line, got %q", line)
+	}
+	var streamed gravixv1.ServiceEvent
+	if err := protojson.Unmarshal([]byte(payload), &streamed); err != nil || streamed.EventId != event.EventId {
+		t.Errorf("expected event %s on the stream, got %q (%v)", event.EventId, payload, err)
+	}
+}
+
+func TestEventTail_DropsSlowSubscribers(t *testing.T) {
+	tail := NewEventTail(2)
+	slow, _ := tail.subscribe(nil)
+	before := counterValue(t, ingestionTailDroppedTotal)
+
+	// Publishing past the buffer must neither block nor keep the subscriber
+	for i := 0; i <= tailBufferSize; i++ {
+		tail.publish("api", []byte(`{}`))
+	}
+	received := 0
+	for range slow.events {
+		received++
+	}
+	if received != tailBufferSize {
+		t.Errorf("expected the %d buffered events before the drop, got %d", tailBufferSize, received)
+	}
+	if got := counterValue(t, ingestionTailDroppedTotal) - before; got != 1 {
+		t.Errorf("expected 1 dropped stream, got %v", got)
+	}
+	tail.unsubscribe(slow) // safe after a drop
+
+	// Bound keys only see their own services
+	bound, ok := tail.subscribe([]string{"checkout-"})
+	if !ok {
+		t.Fatal("expected room for a new stream after the drop")
+	}
+	tail.publish("payments", []byte(`{"service":"payments"}`))
+	tail.publish("checkout-api", []byte(`{"service":"checkout-api"}`))
+	if got := string(<-bound.events); got != `{"service":"checkout-api"}` {
+		t.Errorf("expected only the checkout-api event, got %s", got)
+	}
+
+	tail.Close()
+	if _, ok := <-bound.events; ok {
+		t.Error("expected Close to end the stream")
+	}
+	if _, ok := tail.subscribe(nil); ok {
+		t.Error("expected no new streams after Close")
+	}
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatalf("failed to read counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestDurableSink_MaxActiveFiles(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	sink, err := NewDurableSink(t.TempDir(), store, WithEventDayPartitioning(), WithMaxActiveFiles(2))
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.Close()
+
+	for _, day := range []string{"2025-01-15", "2025-01-16"} {
+		if err := sink.Write("service_events", []byte(`{"event_time":"`+day+`T10:00:00Z"}`)); err != nil {
+			t.Fatalf("Write for %s failed: %v", day, err)
+		}
+	}
+	// Open files take more writes; a third partition is refused
+	if err := sink.Write("service_events", []byte(`{"event_time":"2025-01-15T11:00:00Z"}`)); err != nil {
+		t.Errorf("Write to an open file failed: %v", err)
+	}
+	err = sink.Write("service_events", []byte(`{"event_time":"2025-01-17T10:00:00Z"}`))
+	if !errors.Is(err, ErrTooManyActiveFiles) {
+		t.Fatalf("expected ErrTooManyActiveFiles, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(sink.bufferDir, "service_events", "2025-01-17")); !os.IsNotExist(err) {
+		t.Errorf("expected no buffer dir for the refused partition, got %v", err)
+	}
+
+	// The handler turns it into a 503
+	event := &gravixv1.ServiceEvent{
+		EventId:   newUUIDv7(t),
+		EventTime: timestamppb.New(time.Date(2025, 1, 18, 10, 0, 0, 0, time.UTC)),
+		Service:   "test-service",
+		EventType: "deploy_started",
+	}
+	data, _ := protojson.Marshal(event)
+	rr := httptest.NewRecorder()
+	handleEvents(sink, HandlerConfig{})(rr, jsonRequest("/api/v1/events", string(data)))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Rotation releases the files; wait for both uploads so cleanup doesn't race them
+	sink.rotateAll()
+	waitFor(t, func() bool {
+		keys, _ := store.List(context.Background(), "raw/service_events")
+		return len(keys) == 2
+	})
+	if err := sink.Write("service_events", []byte(`{"event_time":"2025-01-17T10:00:00Z"}`)); err != nil {
+		t.Errorf("Write after rotation failed: %v", err)
+	}
+}
+
+func TestHandleEvents_RedactsProperties(t *testing.T) {
+	for _, mode := range []string{"hash", "drop"} {
+		t.Run(mode, func(t *testing.T) {
+			sink := setupSink(t)
+			policy, err := ParseRedactionPolicy("email, User_ID", mode)
+			if err != nil {
+				t.Fatalf("ParseRedactionPolicy failed: %v", err)
+			}
+			handler := handleEvents(sink, HandlerConfig{Redaction: policy})
+
+			event := &gravixv1.ServiceEvent{
+				EventId:   newUUIDv7(t),
+				EventTime: timestamppb.New(time.Now().UTC()),
+				Service:   "test-service",
+				EventType: "user_signed_up",
+				Properties: map[string]string{
+					"email":   "jane@example.com",
+					"user_id": "u-12345",
+					"plan":    "pro",
+				},
+			}
+			data, _ := protojson.Marshal(event)
+			rr := httptest.NewRecorder()
+			handler(rr, jsonRequest("/api/v1/events", string(data)))
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+			}
+
+			persisted, err := os.ReadFile(filepath.Join(sink.bufferDir, "service_events", "current.jsonl"))
+			if err != nil {
+				t.Fatalf("failed to read buffer: %v", err)
+			}
+			for _, secret := range []string{"jane@example.com", "u-12345"} {
+				if strings.Contains(string(persisted), secret) {
+					t.Errorf("persisted bytes contain redacted value %q: %s", secret, persisted)
+				}
+			}
+			var stored gravixv1.ServiceEvent
+			if err := protojson.Unmarshal(persisted, &stored); err != nil {
+				t.Fatalf("persisted event is not valid: %v", err)
+			}
+			if stored.Properties["plan"] != "pro" {
+				t.Errorf("unlisted property should be kept, got %v", stored.Properties)
+			}
+
+			email, ok := stored.Properties["email"]
+			switch mode {
+			case "drop":
+				if ok {
+					t.Errorf("expected email to be dropped, got %q", email)
+				}
+			case "hash":
+				// sha256("jane@example.com")
+				if want := "8c87b489ce35cf2e2f39f80e282cb2e804932a56a213983eeeb428407d43b52d"; email != want {
+					t.Errorf("expected email hashed to %s, got %q", want, email)
+				}
+			}
+		})
+	}
+
+	if _, err := ParseRedactionPolicy("email", "mask"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestHandleEvents_ServiceNameValidation(t *testing.T) {
+	sink := setupSink(t)
+	cfg := HandlerConfig{SchemaOptions: []schemas.Option{schemas.WithServiceNamePattern(schemas.DefaultServiceNamePattern)}}
+	handler := handleEvents(sink, cfg)
+
+	// A UUID starting with a letter also matches the kebab-case pattern
+	for _, service := range []string{"3f2b8c1e-9d4a-4e7b-a1c2-5d6e7f8a9b0c", "abcdef12-3456-4789-abcd-ef0123456789", uuid.New().String()} {
+		event := &gravixv1.ServiceEvent{
+			EventId:   newUUIDv7(t),
+			EventTime: timestamppb.New(time.Now().UTC()),
+			Service:   service,
+			EventType: "deploy_started",
+		}
+		data, _ := protojson.Marshal(event)
+
+		rr := httptest.NewRecorder()
+		handler(rr, jsonRequest("/api/v1/events", string(data)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for UUID service name %s, got %d", service, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler(rr, jsonRequest("/api/v1/events", validEventJSON(t)))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected 201 for a valid service name, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRejectionLog_KeepsRecentRejections(t *testing.T) {
+	sink := setupSink(t)
+	rejections := NewRejectionLog(2)
+	cfg := HandlerConfig{Rejections: rejections}
+
+	rr := httptest.NewRecorder()
+	handleFacts(sink, cfg)(rr, jsonRequest("/api/v1/facts", `{"service": "first"}`))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handleBatchFacts(sink, cfg)(rr, jsonRequest("/api/v1/facts/batch", validFactJSON(t)+"\n"+`{"service": "second"}`))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	large := `{"service": "` + strings.Repeat("x", 2*maxRejectedPayloadBytes) + `"}`
+	rr = httptest.NewRecorder()
+	handleEvents(sink, cfg)(rr, jsonRequest("/api/v1/events", large))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+
+	// The first rejection has been overwritten; newest comes first
+	rr = httptest.NewRecorder()
+	handleRecentRejections(rejections)(rr, httptest.NewRequest(http.MethodGet, "/admin/recent-rejections", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var resp struct {
+		Capacity   int         `json:"capacity"`
+		Rejections []Rejection `json:"rejections"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if resp.Capacity != 2 || len(resp.Rejections) != 2 {
+		t.Fatalf("expected 2 of 2 rejections, got %d of %d", len(resp.Rejections), resp.Capacity)
+	}
+	newest, older := resp.Rejections[0], resp.Rejections[1]
+	if newest.Path != "/api/v1/events" || !newest.Truncated || len(newest.Payload) != maxRejectedPayloadBytes {
+		t.Errorf("expected a truncated events rejection, got path=%s truncated=%v len=%d", newest.Path, newest.Truncated, len(newest.Payload))
+	}
+	if older.Path != "/api/v1/facts/batch" || older.Payload != `{"service": "second"}` || older.Error == "" || older.Truncated {
+		t.Errorf("expected the rejected batch line with its error, got %+v", older)
+	}
+}
+
+func TestAuditMiddleware_RecordsAdminCalls(t *testing.T) {
+	sink := setupSink(t)
+	audit := NewAuditLog(sink, "admin_audit")
+	now := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	audit.now = func() time.Time { return now }
+	keys := NewAPIKeys("key-a", "key-b")
+	handler := auditMiddleware("recent_rejections", audit, keys, TrustedProxies{},
+		authMiddleware(keys, TrustedProxies{}, handleRecentRejections(NewRejectionLog(1))))
+
+	for _, key := range []string{"key-b", "wrong"} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/recent-rejections", nil)
+		req.Header.Set("X-API-Key", key)
+		handler(httptest.NewRecorder(), req)
+	}
+
+	data, err := os.ReadFile(filepath.Join(sink.bufferDir, "admin_audit", "current.jsonl"))
+	if err != nil {
+		t.Fatalf("expected audit records in the buffer: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit records, got %d: %s", len(lines), data)
+	}
+	var got []AuditRecord
+	for _, line := range lines {
+		var rec AuditRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid audit record %q: %v", line, err)
+		}
+		got = append(got, rec)
+	}
+	want := []AuditRecord{
+		{EventTime: now, Action: "recent_rejections", Method: http.MethodGet, ClientIP: "192.0.2.1", KeyIndex: 1, Status: http.StatusOK, Outcome: "success"},
+		{EventTime: now, Action: "recent_rejections", Method: http.MethodGet, ClientIP: "192.0.2.1", KeyIndex: -1, Status: http.StatusUnauthorized, Outcome: "denied"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+// skewedFactJSON returns a valid RequestFact JSON payload whose event_time is
+// offset from now.
+func skewedFactJSON(t *testing.T, offset time.Duration) string {
+	t.Helper()
+	fact := &gravixv1.RequestFact{
+		EventId:      newUUIDv7(t),
+		EventTime:    timestamppb.New(time.Now().UTC().Add(offset)),
+		Service:      "test-service",
+		Method:       "GET",
+		PathTemplate: "/api/health",
+		StatusCode:   200,
+		LatencyMs:    42,
+	}
+	data, err := protojson.Marshal(fact)
+	if err != nil {
+		t.Fatalf("failed to marshal fact: %v", err)
+	}
+	return string(data)
+}
+
+// clockSkewCount reads the number of skew observations in one direction.
+func clockSkewCount(t *testing.T, direction string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := ingestionClockSkewSeconds.WithLabelValues(direction).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatalf("failed to read metric: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestHandleFacts_ClockSkew(t *testing.T) {
+	future := 2 * time.Hour
+	past := -3 * 24 * time.Hour
+
+	t.Run("accept measures without changing the fact", func(t *testing.T) {
+		sink := setupSink(t)
+		futureBefore, pastBefore := clockSkewCount(t, "future"), clockSkewCount(t, "past")
+
+		handler := handleFacts(sink, HandlerConfig{})
+		for _, offset := range []time.Duration{future, past} {
+			rr := httptest.NewRecorder()
+			handler(rr, jsonRequest("/api/v1/facts", skewedFactJSON(t, offset)))
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("expected 201 for a fact skewed by %v, got %d: %s", offset, rr.Code, rr.Body.String())
+			}
+		}
+		if clockSkewCount(t, "future") != futureBefore+1 || clockSkewCount(t, "past") != pastBefore+1 {
+			t.Error("expected one future and one past skew observation")
+		}
+		persisted, _ := os.ReadFile(filepath.Join(sink.bufferDir, "request_facts", "current.jsonl"))
+		if strings.Contains(string(persisted), "skew_ms") {
+			t.Errorf("accept must not tag facts, got %s", persisted)
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		sink := setupSink(t)
+		policy, err := ParseClockSkewPolicy(time.Hour, "reject")
+		if err != nil {
+			t.Fatalf("ParseClockSkewPolicy failed: %v", err)
+		}
+		handler := handleFacts(sink, HandlerConfig{ClockSkew: policy})
+		for _, offset := range []time.Duration{future, past} {
+			rr := httptest.NewRecorder()
+			handler(rr, jsonRequest("/api/v1/facts", skewedFactJSON(t, offset)))
+			if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "clock skew") {
+				t.Errorf("expected 400 with clock skew for offset %v, got %d: %s", offset, rr.Code, rr.Body.String())
+			}
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, jsonRequest("/api/v1/facts", skewedFactJSON(t, -time.Minute)))
+		if rr.Code != http.StatusCreated {
+			t.Errorf("expected 201 within the allowed skew, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		rr = httptest.NewRecorder()
+		body := skewedFactJSON(t, 0) + "\n" + skewedFactJSON(t, future) + "\n"
+		handleBatchFacts(sink, HandlerConfig{ClockSkew: policy})(rr, jsonRequest("/api/v1/facts/batch", body))
+		var resp map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if fmt.Sprint(resp["accepted"]) != "1" || fmt.Sprint(resp["rejected"]) != "1" || !strings.Contains(fmt.Sprint(resp["errors"]), "line 2: clock skew") {
+			t.Errorf("expected line 2 rejected for clock skew, got %v", resp)
+		}
+	})
+
+	t.Run("tag", func(t *testing.T) {
+		sink := setupSink(t)
+		policy, err := ParseClockSkewPolicy(time.Hour, "tag")
+		if err != nil {
+			t.Fatalf("ParseClockSkewPolicy failed: %v", err)
+		}
+		body := skewedFactJSON(t, past) + "\n" + skewedFactJSON(t, future) + "\n" + skewedFactJSON(t, 0) + "\n"
+		rr := httptest.NewRecorder()
+		handleBatchFacts(sink, HandlerConfig{ClockSkew: policy})(rr, jsonRequest("/api/v1/facts/batch", body))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		persisted, err := os.ReadFile(filepath.Join(sink.bufferDir, "request_facts", "current.jsonl"))
+		if err != nil {
+			t.Fatalf("failed to read buffer: %v", err)
+		}
+		var skews []int64
+		for _, line := range splitJSONL(persisted) {
+			fact, err := schemas.ParseRequestFact(line)
+			if err != nil {
+				t.Fatalf("persisted fact is not valid: %v", err)
+			}
+			skews = append(skews, fact.SkewMs)
+		}
+		if len(skews) != 3 {
+			t.Fatalf("expected 3 persisted facts, got %d", len(skews))
+		}
+		// Allow for the time between building the payload and handling it
+		if d := time.Duration(skews[0])*time.Millisecond - past; d > 0 || d < -time.Minute {
+			t.Errorf("expected skew_ms ~%d for the past fact, got %d", past.Milliseconds(), skews[0])
+		}
+		if d := time.Duration(skews[1])*time.Millisecond - future; d > 0 || d < -time.Minute {
+			t.Errorf("expected skew_ms ~%d for the future fact, got %d", future.Milliseconds(), skews[1])
+		}
+		if skews[2] != 0 {
+			t.Errorf("expected no skew_ms within the allowed skew, got %d", skews[2])
+		}
+	})
+
+	if _, err := ParseClockSkewPolicy(time.Hour, "drop"); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+	if _, err := ParseClockSkewPolicy(0, "reject"); err == nil {
+		t.Error("expected an error for a non-positive max skew")
+	}
+}
+
+func TestHandleBatchFacts_DefaultEventTime(t *testing.T) {
+	sink := setupSink(t)
+	received := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	cfg := HandlerConfig{
+		SchemaOptions:    []schemas.Option{schemas.WithDefaultEventTime(func() time.Time { return received })},
+		DefaultEventTime: true,
+	}
+
+	rest := `"service":"test-service","method":"GET","path_template":"/api/health","status_code":200}`
+	body := `{"event_id":"` + newUUIDv7(t) + `",` + rest + "\n" +
+		`{"event_id":"` + newUUIDv7(t) + `","event_time":"0001-01-01T00:00:00Z",` + rest + "\n" +
+		validFactJSON(t) + "\n"
+	rr := httptest.NewRecorder()
+	handleBatchFacts(sink, cfg)(rr, jsonRequest("/api/v1/facts/batch", body))
+	var resp map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if fmt.Sprint(resp["accepted"]) != "2" || !strings.Contains(fmt.Sprint(resp["errors"]), "event_time is invalid") {
+		t.Fatalf("expected the missing event_time defaulted and the explicit zero one rejected, got %d: %v", rr.Code, resp)
+	}
+
+	persisted, err := os.ReadFile(filepath.Join(sink.bufferDir, "request_facts", "current.jsonl"))
+	if err != nil {
+		t.Fatalf("failed to read buffer: %v", err)
+	}
+	var defaulted []bool
+	for _, line := range splitJSONL(persisted) {
+		fact, err := schemas.ParseRequestFact(line)
+		if err != nil {
+			t.Fatalf("persisted fact is not valid: %v", err)
+		}
+		defaulted = append(defaulted, fact.EventTimeDefaulted)
+		if fact.EventTimeDefaulted && !fact.EventTime.AsTime().Equal(received) {
+			t.Errorf("expected the receive time %v, got %v", received, fact.EventTime.AsTime())
+		}
+	}
+	if !slices.Equal(defaulted, []bool{true, false}) {
+		t.Errorf("expected only the first persisted fact marked event_time_defaulted, got %v", defaulted)
+	}
+
+	// Without the flag a client can't mark its own timestamp as defaulted
+	sink = setupSink(t)
+	spoofed := strings.Replace(validFactJSON(t), "{", `{"event_time_defaulted":true,`, 1)
+	rr = httptest.NewRecorder()
+	handleFacts(sink, HandlerConfig{})(rr, jsonRequest("/api/v1/facts", spoofed))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	persisted, _ = os.ReadFile(filepath.Join(sink.bufferDir, "request_facts", "current.jsonl"))
+	if strings.Contains(string(persisted), "event_time_defaulted") {
+		t.Errorf("expected a client-sent event_time_defaulted to be discarded, got %s", persisted)
+	}
+}
+
+func TestRegisterMetrics_InstanceLabels(t *testing.T) {
+	labels, err := ParseInstanceLabels(" region=eu-west-1 , cluster=b")
+	if err != nil {
+		t.Fatalf("ParseInstanceLabels failed: %v", err)
+	}
+	reg := prometheus.NewRegistry()
+	if err := registerMetrics(prometheus.WrapRegistererWith(labels, reg)); err != nil {
+		t.Fatalf("registerMetrics failed: %v", err)
+	}
+	ingestionRequestsTotal.WithLabelValues("/api/v1/facts", "201").Inc()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	found := false
+	for _, mf := range families {
+		if mf.GetName() != "ingestion_requests_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			got := map[string]string{}
+			for _, lp := range m.GetLabel() {
+				got[lp.GetName()] = lp.GetValue()
+			}
+			if got["region"] != "eu-west-1" || got["cluster"] != "b" {
+				t.Errorf("expected region and cluster labels, got %v", got)
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("ingestion_requests_total was not gathered")
+	}
+
+	// Without -instance-label nothing is wrapped
+	reg = prometheus.NewRegistry()
+	if err := registerMetrics(reg); err != nil {
+		t.Fatalf("registerMetrics failed: %v", err)
+	}
+
+	// A label the metrics already use can't be added as a constant
+	clash, _ := ParseInstanceLabels("path=x")
+	if err := registerMetrics(prometheus.WrapRegistererWith(clash, prometheus.NewRegistry())); err == nil {
+		t.Error("expected an error for an instance label that clashes with a metric label")
+	}
+}
+
+func TestParseInstanceLabels(t *testing.T) {
+	if labels, err := ParseInstanceLabels(""); err != nil || len(labels) != 0 {
+		t.Errorf("expected no labels for an empty list, got %v (err %v)", labels, err)
+	}
+	for _, bad := range []string{"region", "region=", "1region=a", "__name__=a", "region=a,region=b"} {
+		if _, err := ParseInstanceLabels(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestHandleFacts_NormalizeMethod(t *testing.T) {
+	factWithMethod := func(method string) string {
+		data, err := protojson.Marshal(&gravixv1.RequestFact{
+			EventId:      newUUIDv7(t),
+			EventTime:    timestamppb.Now(),
+			Service:      "test-service",
+			Method:       method,
+			PathTemplate: "/api/health",
+			StatusCode:   200,
+		})
+		if err != nil {
+			t.Fatalf("failed to marshal fact: %v", err)
+		}
+		return string(data)
+	}
+	lower, mixed := factWithMethod("get"), factWithMethod("Post")
+
+	for _, normalize := range []bool{false, true} {
+		t.Run(fmt.Sprint("normalize=", normalize), func(t *testing.T) {
+			sink := setupSink(t)
+			cfg := HandlerConfig{NormalizeMethod: normalize}
+			rr := httptest.NewRecorder()
+			handleFacts(sink, cfg)(rr, jsonRequest("/api/v1/facts", lower))
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+			}
+			rr = httptest.NewRecorder()
+			handleBatchFacts(sink, cfg)(rr, jsonRequest("/api/v1/facts/batch", mixed+"\n"))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+
+			persisted, err := os.ReadFile(filepath.Join(sink.bufferDir, "request_facts", "current.jsonl"))
+			if err != nil {
+				t.Fatalf("failed to read buffer: %v", err)
+			}
+			var methods []string
+			for _, line := range splitJSONL(persisted) {
+				fact, err := schemas.ParseRequestFact(line)
+				if err != nil {
+					t.Fatalf("persisted fact is not valid: %v", err)
+				}
+				methods = append(methods, fact.Method)
+			}
+			want := []string{"get", "Post"}
+			if normalize {
+				want = []string{"GET", "POST"}
+			}
+			if !slices.Equal(methods, want) {
+				t.Errorf("expected persisted methods %v, got %v", want, methods)
+			}
+		})
+	}
+}
+
+func TestHandleEvents_PropertyAllowList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.json")
+	if err := os.WriteFile(path, []byte(`{"deploy_started": ["version"], "heartbeat": []}`), 0600); err != nil {
+		t.Fatalf("failed to write allow-list: %v", err)
+	}
+	allow, err := LoadPropertyAllowList(path)
+	if err != nil {
+		t.Fatalf("LoadPropertyAllowList failed: %v", err)
+	}
+	sink := setupSink(t)
+	handler := handleEvents(sink, HandlerConfig{SchemaOptions: []schemas.Option{schemas.WithPropertyAllowList(allow)}})
+
+	eventWith := func(eventType string, props map[string]string) string {
+		data, err := protojson.Marshal(&gravixv1.ServiceEvent{
+			EventId:    newUUIDv7(t),
+			EventTime:  timestamppb.Now(),
+			Service:    "test-service",
+			EventType:  eventType,
+			Properties: props,
+		})
+		if err != nil {
+			t.Fatalf("failed to marshal event: %v", err)
+		}
+		return string(data)
+	}
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"allowed key", eventWith("deploy_started", map[string]string{"version": "1.2.3"}), http.StatusCreated},
+		{"disallowed key", eventWith("deploy_started", map[string]string{"version": "1.2.3", "email": "a@b.c"}), http.StatusBadRequest},
+		{"empty list", eventWith("heartbeat", map[string]string{"region": "eu"}), http.StatusBadRequest},
+		{"unlisted event type", eventWith("cache_flushed", map[string]string{"region": "eu"}), http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler(rr, jsonRequest("/api/v1/events", tt.body))
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	os.WriteFile(path, []byte(`{"deploy_started": null}`), 0600)
+	if _, err := LoadPropertyAllowList(path); err == nil {
+		t.Error("expected an error for a null key list")
+	}
+}
+
+// withKind adds a "kind" discriminator to a JSON object line.
+func withKind(line, kind string) string {
+	return `{"kind":"` + kind + `",` + strings.TrimPrefix(line, "{")
+}
+
+func TestHandleMixedBatch(t *testing.T) {
+	type kindCounts struct{ Accepted, Rejected int }
+	type response struct {
+		Accepted, Rejected int
+		Facts, Events      kindCounts
+		Errors             []string
+	}
+	sink := setupSink(t)
+	handler := handleMixedBatch(sink, HandlerConfig{})
+	factLine := validFactJSON(t)
+
+	tests := []struct {
+		name       string
+		lines      []string
+		want       response
+		facts      float64 // records persisted to request_facts
+		events     float64
+		errorLines []string
+	}{
+		{
+			name:  "facts only",
+			lines: []string{validFactJSON(t), validFactJSON(t)},
+			want:  response{Accepted: 2, Facts: kindCounts{Accepted: 2}},
+			facts: 2,
+		},
+		{
+			name:   "events only",
+			lines:  []string{validEventJSON(t), validEventJSON(t), validEventJSON(t)},
+			want:   response{Accepted: 3, Events: kindCounts{Accepted: 3}},
+			events: 3,
+		},
+		{
+			name: "mixed",
+			lines: []string{
+				validFactJSON(t),
+				withKind(validEventJSON(t), "event"),
+				validEventJSON(t),
+				withKind(validFactJSON(t), "fact"),
+				withKind(validEventJSON(t), "fact"), // kind wins over what the line looks like
+				`{"event_id":"not-a-uuid"}`,
+				withKind(factLine, "metric"),
+			},
+			want: response{
+				Accepted: 4, Rejected: 3,
+				Facts:  kindCounts{Accepted: 2, Rejected: 1},
+				Events: kindCounts{Accepted: 2},
+			},
+			facts:      2,
+			events:     2,
+			errorLines: []string{"line 5", "line 6: neither a RequestFact", "line 7: kind must be"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factsBefore, eventsBefore := persistedRecords(t, "request_facts"), persistedRecords(t, "service_events")
+			rr := httptest.NewRecorder()
+			handler(rr, jsonRequest("/api/v1/ingest/batch", strings.Join(tt.lines, "\n")))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+
+			var got response
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("response is not valid JSON: %v", err)
+			}
+			errs := got.Errors
+			got.Errors = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+			if len(errs) != len(tt.errorLines) {
+				t.Fatalf("expected errors for %v, got %v", tt.errorLines, errs)
+			}
+			for i, prefix := range tt.errorLines {
+				if !strings.HasPrefix(errs[i], prefix) {
+					t.Errorf("expected error %d to start with %q, got %q", i, prefix, errs[i])
+				}
+			}
+
+			if n := persistedRecords(t, "request_facts") - factsBefore; n != tt.facts {
+				t.Errorf("expected %v facts persisted, got %v", tt.facts, n)
+			}
+			if n := persistedRecords(t, "service_events") - eventsBefore; n != tt.events {
+				t.Errorf("expected %v events persisted, got %v", tt.events, n)
+			}
+		})
+	}
+}
+
+func TestHandleBatchFacts_CapsErrors(t *testing.T) {
+	sink := setupSink(t)
+	lines := []string{validFactJSON(t)}
+	for range 150 {
+		lines = append(lines, `{"bad json`)
+	}
+	body := strings.Join(lines, "\n")
+
+	for _, tt := range []struct {
+		maxErrors, listed, truncated int
+	}{
+		{0, defaultMaxBatchErrors, 150 - defaultMaxBatchErrors},
+		{10, 10, 140},
+		{200, 150, 0},
+	} {
+		rr := httptest.NewRecorder()
+		handleBatchFacts(sink, HandlerConfig{MaxBatchErrors: tt.maxErrors})(rr, jsonRequest("/api/v1/facts/batch", body))
+
+		var resp struct {
+			Accepted        int      `json:"accepted"`
+			Rejected        int      `json:"rejected"`
+			Errors          []string `json:"errors"`
+			TruncatedErrors *int     `json:"truncated_errors"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("response is not valid JSON: %v", err)
+		}
+		if resp.Accepted != 1 || resp.Rejected != 150 {
+			t.Errorf("max %d: expected 1 accepted and all 150 rejections counted, got %d/%d", tt.maxErrors, resp.Accepted, resp.Rejected)
+		}
+		if len(resp.Errors) != tt.listed || !strings.HasPrefix(resp.Errors[0], "line 2:") {
+			t.Errorf("max %d: expected %d errors from line 2 on, got %d", tt.maxErrors, tt.listed, len(resp.Errors))
+		}
+		switch {
+		case tt.truncated == 0 && resp.TruncatedErrors != nil:
+			t.Errorf("max %d: expected no truncated_errors, got %d", tt.maxErrors, *resp.TruncatedErrors)
+		case tt.truncated > 0 && (resp.TruncatedErrors == nil || *resp.TruncatedErrors != tt.truncated):
+			t.Errorf("max %d: expected truncated_errors %d, got %v", tt.maxErrors, tt.truncated, resp.TruncatedErrors)
+		}
+	}
+}
+
+func TestDurableSink_OldestPendingBatchAge(t *testing.T) {
+	sink := setupSink(t)
+	touch := func(path string, age time.Duration) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("{}\n"), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		mtime := time.Now().Add(-age)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("Chtimes failed: %v", err)
+		}
+	}
+	// Files are created after NewDurableSink, so its startup scan doesn't upload them
+	touch(filepath.Join(sink.bufferDir, "request_facts", "batch_a.jsonl"), 10*time.Minute)
+	touch(filepath.Join(sink.bufferDir, "request_facts", "batch_b.jsonl"), time.Minute)
+	touch(filepath.Join(sink.bufferDir, "request_facts", "current.jsonl"), 2*time.Hour)
+	touch(filepath.Join(sink.bufferDir, "service_events", "2025-01-15", "batch_c.jsonl"), time.Hour)
+	touch(filepath.Join(sink.bufferDir, "admin_audit", "current.jsonl"), time.Hour)
+
+	sink.updatePendingAges()
+
+	for topic, want := range map[string]time.Duration{
+		"request_facts":  10 * time.Minute, // current.jsonl is not pending
+		"service_events": time.Hour,
+		"admin_audit":    0,
+	} {
+		var m dto.Metric
+		if err := ingestionOldestPendingBatchSeconds.WithLabelValues(topic).Write(&m); err != nil {
+			t.Fatalf("failed to read gauge: %v", err)
+		}
+		if got := m.GetGauge().GetValue(); got < want.Seconds() || got > want.Seconds()+30 {
+			t.Errorf("%s: expected an oldest pending age of about %v, got %vs", topic, want, got)
+		}
+	}
+}
+
+// writeBufferBatch creates a rotated batch file under the buffer and returns its path.
+func writeBufferBatch(t *testing.T, bufDir, partition, name string) string {
+	t.Helper()
+	dir := filepath.Join(bufDir, partition)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(`{"event":"test"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readPendingIndex returns the batches the pending index under bufDir lists.
+func readPendingIndex(t *testing.T, bufDir string) ([]string, bool) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(bufDir, pendingIndexName))
+	if err != nil {
+		t.Fatalf("failed to read pending index: %v", err)
+	}
+	idx := &pendingIndex{root: bufDir, pending: make(map[string]bool)}
+	ok := idx.parse(data)
+	return slices.Sorted(maps.Keys(idx.pending)), ok
+}
+
+func TestDurableSink_PendingIndexAfterCrash(t *testing.T) {
+	bufDir := t.TempDir()
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// Crashed after the rename, before the upload: listed and on disk
+	writeBufferBatch(t, bufDir, "request_facts", "batch_1.jsonl")
+	// batch_2 was listed but never renamed into place, and batch_3 was
+	// uploaded and its removal logged.
+	// An unlisted file is not looked at while the index is intact
+	unlisted := writeBufferBatch(t, bufDir, "service_events", "batch_4.jsonl")
+	index := "+ request_facts/batch_1.jsonl\n" +
+		"+ request_facts/batch_2.jsonl\n" +
+		"+ request_facts/batch_3.jsonl\n" +
+		"- request_facts/batch_3.jsonl\n" +
+		"+ request_facts/batch_5" // torn by a crash mid-append
+	if err := os.WriteFile(filepath.Join(bufDir, pendingIndexName), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := NewDurableSink(bufDir, store, WithPendingIndex())
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.Close()
+
+	waitFor(t, func() bool {
+		pending, _ := readPendingIndex(t, bufDir)
+		return len(pending) == 0
+	})
+	keys, _ := store.List(context.Background(), "raw/")
+	if len(keys) != 1 || !strings.HasSuffix(keys[0], "/batch_1.jsonl") {
+		t.Errorf("expected only batch_1 to be uploaded, got %v", keys)
+	}
+	if _, err := os.Stat(unlisted); err != nil {
+		t.Errorf("expected the unlisted batch to be left alone, got %v", err)
+	}
+}
+
+func TestDurableSink_PendingIndexCorruptFallsBackToWalk(t *testing.T) {
+	bufDir := t.TempDir()
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	writeBufferBatch(t, bufDir, "request_facts/2025-01-15", "batch_1.jsonl")
+	if err := os.WriteFile(filepath.Join(bufDir, pendingIndexName), []byte("not an index\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := NewDurableSink(bufDir, store, WithPendingIndex())
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.Close()
+
+	waitFor(t, func() bool {
+		keys, _ := store.List(context.Background(), "raw/request_facts/2025-01-15/")
+		return len(keys) == 1
+	})
+	waitFor(t, func() bool {
+		pending, ok := readPendingIndex(t, bufDir)
+		return ok && len(pending) == 0
+	})
+}
+
+func TestDurableSink_PendingIndexListsFailedUploads(t *testing.T) {
+	bufDir := t.TempDir()
+	sink, err := NewDurableSink(bufDir, &failingStore{}, WithPendingIndex())
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	if err := sink.Write("request_facts", []byte(`{"event":"test"}`)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	sink.rotateAll()
+	sink.Close()
+
+	pending, ok := readPendingIndex(t, bufDir)
+	if !ok || len(pending) != 1 || !strings.HasPrefix(pending[0], filepath.Join("request_facts", "batch_")) {
+		t.Fatalf("expected the rotated batch to be listed, got %v (ok %v)", pending, ok)
+	}
+
+	// Restart as if after a crash, with a working store
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	restarted, err := NewDurableSink(bufDir, store, WithPendingIndex())
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer restarted.Close()
+
+	waitFor(t, func() bool {
+		keys, _ := store.List(context.Background(), "raw/request_facts/")
+		return len(keys) == 1 && strings.HasSuffix(keys[0], filepath.Base(pending[0]))
+	})
+	waitFor(t, func() bool {
+		pending, _ := readPendingIndex(t, bufDir)
+		return len(pending) == 0
+	})
+}
+
+func TestDurableSink_WithoutPendingIndexRemovesStaleIndex(t *testing.T) {
+	bufDir := t.TempDir()
+	path := filepath.Join(bufDir, pendingIndexName)
+	if err := os.WriteFile(path, []byte("+ request_facts/batch_1.jsonl\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	sink, err := NewDurableSink(bufDir, store)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.Close()
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the stale index to be removed, stat err = %v", err)
+	}
+}
+
+// concurrencyStore records the most Puts it has seen in flight at once.
+type concurrencyStore struct {
+	storage.ObjectStore
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (s *concurrencyStore) Put(ctx context.Context, key string, r io.Reader, opts ...storage.PutOption) error {
+	s.mu.Lock()
+	s.inFlight++
+	s.peak = max(s.peak, s.inFlight)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+	time.Sleep(2 * time.Millisecond)
+	return s.ObjectStore.Put(ctx, key, r, opts...)
+}
+
+func TestDurableSink_StartupScanBoundsConcurrency(t *testing.T) {
+	bufDir := t.TempDir()
+	for i := range 40 {
+		writeBufferBatch(t, bufDir, "request_facts", fmt.Sprintf("batch_%d.jsonl", i))
+	}
+	local, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	store := &concurrencyStore{ObjectStore: local}
+
+	sink, err := NewDurableSink(bufDir, store, WithStartupUploads(3, 0))
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.Close()
+
+	waitFor(t, func() bool {
+		keys, _ := local.List(context.Background(), "raw/request_facts/")
+		return len(keys) == 40
+	})
+	waitFor(t, func() bool {
+		left, _ := os.ReadDir(filepath.Join(bufDir, "request_facts"))
+		return len(left) == 0
+	})
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.peak > 3 {
+		t.Errorf("expected at most 3 uploads at once, got %d", store.peak)
+	}
+	if store.peak < 2 {
+		t.Errorf("expected uploads to run concurrently, peak was %d", store.peak)
+	}
+}
+
+func TestGzipMiddleware_BatchResponse(t *testing.T) {
+	sink := setupSink(t)
+	lines := make([]string, 0, 200)
+	for range 200 {
+		lines = append(lines, `{"bad json`)
+	}
+	handler := gzipMiddleware(handleBatchFacts(sink, HandlerConfig{MaxBatchErrors: 200}))
+
+	req := jsonRequest("/api/v1/facts/batch", strings.Join(lines, "\n"))
+	req.Header.Set("Accept-Encoding", "br;q=1.0, gzip;q=0.8")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a gzip-encoded response, got headers %v", rr.Header())
+	}
+	if rr.Body.Len() > 2000 {
+		t.Errorf("expected 200 similar errors to compress well, got %d bytes", rr.Body.Len())
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("body is not gzip: %v", err)
+	}
+	var resp struct {
+		Rejected int      `json:"rejected"`
+		Errors   []string `json:"errors"`
+	}
+	if err := json.NewDecoder(zr).Decode(&resp); err != nil {
+		t.Fatalf("decompressed body is not valid JSON: %v", err)
+	}
+	if resp.Rejected != 200 || len(resp.Errors) != 200 {
+		t.Errorf("expected 200 listed rejections, got %d/%d", resp.Rejected, len(resp.Errors))
+	}
+
+	// Without Accept-Encoding, or with gzip refused, the body is plain
+	for _, accept := range []string{"", "gzip;q=0"} {
+		req := jsonRequest("/api/v1/facts/batch", strings.Join(lines, "\n"))
+		req.Header.Set("Accept-Encoding", accept)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if enc := rr.Header().Get("Content-Encoding"); enc != "" || !json.Valid(rr.Body.Bytes()) {
+			t.Errorf("Accept-Encoding %q: expected plain JSON, got encoding %q", accept, enc)
+		}
+	}
+}
+
+func TestGzipMiddleware_EmptyBodyUnencoded(t *testing.T) {
+	handler := gzipMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/facts", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusCreated || rr.Header().Get("Content-Encoding") != "" || rr.Body.Len() != 0 {
+		t.Errorf("expected an empty, unencoded 201, got %d %v %q", rr.Code, rr.Header(), rr.Body.String())
+	}
+}
+
+// gzipRequest returns a JSON POST to path with body gzip-compressed.
+func gzipRequest(t *testing.T, path, body string) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(body)); err != nil {
+		t.Fatalf("failed to gzip body: %v", err)
+	}
+	zw.Close()
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	return req
+}
+
+func TestHandlers_GzipRequestBody(t *testing.T) {
+	sink := setupSink(t)
+	tests := []struct {
+		path    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"/api/v1/facts", handleFacts(sink, HandlerConfig{}), validFactJSON(t)},
+		{"/api/v1/facts/batch", handleBatchFacts(sink, HandlerConfig{}), validFactJSON(t) + "\n" + validFactJSON(t)},
+		{"/api/v1/events", handleEvents(sink, HandlerConfig{}), validEventJSON(t)},
+		{"/api/v1/ingest/batch", handleMixedBatch(sink, HandlerConfig{}), validFactJSON(t) + "\n" + validEventJSON(t)},
+		{"/api/v1/events/batch", handleEventsBatch(sink, HandlerConfig{}), validEventJSON(t) + "\n" + validEventJSON(t)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tt.handler(rr, gzipRequest(t, tt.path, tt.body))
+			if rr.Code < 200 || rr.Code > 299 || strings.Contains(rr.Body.String(), `"rejected":1`) {
+				t.Errorf("expected the gzipped payload to be accepted, got %d: %s", rr.Code, rr.Body.String())
+			}
+
+			// A body that claims gzip but isn't
+			req := jsonRequest(tt.path, tt.body)
+			req.Header.Set("Content-Encoding", "gzip")
+			rr = httptest.NewRecorder()
+			tt.handler(rr, req)
+			if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "malformed gzip body") {
+				t.Errorf("expected 400 for a malformed gzip body, got %d: %s", rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleFacts_GzipBombRejected(t *testing.T) {
+	sink := setupSink(t)
+	handler := handleFacts(sink, HandlerConfig{})
+
+	// 8 MB of spaces compresses to a few KB, well under the limit on the wire
+	req := gzipRequest(t, "/api/v1/facts", strings.Repeat(" ", 8*maxBodyBytes))
+	if req.ContentLength >= maxBodyBytes {
+		t.Fatalf("compressed body should be small, got %d bytes", req.ContentLength)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 once the decompressed body passes the limit, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleFacts_UnsupportedContentEncoding(t *testing.T) {
+	sink := setupSink(t)
+	handler := handleFacts(sink, HandlerConfig{})
+
+	req := jsonRequest("/api/v1/facts", validFactJSON(t))
+	req.Header.Set("Content-Encoding", "br")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415 for Content-Encoding br, got %d", rr.Code)
+	}
+}
+
+func TestDurableSink_CloseFlushesPartialBatch(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	bufDir := t.TempDir()
+	// A long interval, so only Close can rotate
+	sink, err := NewDurableSink(bufDir, store, WithRotation(time.Hour, 0))
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	if err := sink.Write("request_facts", []byte(`{"event":"test"}`)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	sink.Close()
+
+	keys, err := store.List(context.Background(), "raw/request_facts")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 1 || !strings.HasPrefix(filepath.Base(keys[0]), "batch_") {
+		t.Fatalf("expected one uploaded batch after Close, got %v", keys)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(bufDir, "request_facts")); len(entries) != 0 {
+		t.Errorf("expected an empty buffer after Close, got %d entries", len(entries))
+	}
+}
+
+func TestDurableSink_WriteAfterClose(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	bufDir := t.TempDir()
+	sink, err := NewDurableSink(bufDir, store, WithRotation(time.Hour, 0))
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	sink.Close()
+
+	if err := sink.Write("request_facts", []byte(`{"event":"late"}`)); !errors.Is(err, ErrSinkClosed) {
+		t.Fatalf("expected ErrSinkClosed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(bufDir, "request_facts", "current.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("expected no buffer file after Close, got %v", err)
+	}
+	// Another instance can take the record
+	if code := sinkWriteStatus(httptest.NewRecorder(), ErrSinkClosed); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", code)
+	}
+}
+
+// blockingStore is an ObjectStore whose Put waits until its context ends.
+type blockingStore struct {
+	storage.ObjectStore
+}
+
+func (blockingStore) Put(ctx context.Context, _ string, _ io.Reader, _ ...storage.PutOption) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestDurableSink_CloseTimeoutKeepsBatch(t *testing.T) {
+	bufDir := t.TempDir()
+	sink, err := NewDurableSink(bufDir, blockingStore{}, WithRotation(time.Hour, 0), WithCloseTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	if err := sink.Write("request_facts", []byte(`{"event":"test"}`)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	start := time.Now()
+	sink.Close()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Close should give up after its timeout, took %v", elapsed)
+	}
+	// The cancelled upload leaves the rotated batch for the next startup scan
+	waitFor(t, func() bool {
+		batches, _ := filepath.Glob(filepath.Join(bufDir, "request_facts", "batch_*.jsonl"))
+		return len(batches) == 1
+	})
+}
+
+func TestDurableSink_RotatesOnSizeBeforeTimer(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	bufDir := t.TempDir()
+	// Each record takes 17 bytes with its newline, so the third reaches 40
+	sink, err := NewDurableSink(bufDir, store, WithRotation(time.Hour, 0), WithMaxBatchBytes(40))
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.Close()
+
+	record := []byte(`{"event":"test"}`)
+	for range 3 {
+		if err := sink.Write("request_facts", record); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	waitFor(t, func() bool {
+		keys, _ := store.List(context.Background(), "raw/request_facts")
+		return len(keys) == 1
+	})
+
+	// The next write starts a new file, counted from zero
+	for range 2 {
+		if err := sink.Write("request_facts", record); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(bufDir, "request_facts", "current.jsonl"))
+	if err != nil {
+		t.Fatalf("expected a new current.jsonl: %v", err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 2 {
+		t.Errorf("expected the new file to hold 2 records, got %d", n)
+	}
+	if keys, _ := store.List(context.Background(), "raw/request_facts"); len(keys) != 1 {
+		t.Errorf("expected no second rotation below the limit, got %v", keys)
+	}
+}
+
+// bufferedLines returns the records buffered for topic and not yet rotated.
+func bufferedLines(t *testing.T, sink *DurableSink, topic string) int {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(sink.bufferDir, topic, "current.jsonl"))
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatalf("failed to read buffer: %v", err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestHandleEventsBatch(t *testing.T) {
+	type response struct {
+		Accepted, Rejected int
+		Errors             []string
+	}
+	tests := []struct {
+		name       string
+		lines      []string
+		wantCode   int
+		want       response
+		errorLines []string
+	}{
+		{
+			name:     "all valid",
+			lines:    []string{validEventJSON(t), validEventJSON(t), validEventJSON(t)},
+			wantCode: http.StatusOK,
+			want:     response{Accepted: 3},
+		},
+		{
+			name:       "mixed valid",
+			lines:      []string{validEventJSON(t), `{"bad json`, validEventJSON(t), validFactJSON(t)},
+			wantCode:   http.StatusOK,
+			want:       response{Accepted: 2, Rejected: 2},
+			errorLines: []string{"line 2:", "line 4:"},
+		},
+		{
+			name:     "empty",
+			lines:    []string{"", ""},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := setupSink(t)
+			rr := httptest.NewRecorder()
+			handleEventsBatch(sink, HandlerConfig{})(rr, jsonRequest("/api/v1/events/batch", strings.Join(tt.lines, "\n")))
+			if rr.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, rr.Code, rr.Body.String())
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			var got response
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("invalid response JSON: %v", err)
+			}
+			if got.Accepted != tt.want.Accepted || got.Rejected != tt.want.Rejected {
+				t.Errorf("expected %d accepted and %d rejected, got %+v", tt.want.Accepted, tt.want.Rejected, got)
+			}
+			if len(got.Errors) != len(tt.errorLines) {
+				t.Fatalf("expected errors for %v, got %v", tt.errorLines, got.Errors)
+			}
+			for i, prefix := range tt.errorLines {
+				if !strings.HasPrefix(got.Errors[i], prefix) {
+					t.Errorf("expected error %d to start with %q, got %q", i, prefix, got.Errors[i])
+				}
+			}
+			if n := bufferedLines(t, sink, "service_events"); n != tt.want.Accepted {
+				t.Errorf("expected %d buffered events, got %d", tt.want.Accepted, n)
+			}
+			if n := bufferedLines(t, sink, "request_facts"); n != 0 {
+				t.Errorf("expected no facts written, got %d", n)
+			}
+		})
+	}
+}
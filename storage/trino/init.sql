@@ -11,7 +11,8 @@ CREATE TABLE IF NOT EXISTS gravix.raw.request_facts (
     path_template VARCHAR,
     status_code INTEGER,
     latency_ms INTEGER,
-    user_agent_family VARCHAR
+    user_agent_family VARCHAR,
+    skew_ms BIGINT
 ) WITH (
     format = 'JSON',
     external_location = '/data/raw/request_facts'
@@ -44,7 +45,17 @@ CREATE TABLE gravix.raw.request_metrics_minute (
     p50_latency_ms DOUBLE,
     p95_latency_ms DOUBLE,
     p99_latency_ms DOUBLE,
-    event_day VARCHAR
+    event_day VARCHAR,
+    user_agent_family VARCHAR,
+    source VARCHAR,
+    apdex DOUBLE,
+    p90_latency_ms DOUBLE,
+    p999_latency_ms DOUBLE,
+    count_2xx BIGINT,
+    count_3xx BIGINT,
+    count_4xx BIGINT,
+    count_5xx BIGINT,
+    bucket_seconds BIGINT
 ) WITH (
     format = 'PARQUET',
     external_location = '/data/warehouse/request_metrics_minute'
@@ -56,7 +67,8 @@ CREATE TABLE gravix.raw.service_events_daily (
     event_day VARCHAR,
     service VARCHAR,
     event_type VARCHAR,
-    event_count BIGINT
+    event_count BIGINT,
+    entity_id VARCHAR
 ) WITH (
     format = 'PARQUET',
     external_location = '/data/warehouse/service_events_daily'
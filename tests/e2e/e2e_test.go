@@ -28,7 +28,8 @@ func TestEndToEnd_IngestionToRollup(t *testing.T) {
 		t.Skip("Set E2E_TEST=1 to run end-to-end tests")
 	}
 
-	dataDir := t.TempDir()
+	rootDir := t.TempDir()
+	dataDir := filepath.Join(rootDir, "data")
 	day := time.Now().UTC()
 	dayStr := day.Format("2006-01-02")
 	hourStr := day.Format("15")
@@ -73,7 +74,7 @@ func TestEndToEnd_IngestionToRollup(t *testing.T) {
 	}
 
 	// Step 2: Run the rollup
-	rollupBin := filepath.Join(dataDir, "rollup-job")
+	rollupBin := filepath.Join(rootDir, "rollup-job")
 	projectRoot := findProjectRoot(t)
 	buildCmd := exec.Command("go", "build", "-o", rollupBin, "./transforms/request_metrics_minute/")
 	buildCmd.Dir = projectRoot
@@ -82,11 +83,15 @@ func TestEndToEnd_IngestionToRollup(t *testing.T) {
 		t.Fatalf("failed to build rollup: %v", err)
 	}
 
+	// The binary's local store is ./data relative to its working dir, so run it
+	// from rootDir and address the store with explicit key prefixes.
 	rollupCmd := exec.Command(rollupBin,
-		"-input-dir", filepath.Join(dataDir, "raw", "request_facts"),
 		"-output-dir", filepath.Join(dataDir, "warehouse", "request_metrics_minute"),
+		"-raw-prefix", "raw/request_facts",
+		"-warehouse-prefix", "warehouse/request_metrics_minute",
 		"-process-time", day.Format(time.RFC3339),
 	)
+	rollupCmd.Dir = rootDir
 	rollupCmd.Env = append(os.Environ(), "S3_ENDPOINT=")
 	rollupCmd.Stderr = os.Stderr
 	rollupCmd.Stdout = os.Stdout
@@ -171,7 +176,8 @@ func TestEndToEnd_ServiceEventsRollup(t *testing.T) {
 		t.Skip("Set E2E_TEST=1 to run end-to-end tests")
 	}
 
-	dataDir := t.TempDir()
+	rootDir := t.TempDir()
+	dataDir := filepath.Join(rootDir, "data")
 	day := time.Now().UTC()
 	dayStr := day.Format("2006-01-02")
 	hourStr := day.Format("15")
@@ -206,7 +212,7 @@ func TestEndToEnd_ServiceEventsRollup(t *testing.T) {
 	}
 
 	// Build and run the events rollup
-	rollupBin := filepath.Join(dataDir, "events-rollup")
+	rollupBin := filepath.Join(rootDir, "events-rollup")
 	projectRoot := findProjectRoot(t)
 	buildCmd := exec.Command("go", "build", "-o", rollupBin, "./transforms/service_events_daily/")
 	buildCmd.Dir = projectRoot
@@ -215,11 +221,15 @@ func TestEndToEnd_ServiceEventsRollup(t *testing.T) {
 		t.Fatalf("failed to build events rollup: %v", err)
 	}
 
+	// The binary's local store is ./data relative to its working dir, so run it
+	// from rootDir and address the store with explicit key prefixes.
 	rollupCmd := exec.Command(rollupBin,
-		"-input-dir", filepath.Join(dataDir, "raw", "service_events"),
 		"-output-dir", filepath.Join(dataDir, "warehouse", "service_events_daily"),
+		"-raw-prefix", "raw/service_events",
+		"-warehouse-prefix", "warehouse/service_events_daily",
 		"-process-time", day.Format(time.RFC3339),
 	)
+	rollupCmd.Dir = rootDir
 	rollupCmd.Env = append(os.Environ(), "S3_ENDPOINT=")
 	rollupCmd.Stderr = os.Stderr
 	rollupCmd.Stdout = os.Stdout
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// dedupSet remembers the event_ids seen so far in a day. Without a window it
+// keeps all of them. With one, ids are bucketed by the minute of their UUIDv7
+// timestamp, and buckets more than the window older than the newest id are
+// dropped, so memory is bounded by the traffic within the window. A duplicate
+// is always in the same bucket as the original, since they share a timestamp.
+//
+// Event ids are generated by clients, so their timestamps aren't bounded. An
+// id stamped after end plus the window is still deduped but doesn't move the
+// window, or one bad clock would leave every later id of the day unchecked.
+type dedupSet struct {
+	window  int64                         // in minutes; 0 keeps every id
+	buckets map[int64]map[string]struct{} // by unix minute of the id
+	newest  int64                         // newest minute added, at most limit
+	limit   int64                         // newest never moves past this minute
+	evicted func(id string)               // called for each id dropped from the window
+}
+
+// newDedupSet returns a set for the ids of facts up to end, normally the end
+// of the day being rolled up.
+func newDedupSet(window time.Duration, end time.Time, evicted func(id string)) *dedupSet {
+	s := &dedupSet{
+		window:  int64((window + time.Minute - 1) / time.Minute),
+		buckets: make(map[int64]map[string]struct{}),
+		evicted: evicted,
+	}
+	s.limit = end.Unix()/60 + s.window
+	return s
+}
+
+// add records id and reports whether it is new. An id that falls behind the
+// window can't be checked and is reported new without being recorded; late
+// says whether that happened.
+func (s *dedupSet) add(id string) (added, late bool) {
+	minute := int64(0)
+	if s.window > 0 {
+		minute = idMinute(id, s.newest)
+		if minute < s.newest-s.window {
+			return true, true
+		}
+	}
+	bucket, ok := s.buckets[minute]
+	if !ok {
+		bucket = make(map[string]struct{})
+		s.buckets[minute] = bucket
+	}
+	if _, exists := bucket[id]; exists {
+		return false, false
+	}
+	bucket[id] = struct{}{}
+	if minute > s.newest && minute <= s.limit {
+		s.newest = minute
+		s.evict()
+	}
+	return true, false
+}
+
+// ids returns every id in the set, in no particular order.
+func (s *dedupSet) ids() []string {
+	var ids []string
+	for _, bucket := range s.buckets {
+		for id := range bucket {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// evict drops the buckets that fell behind the window.
+func (s *dedupSet) evict() {
+	for minute, bucket := range s.buckets {
+		if minute >= s.newest-s.window {
+			continue
+		}
+		if s.evicted != nil {
+			for id := range bucket {
+				s.evicted(id)
+			}
+		}
+		delete(s.buckets, minute)
+	}
+}
+
+// idMinute returns the unix minute of a UUIDv7's timestamp, or fallback if id
+// isn't one (facts are validated, so that shouldn't happen).
+func idMinute(id string, fallback int64) int64 {
+	u, err := uuid.Parse(id)
+	if err != nil || u.Version() != 7 {
+		return fallback
+	}
+	sec, _ := u.Time().UnixTime()
+	return sec / 60
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// uuidV7At returns a UUIDv7 whose embedded timestamp is ts.
+func uuidV7At(t *testing.T, ts time.Time) string {
+	t.Helper()
+	id, err := uuid.NewV7()
+	if err != nil {
+		t.Fatalf("failed to generate UUIDv7: %v", err)
+	}
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(ts.UnixMilli()))
+	copy(id[:6], ms[2:])
+	return id.String()
+}
+
+func TestDedupSet_Window(t *testing.T) {
+	base := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	var evicted []string
+	s := newDedupSet(5*time.Minute, base.Truncate(24*time.Hour).Add(24*time.Hour), func(id string) { evicted = append(evicted, id) })
+
+	a := uuidV7At(t, base)
+	if added, _ := s.add(a); !added {
+		t.Fatal("expected the first id to be new")
+	}
+	if added, _ := s.add(a); added {
+		t.Error("expected a duplicate within the window to be caught")
+	}
+
+	// Within the window of the newest id, duplicates are still caught
+	b := uuidV7At(t, base.Add(4*time.Minute))
+	s.add(b)
+	if added, _ := s.add(a); added {
+		t.Error("expected a duplicate 4 minutes behind the newest id to be caught")
+	}
+
+	// Moving the newest id on by more than the window evicts the first
+	c := uuidV7At(t, base.Add(8*time.Minute))
+	s.add(c)
+	if len(evicted) != 1 || evicted[0] != a {
+		t.Errorf("expected only %s to be evicted, got %v", a, evicted)
+	}
+	if added, late := s.add(a); !added || !late {
+		t.Errorf("expected a duplicate beyond the window to be reported new and late, got added=%v late=%v", added, late)
+	}
+	if added, _ := s.add(b); added {
+		t.Error("expected a duplicate 4 minutes behind the newest id to be caught")
+	}
+}
+
+func TestDedupSet_WholeDay(t *testing.T) {
+	base := time.Date(2025, 1, 15, 1, 0, 0, 0, time.UTC)
+	s := newDedupSet(0, base.Truncate(24*time.Hour).Add(24*time.Hour), nil)
+	a := uuidV7At(t, base)
+	s.add(a)
+	s.add(uuidV7At(t, base.Add(20*time.Hour)))
+	if added, late := s.add(a); added || late {
+		t.Errorf("expected a duplicate 20 hours apart to be caught without a window, got added=%v late=%v", added, late)
+	}
+}
+
+func TestDedupSet_FutureIDDoesNotMoveWindow(t *testing.T) {
+	base := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	s := newDedupSet(5*time.Minute, base.Truncate(24*time.Hour).Add(24*time.Hour), nil)
+
+	a := uuidV7At(t, base)
+	s.add(a)
+	// A client with a bad clock
+	future := uuidV7At(t, time.Date(2049, 1, 1, 0, 0, 0, 0, time.UTC))
+	if added, late := s.add(future); !added || late {
+		t.Errorf("expected a future id to be new, got added=%v late=%v", added, late)
+	}
+	if added, late := s.add(a); added || late {
+		t.Errorf("expected a duplicate after a future id to be caught, got added=%v late=%v", added, late)
+	}
+	if added, _ := s.add(future); added {
+		t.Error("expected a duplicate of the future id to be caught")
+	}
+
+	// Ids up to the end of the day plus the window still move it
+	s.add(uuidV7At(t, time.Date(2025, 1, 16, 0, 4, 0, 0, time.UTC)))
+	if added, late := s.add(a); !added || !late {
+		t.Errorf("expected an id far behind the end of the day to be late, got added=%v late=%v", added, late)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/google/uuid"
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/lgreene/gravix-dashboards/pkg/warehouse"
+)
+
+// dayManifest records what an -incremental run folded into a day's output,
+// so the next run only reads input objects added since. The Parquet output
+// only has percentiles, which can't be merged, so the manifest also keeps
+// each row's counts and latency histogram, and the event_ids already counted
+// so that retries arriving in later objects are still dropped.
+type dayManifest struct {
+	Config    string        `json:"config"`    // incrementalConfig of the run; another config starts over
+	Outputs   []string      `json:"outputs"`   // the day's output objects when written
+	Processed []string      `json:"processed"` // input objects already aggregated, sorted
+	Rows      []manifestRow `json:"rows"`
+	EventIDs  []byte        `json:"event_ids"` // see encodeEventIDs
+}
+
+// manifestRow is the state of one Aggregator.
+type manifestRow struct {
+	BucketStart     time.Time `json:"bucket_start"`
+	Service         string    `json:"service,omitempty"`
+	Method          string    `json:"method,omitempty"`
+	PathTemplate    string    `json:"path_template,omitempty"`
+	UserAgentFamily string    `json:"user_agent_family,omitempty"`
+	Source          string    `json:"source,omitempty"`
+	Requests        int64     `json:"requests"`
+	Errors          int64     `json:"errors"`
+	Count2xx        int64     `json:"count_2xx"`
+	Count3xx        int64     `json:"count_3xx"`
+	Count4xx        int64     `json:"count_4xx"`
+	Count5xx        int64     `json:"count_5xx"`
+	Satisfied       int64     `json:"satisfied"`
+	Tolerating      int64     `json:"tolerating"`
+	Histogram       string    `json:"histogram"` // base64 compressed HDR histogram
+}
+
+// manifestKey is where the manifest for dayStr lives. Trino and Hive skip
+// directories starting with "_", so it stays out of the table. clearDay
+// removes it with the day's outputs, so any run that isn't incremental
+// invalidates it.
+func manifestKey(warehousePrefix, dayStr string) string {
+	return path.Join(warehousePrefix, "_processed", dayStr+".json")
+}
+
+// incrementalConfig describes the options that decide which facts land in
+// which row. Aggregates from a run with other options can't be reused.
+func (c rollupConfig) incrementalConfig() string {
+	pattern := ""
+	if c.ExcludePathPattern != nil {
+		pattern = c.ExcludePathPattern.String()
+	}
+	return fmt.Sprintf("raw=%s group_by=%s bucket=%s normalize=%t exclude=%s exclude_pattern=%s totals=%t apdex=%d",
+		strings.Join(c.RawPrefixes, ","), strings.Join(c.groupBy(), ","), c.bucket(), c.NormalizePaths,
+		strings.Join(c.ExcludePaths, ","), pattern, c.EmitTotals, c.apdexThresholdMs())
+}
+
+// readManifest returns the manifest for dayStr, or nil if there is none or
+// it can't be used, in which case the day is rolled up from scratch.
+func readManifest(ctx context.Context, store storage.ObjectStore, cfg rollupConfig, dayStr string) *dayManifest {
+	key := manifestKey(cfg.WarehousePrefix, dayStr)
+	exists, err := store.Exists(ctx, key)
+	if err != nil {
+		log.Printf("Failed to check %s, rolling up %s in full: %v", key, dayStr, err)
+		return nil
+	}
+	if !exists {
+		return nil
+	}
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		log.Printf("Failed to get %s, rolling up %s in full: %v", key, dayStr, err)
+		return nil
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		log.Printf("Failed to read %s, rolling up %s in full: %v", key, dayStr, err)
+		return nil
+	}
+	var m dayManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		log.Printf("Failed to decode %s, rolling up %s in full: %v", key, dayStr, err)
+		return nil
+	}
+	if m.Config != cfg.incrementalConfig() {
+		log.Printf("Rollup options changed since %s was written, rolling up %s in full", key, dayStr)
+		return nil
+	}
+	// Another run may have replaced the output the manifest describes
+	outputs, err := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, dayStr)
+	if err != nil {
+		log.Printf("Failed to list outputs for %s, rolling up in full: %v", dayStr, err)
+		return nil
+	}
+	if !slices.Equal(outputs, m.Outputs) {
+		log.Printf("Output for %s changed since %s was written, rolling up in full", dayStr, key)
+		return nil
+	}
+	return &m
+}
+
+// unprocessedInputs returns the keys, with their sources, that are not in processed.
+func unprocessedInputs(keys, sources, processed []string) (newKeys, newSources []string) {
+	done := make(map[string]bool, len(processed))
+	for _, k := range processed {
+		done[k] = true
+	}
+	for i, k := range keys {
+		if !done[k] {
+			newKeys = append(newKeys, k)
+			newSources = append(newSources, sources[i])
+		}
+	}
+	return newKeys, newSources
+}
+
+// resume seeds a's rows and dedup set from m. It fails only on corrupt state.
+func (a *dayAggregator) resume(m *dayManifest) error {
+	ids, err := decodeEventIDs(m.EventIDs)
+	if err != nil {
+		return fmt.Errorf("decode event_ids: %w", err)
+	}
+	for _, id := range ids {
+		a.seen.add(id)
+	}
+	for _, row := range m.Rows {
+		h, err := hdrhistogram.Decode([]byte(row.Histogram))
+		if err != nil {
+			return fmt.Errorf("decode histogram of %s %s: %w", row.BucketStart, row.Service, err)
+		}
+		key := AggregationKey{
+			BucketStart:     row.BucketStart,
+			Service:         row.Service,
+			Method:          row.Method,
+			PathTemplate:    row.PathTemplate,
+			UserAgentFamily: row.UserAgentFamily,
+			Source:          row.Source,
+		}
+		a.aggs[key] = &Aggregator{
+			Latencies:  &hdrRecorder{h: h},
+			Requests:   row.Requests,
+			Errors:     row.Errors,
+			Count2xx:   row.Count2xx,
+			Count3xx:   row.Count3xx,
+			Count4xx:   row.Count4xx,
+			Count5xx:   row.Count5xx,
+			Satisfied:  row.Satisfied,
+			Tolerating: row.Tolerating,
+		}
+	}
+	return nil
+}
+
+// writeManifest records processed and a's rows as the state of the day's
+// current output. It runs after writeDay.
+func (a *dayAggregator) writeManifest(ctx context.Context, store storage.ObjectStore, processed []string) error {
+	outputs, err := warehouse.DayKeys(ctx, store, a.cfg.WarehousePrefix, a.dayStr)
+	if err != nil {
+		return err
+	}
+	ids, err := encodeEventIDs(a.seen.ids())
+	if err != nil {
+		return fmt.Errorf("encode event_ids: %w", err)
+	}
+	m := dayManifest{Config: a.cfg.incrementalConfig(), Outputs: outputs, Processed: slices.Sorted(slices.Values(processed)), EventIDs: ids}
+	for key, agg := range a.aggs {
+		enc, err := agg.Latencies.(*hdrRecorder).h.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+		if err != nil {
+			return fmt.Errorf("encode histogram: %w", err)
+		}
+		m.Rows = append(m.Rows, manifestRow{
+			BucketStart:     key.BucketStart,
+			Service:         key.Service,
+			Method:          key.Method,
+			PathTemplate:    key.PathTemplate,
+			UserAgentFamily: key.UserAgentFamily,
+			Source:          key.Source,
+			Requests:        agg.Requests,
+			Errors:          agg.Errors,
+			Count2xx:        agg.Count2xx,
+			Count3xx:        agg.Count3xx,
+			Count4xx:        agg.Count4xx,
+			Count5xx:        agg.Count5xx,
+			Satisfied:       agg.Satisfied,
+			Tolerating:      agg.Tolerating,
+			Histogram:       string(enc),
+		})
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+	key := manifestKey(a.cfg.WarehousePrefix, a.dayStr)
+	if err := store.Put(ctx, key, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	return nil
+}
+
+// encodeEventIDs packs ids as sorted 16-byte UUIDs and gzips them. Sorted
+// UUIDv7s share their timestamp prefixes, which keeps a busy day's ids to a
+// fraction of their JSON size. With -dedup-window only the ids still in the
+// window are saved. Ids that aren't UUIDs can't be packed and are left out;
+// validation rejects them anyway.
+func encodeEventIDs(ids []string) ([]byte, error) {
+	packed := make([][16]byte, 0, len(ids))
+	for _, id := range ids {
+		if u, err := uuid.Parse(id); err == nil {
+			packed = append(packed, u)
+		}
+	}
+	slices.SortFunc(packed, func(a, b [16]byte) int { return bytes.Compare(a[:], b[:]) })
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	for _, u := range packed {
+		zw.Write(u[:])
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeEventIDs reverses encodeEventIDs. An empty input has no ids.
+func decodeEventIDs(data []byte) ([]string, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw)%16 != 0 {
+		return nil, fmt.Errorf("%d bytes is not a whole number of ids", len(raw))
+	}
+	ids := make([]string, 0, len(raw)/16)
+	for i := 0; i < len(raw); i += 16 {
+		ids = append(ids, uuid.UUID(raw[i:i+16]).String())
+	}
+	return ids, nil
+}
+
+// dropManifest deletes the day's manifest, so the next run rolls the day up
+// in full. writeDay's cleanup usually has already, but not with NoCleanup.
+func (a *dayAggregator) dropManifest(ctx context.Context, store storage.ObjectStore) {
+	key := manifestKey(a.cfg.WarehousePrefix, a.dayStr)
+	if err := store.Delete(ctx, key); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Failed to delete %s: %v", key, err)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	gravixv1 "github.com/lgreene/gravix-dashboards/gen/gravix/v1"
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/lgreene/gravix-dashboards/pkg/warehouse"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// recordingStore records which raw objects are read.
+type recordingStore struct {
+	storage.ObjectStore
+	reads []string
+}
+
+func (s *recordingStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if strings.HasPrefix(key, "raw/") {
+		s.reads = append(s.reads, key)
+	}
+	return s.ObjectStore.Get(ctx, key)
+}
+
+func readDay(t *testing.T, store storage.ObjectStore, prefix, day string) ([]string, []MetricRow) {
+	t.Helper()
+	ctx := context.Background()
+	keys, err := warehouse.DayKeys(ctx, store, prefix, day)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected 1 output file, got %v (err %v)", keys, err)
+	}
+	rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	return keys, rows
+}
+
+func TestProcessDay_IncrementalReadsOnlyNewInputs(t *testing.T) {
+	local, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	store := &recordingStore{ObjectStore: local}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	first := day.Add(10 * time.Hour)
+	second := day.Add(11 * time.Hour)
+	writeFacts(t, local, "raw/request_facts/2025-01-15/10/batch_a.jsonl", []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 200, 10, first),
+		makeFact(t, "api-service", "GET", "/users", 500, 20, first),
+	})
+
+	cfg := defaultConfig
+	cfg.PercentileStrategy = "hdr"
+	cfg.Incremental = true
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("first processDay failed: %v", err)
+	}
+	if exists, _ := local.Exists(ctx, manifestKey(cfg.WarehousePrefix, "2025-01-15")); !exists {
+		t.Fatal("expected a manifest after an incremental run")
+	}
+
+	// A later batch adds to the first bucket and starts a new one
+	writeFacts(t, local, "raw/request_facts/2025-01-15/11/batch_b.jsonl", []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 404, 30, first),
+		makeFact(t, "api-service", "GET", "/users", 200, 40, second),
+	})
+	store.reads = nil
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("second processDay failed: %v", err)
+	}
+	if want := []string{"raw/request_facts/2025-01-15/11/batch_b.jsonl"}; !slices.Equal(store.reads, want) {
+		t.Errorf("expected only %v to be read, got %v", want, store.reads)
+	}
+
+	keys, rows := readDay(t, local, cfg.WarehousePrefix, "2025-01-15")
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %+v", rows)
+	}
+	merged := rows[0]
+	if merged.RequestCount != 3 || merged.ErrorCount != 1 || merged.Count2xx != 1 || merged.Count4xx != 1 || merged.Count5xx != 1 {
+		t.Errorf("expected the first bucket to merge both runs, got %+v", merged)
+	}
+	// Percentiles come from the merged histogram, not just the new facts
+	if p := merged.P50LatencyMs; p == nil || *p != 20 {
+		t.Errorf("expected p50 20 over both runs, got %v", p)
+	}
+	if rows[1].BucketStart != "2025-01-15 11:00:00" || rows[1].RequestCount != 1 {
+		t.Errorf("expected a new 11:00 bucket with 1 request, got %+v", rows[1])
+	}
+
+	// Nothing new: nothing read, output untouched
+	store.reads = nil
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("third processDay failed: %v", err)
+	}
+	if len(store.reads) != 0 {
+		t.Errorf("expected no reads without new inputs, got %v", store.reads)
+	}
+	if again, _ := readDay(t, local, cfg.WarehousePrefix, "2025-01-15"); !slices.Equal(again, keys) {
+		t.Errorf("expected output %v to be kept, got %v", keys, again)
+	}
+}
+
+func TestProcessDay_IncrementalStartsOverAfterFullRun(t *testing.T) {
+	local, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	store := &recordingStore{ObjectStore: local}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	writeFact(t, local, "raw/request_facts/2025-01-15/10/batch_a.jsonl", makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour)))
+
+	cfg := defaultConfig
+	cfg.PercentileStrategy = "hdr"
+	cfg.Incremental = true
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+
+	// A full run replaces the output and, with it, the manifest
+	full := cfg
+	full.Incremental = false
+	if err := processDay(ctx, day, store, full); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if exists, _ := local.Exists(ctx, manifestKey(cfg.WarehousePrefix, "2025-01-15")); exists {
+		t.Error("expected a full run to remove the manifest")
+	}
+
+	store.reads = nil
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if len(store.reads) != 1 {
+		t.Errorf("expected the day to be read in full, got %v", store.reads)
+	}
+
+	// Other rollup options invalidate the manifest too
+	cfg.Bucket = 5 * time.Minute
+	store.reads = nil
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if len(store.reads) != 1 {
+		t.Errorf("expected a changed -bucket to read the day in full, got %v", store.reads)
+	}
+	if _, rows := readDay(t, local, cfg.WarehousePrefix, "2025-01-15"); len(rows) != 1 || rows[0].RequestCount != 1 {
+		t.Errorf("expected 1 request after starting over, got %+v", rows)
+	}
+}
+
+func TestProcessDay_IncrementalDropsManifestAfterFailedRead(t *testing.T) {
+	local, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	store := &recordingStore{ObjectStore: local}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	at := day.Add(10 * time.Hour)
+	writeFact(t, local, "raw/request_facts/2025-01-15/10/batch_a.jsonl", makeFact(t, "api-service", "GET", "/users", 200, 10, at))
+
+	cfg := defaultConfig
+	cfg.PercentileStrategy = "hdr"
+	cfg.Incremental = true
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("first processDay failed: %v", err)
+	}
+
+	// A fact, then a line too long to scan: addBatch fails after adding the fact
+	fact := makeFact(t, "api-service", "GET", "/users", 200, 20, at)
+	data, err := protojson.Marshal(fact)
+	if err != nil {
+		t.Fatalf("failed to marshal fact: %v", err)
+	}
+	data = append(data, '\n')
+	data = append(data, bytes.Repeat([]byte("x"), 2*1024*1024)...)
+	if err := local.Put(ctx, "raw/request_facts/2025-01-15/11/batch_b.jsonl", bytes.NewReader(data)); err != nil {
+		t.Fatalf("failed to put facts: %v", err)
+	}
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("second processDay failed: %v", err)
+	}
+	if exists, _ := local.Exists(ctx, manifestKey(cfg.WarehousePrefix, "2025-01-15")); exists {
+		t.Error("expected no manifest after a failed read")
+	}
+
+	// Once the object reads, the day is rolled up in full and counted once
+	writeFact(t, local, "raw/request_facts/2025-01-15/11/batch_b.jsonl", fact)
+	store.reads = nil
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("third processDay failed: %v", err)
+	}
+	if len(store.reads) != 2 {
+		t.Errorf("expected the day to be read in full, got %v", store.reads)
+	}
+	if _, rows := readDay(t, local, cfg.WarehousePrefix, "2025-01-15"); len(rows) != 1 || rows[0].RequestCount != 2 {
+		t.Errorf("expected 2 requests, got %+v", rows)
+	}
+}
+
+func TestProcessDay_IncrementalDropsRetriesAcrossRuns(t *testing.T) {
+	local, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	fact := makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour))
+	writeFact(t, local, "raw/request_facts/2025-01-15/10/batch_a.jsonl", fact)
+
+	for _, window := range []time.Duration{0, 30 * time.Minute} {
+		cfg := defaultConfig
+		cfg.PercentileStrategy = "hdr"
+		cfg.Incremental = true
+		cfg.DedupWindow = window
+		clearDay(ctx, local, cfg.WarehousePrefix, "2025-01-15")
+		local.Delete(ctx, "raw/request_facts/2025-01-15/11/batch_b.jsonl")
+		if err := processDay(ctx, day, local, cfg); err != nil {
+			t.Fatalf("first processDay failed: %v", err)
+		}
+
+		// The client retried, and the retry landed in a later batch
+		writeFacts(t, local, "raw/request_facts/2025-01-15/11/batch_b.jsonl", []*gravixv1.RequestFact{
+			fact,
+			makeFact(t, "api-service", "GET", "/users", 200, 20, day.Add(10*time.Hour)),
+		})
+		if err := processDay(ctx, day, local, cfg); err != nil {
+			t.Fatalf("second processDay failed: %v", err)
+		}
+		if _, rows := readDay(t, local, cfg.WarehousePrefix, "2025-01-15"); len(rows) != 1 || rows[0].RequestCount != 2 {
+			t.Errorf("window %v: expected the retry to be dropped, leaving 2 requests, got %+v", window, rows)
+		}
+	}
+}
+
+func TestEventIDs_RoundTrip(t *testing.T) {
+	ids := []string{uuidV7At(t, time.Now()), uuidV7At(t, time.Now().Add(-time.Hour))}
+	data, err := encodeEventIDs(ids)
+	if err != nil {
+		t.Fatalf("encodeEventIDs failed: %v", err)
+	}
+	got, err := decodeEventIDs(data)
+	if err != nil {
+		t.Fatalf("decodeEventIDs failed: %v", err)
+	}
+	if !slices.Equal(got, []string{ids[1], ids[0]}) {
+		t.Errorf("expected sorted ids %v, got %v", []string{ids[1], ids[0]}, got)
+	}
+}
@@ -3,27 +3,36 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"log"
+	"maps"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
-	"sort"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lgreene/gravix-dashboards/pkg/batch"
 	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/lgreene/gravix-dashboards/pkg/warehouse"
 	"github.com/lgreene/gravix-dashboards/schemas"
-	"github.com/montanaflynn/stats"
 	"github.com/parquet-go/parquet-go"
-	"github.com/parquet-go/parquet-go/compress/zstd"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/protobuf/proto"
 )
 
 var (
@@ -34,6 +43,54 @@ var (
 		},
 		[]string{"service", "day"},
 	)
+	rollupBatchFooterFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rollup_batch_footer_failures_total",
+			Help: "Raw batches whose integrity footer did not match their content (mismatch) or was absent when required (missing).",
+		},
+		[]string{"reason"},
+	)
+	rollupExcludedEventsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rollup_excluded_events_total",
+			Help: "Facts left out of the rollup because their path_template matched -exclude-paths or -exclude-path-pattern.",
+		},
+		[]string{"day"},
+	)
+	rollupConflictingEventIDsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rollup_conflicting_event_ids_total",
+			Help: "Facts dropped as duplicates whose content differs from the first fact with the same event_id (-strict-dedup only).",
+		},
+		[]string{"day"},
+	)
+	rollupDecodeErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rollup_decode_errors_total",
+			Help: "Raw lines skipped because they are not valid fact JSON, e.g. truncated or corrupt uploads.",
+		},
+		[]string{"day"},
+	)
+	rollupValidationErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rollup_validation_errors_total",
+			Help: "Raw lines skipped because they decode but fail fact validation, e.g. a producer sending invalid data.",
+		},
+		[]string{"day"},
+	)
+	rollupDedupLateIDsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rollup_dedup_late_ids_total",
+			Help: "Facts kept without a duplicate check because their event_id was older than -dedup-window behind the newest one.",
+		},
+		[]string{"day"},
+	)
+	rollupEmptyRechecksFailedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rollup_empty_rechecks_failed_total",
+			Help: "Apparently empty days whose second listing (-recheck-empty-after) found raw objects, so their output was kept.",
+		},
+	)
 	rollupDurationSeconds = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "rollup_duration_seconds",
@@ -41,11 +98,34 @@ var (
 		},
 		[]string{"day"},
 	)
+	rollupRowsWritten = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "rollup_rows_written",
+			Help: "Metric rows written by the last rollup of each day; 0 when the day had no data.",
+		},
+		[]string{"day"},
+	)
+	rollupLastRunErrorRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "rollup_last_run_error_rate",
+			Help: "Day-wide error rate of the busiest services (-last-run-top-services) in the day most recently rolled up.",
+		},
+		[]string{"service"},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(rollupProcessedEventsTotal)
 	prometheus.MustRegister(rollupDurationSeconds)
+	prometheus.MustRegister(rollupRowsWritten)
+	prometheus.MustRegister(rollupBatchFooterFailuresTotal)
+	prometheus.MustRegister(rollupExcludedEventsTotal)
+	prometheus.MustRegister(rollupConflictingEventIDsTotal)
+	prometheus.MustRegister(rollupEmptyRechecksFailedTotal)
+	prometheus.MustRegister(rollupDecodeErrorsTotal)
+	prometheus.MustRegister(rollupValidationErrorsTotal)
+	prometheus.MustRegister(rollupDedupLateIDsTotal)
+	prometheus.MustRegister(rollupLastRunErrorRate)
 }
 
 func startMetricsServer(addr string) *http.Server {
@@ -60,32 +140,96 @@ func startMetricsServer(addr string) *http.Server {
 	return srv
 }
 
-// MetricRow represents a 1-minute bucket for a specific service/path/method tuple.
-type MetricRow struct {
-	BucketStart  string  `json:"bucket_start" parquet:"bucket_start"`
-	Service      string  `json:"service" parquet:"service"`
-	Method       string  `json:"method" parquet:"method"`
-	PathTemplate string  `json:"path_template" parquet:"path_template"`
-	RequestCount int64   `json:"request_count" parquet:"request_count"`
-	ErrorCount   int64   `json:"error_count" parquet:"error_count"`
-	ErrorRate    float64 `json:"error_rate" parquet:"error_rate"`
-	P50LatencyMs float64 `json:"p50_latency_ms" parquet:"p50_latency_ms"`
-	P95LatencyMs float64 `json:"p95_latency_ms" parquet:"p95_latency_ms"`
-	P99LatencyMs float64 `json:"p99_latency_ms" parquet:"p99_latency_ms"`
-	EventDay     string  `json:"event_day" parquet:"event_day"`
-}
+// datasetName identifies this job's output in object tags.
+const datasetName = "request_metrics_minute"
 
+// MetricRow aliases the shared warehouse row type so readers (cmd/api) decode exactly what this job writes.
+type MetricRow = warehouse.MetricRow
+
+// AggregationKey identifies one output row. Dimensions outside the
+// configured -group-by are left empty so they don't split rows.
 type AggregationKey struct {
-	BucketStart  time.Time
-	Service      string
-	Method       string
-	PathTemplate string
+	BucketStart     time.Time
+	Service         string
+	Method          string
+	PathTemplate    string
+	UserAgentFamily string
+	Source          string
+}
+
+// groupByDimensions lists the fact fields -group-by accepts, in output order.
+// bucket_start is always included and is not listed.
+var groupByDimensions = []string{"service", "method", "path_template", "user_agent_family", "source"}
+
+// defaultGroupBy is the grouping used when -group-by is not set.
+var defaultGroupBy = []string{"service", "method", "path_template"}
+
+// parseGroupBy validates a comma-separated -group-by list.
+func parseGroupBy(list string) ([]string, error) {
+	var dims []string
+	for _, d := range strings.Split(list, ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		if !slices.Contains(groupByDimensions, d) {
+			return nil, fmt.Errorf("unknown dimension %q (want one of %s)", d, strings.Join(groupByDimensions, ","))
+		}
+		if slices.Contains(dims, d) {
+			return nil, fmt.Errorf("dimension %q listed twice", d)
+		}
+		dims = append(dims, d)
+	}
+	if len(dims) == 0 {
+		return nil, fmt.Errorf("no dimensions given")
+	}
+	return dims, nil
+}
+
+// parseBucket parses a -bucket duration. Buckets must be whole minutes and
+// divide a day evenly, so every day starts a bucket and none spans two days.
+func parseBucket(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < time.Minute || d%time.Minute != 0 || (24*time.Hour)%d != 0 {
+		return 0, fmt.Errorf("%s is not a whole number of minutes that divides 24h", s)
+	}
+	return d, nil
+}
+
+// bucketLabel formats d for object names: 5m, 90m or 1h.
+func bucketLabel(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
+
+// metricSchema is the schema of row (a MetricRow or secondsMetricRow)
+// without the dimension columns that are not grouped by.
+func metricSchema(row any, groupBy []string) *parquet.Schema {
+	group := parquet.Group{}
+	for _, f := range parquet.SchemaOf(row).Fields() {
+		if slices.Contains(groupByDimensions, f.Name()) && !slices.Contains(groupBy, f.Name()) {
+			continue
+		}
+		group[f.Name()] = f
+	}
+	return parquet.NewSchema("MetricRow", group)
 }
 
 type Aggregator struct {
-	Latencies []float64
-	Requests  int64
-	Errors    int64
+	Latencies  latencyRecorder
+	Requests   int64
+	Errors     int64
+	Count2xx   int64 // by status class; 1xx is in none of them
+	Count3xx   int64
+	Count4xx   int64
+	Count5xx   int64
+	Satisfied  int64 // latency within the apdex threshold
+	Tolerating int64 // latency within 4× the apdex threshold
 }
 
 // acquireLock creates an exclusive lock file to prevent concurrent rollup runs.
@@ -151,12 +295,214 @@ func releaseLock(f *os.File) {
 	os.Remove(name)
 }
 
+// prefixFromDir derives a store key prefix from a legacy ./data/-relative directory flag.
+// Deprecated: kept only so -input-dir/-output-dir continue to work; prefer -raw-prefix/-warehouse-prefix.
+func prefixFromDir(dir string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(dir, "./data/"), "/")
+}
+
+// parseRawPrefixes splits a comma-separated -raw-prefix list. Each prefix's
+// last path element names its source, so those must be distinct.
+func parseRawPrefixes(list string) ([]string, error) {
+	var prefixes []string
+	sources := make(map[string]string)
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSuffix(strings.TrimSpace(p), "/")
+		if p == "" {
+			continue
+		}
+		src := path.Base(p)
+		if other, ok := sources[src]; ok {
+			return nil, fmt.Errorf("prefixes %s and %s share the source name %q", other, p, src)
+		}
+		sources[src] = p
+		prefixes = append(prefixes, p)
+	}
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("no prefixes given")
+	}
+	return prefixes, nil
+}
+
+// rollupConfig controls where processDay reads and writes and how facts are grouped.
+type rollupConfig struct {
+	RawPrefixes     []string // e.g. raw/request_facts; all are aggregated together with one dedup set
+	WarehousePrefix string   // e.g. warehouse/request_metrics_minute
+	NormalizePaths  bool     // canonicalize placeholder syntax (:id, <id>, %7Bid%7D) to {id} before grouping
+	StrictDedup     bool     // compare the content of facts that share an event_id and count conflicts
+	EmitTotals      bool     // also write a totalService row per minute across all services
+	MaxPartRows     int      // split a day's parquet into part files of at most this many rows; 0 writes one file
+
+	// LastRunTopServices is how many services, by request count, get a
+	// rollup_last_run_error_rate series after each day; 0 means the default.
+	LastRunTopServices int
+
+	// DedupWindow bounds deduplication to event_ids whose UUIDv7 timestamps
+	// are within this of the newest seen, to cap memory; 0 dedups the whole day.
+	DedupWindow time.Duration
+
+	// Facts whose path_template (after NormalizePaths) is listed in
+	// ExcludePaths or matches ExcludePathPattern are dropped before
+	// aggregation, e.g. health checks that would swamp the counts.
+	ExcludePaths       []string
+	ExcludePathPattern *regexp.Regexp
+
+	RequireBatchFooter bool // warn about raw batches that end without an integrity footer
+	VerifyOutput       bool // read the written parquet back and check its row count before replacing old output
+
+	JSONLPrefix string // if set, also write each day's rows as JSONL under this prefix
+	WriteIndex  bool   // keep <WarehousePrefix>/_index.json pointing at each day's current output
+
+	KeepEmpty bool // leave existing output alone when a day has no facts instead of clearing it
+	NoCleanup bool // sandbox output (-output-key-prefix): never delete earlier outputs, even on empty days
+
+	// RecheckEmptyAfter, if positive, is how long to wait before listing an
+	// apparently empty day again; output is only cleared if nothing new appears.
+	RecheckEmptyAfter time.Duration
+
+	GroupBy []string      // dimensions to aggregate on besides bucket_start; nil means defaultGroupBy
+	Bucket  time.Duration // width of each output row's time bucket; 0 means defaultBucket
+
+	Incremental        bool      // reuse the day's previous aggregates and only read new inputs; needs hdr, see dayManifest
+	PercentileStrategy string    // a percentileStrategies key; empty means exact
+	Percentiles        []float64 // percentileColumns keys to compute; nil means defaultPercentiles
+	MinSamples         int64     // rows with fewer requests get NULL percentiles; 0 always computes them
+	ApdexThresholdMs   int64     // satisfied latency for apdex, tolerating up to 4×; 0 means defaultApdexThresholdMs
+	LatencyUnit        string    // a latencyUnits name for the percentile columns; empty means ms
+
+	// Output, when set, receives each day's rows in OutputFormat instead of
+	// the store, and nothing in the store is written or deleted.
+	Output       io.Writer
+	OutputFormat string // an outputFormats name; empty means parquet
+}
+
+// percentileStrategy returns the configured strategy, or exact.
+func (c rollupConfig) percentileStrategy() string {
+	if c.PercentileStrategy == "" {
+		return "exact"
+	}
+	return c.PercentileStrategy
+}
+
+// defaultBucket is the bucket width when none is configured.
+const defaultBucket = time.Minute
+
+// bucket returns the configured bucket width, or the default.
+func (c rollupConfig) bucket() time.Duration {
+	if c.Bucket == 0 {
+		return defaultBucket
+	}
+	return c.Bucket
+}
+
+// outputName is the first part of output object names: metrics, or for a
+// -bucket other than the default metrics_<bucket>, e.g. metrics_5m.
+func (c rollupConfig) outputName() string {
+	if c.bucket() == defaultBucket {
+		return "metrics"
+	}
+	return "metrics_" + bucketLabel(c.bucket())
+}
+
+// percentiles returns the configured percentiles, or the default set.
+func (c rollupConfig) percentiles() []float64 {
+	if c.Percentiles == nil {
+		return defaultPercentiles
+	}
+	return c.Percentiles
+}
+
+// latencyUnit returns the configured latency unit, or ms.
+func (c rollupConfig) latencyUnit() string {
+	if c.LatencyUnit == "" {
+		return "ms"
+	}
+	return c.LatencyUnit
+}
+
+// excluded reports whether facts for pathTemplate are left out of the rollup.
+func (c rollupConfig) excluded(pathTemplate string) bool {
+	if slices.Contains(c.ExcludePaths, pathTemplate) {
+		return true
+	}
+	return c.ExcludePathPattern != nil && c.ExcludePathPattern.MatchString(pathTemplate)
+}
+
+// defaultApdexThresholdMs is the apdex threshold when none is configured.
+const defaultApdexThresholdMs = 500
+
+// apdexThresholdMs returns the configured apdex threshold, or the default.
+func (c rollupConfig) apdexThresholdMs() int64 {
+	if c.ApdexThresholdMs == 0 {
+		return defaultApdexThresholdMs
+	}
+	return c.ApdexThresholdMs
+}
+
+// defaultLastRunTopServices is the number of rollup_last_run_error_rate
+// series when none is configured.
+const defaultLastRunTopServices = 10
+
+// lastRunTopServices returns the configured number of services reported per
+// run, or the default.
+func (c rollupConfig) lastRunTopServices() int {
+	if c.LastRunTopServices == 0 {
+		return defaultLastRunTopServices
+	}
+	return c.LastRunTopServices
+}
+
+// groupBy returns the configured dimensions, or the default set.
+func (c rollupConfig) groupBy() []string {
+	if c.GroupBy == nil {
+		return defaultGroupBy
+	}
+	return c.GroupBy
+}
+
 func main() {
 	var inputDir, outputDir string
+	var rawPrefix, warehousePrefix string
+	var normalizePaths, requireBatchFooter, verify, noClearEmpty, alsoJSONL bool
+	var strictDedup, writeIndex, emitTotals, incremental bool
+	var lastRunTopServices, maxPartRows int
 	var processingTime, startDay, endDay string
+	var sqsQueueURL string
+	var groupBy, bucket, percentileStrategy, percentiles, latencyUnit string
+	var excludePaths, excludePathPattern string
+	var minSamples, apdexThreshold int64
+	var readStdin bool
+	var recheckEmptyAfter, dedupWindow time.Duration
+	var output, outputFormat string
+	var outputKeyPrefix string
 
-	flag.StringVar(&inputDir, "input-dir", "./data/raw/request_facts", "Path to raw facts (JSONL)")
-	flag.StringVar(&outputDir, "output-dir", "./data/warehouse/request_metrics_minute", "Path to output metrics (Parquet)")
+	flag.StringVar(&inputDir, "input-dir", "./data/raw/request_facts", "Deprecated: use -raw-prefix. Path to raw facts (JSONL)")
+	flag.StringVar(&outputDir, "output-dir", "./data/warehouse/request_metrics_minute", "Local directory for the run lock (and, deprecated, the output prefix)")
+	flag.StringVar(&rawPrefix, "raw-prefix", "", "Comma-separated store key prefixes of raw fact topics, e.g. raw/request_facts,raw/grpc_facts (default: derived from -input-dir)")
+	flag.StringVar(&outputKeyPrefix, "output-key-prefix", "", "Write outputs under this scratch prefix instead of the warehouse prefix, and never delete earlier outputs (for comparing against production)")
+	flag.StringVar(&warehousePrefix, "warehouse-prefix", "", "Store key prefix for output metrics, e.g. warehouse/request_metrics_minute (default: derived from -output-dir)")
+	flag.BoolVar(&verify, "verify", false, "Read each written parquet back and check its row count before deleting the previous output")
+	flag.IntVar(&maxPartRows, "max-part-rows", 0, "Split a day's parquet output into metrics_<uuid>_<day>.partNN.parquet files of at most this many rows (0 writes one file)")
+	flag.BoolVar(&alsoJSONL, "also-jsonl", false, "Also write each day's rows as JSONL under <warehouse-prefix>_jsonl")
+	flag.BoolVar(&writeIndex, "write-index", false, "Keep <warehouse-prefix>/_index.json mapping each day to its output key, sha256, row count and write time")
+	flag.DurationVar(&dedupWindow, "dedup-window", 0, "Only dedup event_ids whose timestamps are within this of the newest seen, bounding memory (0 dedups the whole day)")
+	flag.DurationVar(&recheckEmptyAfter, "recheck-empty-after", 0, "Before clearing a day that has no facts, wait this long and list its raw objects again; keep the output if any appeared (0 disables)")
+	flag.BoolVar(&noClearEmpty, "no-clear-empty", false, "Leave existing output for a day untouched when it has no input facts, instead of deleting it")
+	flag.BoolVar(&requireBatchFooter, "require-batch-footer", false, "Report raw batches without a footer as possibly truncated (use when ingestion runs with -batch-footer)")
+	flag.StringVar(&groupBy, "group-by", strings.Join(defaultGroupBy, ","), "Comma-separated dimensions to aggregate on besides bucket_start: "+strings.Join(groupByDimensions, ","))
+	flag.StringVar(&bucket, "bucket", "1m", "Width of each row's time bucket, a whole number of minutes that divides a day, e.g. 1m, 5m, 15m or 1h")
+	flag.BoolVar(&incremental, "incremental", false, "Only read input objects added since the last -incremental run of a day and merge them into its aggregates (requires -percentile-strategy hdr)")
+	flag.StringVar(&percentileStrategy, "percentile-strategy", "exact", "How latency percentiles are computed: exact (keeps every latency), tdigest (bounded memory, approximate) or hdr (fixed-size histogram, within 1%)")
+	flag.StringVar(&percentiles, "percentiles", "50,95,99", "Comma-separated latency percentiles to compute, from 50,90,95,99,99.9; the other percentile columns are written as NULL")
+	flag.StringVar(&latencyUnit, "latency-unit", "ms", "Unit of the percentile columns: ms (p99_latency_ms) or s (p99_latency_seconds)")
+	flag.Int64Var(&minSamples, "min-samples", 0, "Write NULL percentiles for rows with fewer requests than this (0 always computes them)")
+	flag.Int64Var(&apdexThreshold, "apdex-threshold", defaultApdexThresholdMs, "Apdex threshold in ms: requests up to it are satisfied, up to 4× it tolerating")
+	flag.StringVar(&excludePaths, "exclude-paths", "", "Comma-separated path_template values whose facts are left out, e.g. /live,/ready")
+	flag.StringVar(&excludePathPattern, "exclude-path-pattern", "", "Regular expression; facts whose path_template matches it are left out, e.g. ^/internal/")
+	flag.BoolVar(&emitTotals, "emit-totals", false, "Also write a row per minute with service=__total__ that aggregates every service (requires service in -group-by)")
+	flag.IntVar(&lastRunTopServices, "last-run-top-services", defaultLastRunTopServices, "Export rollup_last_run_error_rate for at most this many services, the busiest by request count")
+	flag.BoolVar(&strictDedup, "strict-dedup", false, "Hash each fact and report duplicates of an event_id whose content differs (still keeps only the first)")
+	flag.BoolVar(&normalizePaths, "normalize-paths", false, "Canonicalize path_template placeholders (:id, <id>, [id], %7Bid%7D) to {id} before aggregating")
 
 	// Single day processing
 	flag.StringVar(&processingTime, "process-time", "", "Single day to process (RFC3339)")
@@ -165,14 +511,154 @@ func main() {
 	flag.StringVar(&startDay, "start-day", "", "Start day for backfill (YYYY-MM-DD)")
 	flag.StringVar(&endDay, "end-day", "", "End day for backfill (YYYY-MM-DD, inclusive)")
 
+	// Event-driven mode
+	flag.StringVar(&sqsQueueURL, "sqs-queue-url", os.Getenv("SQS_QUEUE_URL"), "Consume S3 object-created notifications from this SQS queue and reprocess the affected days instead of running once (env SQS_QUEUE_URL)")
+
+	// Ad-hoc filter mode
+	flag.BoolVar(&readStdin, "stdin", false, "Roll up JSONL facts read from standard input instead of the store, for the -process-time day or else the day of the first fact")
+	flag.StringVar(&output, "output", "", "Where each day's rows go: empty for the output store, - for standard output (a single day)")
+	flag.StringVar(&outputFormat, "output-format", "parquet", "Format of -output -: parquet, jsonl or csv")
+
 	flag.Parse()
 
-	// Acquire exclusive lock to prevent concurrent runs
-	lockFile, err := acquireLock(outputDir)
+	if rawPrefix == "" {
+		rawPrefix = prefixFromDir(inputDir)
+	}
+	if warehousePrefix == "" {
+		warehousePrefix = prefixFromDir(outputDir)
+	}
+	rawPrefixes, err := parseRawPrefixes(rawPrefix)
+	if err != nil {
+		log.Fatalf("Invalid -raw-prefix: %v", err)
+	}
+	noCleanup := false
+	if outputKeyPrefix != "" {
+		outputKeyPrefix = strings.TrimSuffix(outputKeyPrefix, "/")
+		if outputKeyPrefix == warehousePrefix {
+			log.Fatalf("-output-key-prefix must differ from the warehouse prefix %s", warehousePrefix)
+		}
+		log.Printf("Writing sandbox output to %s; earlier outputs are never deleted", outputKeyPrefix)
+		warehousePrefix, noCleanup = outputKeyPrefix, true
+	}
+	cfg := rollupConfig{
+		RawPrefixes:     rawPrefixes,
+		WarehousePrefix: warehousePrefix,
+		NormalizePaths:  normalizePaths,
+		StrictDedup:     strictDedup,
+		EmitTotals:      emitTotals,
+		MaxPartRows:     maxPartRows,
+
+		LastRunTopServices: lastRunTopServices,
+		RequireBatchFooter: requireBatchFooter,
+		VerifyOutput:       verify,
+		WriteIndex:         writeIndex,
+		KeepEmpty:          noClearEmpty,
+		RecheckEmptyAfter:  recheckEmptyAfter,
+		DedupWindow:        dedupWindow,
+		NoCleanup:          noCleanup,
+		MinSamples:         minSamples,
+		ApdexThresholdMs:   apdexThreshold,
+	}
+	if dedupWindow != 0 && dedupWindow < time.Minute {
+		log.Fatal("Invalid -dedup-window: must be 0 or at least 1m")
+	}
+	if maxPartRows < 0 {
+		log.Fatal("Invalid -max-part-rows: must not be negative")
+	}
+	if lastRunTopServices <= 0 {
+		log.Fatal("Invalid -last-run-top-services: must be positive")
+	}
+	if recheckEmptyAfter < 0 {
+		log.Fatal("Invalid -recheck-empty-after: must not be negative")
+	}
+	if minSamples < 0 {
+		log.Fatal("Invalid -min-samples: must not be negative")
+	}
+	if apdexThreshold <= 0 {
+		log.Fatal("Invalid -apdex-threshold: must be positive")
+	}
+	for _, p := range strings.Split(excludePaths, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.ExcludePaths = append(cfg.ExcludePaths, p)
+		}
+	}
+	if excludePathPattern != "" {
+		cfg.ExcludePathPattern, err = regexp.Compile(excludePathPattern)
+		if err != nil {
+			log.Fatalf("Invalid -exclude-path-pattern: %v", err)
+		}
+	}
+	if alsoJSONL {
+		// A sibling prefix, so the Parquet table location holds only Parquet
+		cfg.JSONLPrefix = warehousePrefix + "_jsonl"
+	}
+	cfg.GroupBy, err = parseGroupBy(groupBy)
+	if err != nil {
+		log.Fatalf("Invalid -group-by: %v", err)
+	}
+	if emitTotals && !slices.Contains(cfg.GroupBy, "service") {
+		// Without a service column the total row couldn't be told apart
+		log.Fatal("-emit-totals requires service in -group-by")
+	}
+	cfg.Bucket, err = parseBucket(bucket)
+	if err != nil {
+		log.Fatalf("Invalid -bucket: %v", err)
+	}
+	cfg.PercentileStrategy, err = parsePercentileStrategy(percentileStrategy)
+	if err != nil {
+		log.Fatalf("Invalid -percentile-strategy: %v", err)
+	}
+	cfg.Percentiles, err = parsePercentiles(percentiles)
+	if err != nil {
+		log.Fatalf("Invalid -percentiles: %v", err)
+	}
+	if incremental {
+		// Only histograms can be merged with the facts of a later run
+		if cfg.PercentileStrategy != "hdr" {
+			log.Fatal("-incremental requires -percentile-strategy hdr")
+		}
+		if readStdin || output != "" {
+			log.Fatal("-incremental cannot be combined with -stdin or -output")
+		}
+		cfg.Incremental = true
+	}
+	cfg.LatencyUnit, err = parseLatencyUnit(latencyUnit)
+	if err != nil {
+		log.Fatalf("Invalid -latency-unit: %v", err)
+	}
+
+	cfg.OutputFormat, err = parseOutputFormat(outputFormat)
 	if err != nil {
-		log.Fatalf("Cannot start rollup: %v", err)
+		log.Fatalf("Invalid -output-format: %v", err)
+	}
+	switch output {
+	case "":
+		if cfg.OutputFormat != "parquet" {
+			log.Fatal("-output-format applies only to -output -; use -also-jsonl for JSONL in the store")
+		}
+	case "-":
+		// Several parquet files can't share one stream, so stdout takes one day
+		if startDay != "" || endDay != "" || sqsQueueURL != "" {
+			log.Fatal("-output - writes a single day and cannot be combined with -start-day, -end-day or -sqs-queue-url")
+		}
+		cfg.Output = os.Stdout
+	default:
+		log.Fatalf("Invalid -output %q: use - for standard output or leave it empty for the store", output)
+	}
+
+	if readStdin {
+		runStdin(cfg, processingTime, outputDir, startDay != "" || endDay != "" || sqsQueueURL != "")
+		return
+	}
+
+	// Acquire exclusive lock to prevent concurrent runs; stdout output writes nothing to guard
+	if cfg.Output == nil {
+		lockFile, err := acquireLock(outputDir)
+		if err != nil {
+			log.Fatalf("Cannot start rollup: %v", err)
+		}
+		defer releaseLock(lockFile)
 	}
-	defer releaseLock(lockFile)
 
 	// Determine list of days to process (similar logic as before, just update processing to loop over hours too if needed)
 	// For MVP simplicity, we will assume "Day" granularity processing which re-computes *all hours* in that day.
@@ -204,35 +690,39 @@ func main() {
 		days = append(days, procTime)
 	}
 
+	if cfg.Output != nil {
+		// A one-off filter run: no metrics server to scrape, and no mirror since nothing is written
+		store, err := storage.FromEnv(context.Background(), "./data")
+		if err != nil {
+			log.Fatalf("Failed to initialize store: %v", err)
+		}
+		if err := processDay(context.Background(), days[0], store, cfg); err != nil {
+			log.Fatalf("Failed to process day %s: %v", days[0].Format("2006-01-02"), err)
+		}
+		return
+	}
+
 	// Start metrics server
 	srv := startMetricsServer(":9091")
 
-	var store storage.ObjectStore
-	if os.Getenv("S3_ENDPOINT") != "" {
-		log.Println("Initializing S3/MinIO Storage...")
-		var err error
-		store, err = storage.NewS3Store(
-			context.Background(),
-			os.Getenv("S3_ENDPOINT"),
-			os.Getenv("S3_REGION"),
-			os.Getenv("S3_BUCKET"),
-			os.Getenv("S3_ACCESS_KEY"),
-			os.Getenv("S3_SECRET_KEY"),
-		)
-		if err != nil {
-			log.Fatalf("Failed to initialize S3 store: %v", err)
-		}
-	} else {
-		log.Printf("Initializing Local Storage...")
-		var err error
-		store, err = storage.NewLocalStore("./data") // Fallback to current dir if not provided
+	store := openStore()
+
+	if sqsQueueURL != "" {
+		queue, err := newSQSQueue(context.Background(), sqsQueueURL)
 		if err != nil {
-			log.Fatalf("Failed to initialize local store: %v", err)
+			log.Fatalf("Failed to initialize SQS queue: %v", err)
 		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		log.Printf("Consuming S3 event notifications from %s...", sqsQueueURL)
+		pollNotifications(ctx, queue, store, cfg)
+		log.Println("Notification consumer stopped.")
+		srv.Close()
+		return
 	}
 
 	for _, day := range days {
-		if err := processDay(context.Background(), day, store, inputDir, outputDir); err != nil {
+		if err := processDay(context.Background(), day, store, cfg); err != nil {
 			log.Printf("Failed to process day %s: %v", day.Format("2006-01-02"), err)
 			os.Exit(1)
 		}
@@ -243,177 +733,768 @@ func main() {
 	srv.Close()
 }
 
-// processDay processes all hours within a day.
-// It scans input data partitioned by Day/Hour (part of new durable sink layout).
-// It performs deduplication across the entire day to ensure correctness if events skew across hour boundaries (within reason).
-// But effectively, we partition output by Day/Hour too if needed, or just by Day.
-// Given Hive supports Day partitioning, let's output by Day.
-func processDay(ctx context.Context, day time.Time, store storage.ObjectStore, inputDir, outputDir string) error {
-	dayStr := day.UTC().Format("2006-01-02")
+// verifyOutput reads key back and checks that it decodes to wantRows rows.
+func verifyOutput(ctx context.Context, store storage.ObjectStore, key string, wantRows int) error {
+	rows, err := warehouse.ReadMetricRows(ctx, store, key, warehouse.WithMaxSchemaVersion(warehouse.MetricSchemaVersion))
+	if err != nil {
+		return fmt.Errorf("verify %s: %w", key, err)
+	}
+	if len(rows) != wantRows {
+		return fmt.Errorf("verify %s: read back %d rows, wrote %d", key, len(rows), wantRows)
+	}
+	return nil
+}
 
-	// Input Prefix: raw/request_facts/YYYY-MM-DD/
-	// inputDir is passed as a flag, but we assume it's part of the key now
-	inputPrefix := fmt.Sprintf("%s/%s", strings.TrimPrefix(inputDir, "./data/"), dayStr)
+// maxReadAttempts bounds how often readObject fetches an object whose body fails part way.
+const maxReadAttempts = 3
 
-	log.Printf("Processing metrics for prefix %s...", inputPrefix)
-	start := time.Now()
+// readObject downloads key in full. If the body fails mid-stream (e.g. a reset
+// connection), the object is fetched again from the start, so a transient error
+// never yields a silently truncated batch. Get errors are returned as is; the
+// store does its own retrying for those.
+func readObject(ctx context.Context, store storage.ObjectStore, key string) ([]byte, error) {
+	var err error
+	for attempt := 1; attempt <= maxReadAttempts; attempt++ {
+		var rc io.ReadCloser
+		rc, err = store.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		var data []byte
+		data, err = io.ReadAll(rc)
+		rc.Close()
+		if err == nil {
+			return data, nil
+		}
+		log.Printf("Read of %s failed after %d bytes (attempt %d/%d): %v", key, len(data), attempt, maxReadAttempts, err)
+	}
+	return nil, fmt.Errorf("read %s: %w", key, err)
+}
 
-	aggs := make(map[AggregationKey]*Aggregator)
-	seen := make(map[string]struct{}) // Deduplication set for the day
+// putJSONL uploads rows as newline-delimited JSON.
+func putJSONL(ctx context.Context, store storage.ObjectStore, key string, rows []MetricRow, unit string, opts ...storage.PutOption) error {
+	var buf bytes.Buffer
+	if err := writeRows(&buf, "jsonl", rows, nil, unit); err != nil {
+		return err
+	}
+	if err := store.Put(ctx, key, &buf, opts...); err != nil {
+		return fmt.Errorf("failed to upload metrics JSONL: %w", err)
+	}
+	return nil
+}
 
-	// List all files for the day
-	keys, err := store.List(ctx, inputPrefix)
-	if err != nil {
-		return fmt.Errorf("list error: %w", err)
+// clearDay deletes every object under prefix for dayStr except those in keep.
+func clearDay(ctx context.Context, store storage.ObjectStore, prefix, dayStr string, keep ...string) {
+	// The trailing slash keeps S3 from also matching the sibling _jsonl prefix
+	existing, _ := store.List(ctx, strings.TrimSuffix(prefix, "/")+"/")
+	for _, k := range existing {
+		if strings.Contains(k, dayStr) && !slices.Contains(keep, k) {
+			store.Delete(ctx, k)
+		}
 	}
+}
 
-	for _, key := range keys {
-		if !strings.HasSuffix(key, ".jsonl") {
-			continue
+// conflict records a duplicate of fact's event_id with different content,
+// logging only the first conflictLogLimit of the day.
+func (a *dayAggregator) conflict(fact *schemas.RequestFact, name string) {
+	rollupConflictingEventIDsTotal.WithLabelValues(a.dayStr).Inc()
+	a.conflicts++
+	switch {
+	case a.conflicts <= conflictLogLimit:
+		log.Printf("WARNING: event_id %s in %s reuses the id of a different fact (service %s, %s %s); keeping the first",
+			fact.EventId, name, fact.Service, fact.Method, fact.PathTemplate)
+	case a.conflicts == conflictLogLimit+1:
+		log.Printf("WARNING: more conflicting event_ids for %s; only counting them in rollup_conflicting_event_ids_total", a.dayStr)
+	}
+}
+
+// factHash hashes the content of fact. skew_ms is left out because
+// ingestion sets it on receipt, so a retried fact may carry another value.
+func factHash(fact *schemas.RequestFact) uint64 {
+	skew := fact.SkewMs
+	fact.SkewMs = 0
+	b, _ := proto.MarshalOptions{Deterministic: true}.Marshal(fact)
+	fact.SkewMs = skew
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+// listDayInputs lists the raw objects that may hold facts for day, with the
+// source dimension of each: the name of its topic.
+func listDayInputs(ctx context.Context, store storage.ObjectStore, cfg rollupConfig, day time.Time) (keys, sources []string, err error) {
+	for _, rawPrefix := range cfg.RawPrefixes {
+		for _, inputPrefix := range dayInputPrefixes(rawPrefix, day) {
+			log.Printf("Processing metrics for prefix %s...", inputPrefix)
+			prefixKeys, err := store.List(ctx, inputPrefix)
+			if err != nil {
+				return nil, nil, fmt.Errorf("list error: %w", err)
+			}
+			for _, key := range prefixKeys {
+				keys = append(keys, key)
+				sources = append(sources, path.Base(rawPrefix))
+			}
 		}
+	}
+	return keys, sources, nil
+}
 
-		// Process JSONL Object
-		rc, err := store.Get(ctx, key)
-		if err != nil {
-			log.Printf("Error getting object %s: %v", key, err)
-			continue
+// recheckEmptyDay lists day's raw objects again after cfg.RecheckEmptyAfter
+// and fails if any appeared that the first listing, keys, missed. An
+// eventually consistent List can briefly omit objects, and clearing on such
+// a listing would delete a good partition.
+func recheckEmptyDay(ctx context.Context, store storage.ObjectStore, cfg rollupConfig, day time.Time, keys []string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(cfg.RecheckEmptyAfter):
+	}
+	again, _, err := listDayInputs(ctx, store, cfg, day)
+	if err != nil {
+		return err
+	}
+	missed := 0
+	for _, key := range again {
+		if strings.HasSuffix(key, ".jsonl") && !slices.Contains(keys, key) {
+			missed++
 		}
+	}
+	if missed > 0 {
+		rollupEmptyRechecksFailedTotal.Inc()
+		return fmt.Errorf("%s looked empty but listing again after %v found %d more raw objects; existing output kept, rerun the day",
+			day.UTC().Format("2006-01-02"), cfg.RecheckEmptyAfter, missed)
+	}
+	return nil
+}
 
-		scanner := bufio.NewScanner(rc)
-		// Increase buffer size just in case lines are long
-		buf := make([]byte, 0, 64*1024)
-		scanner.Buffer(buf, 1024*1024)
+// dayInputPrefixes returns where facts for day can be found. Ingestion files a
+// batch under the hour it was rotated, not the hour of its events, so a fact
+// from 23:59:59 rotated at 00:00:30 sits under the next day's 00 hour, and a
+// client clock running ahead can do the opposite. Both boundary hours are
+// scanned as well; the event_time day filter drops facts that belong elsewhere.
+func dayInputPrefixes(rawPrefix string, day time.Time) []string {
+	day = day.UTC()
+	return []string{
+		fmt.Sprintf("%s/%s/23/", rawPrefix, day.AddDate(0, 0, -1).Format("2006-01-02")),
+		fmt.Sprintf("%s/%s", rawPrefix, day.Format("2006-01-02")),
+		fmt.Sprintf("%s/%s/00/", rawPrefix, day.AddDate(0, 0, 1).Format("2006-01-02")),
+	}
+}
 
-		for scanner.Scan() {
-			line := scanner.Bytes()
-			if len(line) == 0 {
-				continue
-			}
+// dayAggregator folds the request facts of one day into output rows.
+type dayAggregator struct {
+	dayStr      string
+	cfg         rollupConfig
+	groupBy     []string
+	newRecorder func() latencyRecorder
+	aggs        map[AggregationKey]*Aggregator
+	seen        *dedupSet         // Deduplication set for the day, shared by every topic
+	hashes      map[string]uint64 // content hash per event_id, only with StrictDedup
+	conflicts   int               // conflicting event_ids seen so far, to sample the log
+}
 
-			// Parse JSON Fact
-			fact, err := schemas.ParseRequestFact(line)
-			if err != nil {
-				log.Printf("Skipping invalid JSON line in %s: %v", key, err)
-				continue
-			}
+// conflictLogLimit is how many conflicting event_ids are logged per day;
+// the rest are only counted.
+const conflictLogLimit = 10
 
-			// 1. Deduplication (EventID -> EventId)
-			if _, exists := seen[fact.EventId]; exists {
-				continue // Skip duplicate
-			}
-			seen[fact.EventId] = struct{}{}
+func newDayAggregator(day time.Time, cfg rollupConfig) *dayAggregator {
+	a := &dayAggregator{
+		dayStr:      day.UTC().Format("2006-01-02"),
+		cfg:         cfg,
+		groupBy:     cfg.groupBy(),
+		newRecorder: percentileStrategies[cfg.percentileStrategy()],
+		aggs:        make(map[AggregationKey]*Aggregator),
+	}
+	if cfg.StrictDedup {
+		a.hashes = make(map[string]uint64)
+	}
+	a.seen = newDedupSet(cfg.DedupWindow, day.UTC().Truncate(24*time.Hour).Add(24*time.Hour), func(id string) { delete(a.hashes, id) })
+	return a
+}
 
-			// 2. Filter Time Window (Strict Day boundary)
-			eventTime := fact.EventTime.AsTime()
-			if eventTime.UTC().Format("2006-01-02") != dayStr {
-				continue // Wrong day
+// addBatch aggregates the JSONL facts in data. name identifies the batch in
+// logs and source is its value for the source dimension. Facts from other
+// days, duplicates and invalid lines are skipped.
+func (a *dayAggregator) addBatch(data []byte, name, source string) error {
+	// ScanLines drops a trailing "\r", so CRLF objects split cleanly too
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	// Increase buffer size just in case lines are long
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	sum := batch.NewChecksum()
+	hasFooter := false
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		// Integrity footer written by ingestion -batch-footer: verify, never aggregate
+		if footer, ok := batch.ParseFooter(line); ok {
+			hasFooter = true
+			if err := sum.Verify(footer); err != nil {
+				log.Printf("WARNING: batch %s may be truncated or corrupted: %v", name, err)
+				rollupBatchFooterFailuresTotal.WithLabelValues("mismatch").Inc()
 			}
+			continue
+		}
+		sum.Add(line)
+
+		if len(line) == 0 {
+			continue
+		}
 
-			// 3. Aggregate
-			bucket := eventTime.Truncate(time.Minute).UTC()
-			keyAgg := AggregationKey{
-				BucketStart:  bucket,
-				Service:      fact.Service,
-				Method:       fact.Method,
-				PathTemplate: fact.PathTemplate,
+		// Parse JSON Fact
+		fact, err := schemas.ParseRequestFact(line)
+		if err != nil {
+			var validationErr *schemas.ValidationError
+			if errors.As(err, &validationErr) {
+				rollupValidationErrorsTotal.WithLabelValues(a.dayStr).Inc()
+				log.Printf("Skipping invalid fact in %s: %v", name, err)
+			} else {
+				rollupDecodeErrorsTotal.WithLabelValues(a.dayStr).Inc()
+				log.Printf("Skipping undecodable line in %s: %v", name, err)
 			}
+			continue
+		}
 
-			agg, exists := aggs[keyAgg]
-			if !exists {
-				agg = &Aggregator{}
-				aggs[keyAgg] = agg
+		// 1. Deduplication (EventID -> EventId)
+		added, late := a.seen.add(fact.EventId)
+		if !added {
+			// Ids resumed from a manifest have no hash to compare against
+			if h, ok := a.hashes[fact.EventId]; ok && h != factHash(fact) {
+				a.conflict(fact, name)
 			}
+			continue // Skip duplicate
+		}
+		if late {
+			rollupDedupLateIDsTotal.WithLabelValues(a.dayStr).Inc()
+		}
+		if a.hashes != nil {
+			a.hashes[fact.EventId] = factHash(fact)
+		}
+
+		// 2. Filter Time Window (Strict Day boundary)
+		eventTime := fact.EventTime.AsTime()
+		if eventTime.UTC().Format("2006-01-02") != a.dayStr {
+			continue // Wrong day
+		}
 
-			agg.Requests++
-			if fact.StatusCode >= 500 {
-				agg.Errors++
+		// 3. Aggregate
+		// Truncate rounds relative to the zero time, which falls on a day boundary
+		bucket := eventTime.Truncate(a.cfg.bucket()).UTC()
+		pathTemplate := fact.PathTemplate
+		if a.cfg.NormalizePaths {
+			pathTemplate = schemas.NormalizePathTemplate(pathTemplate)
+		}
+		if a.cfg.excluded(pathTemplate) {
+			rollupExcludedEventsTotal.WithLabelValues(a.dayStr).Inc()
+			continue
+		}
+		keyAgg := AggregationKey{BucketStart: bucket}
+		for _, dim := range a.groupBy {
+			switch dim {
+			case "service":
+				keyAgg.Service = fact.Service
+			case "method":
+				keyAgg.Method = fact.Method
+			case "path_template":
+				keyAgg.PathTemplate = pathTemplate
+			case "user_agent_family":
+				keyAgg.UserAgentFamily = fact.UserAgentFamily
+			case "source":
+				keyAgg.Source = source
 			}
-			agg.Latencies = append(agg.Latencies, float64(fact.LatencyMs))
+		}
 
-			rollupProcessedEventsTotal.WithLabelValues(fact.Service, dayStr).Inc()
+		a.add(keyAgg, fact)
+		if a.cfg.EmitTotals {
+			a.add(AggregationKey{BucketStart: bucket, Service: totalService}, fact)
 		}
-		rc.Close()
+
+		rollupProcessedEventsTotal.WithLabelValues(fact.Service, a.dayStr).Inc()
+	}
+	if err := scanner.Err(); err != nil {
+		return err
 	}
 
-	// Output Object: warehouse/request_metrics_minute/metrics_<uuid>_<day>.parquet
-	outputPrefix := strings.TrimPrefix(outputDir, "./data/")
+	if a.cfg.RequireBatchFooter && !hasFooter {
+		log.Printf("WARNING: batch %s has no footer and may be truncated", name)
+		rollupBatchFooterFailuresTotal.WithLabelValues("missing").Inc()
+	}
+	return nil
+}
 
-	if len(aggs) == 0 {
-		// Idempotency: clear stale output even when no new data
-		existing, _ := store.List(ctx, outputPrefix)
-		for _, k := range existing {
-			if strings.Contains(k, dayStr) {
-				store.Delete(ctx, k)
-			}
-		}
-		log.Printf("No data found for %s, partition cleared.", dayStr)
-		return nil
+// totalService is the service of the -emit-totals rows. Their other
+// dimensions are empty.
+const totalService = "__total__"
+
+// add folds fact into the row for key.
+func (a *dayAggregator) add(key AggregationKey, fact *schemas.RequestFact) {
+	agg, exists := a.aggs[key]
+	if !exists {
+		agg = &Aggregator{Latencies: a.newRecorder()}
+		a.aggs[key] = agg
 	}
 
-	// Compute Metrics
-	metrics := make([]MetricRow, 0, len(aggs))
-	for key, agg := range aggs {
-		p50, _ := stats.Percentile(agg.Latencies, 50)
-		p95, _ := stats.Percentile(agg.Latencies, 95)
-		p99, _ := stats.Percentile(agg.Latencies, 99)
+	agg.Requests++
+	if fact.StatusCode >= 500 {
+		agg.Errors++
+	}
+	switch fact.StatusCode / 100 {
+	case 2:
+		agg.Count2xx++
+	case 3:
+		agg.Count3xx++
+	case 4:
+		agg.Count4xx++
+	case 5:
+		agg.Count5xx++
+	}
+	agg.Latencies.Add(float64(fact.LatencyMs))
+	switch latency := int64(fact.LatencyMs); {
+	case latency <= a.cfg.apdexThresholdMs():
+		agg.Satisfied++
+	case latency <= 4*a.cfg.apdexThresholdMs():
+		agg.Tolerating++
+	}
+}
 
+// rows computes one MetricRow per aggregation key, sorted by bucket and service.
+func (a *dayAggregator) rows() []MetricRow {
+	metrics := make([]MetricRow, 0, len(a.aggs))
+	for key, agg := range a.aggs {
 		rate := 0.0
+		var apdex *float64
 		if agg.Requests > 0 {
 			rate = float64(agg.Errors) / float64(agg.Requests)
+			score := (float64(agg.Satisfied) + float64(agg.Tolerating)/2) / float64(agg.Requests)
+			apdex = &score
 		}
 
-		metrics = append(metrics, MetricRow{
+		row := MetricRow{
 			BucketStart:  key.BucketStart.Format("2006-01-02 15:04:05"),
 			Service:      key.Service,
 			Method:       key.Method,
 			PathTemplate: key.PathTemplate,
 			RequestCount: agg.Requests,
-			EventDay:     dayStr,
+			EventDay:     a.dayStr,
 			ErrorCount:   agg.Errors,
 			ErrorRate:    rate,
-			P50LatencyMs: p50,
-			P95LatencyMs: p95,
-			P99LatencyMs: p99,
-		})
-	}
+			Count2xx:     agg.Count2xx,
+			Count3xx:     agg.Count3xx,
+			Count4xx:     agg.Count4xx,
+			Count5xx:     agg.Count5xx,
+			Apdex:        apdex,
 
-	// Sort for consistent output
-	sort.Slice(metrics, func(i, j int) bool {
-		if metrics[i].BucketStart == metrics[j].BucketStart {
-			return metrics[i].Service < metrics[j].Service
+			UserAgentFamily: key.UserAgentFamily,
+			Source:          key.Source,
+			BucketSeconds:   int64(a.cfg.bucket() / time.Second),
+		}
+		// Below -min-samples the percentiles are left NULL rather than charted as if meaningful
+		if agg.Requests >= a.cfg.MinSamples {
+			for _, p := range a.cfg.percentiles() {
+				percentileColumns[p](&row, percentile(agg.Latencies, p))
+			}
 		}
-		return metrics[i].BucketStart < metrics[j].BucketStart
+		metrics = append(metrics, row)
+	}
+
+	// Sort on every dimension, so the same facts always give byte-identical output
+	slices.SortFunc(metrics, func(a, b MetricRow) int {
+		return cmp.Or(
+			cmp.Compare(a.BucketStart, b.BucketStart),
+			cmp.Compare(a.Service, b.Service),
+			cmp.Compare(a.Method, b.Method),
+			cmp.Compare(a.PathTemplate, b.PathTemplate),
+			cmp.Compare(a.UserAgentFamily, b.UserAgentFamily),
+			cmp.Compare(a.Source, b.Source),
+		)
 	})
+	return metrics
+}
 
-	// Write Parquet to buffer
-	idx := uuid.New().String()
-	destKey := fmt.Sprintf("%s/metrics_%s_%s.parquet", outputPrefix, idx, dayStr)
+// openStore returns the store from the environment, mirrored to a second
+// bucket (e.g. an S3 archive behind a MinIO hot copy) when one is configured.
+func openStore() storage.ObjectStore {
+	store, err := storage.FromEnv(context.Background(), "./data")
+	if err != nil {
+		log.Fatalf("Failed to initialize store: %v", err)
+	}
+	store, err = storage.MirrorFromEnv(context.Background(), store)
+	if err != nil {
+		log.Fatalf("Failed to initialize mirror store: %v", err)
+	}
+	return store
+}
 
-	var buf bytes.Buffer
-	writer := parquet.NewGenericWriter[MetricRow](&buf, parquet.Compression(&zstd.Codec{Level: zstd.SpeedDefault}))
-	if _, err := writer.Write(metrics); err != nil {
+// runStdin is main for -stdin. Writing to standard output touches neither the
+// store nor the run lock, and no metrics server is started for a one-off run.
+func runStdin(cfg rollupConfig, processingTime, outputDir string, otherMode bool) {
+	if otherMode {
+		log.Fatal("-stdin processes a single day and cannot be combined with -start-day, -end-day or -sqs-queue-url")
+	}
+	var day time.Time
+	if processingTime != "" {
+		var err error
+		if day, err = time.Parse(time.RFC3339, processingTime); err != nil {
+			log.Fatalf("Invalid process-time: %v", err)
+		}
+	}
+
+	var store storage.ObjectStore
+	if cfg.Output == nil {
+		lockFile, err := acquireLock(outputDir)
+		if err != nil {
+			log.Fatalf("Cannot start rollup: %v", err)
+		}
+		defer releaseLock(lockFile)
+		store = openStore()
+	}
+
+	if err := processReader(context.Background(), os.Stdin, day, store, cfg); err != nil {
+		log.Fatalf("Failed to process standard input: %v", err)
+	}
+}
+
+// processDay processes all hours within a day.
+// It scans input data partitioned by Day/Hour (part of new durable sink layout).
+// It performs deduplication across the entire day to ensure correctness if events skew across hour boundaries (within reason).
+// But effectively, we partition output by Day/Hour too if needed, or just by Day.
+// Given Hive supports Day partitioning, let's output by Day.
+func processDay(ctx context.Context, day time.Time, store storage.ObjectStore, cfg rollupConfig) error {
+	dayStr := day.UTC().Format("2006-01-02")
+
+	start := time.Now()
+
+	agg := newDayAggregator(day, cfg)
+
+	keys, sources, err := listDayInputs(ctx, store, cfg, day)
+	if err != nil {
+		// Abort rather than fall through to the empty-day path, which would clear output
 		return err
 	}
-	if err := writer.Close(); err != nil {
+
+	var processed []string // inputs in aggs, including those of the previous -incremental run
+	if cfg.Incremental {
+		if m := readManifest(ctx, store, cfg, dayStr); m != nil {
+			if err := agg.resume(m); err != nil {
+				log.Printf("Failed to resume %s, rolling up in full: %v", dayStr, err)
+				agg = newDayAggregator(day, cfg)
+			} else {
+				processed = m.Processed
+				keys, sources = unprocessedInputs(keys, sources, m.Processed)
+				if len(keys) == 0 {
+					log.Printf("No new input for %s since the last run, output kept.", dayStr)
+					// Still report the run; the kept output has the rows of the last one
+					metrics := agg.rows()
+					rollupRowsWritten.WithLabelValues(dayStr).Set(float64(len(metrics)))
+					rollupDurationSeconds.WithLabelValues(dayStr).Set(time.Since(start).Seconds())
+					reportLastRun(metrics, cfg.lastRunTopServices())
+					return nil
+				}
+				log.Printf("Resuming %s with %d new input objects", dayStr, len(keys))
+			}
+		}
+	}
+
+	unreadable := 0 // objects that failed to read; their facts are missing from aggs
+	for i, key := range keys {
+		if !strings.HasSuffix(key, ".jsonl") {
+			processed = append(processed, key)
+			continue
+		}
+
+		// Process JSONL Object
+		data, err := readObject(ctx, store, key)
+		if err != nil {
+			log.Printf("Error getting object %s: %v", key, err)
+			unreadable++
+			continue
+		}
+		if err := agg.addBatch(data, key, sources[i]); err != nil {
+			log.Printf("Error reading object %s: %v", key, err)
+			unreadable++
+			continue
+		}
+		processed = append(processed, key)
+	}
+
+	// Output Object: warehouse/request_metrics_minute/metrics_<uuid>_<day>.parquet, see rollupConfig.outputName
+	outputPrefix := cfg.WarehousePrefix
+
+	// Nothing read is not the same as nothing there: never clear on a failed read
+	if len(agg.aggs) == 0 && unreadable > 0 {
+		return fmt.Errorf("no facts read for %s and %d objects failed to read; existing output kept", dayStr, unreadable)
+	}
+
+	if cfg.Output != nil {
+		// An empty day is still valid output (an empty table), there's just nothing to clear
+		metrics := agg.rows()
+		if err := writeRows(cfg.Output, cfg.OutputFormat, metrics, cfg.groupBy(), cfg.latencyUnit()); err != nil {
+			return fmt.Errorf("failed to write metrics: %w", err)
+		}
+		log.Printf("Wrote %d metrics rows for %s", len(metrics), dayStr)
+		return nil
+	}
+
+	if len(agg.aggs) == 0 {
+		if cfg.NoCleanup {
+			log.Printf("No data found for %s, nothing written (sandbox output).", dayStr)
+			rollupRowsWritten.WithLabelValues(dayStr).Set(0)
+			rollupDurationSeconds.WithLabelValues(dayStr).Set(time.Since(start).Seconds())
+			return nil
+		}
+		if cfg.KeepEmpty {
+			log.Printf("No data found for %s, existing output kept (-no-clear-empty).", dayStr)
+			rollupRowsWritten.WithLabelValues(dayStr).Set(0)
+			rollupDurationSeconds.WithLabelValues(dayStr).Set(time.Since(start).Seconds())
+			return nil
+		}
+		if cfg.RecheckEmptyAfter > 0 {
+			if err := recheckEmptyDay(ctx, store, cfg, day, keys); err != nil {
+				return err
+			}
+		}
+		// Idempotency: clear stale output even when no new data
+		clearDay(ctx, store, outputPrefix, dayStr)
+		if cfg.JSONLPrefix != "" {
+			clearDay(ctx, store, cfg.JSONLPrefix, dayStr)
+		}
+		if cfg.WriteIndex {
+			if err := warehouse.UpdateIndex(ctx, store, outputPrefix, dayStr, nil); err != nil {
+				return fmt.Errorf("failed to update index: %w", err)
+			}
+		}
+		log.Printf("No data found for %s, partition cleared.", dayStr)
+		// Still report the run so "ran, no data" is distinguishable from "didn't run"
+		rollupRowsWritten.WithLabelValues(dayStr).Set(0)
+		rollupDurationSeconds.WithLabelValues(dayStr).Set(time.Since(start).Seconds())
+		reportLastRun(nil, cfg.lastRunTopServices())
+		return nil
+	}
+
+	metrics := agg.rows()
+	if err := writeDay(ctx, store, cfg, dayStr, metrics); err != nil {
 		return err
 	}
+	if cfg.Incremental {
+		if unreadable > 0 {
+			// addBatch keeps the lines it read before a failure, so resuming would
+			// add them a second time once the object is read again
+			log.Printf("%d objects of %s failed to read; the next run rolls it up in full", unreadable, dayStr)
+			agg.dropManifest(ctx, store)
+		} else if err := agg.writeManifest(ctx, store, processed); err != nil {
+			log.Printf("Failed to write the manifest for %s; the next run rolls it up in full: %v", dayStr, err)
+			agg.dropManifest(ctx, store)
+		}
+	}
+	rollupRowsWritten.WithLabelValues(dayStr).Set(float64(len(metrics)))
+	rollupDurationSeconds.WithLabelValues(dayStr).Set(time.Since(start).Seconds())
+	reportLastRun(metrics, cfg.lastRunTopServices())
+	return nil
+}
+
+// reportLastRun replaces the rollup_last_run_error_rate series with the
+// day-wide error rates of the top services by request count in metrics, so
+// the series count stays bounded however many services report. Ties go to
+// the service that sorts first. -emit-totals rows are left out.
+func reportLastRun(metrics []MetricRow, top int) {
+	type serviceCounts struct {
+		service          string
+		requests, errors int64
+	}
+	byService := make(map[string]*serviceCounts)
+	for _, m := range metrics {
+		if m.Service == totalService {
+			continue
+		}
+		c, ok := byService[m.Service]
+		if !ok {
+			c = &serviceCounts{service: m.Service}
+			byService[m.Service] = c
+		}
+		c.requests += m.RequestCount
+		c.errors += m.ErrorCount
+	}
+	services := slices.Collect(maps.Values(byService))
+	slices.SortFunc(services, func(a, b *serviceCounts) int {
+		if a.requests != b.requests {
+			return cmp.Compare(b.requests, a.requests)
+		}
+		return strings.Compare(a.service, b.service)
+	})
+
+	rollupLastRunErrorRate.Reset()
+	for _, c := range services[:min(top, len(services))] {
+		if c.requests > 0 {
+			rollupLastRunErrorRate.WithLabelValues(c.service).Set(float64(c.errors) / float64(c.requests))
+		}
+	}
+}
+
+// writeDay uploads metrics as the day's new output and then removes the
+// previous output for the day, unless cfg.NoCleanup.
+func writeDay(ctx context.Context, store storage.ObjectStore, cfg rollupConfig, dayStr string, metrics []MetricRow) error {
+	// Write Parquet to buffer
+	// UUIDv7 embeds the write time, which lets cmd/warehouse-doctor pick the
+	// newest file if a crash ever leaves more than one for the same day.
+	id, err := uuid.NewV7()
+	if err != nil {
+		return fmt.Errorf("failed to generate output id: %w", err)
+	}
+	idx := id.String()
+	outputPrefix := cfg.WarehousePrefix
+	parts := splitParts(metrics, cfg.MaxPartRows)
+	destKeys := partKeys(fmt.Sprintf("%s/%s_%s_%s", outputPrefix, cfg.outputName(), idx, dayStr), len(parts))
+
+	// removeNew deletes parts already uploaded, so a failed write keeps the previous output whole
+	removeNew := func(keys []string) {
+		for _, key := range keys {
+			if delErr := store.Delete(ctx, key); delErr != nil {
+				log.Printf("Failed to remove output %s: %v", key, delErr)
+			}
+		}
+	}
 
 	// Write new file FIRST, then delete old files (write-then-swap).
 	// This ensures that if we crash between write and delete, stale data
 	// remains instead of no data at all.
-	if err := store.Put(ctx, destKey, bytes.NewReader(buf.Bytes())); err != nil {
-		return fmt.Errorf("failed to upload metrics: %w", err)
+	// Tags let S3 lifecycle rules and cost reports select outputs by dataset/day
+	tags := storage.WithTags(map[string]string{"dataset": datasetName, "day": dayStr})
+	var written []byte // every part in order, for the index checksum
+	for i, part := range parts {
+		var buf bytes.Buffer
+		if err := writeRows(&buf, "parquet", part, cfg.groupBy(), cfg.latencyUnit()); err != nil {
+			removeNew(destKeys[:i])
+			return err
+		}
+		if err := store.Put(ctx, destKeys[i], bytes.NewReader(buf.Bytes()), tags); err != nil {
+			removeNew(destKeys[:i])
+			return fmt.Errorf("failed to upload metrics: %w", err)
+		}
+		written = append(written, buf.Bytes()...)
+
+		if cfg.VerifyOutput {
+			if err := verifyOutput(ctx, store, destKeys[i], len(part)); err != nil {
+				// Keep the previous output; a bad newest file would otherwise win in queries and in warehouse-doctor
+				removeNew(destKeys[:i+1])
+				return err
+			}
+		}
+	}
+
+	var jsonlKey string
+	if cfg.JSONLPrefix != "" {
+		jsonlKey = fmt.Sprintf("%s/%s_%s_%s.jsonl", cfg.JSONLPrefix, cfg.outputName(), idx, dayStr)
+		if err := putJSONL(ctx, store, jsonlKey, metrics, cfg.latencyUnit(), tags); err != nil {
+			// Keep both previous artifacts rather than a parquet without its JSONL twin
+			removeNew(destKeys)
+			return err
+		}
 	}
 
 	// Idempotency: remove previous objects for this day (now safe -- new file exists)
-	existing, _ := store.List(ctx, outputPrefix)
-	for _, k := range existing {
-		if strings.Contains(k, dayStr) && k != destKey {
-			store.Delete(ctx, k)
+	if !cfg.NoCleanup {
+		clearDay(ctx, store, outputPrefix, dayStr, destKeys...)
+		if jsonlKey != "" {
+			clearDay(ctx, store, cfg.JSONLPrefix, dayStr, jsonlKey)
 		}
 	}
 
-	log.Printf("Uploaded %d metrics rows to %s", len(metrics), destKey)
-	rollupDurationSeconds.WithLabelValues(dayStr).Set(time.Since(start).Seconds())
+	// Only now do destKeys hold the day's data, so readers of the index never see a key that may be rolled back
+	if cfg.WriteIndex {
+		entry := warehouse.NewIndexEntry(destKeys[0], written, len(metrics), time.Now())
+		if len(destKeys) > 1 {
+			entry.Parts = destKeys
+		}
+		if err := warehouse.UpdateIndex(ctx, store, outputPrefix, dayStr, &entry); err != nil {
+			return fmt.Errorf("failed to update index: %w", err)
+		}
+	}
+
+	if len(destKeys) > 1 {
+		log.Printf("Uploaded %d metrics rows to %s and %d more parts", len(metrics), destKeys[0], len(destKeys)-1)
+	} else {
+		log.Printf("Uploaded %d metrics rows to %s", len(metrics), destKeys[0])
+	}
 	return nil
 }
+
+// splitParts cuts rows into consecutive parts of at most max rows, keeping
+// their order. max <= 0 keeps them in one part.
+func splitParts(rows []MetricRow, max int) [][]MetricRow {
+	if max <= 0 || len(rows) <= max {
+		return [][]MetricRow{rows}
+	}
+	return slices.Collect(slices.Chunk(rows, max))
+}
+
+// partKeys returns the object keys for n parts of the output named base: a
+// single base.parquet, or base.part00.parquet onwards. Part numbers are
+// zero-padded to the same width so the keys sort in part order.
+func partKeys(base string, n int) []string {
+	if n == 1 {
+		return []string{base + ".parquet"}
+	}
+	width := max(2, len(strconv.Itoa(n-1)))
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s.part%0*d.parquet", base, width, i)
+	}
+	return keys
+}
+
+// stdinSource is the source dimension of facts read by -stdin.
+const stdinSource = "stdin"
+
+// processReader rolls up the JSONL facts read from r, for -stdin. A zero day
+// means the day of the first valid fact. The rows go to cfg.Output when it is
+// set, and otherwise replace the day's output in store. Unlike processDay,
+// input without facts for the day is an error and never clears existing
+// output.
+func processReader(ctx context.Context, r io.Reader, day time.Time, store storage.ObjectStore, cfg rollupConfig) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read input: %w", err)
+	}
+	if day.IsZero() {
+		if day, err = firstFactDay(data); err != nil {
+			return err
+		}
+		log.Printf("Inferred day %s from the first fact", day.Format("2006-01-02"))
+	}
+
+	agg := newDayAggregator(day, cfg)
+	if err := agg.addBatch(data, stdinSource, stdinSource); err != nil {
+		return fmt.Errorf("read input: %w", err)
+	}
+	if len(agg.aggs) == 0 {
+		return fmt.Errorf("no facts for %s in input", agg.dayStr)
+	}
+
+	metrics := agg.rows()
+	if cfg.Output != nil {
+		if err := writeRows(cfg.Output, cfg.OutputFormat, metrics, cfg.groupBy(), cfg.latencyUnit()); err != nil {
+			return fmt.Errorf("failed to write metrics: %w", err)
+		}
+		log.Printf("Wrote %d metrics rows for %s", len(metrics), agg.dayStr)
+		return nil
+	}
+	return writeDay(ctx, store, cfg, agg.dayStr, metrics)
+}
+
+// firstFactDay returns the UTC day of the first valid fact in data.
+func firstFactDay(data []byte) (time.Time, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fact, err := schemas.ParseRequestFact(scanner.Bytes())
+		if err != nil {
+			continue
+		}
+		return fact.EventTime.AsTime().UTC().Truncate(24 * time.Hour), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return time.Time{}, fmt.Errorf("read input: %w", err)
+	}
+	return time.Time{}, fmt.Errorf("no valid facts in input to infer the day from")
+}
@@ -3,18 +3,39 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lgreene/gravix-dashboards/pkg/batch"
 	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/lgreene/gravix-dashboards/pkg/warehouse"
+	"github.com/parquet-go/parquet-go"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	gravixv1 "github.com/lgreene/gravix-dashboards/gen/gravix/v1"
 )
 
+// defaultConfig mirrors the production key layout with every optional behaviour off.
+var defaultConfig = rollupConfig{
+	RawPrefixes:     []string{"raw/request_facts"},
+	WarehousePrefix: "warehouse/request_metrics_minute",
+}
+
 func newUUIDv7(t *testing.T) string {
 	t.Helper()
 	id, err := uuid.NewV7()
@@ -87,10 +108,7 @@ func TestProcessDay_BasicAggregation(t *testing.T) {
 	key := fmt.Sprintf("raw/request_facts/%s/10/batch_test.jsonl", day.Format("2006-01-02"))
 	writeFacts(t, store, key, facts)
 
-	outputDir := "./data/warehouse/request_metrics_minute"
-	inputDir := "./data/raw/request_facts"
-
-	err = processDay(context.Background(), day, store, inputDir, outputDir)
+	err = processDay(context.Background(), day, store, defaultConfig)
 	if err != nil {
 		t.Fatalf("processDay failed: %v", err)
 	}
@@ -134,10 +152,7 @@ func TestProcessDay_Deduplication(t *testing.T) {
 	writeFact(t, store, key1, fact)
 	writeFact(t, store, key2, duplicate)
 
-	outputDir := "./data/warehouse/request_metrics_minute"
-	inputDir := "./data/raw/request_facts"
-
-	err = processDay(context.Background(), day, store, inputDir, outputDir)
+	err = processDay(context.Background(), day, store, defaultConfig)
 	if err != nil {
 		t.Fatalf("processDay failed: %v", err)
 	}
@@ -163,11 +178,8 @@ func TestProcessDay_EmptyInput(t *testing.T) {
 
 	day, _ := time.Parse("2006-01-02", "2025-01-15")
 
-	outputDir := "./data/warehouse/request_metrics_minute"
-	inputDir := "./data/raw/request_facts"
-
 	// processDay with no input data should succeed (no-op)
-	err = processDay(context.Background(), day, store, inputDir, outputDir)
+	err = processDay(context.Background(), day, store, defaultConfig)
 	if err != nil {
 		t.Fatalf("processDay with empty input should not fail: %v", err)
 	}
@@ -198,10 +210,7 @@ func TestProcessDay_WrongDayFiltered(t *testing.T) {
 	key := fmt.Sprintf("raw/request_facts/%s/10/batch_test.jsonl", day.Format("2006-01-02"))
 	writeFact(t, store, key, fact)
 
-	outputDir := "./data/warehouse/request_metrics_minute"
-	inputDir := "./data/raw/request_facts"
-
-	err = processDay(context.Background(), day, store, inputDir, outputDir)
+	err = processDay(context.Background(), day, store, defaultConfig)
 	if err != nil {
 		t.Fatalf("processDay failed: %v", err)
 	}
@@ -217,6 +226,82 @@ func TestProcessDay_WrongDayFiltered(t *testing.T) {
 	}
 }
 
+func TestProcessDay_CRLFLines(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	day, _ := time.Parse("2006-01-02", "2025-01-15")
+	eventTime := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	for _, latency := range []int32{10, 20} {
+		data, _ := protojson.Marshal(makeFact(t, "api-service", "GET", "/users", 200, latency, eventTime))
+		buf.Write(data)
+		buf.WriteString("\r\n\r\n")
+	}
+	if err := store.Put(ctx, "raw/request_facts/2025-01-15/10/batch_crlf.jsonl", &buf); err != nil {
+		t.Fatalf("failed to put facts: %v", err)
+	}
+
+	if err := processDay(ctx, day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	keys, err := warehouse.DayKeys(ctx, store, defaultConfig.WarehousePrefix, "2025-01-15")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected 1 output file, got %v (err %v)", keys, err)
+	}
+	rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if len(rows) != 1 || rows[0].RequestCount != 2 {
+		t.Errorf("expected both CRLF-terminated facts in 1 row, got %+v", rows)
+	}
+}
+
+func TestProcessDay_DayBoundaryOverlap(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	day, _ := time.Parse("2006-01-02", "2025-01-15")
+	// Rotated after midnight, so filed under the next day's first hour
+	late := makeFact(t, "api-service", "GET", "/users", 200, 10, time.Date(2025, 1, 15, 23, 59, 59, 0, time.UTC))
+	writeFacts(t, store, "raw/request_facts/2025-01-16/00/batch_a.jsonl", []*gravixv1.RequestFact{late})
+	// A client clock running ahead files a fact under the previous day's last hour
+	early := makeFact(t, "api-service", "GET", "/users", 200, 20, time.Date(2025, 1, 15, 0, 0, 5, 0, time.UTC))
+	writeFacts(t, store, "raw/request_facts/2025-01-14/23/batch_b.jsonl", []*gravixv1.RequestFact{early})
+	// Further from the boundary: not scanned
+	writeFacts(t, store, "raw/request_facts/2025-01-16/01/batch_c.jsonl",
+		[]*gravixv1.RequestFact{makeFact(t, "api-service", "GET", "/users", 200, 30, time.Date(2025, 1, 15, 23, 0, 0, 0, time.UTC))})
+	// Boundary hour, but the event belongs to the neighbouring day
+	writeFacts(t, store, "raw/request_facts/2025-01-16/00/batch_d.jsonl",
+		[]*gravixv1.RequestFact{makeFact(t, "api-service", "GET", "/users", 200, 40, time.Date(2025, 1, 16, 0, 0, 1, 0, time.UTC))})
+
+	if err := processDay(ctx, day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	keys, err := warehouse.DayKeys(ctx, store, defaultConfig.WarehousePrefix, "2025-01-15")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected 1 output file, got %v (err %v)", keys, err)
+	}
+	rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	var total int64
+	for _, r := range rows {
+		total += r.RequestCount
+	}
+	if total != 2 {
+		t.Errorf("expected both boundary facts and nothing else, got %d requests in %+v", total, rows)
+	}
+}
+
 func TestAcquireReleaseLock(t *testing.T) {
 	dir := t.TempDir()
 
@@ -242,3 +327,1521 @@ func TestAcquireReleaseLock(t *testing.T) {
 	}
 	releaseLock(f2)
 }
+
+func TestProcessDay_CustomPrefixes(t *testing.T) {
+	dataDir := t.TempDir()
+	store, err := storage.NewLocalStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	day, _ := time.Parse("2006-01-02", "2025-01-15")
+	eventTime := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	// Key layout unrelated to any on-disk ./data/ directory
+	key := fmt.Sprintf("tenant-a/facts/%s/10/batch_test.jsonl", day.Format("2006-01-02"))
+	writeFact(t, store, key, makeFact(t, "api-service", "GET", "/users", 200, 10, eventTime))
+
+	err = processDay(context.Background(), day, store, rollupConfig{RawPrefixes: []string{"tenant-a/facts"}, WarehousePrefix: "tenant-a/metrics"})
+	if err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+
+	keys, err := store.List(context.Background(), "tenant-a/metrics")
+	if err != nil {
+		t.Fatalf("failed to list output: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("expected 1 output file under custom warehouse prefix, got %v", keys)
+	}
+}
+
+func TestPrefixFromDir(t *testing.T) {
+	tests := map[string]string{
+		"./data/raw/request_facts":                 "raw/request_facts",
+		"./data/warehouse/request_metrics_minute/": "warehouse/request_metrics_minute",
+		"raw/request_facts":                        "raw/request_facts",
+	}
+	for dir, want := range tests {
+		if got := prefixFromDir(dir); got != want {
+			t.Errorf("prefixFromDir(%q) = %q, want %q", dir, got, want)
+		}
+	}
+}
+
+func TestProcessDay_NormalizePaths(t *testing.T) {
+	dataDir := t.TempDir()
+	store, err := storage.NewLocalStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	day, _ := time.Parse("2006-01-02", "2025-01-15")
+	eventTime := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	facts := []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users/{id}", 200, 10, eventTime),
+		makeFact(t, "api-service", "GET", "/users/:id", 200, 20, eventTime),
+		makeFact(t, "api-service", "GET", "/users/%7Bid%7D", 200, 30, eventTime),
+	}
+	key := fmt.Sprintf("raw/request_facts/%s/10/batch_test.jsonl", day.Format("2006-01-02"))
+	writeFacts(t, store, key, facts)
+
+	countRows := func() []warehouse.MetricRow {
+		t.Helper()
+		keys, err := warehouse.DayKeys(ctx, store, defaultConfig.WarehousePrefix, "2025-01-15")
+		if err != nil || len(keys) != 1 {
+			t.Fatalf("expected 1 output file, got %v (err %v)", keys, err)
+		}
+		rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+		if err != nil {
+			t.Fatalf("failed to read output: %v", err)
+		}
+		return rows
+	}
+
+	// Off by default: each placeholder style is its own bucket
+	if err := processDay(ctx, day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if rows := countRows(); len(rows) != 3 {
+		t.Fatalf("expected 3 rows without normalization, got %d", len(rows))
+	}
+
+	cfg := defaultConfig
+	cfg.NormalizePaths = true
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	rows := countRows()
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row with normalization, got %d: %+v", len(rows), rows)
+	}
+	if rows[0].PathTemplate != "/users/{id}" || rows[0].RequestCount != 3 {
+		t.Errorf("expected 3 requests on /users/{id}, got %+v", rows[0])
+	}
+}
+
+// footerBatch marshals facts as JSONL and appends a batch footer, optionally lying about the count.
+func footerBatch(t *testing.T, facts []*gravixv1.RequestFact, countDelta int64) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	sum := batch.NewChecksum()
+	for _, fact := range facts {
+		data, err := protojson.Marshal(fact)
+		if err != nil {
+			t.Fatalf("failed to marshal fact: %v", err)
+		}
+		sum.Add(data)
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	footer := sum.Footer()
+	footer.Count += countDelta
+	data, _ := json.Marshal(footer)
+	buf.Write(data)
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func TestProcessDay_BatchFooter(t *testing.T) {
+	dataDir := t.TempDir()
+	store, err := storage.NewLocalStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	day, _ := time.Parse("2006-01-02", "2025-01-15")
+	eventTime := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	prefix := "raw/request_facts/2025-01-15/10/"
+
+	intact := footerBatch(t, []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 200, 10, eventTime),
+		makeFact(t, "api-service", "GET", "/users", 200, 20, eventTime),
+	}, 0)
+	corrupt := footerBatch(t, []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 200, 30, eventTime),
+	}, 1)
+	store.Put(ctx, prefix+"batch_intact.jsonl", bytes.NewReader(intact))
+	store.Put(ctx, prefix+"batch_corrupt.jsonl", bytes.NewReader(corrupt))
+	writeFact(t, store, prefix+"batch_nofooter.jsonl", makeFact(t, "api-service", "GET", "/users", 200, 40, eventTime))
+
+	mismatchBefore := testCounter(t, rollupBatchFooterFailuresTotal.WithLabelValues("mismatch"))
+	missingBefore := testCounter(t, rollupBatchFooterFailuresTotal.WithLabelValues("missing"))
+
+	cfg := defaultConfig
+	cfg.RequireBatchFooter = true
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+
+	if got := testCounter(t, rollupBatchFooterFailuresTotal.WithLabelValues("mismatch")) - mismatchBefore; got != 1 {
+		t.Errorf("expected 1 footer mismatch, got %v", got)
+	}
+	if got := testCounter(t, rollupBatchFooterFailuresTotal.WithLabelValues("missing")) - missingBefore; got != 1 {
+		t.Errorf("expected 1 missing footer, got %v", got)
+	}
+
+	// Footers are control lines: every fact is still aggregated, no footer is
+	keys, _ := warehouse.DayKeys(ctx, store, defaultConfig.WarehousePrefix, "2025-01-15")
+	if len(keys) != 1 {
+		t.Fatalf("expected 1 output file, got %v", keys)
+	}
+	rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if len(rows) != 1 || rows[0].RequestCount != 4 {
+		t.Errorf("expected a single row with 4 requests, got %+v", rows)
+	}
+}
+
+func testCounter(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatalf("failed to read counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func testGauge(t *testing.T, g prometheus.Gauge) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := g.Write(&m); err != nil {
+		t.Fatalf("failed to read gauge: %v", err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func TestProcessDay_EmptyDayReportsMetrics(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	day := time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC)
+
+	// Sentinels: a run that skips the metrics would leave them untouched
+	rollupRowsWritten.WithLabelValues("2025-02-03").Set(-1)
+	rollupDurationSeconds.WithLabelValues("2025-02-03").Set(-1)
+
+	if err := processDay(context.Background(), day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if got := testGauge(t, rollupRowsWritten.WithLabelValues("2025-02-03")); got != 0 {
+		t.Errorf("expected rollup_rows_written 0 for an empty day, got %v", got)
+	}
+	if got := testGauge(t, rollupDurationSeconds.WithLabelValues("2025-02-03")); got < 0 {
+		t.Errorf("expected rollup_duration_seconds to be set for an empty day, got %v", got)
+	}
+
+	writeFacts(t, store, "raw/request_facts/2025-02-03/10/batch_a.jsonl", []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour)),
+		makeFact(t, "api-service", "GET", "/users", 200, 12, day.Add(10*time.Hour+time.Minute)),
+	})
+	if err := processDay(context.Background(), day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if got := testGauge(t, rollupRowsWritten.WithLabelValues("2025-02-03")); got != 2 {
+		t.Errorf("expected rollup_rows_written 2, got %v", got)
+	}
+}
+
+func TestReportLastRun_TopServices(t *testing.T) {
+	series := func() int {
+		ch := make(chan prometheus.Metric, 16)
+		rollupLastRunErrorRate.Collect(ch)
+		close(ch)
+		return len(ch)
+	}
+	row := func(service string, requests, errors int64) MetricRow {
+		return MetricRow{Service: service, RequestCount: requests, ErrorCount: errors}
+	}
+
+	reportLastRun([]MetricRow{
+		row("checkout", 60, 3),
+		row("checkout", 40, 2),
+		row("search", 80, 8),
+		row("billing", 80, 0),
+		row("auth", 5, 5),
+		row(totalService, 265, 18),
+	}, 2)
+	if got := series(); got != 2 {
+		t.Fatalf("expected 2 rollup_last_run_error_rate series, got %d", got)
+	}
+	if got := testGauge(t, rollupLastRunErrorRate.WithLabelValues("checkout")); got != 0.05 {
+		t.Errorf("expected checkout error rate 0.05 over the whole day, got %v", got)
+	}
+	// search and billing tie on requests; billing sorts first
+	if got := testGauge(t, rollupLastRunErrorRate.WithLabelValues("billing")); got != 0 {
+		t.Errorf("expected billing error rate 0, got %v", got)
+	}
+	if got := series(); got != 2 {
+		t.Errorf("expected search and auth to be left out, got %d series", got)
+	}
+
+	// A later run with no data drops the previous run's series
+	reportLastRun(nil, 2)
+	if got := series(); got != 0 {
+		t.Errorf("expected no series after an empty run, got %d", got)
+	}
+}
+
+// truncatingStore cuts parquet uploads short, simulating a corrupt write that Put reports as successful.
+type truncatingStore struct {
+	storage.ObjectStore
+}
+
+func (s *truncatingStore) Put(ctx context.Context, key string, r io.Reader, opts ...storage.PutOption) error {
+	if !strings.HasSuffix(key, ".parquet") {
+		return s.ObjectStore.Put(ctx, key, r, opts...)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return s.ObjectStore.Put(ctx, key, bytes.NewReader(data[:len(data)/2]), opts...)
+}
+
+func TestProcessDay_VerifyKeepsOldOutputOnCorruptWrite(t *testing.T) {
+	local, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	writeFact(t, local, "raw/request_facts/2025-01-15/10/batch_a.jsonl", makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour)))
+
+	cfg := defaultConfig
+	cfg.VerifyOutput = true
+	if err := processDay(ctx, day, local, cfg); err != nil {
+		t.Fatalf("verified run on a healthy store failed: %v", err)
+	}
+	good, _ := warehouse.DayKeys(ctx, local, cfg.WarehousePrefix, "2025-01-15")
+	if len(good) != 1 {
+		t.Fatalf("expected 1 output file, got %v", good)
+	}
+
+	if err := processDay(ctx, day, &truncatingStore{ObjectStore: local}, cfg); err == nil {
+		t.Fatal("expected verification to fail for a truncated write")
+	}
+	after, _ := warehouse.DayKeys(ctx, local, cfg.WarehousePrefix, "2025-01-15")
+	if len(after) != 1 || after[0] != good[0] {
+		t.Errorf("expected only the previous output %v to remain, got %v", good, after)
+	}
+	if _, err := warehouse.ReadMetricRows(ctx, local, good[0]); err != nil {
+		t.Errorf("previous output is no longer readable: %v", err)
+	}
+}
+
+func TestParseGroupBy(t *testing.T) {
+	dims, err := parseGroupBy(" service , user_agent_family")
+	if err != nil || strings.Join(dims, ",") != "service,user_agent_family" {
+		t.Errorf("expected [service user_agent_family], got %v (err %v)", dims, err)
+	}
+	for _, bad := range []string{"", "service,status_code", "service,service", "bucket_start"} {
+		if _, err := parseGroupBy(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestProcessDay_GroupBy(t *testing.T) {
+	dataDir := t.TempDir()
+	store, err := storage.NewLocalStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	day, _ := time.Parse("2006-01-02", "2025-01-15")
+	eventTime := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	facts := []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 200, 10, eventTime),
+		makeFact(t, "api-service", "POST", "/orders", 500, 20, eventTime),
+		makeFact(t, "api-service", "GET", "/users", 200, 30, eventTime),
+	}
+	facts[0].UserAgentFamily = "Chrome"
+	facts[1].UserAgentFamily = "Chrome"
+	facts[2].UserAgentFamily = "Firefox"
+	writeFacts(t, store, "raw/request_facts/2025-01-15/10/batch_test.jsonl", facts)
+
+	cfg := defaultConfig
+	cfg.GroupBy = []string{"service", "user_agent_family"}
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+
+	keys, err := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-15")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected 1 output file, got %v (err %v)", keys, err)
+	}
+	rc, err := store.Get(ctx, keys[0])
+	if err != nil {
+		t.Fatalf("failed to get output: %v", err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("failed to open parquet: %v", err)
+	}
+	for _, col := range []string{"method", "path_template"} {
+		if _, ok := file.Schema().Lookup(col); ok {
+			t.Errorf("ungrouped dimension %s should not be a column", col)
+		}
+	}
+	for _, col := range []string{"bucket_start", "service", "user_agent_family", "request_count"} {
+		if _, ok := file.Schema().Lookup(col); !ok {
+			t.Errorf("expected column %s in output", col)
+		}
+	}
+
+	rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	counts := map[string]int64{}
+	for _, r := range rows {
+		if r.Method != "" || r.PathTemplate != "" {
+			t.Errorf("expected ungrouped dimensions to read back empty, got %+v", r)
+		}
+		counts[r.UserAgentFamily] = r.RequestCount
+	}
+	if len(rows) != 2 || counts["Chrome"] != 2 || counts["Firefox"] != 1 {
+		t.Errorf("expected Chrome=2 and Firefox=1, got %+v", rows)
+	}
+}
+
+func TestParseRawPrefixes(t *testing.T) {
+	prefixes, err := parseRawPrefixes("raw/request_facts, raw/grpc_facts/")
+	if err != nil || strings.Join(prefixes, ",") != "raw/request_facts,raw/grpc_facts" {
+		t.Errorf("expected [raw/request_facts raw/grpc_facts], got %v (err %v)", prefixes, err)
+	}
+	for _, bad := range []string{"", " , ", "a/request_facts,b/request_facts"} {
+		if _, err := parseRawPrefixes(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestProcessDay_MultipleRawPrefixes(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	day, _ := time.Parse("2006-01-02", "2025-01-15")
+	eventTime := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	httpFact := makeFact(t, "api-service", "GET", "/users", 200, 10, eventTime)
+	grpcFact := makeFact(t, "api-service", "GET", "/users", 200, 20, eventTime)
+	writeFacts(t, store, "raw/request_facts/2025-01-15/10/batch_a.jsonl", []*gravixv1.RequestFact{httpFact})
+	// The same event delivered on both topics is counted once
+	writeFacts(t, store, "raw/grpc_facts/2025-01-15/10/batch_b.jsonl", []*gravixv1.RequestFact{grpcFact, httpFact})
+
+	readRows := func() []warehouse.MetricRow {
+		t.Helper()
+		keys, err := warehouse.DayKeys(ctx, store, defaultConfig.WarehousePrefix, "2025-01-15")
+		if err != nil || len(keys) != 1 {
+			t.Fatalf("expected 1 output file, got %v (err %v)", keys, err)
+		}
+		rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+		if err != nil {
+			t.Fatalf("failed to read output: %v", err)
+		}
+		return rows
+	}
+
+	cfg := defaultConfig
+	cfg.RawPrefixes = []string{"raw/request_facts", "raw/grpc_facts"}
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if rows := readRows(); len(rows) != 1 || rows[0].RequestCount != 2 || rows[0].Source != "" {
+		t.Fatalf("expected both topics combined into 1 row of 2 requests, got %+v", rows)
+	}
+
+	cfg.GroupBy = append(slices.Clone(defaultGroupBy), "source")
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	counts := map[string]int64{}
+	for _, r := range readRows() {
+		counts[r.Source] = r.RequestCount
+	}
+	if len(counts) != 2 || counts["request_facts"] != 1 || counts["grpc_facts"] != 1 {
+		t.Errorf("expected one request per source, got %v", counts)
+	}
+}
+
+// failingReadStore fails to list or read raw facts, leaving other keys alone.
+type failingReadStore struct {
+	storage.ObjectStore
+	failList bool
+}
+
+func (s *failingReadStore) List(ctx context.Context, prefix string) ([]string, error) {
+	if s.failList && strings.HasPrefix(prefix, "raw/") {
+		return nil, fmt.Errorf("injected list failure")
+	}
+	return s.ObjectStore.List(ctx, prefix)
+}
+
+func (s *failingReadStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if strings.HasPrefix(key, "raw/") {
+		return nil, fmt.Errorf("injected get failure")
+	}
+	return s.ObjectStore.Get(ctx, key)
+}
+
+func TestProcessDay_ReadErrorsKeepExistingOutput(t *testing.T) {
+	local, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	writeFact(t, local, "raw/request_facts/2025-01-15/10/batch_a.jsonl", makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour)))
+	if err := processDay(ctx, day, local, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	good, _ := warehouse.DayKeys(ctx, local, defaultConfig.WarehousePrefix, "2025-01-15")
+	if len(good) != 1 {
+		t.Fatalf("expected 1 output file, got %v", good)
+	}
+
+	for _, failList := range []bool{true, false} {
+		store := &failingReadStore{ObjectStore: local, failList: failList}
+		if err := processDay(ctx, day, store, defaultConfig); err == nil {
+			t.Errorf("failList=%v: expected an error when raw facts can't be read", failList)
+		}
+		after, _ := warehouse.DayKeys(ctx, local, defaultConfig.WarehousePrefix, "2025-01-15")
+		if len(after) != 1 || after[0] != good[0] {
+			t.Errorf("failList=%v: expected output %v to be kept, got %v", failList, good, after)
+		}
+	}
+}
+
+func TestProcessDay_KeepEmpty(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	rawKey := "raw/request_facts/2025-01-15/10/batch_a.jsonl"
+	writeFact(t, store, rawKey, makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour)))
+	if err := processDay(ctx, day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if err := store.Delete(ctx, rawKey); err != nil {
+		t.Fatalf("failed to delete raw input: %v", err)
+	}
+
+	cfg := defaultConfig
+	cfg.KeepEmpty = true
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if keys, _ := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-15"); len(keys) != 1 {
+		t.Errorf("expected output to be kept with KeepEmpty, got %v", keys)
+	}
+
+	if err := processDay(ctx, day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if keys, _ := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-15"); len(keys) != 0 {
+		t.Errorf("expected output to be cleared by default, got %v", keys)
+	}
+}
+
+// s3PrefixStore lists like S3: prefix is matched as a plain string, not a directory.
+type s3PrefixStore struct {
+	storage.ObjectStore
+}
+
+func (s *s3PrefixStore) List(ctx context.Context, prefix string) ([]string, error) {
+	all, err := s.ObjectStore.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, k := range all {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func TestProcessDay_AlsoJSONL(t *testing.T) {
+	local, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	// warehouse/request_metrics_minute is a string prefix of the _jsonl sibling
+	store := &s3PrefixStore{ObjectStore: local}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	rawKey := "raw/request_facts/2025-01-15/10/batch_a.jsonl"
+	writeFacts(t, store, rawKey, []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour)),
+		makeFact(t, "api-service", "POST", "/orders", 500, 20, day.Add(10*time.Hour)),
+	})
+
+	cfg := defaultConfig
+	cfg.JSONLPrefix = "warehouse/request_metrics_minute_jsonl"
+	// Run twice: the second run must replace, not add to, both artifacts
+	for i := 0; i < 2; i++ {
+		if err := processDay(ctx, day, store, cfg); err != nil {
+			t.Fatalf("processDay failed: %v", err)
+		}
+	}
+
+	parquetKeys, _ := store.List(ctx, cfg.WarehousePrefix+"/")
+	jsonlKeys, _ := store.List(ctx, cfg.JSONLPrefix)
+	if len(parquetKeys) != 1 || len(jsonlKeys) != 1 {
+		t.Fatalf("expected one parquet and one JSONL object, got %v and %v", parquetKeys, jsonlKeys)
+	}
+	if strings.TrimSuffix(path.Base(parquetKeys[0]), ".parquet") != strings.TrimSuffix(path.Base(jsonlKeys[0]), ".jsonl") {
+		t.Errorf("expected matching object names, got %s and %s", parquetKeys[0], jsonlKeys[0])
+	}
+
+	want, err := warehouse.ReadMetricRows(ctx, store, parquetKeys[0])
+	if err != nil {
+		t.Fatalf("failed to read parquet: %v", err)
+	}
+	rc, err := store.Get(ctx, jsonlKeys[0])
+	if err != nil {
+		t.Fatalf("failed to get JSONL: %v", err)
+	}
+	defer rc.Close()
+	var got []warehouse.MetricRow
+	dec := json.NewDecoder(rc)
+	for dec.More() {
+		var row warehouse.MetricRow
+		if err := dec.Decode(&row); err != nil {
+			t.Fatalf("invalid JSONL row: %v", err)
+		}
+		got = append(got, row)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSONL rows differ from parquet:\n got %+v\nwant %+v", got, want)
+	}
+
+	// An empty day clears both artifacts
+	if err := store.Delete(ctx, rawKey); err != nil {
+		t.Fatalf("failed to delete raw input: %v", err)
+	}
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	parquetKeys, _ = store.List(ctx, cfg.WarehousePrefix+"/")
+	jsonlKeys, _ = store.List(ctx, cfg.JSONLPrefix)
+	if len(parquetKeys) != 0 || len(jsonlKeys) != 0 {
+		t.Errorf("expected both artifacts cleared, got %v and %v", parquetKeys, jsonlKeys)
+	}
+}
+
+// flakyBodyStore cuts the first failures raw bodies it serves short with a read error.
+type flakyBodyStore struct {
+	storage.ObjectStore
+	failures int
+	gets     int
+}
+
+func (s *flakyBodyStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := s.ObjectStore.Get(ctx, key)
+	if err != nil || !strings.HasPrefix(key, "raw/") {
+		return rc, err
+	}
+	s.gets++
+	if s.gets > s.failures {
+		return rc, nil
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	// Enough to include the first line, then a reset connection
+	cut := bytes.IndexByte(data, '\n') + 10
+	return io.NopCloser(io.MultiReader(bytes.NewReader(data[:cut]), iotest.ErrReader(fmt.Errorf("connection reset by peer")))), nil
+}
+
+func TestProcessDay_RefetchesBodyAfterMidStreamError(t *testing.T) {
+	local, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	eventTime := day.Add(10 * time.Hour)
+	writeFacts(t, local, "raw/request_facts/2025-01-15/10/batch_a.jsonl", []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 200, 10, eventTime),
+		makeFact(t, "api-service", "GET", "/users", 200, 20, eventTime),
+		makeFact(t, "api-service", "GET", "/users", 500, 30, eventTime),
+	})
+
+	store := &flakyBodyStore{ObjectStore: local, failures: 1}
+	if err := processDay(ctx, day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if store.gets != 2 {
+		t.Errorf("expected the object to be fetched twice, got %d", store.gets)
+	}
+	keys, _ := warehouse.DayKeys(ctx, local, defaultConfig.WarehousePrefix, "2025-01-15")
+	if len(keys) != 1 {
+		t.Fatalf("expected 1 output file, got %v", keys)
+	}
+	rows, err := warehouse.ReadMetricRows(ctx, local, keys[0])
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if len(rows) != 1 || rows[0].RequestCount != 3 || rows[0].ErrorCount != 1 {
+		t.Errorf("expected all 3 facts aggregated, got %+v", rows)
+	}
+
+	// A body that keeps failing is never aggregated from a truncated prefix
+	store = &flakyBodyStore{ObjectStore: local, failures: maxReadAttempts}
+	if err := processDay(ctx, day, store, defaultConfig); err == nil {
+		t.Error("expected an error when every read of the only object fails")
+	}
+	if after, _ := warehouse.DayKeys(ctx, local, defaultConfig.WarehousePrefix, "2025-01-15"); len(after) != 1 || after[0] != keys[0] {
+		t.Errorf("expected output %v to be kept, got %v", keys, after)
+	}
+}
+
+func TestProcessDay_PercentileStrategy(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	var facts []*gravixv1.RequestFact
+	for i := int32(1); i <= 1000; i++ {
+		facts = append(facts, makeFact(t, "api-service", "GET", "/users", 200, i, day.Add(10*time.Hour)))
+	}
+	writeFacts(t, store, "raw/request_facts/2025-01-15/10/batch_a.jsonl", facts)
+
+	cfg := defaultConfig
+	cfg.PercentileStrategy = "tdigest"
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	keys, _ := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-15")
+	if len(keys) != 1 {
+		t.Fatalf("expected 1 output file, got %v", keys)
+	}
+	rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if len(rows) != 1 || rows[0].RequestCount != 1000 {
+		t.Fatalf("expected 1 row of 1000 requests, got %+v", rows)
+	}
+	if p99 := rows[0].P99LatencyMs; p99 == nil || *p99 < 985 || *p99 > 995 {
+		t.Errorf("expected tdigest p99 near 990, got %v", p99)
+	}
+}
+
+// factLines marshals facts as JSONL, as they would be piped to -stdin.
+func factLines(t *testing.T, facts ...*gravixv1.RequestFact) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, fact := range facts {
+		data, err := protojson.Marshal(fact)
+		if err != nil {
+			t.Fatalf("failed to marshal fact: %v", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return &buf
+}
+
+func TestProcessReader_InfersDayAndWritesToOut(t *testing.T) {
+	eventTime := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	in := factLines(t,
+		makeFact(t, "api-service", "GET", "/users", 200, 10, eventTime),
+		makeFact(t, "api-service", "GET", "/users", 500, 30, eventTime.Add(5*time.Second)),
+		// Another day: dropped, as in the store-backed rollup
+		makeFact(t, "api-service", "GET", "/users", 200, 20, eventTime.AddDate(0, 0, 1)),
+	)
+	in.WriteString("not json\n")
+
+	var out bytes.Buffer
+	cfg := defaultConfig
+	cfg.Output = &out
+	if err := processReader(context.Background(), in, time.Time{}, nil, cfg); err != nil {
+		t.Fatalf("processReader failed: %v", err)
+	}
+	rows, err := parquet.Read[warehouse.MetricRow](bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if len(rows) != 1 || rows[0].EventDay != "2025-01-15" || rows[0].RequestCount != 2 || rows[0].ErrorCount != 1 {
+		t.Errorf("expected 1 row of 2 requests on 2025-01-15, got %+v", rows)
+	}
+}
+
+func TestProcessReader_WritesToStore(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)
+	// The first fact is from the day before; an explicit day wins over inference
+	in := factLines(t,
+		makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(-time.Hour)),
+		makeFact(t, "api-service", "GET", "/users", 200, 20, day.Add(time.Hour)),
+	)
+
+	cfg := defaultConfig
+	cfg.GroupBy = []string{"service", "source"}
+	if err := processReader(ctx, in, day, store, cfg); err != nil {
+		t.Fatalf("processReader failed: %v", err)
+	}
+	keys, err := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-16")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected 1 output file, got %v (err %v)", keys, err)
+	}
+	rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if len(rows) != 1 || rows[0].RequestCount != 1 || rows[0].Source != stdinSource {
+		t.Errorf("expected 1 row of 1 request from %q, got %+v", stdinSource, rows)
+	}
+}
+
+func TestProcessReader_NoFactsKeepsExistingOutput(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	writeFact(t, store, "raw/request_facts/2025-01-15/10/batch_a.jsonl", makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour)))
+	if err := processDay(ctx, day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+
+	if err := processReader(ctx, strings.NewReader(""), time.Time{}, store, defaultConfig); err == nil {
+		t.Error("expected an error for input without facts")
+	}
+	other := factLines(t, makeFact(t, "api-service", "GET", "/users", 200, 10, day.AddDate(0, 0, 1)))
+	if err := processReader(ctx, other, day, store, defaultConfig); err == nil {
+		t.Error("expected an error for input without facts for the day")
+	}
+	if keys, _ := warehouse.DayKeys(ctx, store, defaultConfig.WarehousePrefix, "2025-01-15"); len(keys) != 1 {
+		t.Errorf("expected existing output to be kept, got %v", keys)
+	}
+}
+
+func TestProcessDay_OutputWriterLeavesStoreAlone(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	writeFact(t, store, "raw/request_facts/2025-01-15/10/batch_a.jsonl", makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour)))
+	if err := processDay(ctx, day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	before, _ := warehouse.DayKeys(ctx, store, defaultConfig.WarehousePrefix, "2025-01-15")
+
+	var out bytes.Buffer
+	cfg := defaultConfig
+	cfg.Output = &out
+	cfg.OutputFormat = "jsonl"
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	var row MetricRow
+	if err := json.Unmarshal(out.Bytes(), &row); err != nil || row.RequestCount != 1 {
+		t.Errorf("expected 1 JSONL row of 1 request, got %q (err %v)", out.String(), err)
+	}
+
+	// An empty day writes an empty result rather than clearing anything
+	out.Reset()
+	if err := processDay(ctx, day.AddDate(0, 0, 1), store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no rows for an empty day, got %q", out.String())
+	}
+	after, _ := warehouse.DayKeys(ctx, store, defaultConfig.WarehousePrefix, "2025-01-15")
+	if !slices.Equal(before, after) {
+		t.Errorf("expected store output to be untouched, had %v, now %v", before, after)
+	}
+}
+
+func TestProcessDay_MinSamples(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	busy := day.Add(10 * time.Hour)
+	quiet := day.Add(11 * time.Hour)
+	writeFacts(t, store, "raw/request_facts/2025-01-15/10/batch_a.jsonl", []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 200, 0, busy),
+		makeFact(t, "api-service", "GET", "/users", 200, 0, busy),
+		makeFact(t, "api-service", "GET", "/users", 200, 0, busy),
+		makeFact(t, "api-service", "GET", "/users", 500, 40, quiet),
+		makeFact(t, "api-service", "GET", "/users", 200, 10, quiet),
+	})
+
+	cfg := defaultConfig
+	cfg.MinSamples = 3
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	keys, err := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-15")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected 1 output file, got %v (err %v)", keys, err)
+	}
+	rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %+v", rows)
+	}
+
+	// At the threshold: computed, and a genuine 0 ms survives as 0 rather than NULL
+	if p := rows[0].P50LatencyMs; p == nil || *p != 0 {
+		t.Errorf("expected p50 of 0 for the busy bucket, got %v", p)
+	}
+	// Below it: counts are kept, percentiles are NULL
+	low := rows[1]
+	if low.RequestCount != 2 || low.ErrorCount != 1 || low.ErrorRate != 0.5 {
+		t.Errorf("expected counts for the quiet bucket, got %+v", low)
+	}
+	if low.P50LatencyMs != nil || low.P95LatencyMs != nil || low.P99LatencyMs != nil {
+		t.Errorf("expected NULL percentiles below -min-samples, got %v %v %v", low.P50LatencyMs, low.P95LatencyMs, low.P99LatencyMs)
+	}
+}
+
+func TestProcessDay_Apdex(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	bucket := day.Add(10 * time.Hour)
+
+	// Threshold 100ms: 2 satisfied (<=100), 2 tolerating (<=400), 2 frustrated
+	var facts []*gravixv1.RequestFact
+	for _, latency := range []int32{50, 100, 150, 400, 401, 5000} {
+		facts = append(facts, makeFact(t, "api-service", "GET", "/users", 200, latency, bucket))
+	}
+	writeFacts(t, store, "raw/request_facts/2025-01-15/10/batch_a.jsonl", facts)
+
+	cfg := defaultConfig
+	cfg.ApdexThresholdMs = 100
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	keys, err := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-15")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected 1 output file, got %v (err %v)", keys, err)
+	}
+	rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %+v", rows)
+	}
+	// (2 + 2/2) / 6
+	if a := rows[0].Apdex; a == nil || *a != 0.5 {
+		t.Errorf("expected apdex 0.5, got %v", a)
+	}
+}
+
+func TestProcessDay_StatusClassCounts(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	bucket := day.Add(10 * time.Hour)
+	var facts []*gravixv1.RequestFact
+	for _, status := range []int32{200, 201, 204, 301, 304, 400, 404, 429, 500, 503} {
+		facts = append(facts, makeFact(t, "api-service", "GET", "/users", status, 10, bucket))
+	}
+	writeFacts(t, store, "raw/request_facts/2025-01-15/10/batch_a.jsonl", facts)
+
+	cfg := defaultConfig
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	keys, err := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-15")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected 1 output file, got %v (err %v)", keys, err)
+	}
+	rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %+v", rows)
+	}
+
+	row := rows[0]
+	if row.Count2xx != 3 || row.Count3xx != 2 || row.Count4xx != 3 || row.Count5xx != 2 {
+		t.Errorf("expected 3/2/3/2 by class, got %d/%d/%d/%d", row.Count2xx, row.Count3xx, row.Count4xx, row.Count5xx)
+	}
+	if sum := row.Count2xx + row.Count3xx + row.Count4xx + row.Count5xx; sum != row.RequestCount {
+		t.Errorf("expected class counts to sum to request_count %d, got %d", row.RequestCount, sum)
+	}
+	// Unchanged: only 5xx are errors
+	if row.ErrorCount != 2 || row.ErrorRate != 0.2 {
+		t.Errorf("expected 2 errors at rate 0.2, got %d at %v", row.ErrorCount, row.ErrorRate)
+	}
+}
+
+func TestProcessDay_Bucket(t *testing.T) {
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	facts := []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour+30*time.Second)),
+		makeFact(t, "api-service", "GET", "/users", 500, 10, day.Add(10*time.Hour+4*time.Minute+59*time.Second)),
+		makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour+5*time.Minute)),
+		makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour+59*time.Minute)),
+		makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(11*time.Hour)),
+	}
+
+	tests := []struct {
+		bucket   time.Duration
+		name     string
+		wantRows map[string]int64 // bucket_start -> request_count
+	}{
+		{5 * time.Minute, "metrics_5m_", map[string]int64{
+			"2025-01-15 10:00:00": 2,
+			"2025-01-15 10:05:00": 1,
+			"2025-01-15 10:55:00": 1,
+			"2025-01-15 11:00:00": 1,
+		}},
+		{time.Hour, "metrics_1h_", map[string]int64{
+			"2025-01-15 10:00:00": 4,
+			"2025-01-15 11:00:00": 1,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.bucket.String(), func(t *testing.T) {
+			store, err := storage.NewLocalStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("failed to create store: %v", err)
+			}
+			ctx := context.Background()
+			writeFacts(t, store, "raw/request_facts/2025-01-15/10/batch_a.jsonl", facts)
+
+			cfg := defaultConfig
+			cfg.Bucket = tt.bucket
+			if err := processDay(ctx, day, store, cfg); err != nil {
+				t.Fatalf("processDay failed: %v", err)
+			}
+			keys, err := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-15")
+			if err != nil || len(keys) != 1 {
+				t.Fatalf("expected 1 output file, got %v (err %v)", keys, err)
+			}
+			if !strings.HasPrefix(path.Base(keys[0]), tt.name) {
+				t.Errorf("expected the output key to start with %s, got %s", tt.name, keys[0])
+			}
+			rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			got := make(map[string]int64)
+			for _, row := range rows {
+				got[row.BucketStart] = row.RequestCount
+				if row.BucketSize() != tt.bucket {
+					t.Errorf("expected bucket size %v, got %v", tt.bucket, row.BucketSize())
+				}
+			}
+			if !reflect.DeepEqual(got, tt.wantRows) {
+				t.Errorf("expected request counts %v, got %v", tt.wantRows, got)
+			}
+		})
+	}
+}
+
+func TestParseBucket(t *testing.T) {
+	for _, s := range []string{"1m", "5m", "15m", "90m", "1h", "24h"} {
+		if _, err := parseBucket(s); err != nil {
+			t.Errorf("expected %s to be valid: %v", s, err)
+		}
+	}
+	// Sub-minute, not whole minutes, not dividing a day, nonsense
+	for _, s := range []string{"30s", "90s", "7m", "5h", "48h", "0", "-5m", "five"} {
+		if _, err := parseBucket(s); err == nil {
+			t.Errorf("expected an error for %s", s)
+		}
+	}
+}
+
+func TestProcessDay_Percentiles(t *testing.T) {
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	bucket := day.Add(10 * time.Hour)
+	// Latencies 1..1000ms, so the p-th percentile is close to 10*p
+	var facts []*gravixv1.RequestFact
+	for ms := int32(1); ms <= 1000; ms++ {
+		facts = append(facts, makeFact(t, "api-service", "GET", "/users", 200, ms, bucket))
+	}
+
+	for _, strategy := range []string{"exact", "tdigest", "hdr"} {
+		t.Run(strategy, func(t *testing.T) {
+			store, err := storage.NewLocalStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("failed to create store: %v", err)
+			}
+			ctx := context.Background()
+			writeFacts(t, store, "raw/request_facts/2025-01-15/10/batch_a.jsonl", facts)
+
+			cfg := defaultConfig
+			cfg.PercentileStrategy = strategy
+			cfg.Percentiles = []float64{50, 90, 99, 99.9}
+			if err := processDay(ctx, day, store, cfg); err != nil {
+				t.Fatalf("processDay failed: %v", err)
+			}
+			keys, err := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-15")
+			if err != nil || len(keys) != 1 {
+				t.Fatalf("expected 1 output file, got %v (err %v)", keys, err)
+			}
+			rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			if len(rows) != 1 {
+				t.Fatalf("expected 1 row, got %+v", rows)
+			}
+
+			row := rows[0]
+			for _, c := range []struct {
+				name string
+				got  *float64
+				want float64
+			}{
+				{"p50", row.P50LatencyMs, 500},
+				{"p90", row.P90LatencyMs, 900},
+				{"p99", row.P99LatencyMs, 990},
+				{"p99.9", row.P999LatencyMs, 999},
+			} {
+				if c.got == nil || math.Abs(*c.got-c.want) > 5 {
+					t.Errorf("%s: expected %v±5ms, got %v", c.name, c.want, c.got)
+				}
+			}
+			// Not selected, so NULL
+			if row.P95LatencyMs != nil {
+				t.Errorf("expected NULL p95, got %v", *row.P95LatencyMs)
+			}
+		})
+	}
+}
+
+func TestRollupConfig_DefaultApdexThreshold(t *testing.T) {
+	if got := defaultConfig.apdexThresholdMs(); got != 500 {
+		t.Errorf("expected the default threshold of 500ms, got %d", got)
+	}
+}
+
+func TestProcessDay_ExcludePaths(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)
+	bucket := day.Add(10 * time.Hour)
+	writeFacts(t, store, "raw/request_facts/2025-01-16/10/batch_a.jsonl", []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 200, 10, bucket),
+		makeFact(t, "api-service", "GET", "/live", 200, 1, bucket),
+		makeFact(t, "api-service", "GET", "/ready", 503, 1, bucket),
+		makeFact(t, "api-service", "GET", "/internal/gc", 200, 1, bucket),
+	})
+
+	cfg := defaultConfig
+	cfg.ExcludePaths = []string{"/live", "/ready"}
+	cfg.ExcludePathPattern = regexp.MustCompile(`^/internal/`)
+	excluded := rollupExcludedEventsTotal.WithLabelValues("2025-01-16")
+	before := testCounter(t, excluded)
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+
+	keys, err := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-16")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected 1 output file, got %v (err %v)", keys, err)
+	}
+	rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if len(rows) != 1 || rows[0].PathTemplate != "/users" || rows[0].ErrorCount != 0 {
+		t.Errorf("expected only the /users row, got %+v", rows)
+	}
+	if got := testCounter(t, excluded) - before; got != 3 {
+		t.Errorf("expected 3 excluded facts, got %v", got)
+	}
+}
+
+func TestProcessDay_EmitTotals(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)
+	bucket := day.Add(10 * time.Hour)
+	writeFacts(t, store, "raw/request_facts/2025-01-19/10/batch_a.jsonl", []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 200, 10, bucket),
+		makeFact(t, "api-service", "POST", "/users", 500, 20, bucket),
+		makeFact(t, "web-service", "GET", "/", 200, 30, bucket.Add(time.Second)),
+		makeFact(t, "web-service", "GET", "/", 503, 40, bucket.Add(time.Minute)),
+	})
+
+	cfg := defaultConfig
+	cfg.EmitTotals = true
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	keys, err := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-19")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected 1 output file, got %v (err %v)", keys, err)
+	}
+	rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+
+	type sums struct{ requests, errors int64 }
+	parts, totals := map[string]sums{}, map[string]MetricRow{}
+	for _, row := range rows {
+		if row.Service == totalService {
+			totals[row.BucketStart] = row
+			continue
+		}
+		s := parts[row.BucketStart]
+		parts[row.BucketStart] = sums{s.requests + row.RequestCount, s.errors + row.ErrorCount}
+	}
+	if len(totals) != 2 || len(parts) != 2 {
+		t.Fatalf("expected a total row for each of 2 minutes, got %+v", rows)
+	}
+	for minute, want := range parts {
+		got := totals[minute]
+		if got.RequestCount != want.requests || got.ErrorCount != want.errors {
+			t.Errorf("%s: expected totals %+v, got requests=%d errors=%d", minute, want, got.RequestCount, got.ErrorCount)
+		}
+		if got.Method != "" || got.PathTemplate != "" {
+			t.Errorf("%s: expected empty dimensions on the total row, got %+v", minute, got)
+		}
+	}
+	first := totals["2025-01-19 10:00:00"]
+	if first.P99LatencyMs == nil || *first.P99LatencyMs <= 20 || first.ErrorRate != 1.0/3 {
+		t.Errorf("expected percentiles and error rate over all 3 facts of the minute, got %+v", first)
+	}
+}
+
+func TestProcessDay_CountsDecodeAndValidationErrors(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 18, 0, 0, 0, 0, time.UTC)
+	valid, err := protojson.Marshal(makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour)))
+	if err != nil {
+		t.Fatalf("failed to marshal fact: %v", err)
+	}
+	invalid, err := protojson.Marshal(makeFact(t, "api-service", "GET", "/users", 700, 10, day.Add(10*time.Hour)))
+	if err != nil {
+		t.Fatalf("failed to marshal fact: %v", err)
+	}
+	lines := [][]byte{valid, invalid, valid[:len(valid)/2], []byte("not json")}
+	if err := store.Put(ctx, "raw/request_facts/2025-01-18/10/batch_a.jsonl", bytes.NewReader(bytes.Join(lines, []byte("\n")))); err != nil {
+		t.Fatalf("failed to put facts: %v", err)
+	}
+
+	decode := rollupDecodeErrorsTotal.WithLabelValues("2025-01-18")
+	validation := rollupValidationErrorsTotal.WithLabelValues("2025-01-18")
+	decodeBefore, validationBefore := testCounter(t, decode), testCounter(t, validation)
+	if err := processDay(ctx, day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if got := testCounter(t, decode) - decodeBefore; got != 2 {
+		t.Errorf("expected 2 decode errors, got %v", got)
+	}
+	if got := testCounter(t, validation) - validationBefore; got != 1 {
+		t.Errorf("expected 1 validation error, got %v", got)
+	}
+}
+
+func TestProcessDay_NoCleanupLeavesEarlierOutputs(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	writeFacts(t, store, "raw/request_facts/2025-01-15/10/batch_a.jsonl", []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour)),
+	})
+	if err := processDay(ctx, day, store, defaultConfig); err != nil {
+		t.Fatalf("production processDay failed: %v", err)
+	}
+	production, _ := warehouse.DayKeys(ctx, store, defaultConfig.WarehousePrefix, "2025-01-15")
+
+	sandbox := defaultConfig
+	sandbox.WarehousePrefix = "scratch/request_metrics_minute"
+	sandbox.NoCleanup = true
+	for range 2 {
+		if err := processDay(ctx, day, store, sandbox); err != nil {
+			t.Fatalf("sandbox processDay failed: %v", err)
+		}
+	}
+	// An empty day writes nothing and clears nothing
+	if err := processDay(ctx, day.AddDate(0, 0, 1), store, sandbox); err != nil {
+		t.Fatalf("sandbox processDay for an empty day failed: %v", err)
+	}
+
+	keys, _ := warehouse.DayKeys(ctx, store, defaultConfig.WarehousePrefix, "2025-01-15")
+	if !reflect.DeepEqual(keys, production) {
+		t.Errorf("expected production output %v untouched, got %v", production, keys)
+	}
+	keys, _ = warehouse.DayKeys(ctx, store, sandbox.WarehousePrefix, "2025-01-15")
+	if len(keys) != 2 {
+		t.Errorf("expected both sandbox runs to be kept, got %v", keys)
+	}
+}
+
+func TestProcessDay_StrictDedupCountsConflicts(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC)
+	bucket := day.Add(10 * time.Hour)
+	first := makeFact(t, "api-service", "GET", "/users", 200, 10, bucket)
+	retried := proto.Clone(first).(*gravixv1.RequestFact)
+	retried.SkewMs = 1500 // only set by ingestion, so not a conflict
+	reused := makeFact(t, "api-service", "POST", "/orders", 500, 80, bucket)
+	reused.EventId = first.EventId
+	writeFacts(t, store, "raw/request_facts/2025-01-17/10/batch_a.jsonl", []*gravixv1.RequestFact{first, retried, reused})
+
+	conflicts := rollupConflictingEventIDsTotal.WithLabelValues("2025-01-17")
+	for _, strict := range []bool{false, true} {
+		cfg := defaultConfig
+		cfg.StrictDedup = strict
+		before := testCounter(t, conflicts)
+		if err := processDay(ctx, day, store, cfg); err != nil {
+			t.Fatalf("processDay failed: %v", err)
+		}
+		want := 0.0
+		if strict {
+			want = 1
+		}
+		if got := testCounter(t, conflicts) - before; got != want {
+			t.Errorf("strict=%v: expected %v conflicts, got %v", strict, want, got)
+		}
+
+		// Either way only the first fact is aggregated
+		keys, _ := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-17")
+		rows, err := warehouse.ReadMetricRows(ctx, store, keys[0])
+		if err != nil {
+			t.Fatalf("failed to read output: %v", err)
+		}
+		if len(rows) != 1 || rows[0].Method != "GET" || rows[0].RequestCount != 1 {
+			t.Errorf("strict=%v: expected only the first fact, got %+v", strict, rows)
+		}
+	}
+}
+
+func TestProcessDay_WriteIndex(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 18, 0, 0, 0, 0, time.UTC)
+	bucket := day.Add(10 * time.Hour)
+	writeFacts(t, store, "raw/request_facts/2025-01-18/10/batch_a.jsonl", []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 200, 10, bucket),
+		makeFact(t, "api-service", "POST", "/users", 201, 20, bucket),
+		makeFact(t, "api-service", "GET", "/orders", 200, 30, bucket),
+	})
+	cfg := defaultConfig
+	cfg.WriteIndex = true
+	entry := func() warehouse.IndexEntry {
+		t.Helper()
+		if err := processDay(ctx, day, store, cfg); err != nil {
+			t.Fatalf("processDay failed: %v", err)
+		}
+		idx, err := warehouse.ReadIndex(ctx, store, cfg.WarehousePrefix)
+		if err != nil {
+			t.Fatalf("ReadIndex failed: %v", err)
+		}
+		return idx["2025-01-18"]
+	}
+
+	first := entry()
+	keys, _ := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-18")
+	if len(keys) != 1 || first.Key != keys[0] || first.RowCount != 3 {
+		t.Fatalf("expected the index to point at %v with 3 rows, got %+v", keys, first)
+	}
+
+	// Reprocessing the same facts rewrites the file but not its content
+	same := entry()
+	if same.Key == first.Key || same.SHA256 != first.SHA256 {
+		t.Errorf("expected a new key with the same sha256, got %+v after %+v", same, first)
+	}
+
+	writeFacts(t, store, "raw/request_facts/2025-01-18/11/batch_b.jsonl", []*gravixv1.RequestFact{
+		makeFact(t, "api-service", "GET", "/users", 500, 40, bucket.Add(time.Hour)),
+	})
+	changed := entry()
+	if changed.SHA256 == same.SHA256 || changed.RowCount != 4 {
+		t.Errorf("expected a new sha256 and 4 rows after new facts, got %+v", changed)
+	}
+
+	// The index itself is never taken for a day's output
+	if keys, _ := warehouse.DayKeys(ctx, store, cfg.WarehousePrefix, "2025-01-18"); len(keys) != 1 {
+		t.Errorf("expected one output file next to the index, got %v", keys)
+	}
+}
+
+func TestProcessDay_MaxPartRows(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)
+	var facts []*gravixv1.RequestFact
+	for i := range 7 {
+		facts = append(facts, makeFact(t, "api-service", "GET", "/users", 200, int32(10+i), day.Add(10*time.Hour+time.Duration(i)*time.Minute)))
+	}
+	writeFacts(t, store, "raw/request_facts/2025-01-19/10/batch_a.jsonl", facts)
+
+	readDay := func(maxRows int) (keys []string, rows []MetricRow) {
+		t.Helper()
+		keys, err := warehouse.DayKeys(ctx, store, defaultConfig.WarehousePrefix, "2025-01-19")
+		if err != nil {
+			t.Fatalf("DayKeys failed: %v", err)
+		}
+		for _, key := range keys {
+			part, err := warehouse.ReadMetricRows(ctx, store, key)
+			if err != nil {
+				t.Fatalf("ReadMetricRows(%s) failed: %v", key, err)
+			}
+			if len(part) > maxRows {
+				t.Errorf("expected at most %d rows in %s, got %d", maxRows, key, len(part))
+			}
+			rows = append(rows, part...)
+		}
+		return keys, rows
+	}
+
+	// A single-file output is replaced by the parts
+	if err := processDay(ctx, day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	cfg := defaultConfig
+	cfg.MaxPartRows = 3
+	cfg.VerifyOutput = true
+	cfg.WriteIndex = true
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	keys, split := readDay(3)
+	if len(keys) != 3 || !strings.HasSuffix(keys[0], "_2025-01-19.part00.parquet") || !strings.HasSuffix(keys[2], "_2025-01-19.part02.parquet") {
+		t.Fatalf("expected 3 part files, got %v", keys)
+	}
+	idx, err := warehouse.ReadIndex(ctx, store, cfg.WarehousePrefix)
+	if err != nil {
+		t.Fatalf("ReadIndex failed: %v", err)
+	}
+	if entry := idx["2025-01-19"]; entry.Key != keys[0] || !slices.Equal(entry.Parts, keys) || entry.RowCount != 7 {
+		t.Errorf("expected the index to list all 3 parts and 7 rows, got %+v", entry)
+	}
+
+	// The parts hold the same rows, in the same order, as a single file
+	if err := processDay(ctx, day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	keys, whole := readDay(7)
+	if len(keys) != 1 {
+		t.Fatalf("expected the parts replaced by one file, got %v", keys)
+	}
+	if len(whole) != 7 || !reflect.DeepEqual(split, whole) {
+		t.Errorf("expected the 3 parts to read back as the full 7 rows, got %+v and %+v", split, whole)
+	}
+}
+
+// lateListStore hides raw objects from the first emptyLists raw List calls,
+// like an eventually consistent listing.
+type lateListStore struct {
+	storage.ObjectStore
+	emptyLists int
+}
+
+func (s *lateListStore) List(ctx context.Context, prefix string) ([]string, error) {
+	if s.emptyLists > 0 && strings.HasPrefix(prefix, "raw/") {
+		s.emptyLists--
+		return nil, nil
+	}
+	return s.ObjectStore.List(ctx, prefix)
+}
+
+func TestProcessDay_RecheckEmptyDay(t *testing.T) {
+	local, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	writeFact(t, local, "raw/request_facts/2025-01-15/10/batch_a.jsonl", makeFact(t, "api-service", "GET", "/users", 200, 10, day.Add(10*time.Hour)))
+	if err := processDay(ctx, day, local, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	good, _ := warehouse.DayKeys(ctx, local, defaultConfig.WarehousePrefix, "2025-01-15")
+
+	cfg := defaultConfig
+	cfg.RecheckEmptyAfter = time.Millisecond
+	// The first listing of all three day prefixes comes back empty
+	store := &lateListStore{ObjectStore: local, emptyLists: 3}
+	before := testCounter(t, rollupEmptyRechecksFailedTotal)
+	if err := processDay(ctx, day, store, cfg); err == nil || !strings.Contains(err.Error(), "looked empty") {
+		t.Errorf("expected the recheck to fail the day, got %v", err)
+	}
+	if got := testCounter(t, rollupEmptyRechecksFailedTotal) - before; got != 1 {
+		t.Errorf("expected 1 failed recheck, got %v", got)
+	}
+	if after, _ := warehouse.DayKeys(ctx, local, cfg.WarehousePrefix, "2025-01-15"); !reflect.DeepEqual(after, good) {
+		t.Errorf("expected output %v to be kept, got %v", good, after)
+	}
+
+	// A day that is still empty on the second listing is cleared as before
+	if err := local.Delete(ctx, "raw/request_facts/2025-01-15/10/batch_a.jsonl"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := processDay(ctx, day, local, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if after, _ := warehouse.DayKeys(ctx, local, cfg.WarehousePrefix, "2025-01-15"); len(after) != 0 {
+		t.Errorf("expected the empty day to be cleared, got %v", after)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+)
+
+// notification is one queued message announcing new raw objects.
+type notification struct {
+	Body          string
+	ReceiptHandle string
+}
+
+// notificationQueue is the subset of SQS the event-driven mode needs.
+type notificationQueue interface {
+	Receive(ctx context.Context) ([]notification, error)
+	Delete(ctx context.Context, receiptHandle string) error
+}
+
+// s3EventMessage is an S3 event notification, optionally wrapped in an SNS envelope.
+type s3EventMessage struct {
+	Type    string `json:"Type"`    // "Notification" when delivered via SNS
+	Message string `json:"Message"` // SNS payload: the S3 event as a JSON string
+	Event   string `json:"Event"`   // "s3:TestEvent" when the notification is first configured
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// affectedDays returns the distinct raw days touched by the object-created events in body.
+// Keys outside every rawPrefix, or without a YYYY-MM-DD partition right after it, are ignored.
+func affectedDays(body string, rawPrefixes ...string) ([]string, error) {
+	var msg s3EventMessage
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		return nil, fmt.Errorf("invalid notification: %w", err)
+	}
+	if msg.Type == "Notification" && msg.Message != "" {
+		return affectedDays(msg.Message, rawPrefixes...)
+	}
+
+	seen := make(map[string]struct{})
+	var days []string
+	for _, rec := range msg.Records {
+		if !strings.HasPrefix(rec.EventName, "ObjectCreated:") {
+			continue
+		}
+		// S3 URL-encodes object keys in event notifications
+		key, err := url.QueryUnescape(rec.S3.Object.Key)
+		if err != nil {
+			continue
+		}
+		for _, day := range daysUnderPrefix(key, rawPrefixes) {
+			if _, ok := seen[day]; !ok {
+				seen[day] = struct{}{}
+				days = append(days, day)
+			}
+		}
+	}
+	return days, nil
+}
+
+// daysUnderPrefix returns the days whose rollup reads key: the YYYY-MM-DD
+// partition that follows whichever of rawPrefixes key falls under, plus the
+// adjacent day when key is in a boundary hour (see dayInputPrefixes).
+func daysUnderPrefix(key string, rawPrefixes []string) []string {
+	for _, rawPrefix := range rawPrefixes {
+		prefix := strings.TrimSuffix(rawPrefix, "/") + "/"
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		dayStr, rest, _ := strings.Cut(strings.TrimPrefix(key, prefix), "/")
+		day, err := time.Parse("2006-01-02", dayStr)
+		if err != nil {
+			continue
+		}
+		days := []string{dayStr}
+		switch hour, _, _ := strings.Cut(rest, "/"); hour {
+		case "00":
+			days = append(days, day.AddDate(0, 0, -1).Format("2006-01-02"))
+		case "23":
+			days = append(days, day.AddDate(0, 0, 1).Format("2006-01-02"))
+		}
+		return days
+	}
+	return nil
+}
+
+// pollNotifications reprocesses the days named by each batch of queued
+// notifications until ctx is cancelled. Messages are only deleted once every
+// day they mention has been rolled up, so a failed day is retried when the
+// messages become visible again.
+func pollNotifications(ctx context.Context, queue notificationQueue, store storage.ObjectStore, cfg rollupConfig) {
+	for ctx.Err() == nil {
+		msgs, err := queue.Receive(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to receive notifications: %v", err)
+				time.Sleep(5 * time.Second)
+			}
+			continue
+		}
+		handleNotifications(ctx, queue, store, cfg, msgs)
+	}
+}
+
+// handleNotifications rolls up every day referenced by msgs once, then deletes
+// the messages whose days all succeeded.
+func handleNotifications(ctx context.Context, queue notificationQueue, store storage.ObjectStore, cfg rollupConfig, msgs []notification) {
+	msgDays := make([][]string, len(msgs))
+	pending := make(map[string]struct{})
+	for i, msg := range msgs {
+		days, err := affectedDays(msg.Body, cfg.RawPrefixes...)
+		if err != nil {
+			// Unparseable messages will never succeed; drop them rather than redeliver forever
+			log.Printf("Discarding notification: %v", err)
+		}
+		msgDays[i] = days
+		for _, d := range days {
+			pending[d] = struct{}{}
+		}
+	}
+
+	days := make([]string, 0, len(pending))
+	for d := range pending {
+		days = append(days, d)
+	}
+	sort.Strings(days)
+
+	failed := make(map[string]bool)
+	for _, dayStr := range days {
+		day, _ := time.Parse("2006-01-02", dayStr)
+		if err := processDay(ctx, day, store, cfg); err != nil {
+			log.Printf("Failed to process day %s from notification: %v", dayStr, err)
+			failed[dayStr] = true
+		}
+	}
+
+	for i, msg := range msgs {
+		ok := true
+		for _, d := range msgDays[i] {
+			if failed[d] {
+				ok = false
+			}
+		}
+		if !ok {
+			continue
+		}
+		if err := queue.Delete(ctx, msg.ReceiptHandle); err != nil {
+			log.Printf("Failed to delete notification: %v", err)
+		}
+	}
+}
+
+// sqsQueue reads S3 event notifications from an SQS queue with long polling.
+type sqsQueue struct {
+	client   *sqs.Client
+	queueURL string
+}
+
+// newSQSQueue builds an SQS client from the same S3_REGION/S3_ACCESS_KEY/S3_SECRET_KEY
+// settings as the store. SQS_ENDPOINT overrides the endpoint (e.g. for ElasticMQ).
+func newSQSQueue(ctx context.Context, queueURL string) (*sqsQueue, error) {
+	opts := []func(*config.LoadOptions) error{config.WithRegion(os.Getenv("S3_REGION"))}
+	if os.Getenv("S3_ACCESS_KEY") != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"), "")))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SDK config: %w", err)
+	}
+	client := sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+		if endpoint := os.Getenv("SQS_ENDPOINT"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	return &sqsQueue{client: client, queueURL: queueURL}, nil
+}
+
+func (q *sqsQueue) Receive(ctx context.Context) ([]notification, error) {
+	out, err := q.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(q.queueURL),
+		MaxNumberOfMessages: 10,
+		WaitTimeSeconds:     20,
+	})
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]notification, 0, len(out.Messages))
+	for _, m := range out.Messages {
+		msgs = append(msgs, notification{Body: aws.ToString(m.Body), ReceiptHandle: aws.ToString(m.ReceiptHandle)})
+	}
+	return msgs, nil
+}
+
+func (q *sqsQueue) Delete(ctx context.Context, receiptHandle string) error {
+	_, err := q.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.queueURL),
+		ReceiptHandle: aws.String(receiptHandle),
+	})
+	return err
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lgreene/gravix-dashboards/pkg/storage"
+)
+
+func s3Event(eventName string, keys ...string) string {
+	records := make([]string, len(keys))
+	for i, k := range keys {
+		records[i] = fmt.Sprintf(`{"eventName":%q,"s3":{"bucket":{"name":"gravix"},"object":{"key":%q}}}`, eventName, k)
+	}
+	return `{"Records":[` + strings.Join(records, ",") + `]}`
+}
+
+func TestAffectedDays(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "Single object",
+			body: s3Event("ObjectCreated:Put", "raw/request_facts/2025-01-15/10/batch_a.jsonl"),
+			want: []string{"2025-01-15"},
+		},
+		{
+			name: "Deduplicated across records",
+			body: s3Event("ObjectCreated:Put",
+				"raw/request_facts/2025-01-15/10/batch_a.jsonl",
+				"raw/request_facts/2025-01-15/11/batch_b.jsonl",
+				"raw/request_facts/2025-01-16/00/batch_c.jsonl"),
+			want: []string{"2025-01-15", "2025-01-16"},
+		},
+		{
+			name: "Hour 00 also re-rolls the previous day",
+			body: s3Event("ObjectCreated:Put", "raw/request_facts/2025-01-01/00/batch_a.jsonl"),
+			want: []string{"2025-01-01", "2024-12-31"},
+		},
+		{
+			name: "Hour 23 also re-rolls the next day",
+			body: s3Event("ObjectCreated:Put", "raw/request_facts/2025-01-15/23/batch_a.jsonl"),
+			want: []string{"2025-01-15", "2025-01-16"},
+		},
+		{
+			name: "URL-encoded key",
+			body: s3Event("ObjectCreated:CompleteMultipartUpload", "raw%2Frequest_facts%2F2025-01-15%2F10%2Fbatch+a.jsonl"),
+			want: []string{"2025-01-15"},
+		},
+		{
+			name: "Other prefix ignored",
+			body: s3Event("ObjectCreated:Put", "raw/service_events/2025-01-15/10/batch_a.jsonl"),
+			want: nil,
+		},
+		{
+			name: "Deletes ignored",
+			body: s3Event("ObjectRemoved:Delete", "raw/request_facts/2025-01-15/10/batch_a.jsonl"),
+			want: nil,
+		},
+		{
+			name: "S3 test event",
+			body: `{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"gravix"}`,
+			want: nil,
+		},
+		{
+			name: "SNS envelope",
+			body: fmt.Sprintf(`{"Type":"Notification","Message":%q}`, s3Event("ObjectCreated:Put", "raw/request_facts/2025-01-17/01/batch.jsonl")),
+			want: []string{"2025-01-17"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := affectedDays(tt.body, "raw/request_facts")
+			if err != nil {
+				t.Fatalf("affectedDays failed: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("affectedDays = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := affectedDays("not json", "raw/request_facts"); err == nil {
+		t.Error("expected error for malformed body")
+	}
+
+	// With several topics, a key under any of them counts
+	got, err := affectedDays(s3Event("ObjectCreated:Put", "raw/grpc_facts/2025-01-18/12/batch.jsonl"), "raw/request_facts", "raw/grpc_facts")
+	if err != nil || fmt.Sprint(got) != "[2025-01-18]" {
+		t.Errorf("expected [2025-01-18] from the second prefix, got %v (err %v)", got, err)
+	}
+}
+
+// fakeQueue records deleted receipt handles.
+type fakeQueue struct {
+	deleted []string
+}
+
+func (q *fakeQueue) Receive(ctx context.Context) ([]notification, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (q *fakeQueue) Delete(ctx context.Context, receiptHandle string) error {
+	q.deleted = append(q.deleted, receiptHandle)
+	return nil
+}
+
+// failListStore fails List for one prefix so processDay errors for that day.
+type failListStore struct {
+	storage.ObjectStore
+	failPrefix string
+}
+
+func (s *failListStore) List(ctx context.Context, prefix string) ([]string, error) {
+	if prefix == s.failPrefix {
+		return nil, errors.New("simulated list failure")
+	}
+	return s.ObjectStore.List(ctx, prefix)
+}
+
+func TestHandleNotifications_DeletesOnlySucceededMessages(t *testing.T) {
+	local, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	store := &failListStore{ObjectStore: local, failPrefix: "raw/request_facts/2025-01-16"}
+
+	eventTime := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	writeFact(t, store, "raw/request_facts/2025-01-15/10/batch_a.jsonl", makeFact(t, "api-service", "GET", "/users", 200, 10, eventTime))
+
+	queue := &fakeQueue{}
+	msgs := []notification{
+		{Body: s3Event("ObjectCreated:Put", "raw/request_facts/2025-01-15/10/batch_a.jsonl"), ReceiptHandle: "ok"},
+		{Body: s3Event("ObjectCreated:Put", "raw/request_facts/2025-01-16/10/batch_b.jsonl"), ReceiptHandle: "failed"},
+		{Body: "garbage", ReceiptHandle: "garbage"},
+	}
+	handleNotifications(context.Background(), queue, store, defaultConfig, msgs)
+
+	if fmt.Sprint(queue.deleted) != "[ok garbage]" {
+		t.Errorf("expected only the succeeded and unparseable messages to be deleted, got %v", queue.deleted)
+	}
+
+	keys, _ := local.List(context.Background(), defaultConfig.WarehousePrefix)
+	if len(keys) != 1 {
+		t.Errorf("expected the notified day to be rolled up, got %v", keys)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/lgreene/gravix-dashboards/pkg/warehouse"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+)
+
+// outputFormats lists the -output-format values. Only parquet is written to
+// the store; the others are for -output -.
+var outputFormats = []string{"parquet", "jsonl", "csv"}
+
+// parseOutputFormat validates an -output-format name.
+func parseOutputFormat(name string) (string, error) {
+	if !slices.Contains(outputFormats, name) {
+		return "", fmt.Errorf("unknown output format %q (want one of parquet,jsonl,csv)", name)
+	}
+	return name, nil
+}
+
+// latencyUnits lists the -latency-unit values. Rows are aggregated in
+// milliseconds; s scales the percentiles and renames their columns on output.
+var latencyUnits = []string{"ms", "s"}
+
+// parseLatencyUnit validates a -latency-unit name.
+func parseLatencyUnit(name string) (string, error) {
+	if !slices.Contains(latencyUnits, name) {
+		return "", fmt.Errorf("unknown latency unit %q (want ms or s)", name)
+	}
+	return name, nil
+}
+
+// secondsMetricRow is the row written for -latency-unit s.
+type secondsMetricRow = warehouse.SecondsMetricRow
+
+// msToSeconds scales a nullable millisecond value; NULL stays NULL.
+func msToSeconds(ms *float64) *float64 {
+	if ms == nil {
+		return nil
+	}
+	s := *ms / 1000
+	return &s
+}
+
+// writeRows encodes metrics to w in format, with latencies in unit (a
+// latencyUnits name). As in parquet, dimensions that are not grouped by are
+// left out of CSV output.
+func writeRows(w io.Writer, format string, metrics []MetricRow, groupBy []string, unit string) error {
+	switch {
+	case format == "csv":
+		return encodeCSV(w, metrics, groupBy, unit)
+	case unit == "s":
+		return encodeRows(w, format, warehouse.InSeconds(metrics), groupBy, unit)
+	default:
+		return encodeRows(w, format, metrics, groupBy, unit)
+	}
+}
+
+// encodeRows writes rows as parquet or jsonl.
+func encodeRows[T any](w io.Writer, format string, rows []T, groupBy []string, unit string) error {
+	if format == "jsonl" {
+		return encodeJSONL(w, rows)
+	}
+	return encodeParquet(w, rows, groupBy, unit)
+}
+
+// encodeParquet writes rows as zstd-compressed parquet. Only the grouped
+// dimensions become columns; the rest would be empty.
+func encodeParquet[T any](w io.Writer, rows []T, groupBy []string, unit string) error {
+	var row T
+	writer := parquet.NewGenericWriter[T](w, metricSchema(row, groupBy),
+		parquet.Compression(&zstd.Codec{Level: zstd.SpeedDefault}),
+		// Tells readers which layout to decode, see warehouse.DecodeMetricRows
+		parquet.KeyValueMetadata(warehouse.SchemaVersionKey, strconv.Itoa(warehouse.MetricSchemaVersion)),
+		parquet.KeyValueMetadata(warehouse.LatencyUnitKey, unit),
+	)
+	if _, err := writer.Write(rows); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// encodeJSONL writes one JSON object per row and line.
+func encodeJSONL[T any](w io.Writer, rows []T) error {
+	enc := json.NewEncoder(w)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("failed to encode metrics row: %w", err)
+		}
+	}
+	return nil
+}
+
+// encodeCSV writes a header of parquet column names followed by one record per row.
+func encodeCSV(w io.Writer, metrics []MetricRow, groupBy []string, unit string) error {
+	columns := []string{"bucket_start"}
+	for _, dim := range groupByDimensions {
+		if slices.Contains(groupBy, dim) {
+			columns = append(columns, dim)
+		}
+	}
+	columns = append(columns, "request_count", "error_count", "error_rate", "count_2xx", "count_3xx", "count_4xx", "count_5xx")
+	if unit == "s" {
+		columns = append(columns, "p50_latency_seconds", "p90_latency_seconds", "p95_latency_seconds", "p99_latency_seconds", "p999_latency_seconds")
+	} else {
+		columns = append(columns, "p50_latency_ms", "p90_latency_ms", "p95_latency_ms", "p99_latency_ms", "p999_latency_ms")
+	}
+	columns = append(columns, "apdex", "event_day")
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, row := range metrics {
+		record := make([]string, len(columns))
+		for i, col := range columns {
+			record[i] = csvValue(row, col)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvValue formats the column named col of row.
+func csvValue(row MetricRow, col string) string {
+	switch col {
+	case "bucket_start":
+		return row.BucketStart
+	case "service":
+		return row.Service
+	case "method":
+		return row.Method
+	case "path_template":
+		return row.PathTemplate
+	case "user_agent_family":
+		return row.UserAgentFamily
+	case "source":
+		return row.Source
+	case "request_count":
+		return strconv.FormatInt(row.RequestCount, 10)
+	case "error_count":
+		return strconv.FormatInt(row.ErrorCount, 10)
+	case "error_rate":
+		return strconv.FormatFloat(row.ErrorRate, 'g', -1, 64)
+	case "count_2xx":
+		return strconv.FormatInt(row.Count2xx, 10)
+	case "count_3xx":
+		return strconv.FormatInt(row.Count3xx, 10)
+	case "count_4xx":
+		return strconv.FormatInt(row.Count4xx, 10)
+	case "count_5xx":
+		return strconv.FormatInt(row.Count5xx, 10)
+	case "p50_latency_ms":
+		return formatNullable(row.P50LatencyMs)
+	case "p90_latency_ms":
+		return formatNullable(row.P90LatencyMs)
+	case "p95_latency_ms":
+		return formatNullable(row.P95LatencyMs)
+	case "p99_latency_ms":
+		return formatNullable(row.P99LatencyMs)
+	case "p999_latency_ms":
+		return formatNullable(row.P999LatencyMs)
+	case "p50_latency_seconds":
+		return formatNullable(msToSeconds(row.P50LatencyMs))
+	case "p90_latency_seconds":
+		return formatNullable(msToSeconds(row.P90LatencyMs))
+	case "p95_latency_seconds":
+		return formatNullable(msToSeconds(row.P95LatencyMs))
+	case "p99_latency_seconds":
+		return formatNullable(msToSeconds(row.P99LatencyMs))
+	case "p999_latency_seconds":
+		return formatNullable(msToSeconds(row.P999LatencyMs))
+	case "apdex":
+		return formatNullable(row.Apdex)
+	default:
+		return row.EventDay
+	}
+}
+
+// formatNullable formats v, or returns an empty field for NULL.
+func formatNullable(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'g', -1, 64)
+}
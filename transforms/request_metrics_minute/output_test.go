@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	for _, name := range outputFormats {
+		if _, err := parseOutputFormat(name); err != nil {
+			t.Errorf("parseOutputFormat(%q) failed: %v", name, err)
+		}
+	}
+	if _, err := parseOutputFormat("xlsx"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestWriteRows_CSV(t *testing.T) {
+	rows := []MetricRow{{
+		BucketStart:  "2025-01-15 10:30:00",
+		Service:      "api-service",
+		Method:       "GET",
+		PathTemplate: "/users",
+		RequestCount: 4,
+		ErrorCount:   1,
+		ErrorRate:    0.25,
+		P50LatencyMs: ptr(10),
+		P95LatencyMs: ptr(20.5),
+		P99LatencyMs: ptr(30),
+		Apdex:        ptr(0.875),
+		EventDay:     "2025-01-15",
+	}, {
+		BucketStart:  "2025-01-15 10:31:00",
+		Service:      "api-service",
+		PathTemplate: "/users",
+		RequestCount: 1,
+		EventDay:     "2025-01-15",
+	}}
+
+	var out bytes.Buffer
+	if err := writeRows(&out, "csv", rows, []string{"service", "path_template"}, "ms"); err != nil {
+		t.Fatalf("writeRows failed: %v", err)
+	}
+	want := "bucket_start,service,path_template,request_count,error_count,error_rate,count_2xx,count_3xx,count_4xx,count_5xx,p50_latency_ms,p90_latency_ms,p95_latency_ms,p99_latency_ms,p999_latency_ms,apdex,event_day\n" +
+		"2025-01-15 10:30:00,api-service,/users,4,1,0.25,0,0,0,0,10,,20.5,30,,0.875,2025-01-15\n" +
+		// NULL percentiles and apdex are empty fields
+		"2025-01-15 10:31:00,api-service,/users,1,0,0,0,0,0,0,,,,,,,2025-01-15\n"
+	if out.String() != want {
+		t.Errorf("unexpected CSV:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestWriteRows_LatencySeconds(t *testing.T) {
+	rows := []MetricRow{{
+		BucketStart:  "2025-01-15 10:30:00",
+		Service:      "api-service",
+		RequestCount: 4,
+		P50LatencyMs: ptr(10),
+		P95LatencyMs: ptr(20.5),
+		P99LatencyMs: ptr(1500),
+		EventDay:     "2025-01-15",
+	}, {
+		BucketStart:  "2025-01-15 10:31:00",
+		Service:      "api-service",
+		RequestCount: 1,
+		EventDay:     "2025-01-15",
+	}}
+	groupBy := []string{"service"}
+
+	var buf bytes.Buffer
+	if err := writeRows(&buf, "parquet", rows, groupBy, "s"); err != nil {
+		t.Fatalf("writeRows failed: %v", err)
+	}
+	file, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to open parquet: %v", err)
+	}
+	var columns []string
+	for _, f := range file.Schema().Fields() {
+		columns = append(columns, f.Name())
+	}
+	if got := strings.Join(columns, ","); !strings.Contains(got, "p99_latency_seconds") || strings.Contains(got, "_latency_ms") {
+		t.Errorf("expected *_latency_seconds columns only, got %s", got)
+	}
+	got, err := parquet.Read[secondsMetricRow](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to read parquet: %v", err)
+	}
+	if len(got) != 2 || *got[0].P50LatencySeconds != 0.01 || *got[0].P95LatencySeconds != 0.0205 || *got[0].P99LatencySeconds != 1.5 {
+		t.Fatalf("expected percentiles scaled to seconds, got %+v", got)
+	}
+	if got[1].P99LatencySeconds != nil {
+		t.Errorf("expected NULL percentiles to stay NULL, got %v", *got[1].P99LatencySeconds)
+	}
+
+	var out bytes.Buffer
+	if err := writeRows(&out, "jsonl", rows[:1], groupBy, "s"); err != nil {
+		t.Fatalf("writeRows failed: %v", err)
+	}
+	if line := out.String(); !strings.Contains(line, `"p99_latency_seconds":1.5`) || strings.Contains(line, "_latency_ms") {
+		t.Errorf("unexpected JSONL: %s", line)
+	}
+	out.Reset()
+	if err := writeRows(&out, "csv", rows[:1], groupBy, "s"); err != nil {
+		t.Fatalf("writeRows failed: %v", err)
+	}
+	want := "bucket_start,service,request_count,error_count,error_rate,count_2xx,count_3xx,count_4xx,count_5xx,p50_latency_seconds,p90_latency_seconds,p95_latency_seconds,p99_latency_seconds,p999_latency_seconds,apdex,event_day\n" +
+		"2025-01-15 10:30:00,api-service,4,0,0,0,0,0,0,0.01,,0.0205,1.5,,,2025-01-15\n"
+	if out.String() != want {
+		t.Errorf("unexpected CSV:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestParseLatencyUnit(t *testing.T) {
+	for _, name := range latencyUnits {
+		if _, err := parseLatencyUnit(name); err != nil {
+			t.Errorf("parseLatencyUnit(%q) failed: %v", name, err)
+		}
+	}
+	if _, err := parseLatencyUnit("us"); err == nil {
+		t.Error("expected an error for an unknown unit")
+	}
+}
+
+func ptr(v float64) *float64 { return &v }
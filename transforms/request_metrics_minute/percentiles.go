@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/montanaflynn/stats"
+)
+
+// latencyRecorder collects the latencies of one output row and answers
+// percentile queries over them.
+type latencyRecorder interface {
+	Add(ms float64)
+	Percentile(p float64) float64 // p in (0, 100]; 0 when nothing was added
+}
+
+// percentileStrategies maps -percentile-strategy names to recorder constructors.
+var percentileStrategies = map[string]func() latencyRecorder{
+	"exact":   func() latencyRecorder { return &exactRecorder{} },
+	"tdigest": func() latencyRecorder { return newTDigest(tdigestCompression) },
+	"hdr":     func() latencyRecorder { return newHDRRecorder() },
+}
+
+// parsePercentileStrategy validates a -percentile-strategy name.
+func parsePercentileStrategy(name string) (string, error) {
+	if _, ok := percentileStrategies[name]; !ok {
+		names := make([]string, 0, len(percentileStrategies))
+		for n := range percentileStrategies {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("unknown percentile strategy %q (want one of %s)", name, strings.Join(names, ","))
+	}
+	return name, nil
+}
+
+// percentileColumns maps each -percentiles value to the MetricRow column
+// holding it. The columns of unselected percentiles are written as NULL, so
+// the schema doesn't depend on the flag.
+var percentileColumns = map[float64]func(row *MetricRow, v *float64){
+	50:   func(row *MetricRow, v *float64) { row.P50LatencyMs = v },
+	90:   func(row *MetricRow, v *float64) { row.P90LatencyMs = v },
+	95:   func(row *MetricRow, v *float64) { row.P95LatencyMs = v },
+	99:   func(row *MetricRow, v *float64) { row.P99LatencyMs = v },
+	99.9: func(row *MetricRow, v *float64) { row.P999LatencyMs = v },
+}
+
+// defaultPercentiles are the percentiles computed when none are configured.
+var defaultPercentiles = []float64{50, 95, 99}
+
+// parsePercentiles parses a comma-separated -percentiles list such as
+// "50,90,99,99.9". Only percentiles with a MetricRow column are accepted.
+func parsePercentiles(list string) ([]float64, error) {
+	var ps []float64
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		p, err := strconv.ParseFloat(field, 64)
+		if _, ok := percentileColumns[p]; err != nil || !ok {
+			supported := make([]float64, 0, len(percentileColumns))
+			for p := range percentileColumns {
+				supported = append(supported, p)
+			}
+			slices.Sort(supported)
+			names := make([]string, len(supported))
+			for i, p := range supported {
+				names[i] = strconv.FormatFloat(p, 'g', -1, 64)
+			}
+			return nil, fmt.Errorf("unsupported percentile %q (want some of %s)", field, strings.Join(names, ","))
+		}
+		if slices.Contains(ps, p) {
+			return nil, fmt.Errorf("percentile %q listed twice", field)
+		}
+		ps = append(ps, p)
+	}
+	if len(ps) == 0 {
+		return nil, fmt.Errorf("no percentiles given")
+	}
+	return ps, nil
+}
+
+// exactRecorder keeps every latency and sorts them on each query. Memory grows
+// with the number of requests in the row.
+type exactRecorder struct {
+	latencies []float64
+}
+
+func (r *exactRecorder) Add(ms float64) { r.latencies = append(r.latencies, ms) }
+
+func (r *exactRecorder) Percentile(p float64) float64 {
+	v, _ := stats.Percentile(r.latencies, p)
+	return v
+}
+
+// tdigestCompression bounds a digest to roughly this many centroids. At 100,
+// p95/p99 land within 0.25 percentile points of the exact rank and p50 within
+// 1 (see TestTDigest_AccuracyAgainstExact).
+const tdigestCompression = 100
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// tdigest is a merging t-digest (Dunning, "Computing Extremely Accurate
+// Quantiles Using t-Digests"). Memory is bounded by the compression, not by
+// the number of values added; accuracy is best near the tails.
+type tdigest struct {
+	compression float64
+	centroids   []centroid // sorted by mean
+	buffer      []centroid // unmerged values
+	count       float64
+	min, max    float64
+}
+
+func newTDigest(compression float64) *tdigest {
+	return &tdigest{compression: compression, min: math.Inf(1), max: math.Inf(-1)}
+}
+
+func (d *tdigest) Add(ms float64) {
+	d.buffer = append(d.buffer, centroid{mean: ms, weight: 1})
+	d.count++
+	d.min = math.Min(d.min, ms)
+	d.max = math.Max(d.max, ms)
+	if len(d.buffer) >= int(5*d.compression) {
+		d.compress()
+	}
+}
+
+// scale is the k1 scale function; a centroid may span at most one unit of it,
+// which keeps centroids small near q=0 and q=1.
+func (d *tdigest) scale(q float64) float64 {
+	return d.compression / (2 * math.Pi) * math.Asin(2*math.Min(q, 1)-1)
+}
+
+// compress merges buffered values into the centroids.
+func (d *tdigest) compress() {
+	if len(d.buffer) == 0 {
+		return
+	}
+	all := make([]centroid, 0, len(d.centroids)+len(d.buffer))
+	all = append(append(all, d.centroids...), d.buffer...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := make([]centroid, 0, len(d.centroids)+1)
+	cur := all[0]
+	before := 0.0 // weight of the centroids left of cur
+	kLeft := d.scale(0)
+	for _, c := range all[1:] {
+		if d.scale((before+cur.weight+c.weight)/d.count)-kLeft <= 1 {
+			cur.weight += c.weight
+			cur.mean += (c.mean - cur.mean) * c.weight / cur.weight
+			continue
+		}
+		merged = append(merged, cur)
+		before += cur.weight
+		kLeft = d.scale(before / d.count)
+		cur = c
+	}
+	d.centroids = append(merged, cur)
+	d.buffer = d.buffer[:0]
+}
+
+// Percentile interpolates between centroid means, treating each centroid's
+// mean as sitting at the middle of its weight, and between min/max at the ends.
+func (d *tdigest) Percentile(p float64) float64 {
+	d.compress()
+	if len(d.centroids) == 0 {
+		return 0
+	}
+	target := p / 100 * d.count
+	cum := 0.0
+	for i, c := range d.centroids {
+		mid := cum + c.weight/2
+		if target < mid {
+			if i == 0 {
+				return d.min + (c.mean-d.min)*target/mid
+			}
+			prev := d.centroids[i-1]
+			prevMid := cum - prev.weight/2
+			return prev.mean + (c.mean-prev.mean)*(target-prevMid)/(mid-prevMid)
+		}
+		cum += c.weight
+	}
+	last := d.centroids[len(d.centroids)-1]
+	lastMid := d.count - last.weight/2
+	if target >= d.count || lastMid >= d.count {
+		return d.max
+	}
+	return last.mean + (d.max-last.mean)*(target-lastMid)/(d.count-lastMid)
+}
+
+// hdrMaxLatencyMs is the largest latency an hdr recorder tells apart; slower
+// requests are recorded as this. An hour is beyond any request timeout.
+const hdrMaxLatencyMs = int64(time.Hour / time.Millisecond)
+
+// hdrSignificantDigits sets the hdr recorder's resolution: with 2 digits a
+// reported percentile is within 1% of a latency at the exact rank.
+const hdrSignificantDigits = 2
+
+// hdrRecorder counts latencies in an HDR histogram: fixed-size buckets, 1 ms
+// wide up to 256 ms and logarithmically wider above. Memory (about 15 KiB)
+// and the cost of Add don't grow with the number of requests.
+type hdrRecorder struct {
+	h *hdrhistogram.Histogram
+}
+
+func newHDRRecorder() *hdrRecorder {
+	return &hdrRecorder{h: hdrhistogram.New(1, hdrMaxLatencyMs, hdrSignificantDigits)}
+}
+
+func (r *hdrRecorder) Add(ms float64) {
+	v := min(max(int64(math.Round(ms)), 0), hdrMaxLatencyMs)
+	r.h.RecordValue(v) // Never fails: v is within the trackable range
+}
+
+func (r *hdrRecorder) Percentile(p float64) float64 {
+	return float64(r.h.ValueAtQuantile(p))
+}
+
+// percentile returns r's p-th percentile as the nullable column value.
+func percentile(r latencyRecorder, p float64) *float64 {
+	v := r.Percentile(p)
+	return &v
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// tdigestRankTolerance is the documented accuracy of the tdigest strategy, in
+// percentile points: its p99 lies between the exact p98.75 and p99.25. The
+// digest is deliberately coarser in the middle of the distribution.
+var tdigestRankTolerance = map[float64]float64{50: 1, 95: 0.25, 99: 0.25}
+
+func TestTDigest_AccuracyAgainstExact(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	distributions := map[string]func() float64{
+		// Typical request latency: long right tail around a ~50ms median
+		"lognormal": func() float64 { return math.Exp(3.9 + 0.8*rng.NormFloat64()) },
+		// Fast path plus a slow cache-miss path
+		"bimodal": func() float64 {
+			if rng.Float64() < 0.9 {
+				return 5 + rng.Float64()*10
+			}
+			return 200 + rng.Float64()*300
+		},
+		"uniform": func() float64 { return rng.Float64() * 1000 },
+	}
+
+	for name, next := range distributions {
+		t.Run(name, func(t *testing.T) {
+			exact := percentileStrategies["exact"]()
+			digest := percentileStrategies["tdigest"]()
+			values := make([]float64, 0, 100000)
+			for i := 0; i < cap(values); i++ {
+				v := math.Round(next()) // latency_ms is an integer
+				values = append(values, v)
+				exact.Add(v)
+				digest.Add(v)
+			}
+			sort.Float64s(values)
+			for p, tolerance := range tdigestRankTolerance {
+				want, got := exact.Percentile(p), digest.Percentile(p)
+				// With integer latencies many samples tie, so measure the error in rank:
+				// some rank occupied by the estimate must be within tolerance of p
+				lo := float64(sort.SearchFloat64s(values, got)) / float64(len(values)) * 100
+				hi := float64(sort.Search(len(values), func(i int) bool { return values[i] > got })) / float64(len(values)) * 100
+				if lo > p+tolerance || hi < p-tolerance {
+					t.Errorf("p%v: tdigest %.2f (ranks %.2f-%.2f) vs exact %.2f, tolerance ±%v", p, got, lo, hi, want, tolerance)
+				}
+			}
+			if n := len(digest.(*tdigest).centroids); n > 2*tdigestCompression {
+				t.Errorf("expected at most %d centroids, got %d", 2*tdigestCompression, n)
+			}
+		})
+	}
+}
+
+func TestHDR_AccuracyAgainstExact(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	exact := percentileStrategies["exact"]()
+	hdr := percentileStrategies["hdr"]()
+	values := make([]float64, 0, 100000)
+	for i := 0; i < cap(values); i++ {
+		v := math.Round(math.Exp(3.9 + 0.8*rng.NormFloat64()))
+		values = append(values, v)
+		exact.Add(v)
+		hdr.Add(v)
+	}
+	sort.Float64s(values)
+	for _, p := range []float64{50, 90, 95, 99, 99.9} {
+		got := hdr.Percentile(p)
+		// The histogram reports the top of the bucket holding the value at rank p,
+		// so it may read up to 1% high but never low
+		rank := values[int(math.Ceil(p/100*float64(len(values))))-1]
+		if got < rank || got > rank*1.01+1 {
+			t.Errorf("p%v: hdr %v, want %v to %v (exact %v)", p, got, rank, rank*1.01+1, exact.Percentile(p))
+		}
+	}
+}
+
+func TestHDR_MemoryIndependentOfCount(t *testing.T) {
+	r := newHDRRecorder()
+	size := r.h.ByteSize()
+	for i := 0; i < 1_000_000; i++ {
+		r.Add(float64(i % 5000))
+	}
+	if got := r.h.ByteSize(); got != size {
+		t.Errorf("expected the histogram to stay %d bytes, got %d", size, got)
+	}
+	if allocs := testing.AllocsPerRun(1000, func() { r.Add(123) }); allocs != 0 {
+		t.Errorf("expected Add not to allocate, got %v allocations", allocs)
+	}
+	// Out-of-range latencies are clamped rather than dropped
+	r = newHDRRecorder()
+	r.Add(-1)
+	r.Add(10 * float64(hdrMaxLatencyMs))
+	if got := r.h.TotalCount(); got != 2 {
+		t.Errorf("expected both latencies recorded, got %d", got)
+	}
+}
+
+func TestTDigest_SmallInputs(t *testing.T) {
+	d := newTDigest(tdigestCompression)
+	if got := d.Percentile(50); got != 0 {
+		t.Errorf("expected 0 for an empty digest, got %v", got)
+	}
+	d.Add(42)
+	for _, p := range []float64{50, 99} {
+		if got := d.Percentile(p); got != 42 {
+			t.Errorf("p%v of a single value: expected 42, got %v", p, got)
+		}
+	}
+	d.Add(10)
+	d.Add(90)
+	if got := d.Percentile(100); got != 90 {
+		t.Errorf("p100: expected the max 90, got %v", got)
+	}
+	if got := d.Percentile(50); got < 10 || got > 90 {
+		t.Errorf("p50 must stay within [min, max], got %v", got)
+	}
+}
+
+func TestParsePercentileStrategy(t *testing.T) {
+	for _, name := range []string{"exact", "tdigest", "hdr"} {
+		if _, err := parsePercentileStrategy(name); err != nil {
+			t.Errorf("expected %s to be valid: %v", name, err)
+		}
+	}
+	if _, err := parsePercentileStrategy("histogram"); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+func TestParsePercentiles(t *testing.T) {
+	got, err := parsePercentiles(" 50, 90,99,99.9 ")
+	if err != nil {
+		t.Fatalf("parsePercentiles failed: %v", err)
+	}
+	if want := []float64{50, 90, 99, 99.9}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	for _, list := range []string{"", "50,75", "p99", "50,50"} {
+		if _, err := parsePercentiles(list); err == nil {
+			t.Errorf("expected an error for %q", list)
+		}
+	}
+}
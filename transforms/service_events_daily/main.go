@@ -4,11 +4,16 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,23 +21,86 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lgreene/gravix-dashboards/pkg/batch"
 	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/lgreene/gravix-dashboards/pkg/warehouse"
 	"github.com/lgreene/gravix-dashboards/schemas"
-	"github.com/parquet-go/parquet-go"
-	"github.com/parquet-go/parquet-go/compress/zstd"
 )
 
+// datasetName identifies this job's output in object tags.
+const datasetName = "service_events_daily"
+
 // EventSummaryRow represents a daily summary of service events by type.
 type EventSummaryRow struct {
 	EventDay   string `json:"event_day" parquet:"event_day"`
 	Service    string `json:"service" parquet:"service"`
 	EventType  string `json:"event_type" parquet:"event_type"`
 	EventCount int64  `json:"event_count" parquet:"event_count"`
+	EntityID   string `json:"entity_id" parquet:"entity_id"` // empty unless -entity-dimension is set
 }
 
 type EventAggKey struct {
 	Service   string
 	EventType string
+	EntityID  string
+}
+
+// rollupConfig controls where processDay reads and writes and how events are grouped.
+type rollupConfig struct {
+	RawPrefix       string // e.g. raw/service_events
+	WarehousePrefix string // e.g. warehouse/service_events_daily
+
+	// Entity adds entity_id as a grouping dimension; nil leaves it out.
+	Entity *entityKeyer
+
+	WriteIndex bool // keep <WarehousePrefix>/_index.json pointing at each day's current output
+
+	// RecheckEmptyAfter, if positive, is how long to wait before listing an
+	// apparently empty day again; output is only cleared if nothing new appears.
+	RecheckEmptyAfter time.Duration
+
+	// Output, when set, receives each day's rows in OutputFormat instead of
+	// the store, and nothing in the store is written or deleted.
+	Output       io.Writer
+	OutputFormat string // an outputFormats name; empty means parquet
+}
+
+// entityKeyer maps a raw EntityID to the value written to the warehouse.
+type entityKeyer struct {
+	hmacKey []byte // nil writes ids unchanged
+}
+
+// newEntityKeyer returns the keyer for an -entity-dimension mode: "off"
+// (nil), "raw", or "hashed", which requires a non-empty key.
+func newEntityKeyer(mode, key string) (*entityKeyer, error) {
+	switch mode {
+	case "off":
+		return nil, nil
+	case "raw":
+		return &entityKeyer{}, nil
+	case "hashed":
+		if key == "" {
+			return nil, fmt.Errorf("-entity-dimension=hashed requires ENTITY_HASH_KEY")
+		}
+		return &entityKeyer{hmacKey: []byte(key)}, nil
+	default:
+		return nil, fmt.Errorf("invalid -entity-dimension %q (want off, raw or hashed)", mode)
+	}
+}
+
+// key returns the warehouse value for id. With a hash key it is the hex
+// HMAC-SHA256 of id, stable across runs for the same key so distinct counts
+// still work without storing the raw identifier.
+func (k *entityKeyer) key(id string) string {
+	if k == nil {
+		return ""
+	}
+	if id == "" || k.hmacKey == nil {
+		return id
+	}
+	mac := hmac.New(sha256.New, k.hmacKey)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
 // acquireLock creates an exclusive lock file to prevent concurrent runs.
@@ -93,22 +161,84 @@ func releaseLock(f *os.File) {
 	os.Remove(name)
 }
 
+// prefixFromDir derives a store key prefix from a legacy ./data/-relative directory flag.
+// Deprecated: kept only so -input-dir/-output-dir continue to work; prefer -raw-prefix/-warehouse-prefix.
+func prefixFromDir(dir string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(dir, "./data/"), "/")
+}
+
 func main() {
 	var inputDir, outputDir string
+	var rawPrefix, warehousePrefix string
 	var startDay, endDay, processingTime string
-
-	flag.StringVar(&inputDir, "input-dir", "./data/raw/service_events", "Path to raw service events (JSONL)")
-	flag.StringVar(&outputDir, "output-dir", "./data/warehouse/service_events_daily", "Path to output summary (Parquet)")
+	var entityDimension string
+	var output, outputFormat string
+	var writeIndex bool
+	var recheckEmptyAfter time.Duration
+
+	flag.StringVar(&inputDir, "input-dir", "./data/raw/service_events", "Deprecated: use -raw-prefix. Path to raw service events (JSONL)")
+	flag.StringVar(&outputDir, "output-dir", "./data/warehouse/service_events_daily", "Local directory for the run lock (and, deprecated, the output prefix)")
+	flag.StringVar(&rawPrefix, "raw-prefix", "", "Store key prefix for raw service events, e.g. raw/service_events (default: derived from -input-dir)")
+	flag.StringVar(&warehousePrefix, "warehouse-prefix", "", "Store key prefix for output summaries, e.g. warehouse/service_events_daily (default: derived from -output-dir)")
 	flag.StringVar(&processingTime, "process-time", "", "Single day to process (RFC3339)")
 	flag.StringVar(&startDay, "start-day", "", "Start day for backfill (YYYY-MM-DD)")
 	flag.StringVar(&endDay, "end-day", "", "End day for backfill (YYYY-MM-DD, inclusive)")
+	flag.StringVar(&entityDimension, "entity-dimension", "off", "Group by entity_id: off, raw, or hashed (HMAC-SHA256 keyed by ENTITY_HASH_KEY)")
+	flag.DurationVar(&recheckEmptyAfter, "recheck-empty-after", 0, "Before clearing a day that has no events, wait this long and list its raw objects again; keep the output if any appeared (0 disables)")
+	flag.BoolVar(&writeIndex, "write-index", false, "Keep <warehouse-prefix>/_index.json mapping each day to its output key, sha256, row count and write time")
+	flag.StringVar(&output, "output", "", "Where each day's rows go: empty for the output store, - for standard output (a single day)")
+	flag.StringVar(&outputFormat, "output-format", "parquet", "Format of -output -: parquet, jsonl or csv")
 	flag.Parse()
 
-	lockFile, err := acquireLock(outputDir)
+	if rawPrefix == "" {
+		rawPrefix = prefixFromDir(inputDir)
+	}
+	if warehousePrefix == "" {
+		warehousePrefix = prefixFromDir(outputDir)
+	}
+	entity, err := newEntityKeyer(entityDimension, os.Getenv("ENTITY_HASH_KEY"))
+	if err != nil {
+		log.Fatalf("Invalid entity settings: %v", err)
+	}
+	cfg := rollupConfig{
+		RawPrefix:       rawPrefix,
+		WarehousePrefix: warehousePrefix,
+		Entity:          entity,
+		WriteIndex:      writeIndex,
+
+		RecheckEmptyAfter: recheckEmptyAfter,
+	}
+	if recheckEmptyAfter < 0 {
+		log.Fatal("Invalid -recheck-empty-after: must not be negative")
+	}
+
+	cfg.OutputFormat, err = parseOutputFormat(outputFormat)
 	if err != nil {
-		log.Fatalf("Cannot start event rollup: %v", err)
+		log.Fatalf("Invalid -output-format: %v", err)
+	}
+	switch output {
+	case "":
+		if cfg.OutputFormat != "parquet" {
+			log.Fatal("-output-format applies only to -output -")
+		}
+	case "-":
+		// Several parquet files can't share one stream, so stdout takes one day
+		if startDay != "" || endDay != "" {
+			log.Fatal("-output - writes a single day and cannot be combined with -start-day or -end-day")
+		}
+		cfg.Output = os.Stdout
+	default:
+		log.Fatalf("Invalid -output %q: use - for standard output or leave it empty for the store", output)
+	}
+
+	// Stdout output writes nothing to the store, so there is nothing to guard
+	if cfg.Output == nil {
+		lockFile, err := acquireLock(outputDir)
+		if err != nil {
+			log.Fatalf("Cannot start event rollup: %v", err)
+		}
+		defer releaseLock(lockFile)
 	}
-	defer releaseLock(lockFile)
 
 	var days []time.Time
 	if startDay != "" && endDay != "" {
@@ -134,28 +264,21 @@ func main() {
 		days = append(days, procTime)
 	}
 
-	var store storage.ObjectStore
-	if os.Getenv("S3_ENDPOINT") != "" {
-		store, err = storage.NewS3Store(
-			context.Background(),
-			os.Getenv("S3_ENDPOINT"),
-			os.Getenv("S3_REGION"),
-			os.Getenv("S3_BUCKET"),
-			os.Getenv("S3_ACCESS_KEY"),
-			os.Getenv("S3_SECRET_KEY"),
-		)
-		if err != nil {
-			log.Fatalf("Failed to initialize S3 store: %v", err)
-		}
-	} else {
-		store, err = storage.NewLocalStore("./data")
+	store, err := storage.FromEnv(context.Background(), "./data")
+	if err != nil {
+		log.Fatalf("Failed to initialize store: %v", err)
+	}
+
+	// Mirror outputs to a second bucket, e.g. an S3 archive behind a MinIO hot copy
+	if cfg.Output == nil {
+		store, err = storage.MirrorFromEnv(context.Background(), store)
 		if err != nil {
-			log.Fatalf("Failed to initialize local store: %v", err)
+			log.Fatalf("Failed to initialize mirror store: %v", err)
 		}
 	}
 
 	for _, day := range days {
-		if err := processDay(context.Background(), day, store, inputDir, outputDir); err != nil {
+		if err := processDay(context.Background(), day, store, cfg); err != nil {
 			log.Printf("Failed to process day %s: %v", day.Format("2006-01-02"), err)
 			os.Exit(1)
 		}
@@ -164,18 +287,68 @@ func main() {
 	log.Println("Service events rollup complete.")
 }
 
-func processDay(ctx context.Context, day time.Time, store storage.ObjectStore, inputDir, outputDir string) error {
-	dayStr := day.UTC().Format("2006-01-02")
-	inputPrefix := fmt.Sprintf("%s/%s", strings.TrimPrefix(inputDir, "./data/"), dayStr)
+// dayInputPrefixes returns where events for day can be found: the day itself
+// plus the adjacent boundary hours, since ingestion files a batch under its
+// rotation hour rather than its event hours. The event_time day filter drops
+// events that belong to the neighbouring days.
+func dayInputPrefixes(rawPrefix string, day time.Time) []string {
+	day = day.UTC()
+	return []string{
+		fmt.Sprintf("%s/%s/23/", rawPrefix, day.AddDate(0, 0, -1).Format("2006-01-02")),
+		fmt.Sprintf("%s/%s", rawPrefix, day.Format("2006-01-02")),
+		fmt.Sprintf("%s/%s/00/", rawPrefix, day.AddDate(0, 0, 1).Format("2006-01-02")),
+	}
+}
+
+// listDayInputs lists the raw objects that may hold events for day.
+func listDayInputs(ctx context.Context, store storage.ObjectStore, cfg rollupConfig, day time.Time) ([]string, error) {
+	var keys []string
+	for _, inputPrefix := range dayInputPrefixes(cfg.RawPrefix, day) {
+		log.Printf("Processing service events for prefix %s...", inputPrefix)
+		prefixKeys, err := store.List(ctx, inputPrefix)
+		if err != nil {
+			return nil, fmt.Errorf("list error: %w", err)
+		}
+		keys = append(keys, prefixKeys...)
+	}
+	return keys, nil
+}
+
+// recheckEmptyDay lists day's raw objects again after cfg.RecheckEmptyAfter
+// and fails if any appeared that the first listing, keys, missed, so an
+// eventually consistent List can't get a good partition cleared.
+func recheckEmptyDay(ctx context.Context, store storage.ObjectStore, cfg rollupConfig, day time.Time, keys []string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(cfg.RecheckEmptyAfter):
+	}
+	again, err := listDayInputs(ctx, store, cfg, day)
+	if err != nil {
+		return err
+	}
+	missed := 0
+	for _, key := range again {
+		if strings.HasSuffix(key, ".jsonl") && !slices.Contains(keys, key) {
+			missed++
+		}
+	}
+	if missed > 0 {
+		return fmt.Errorf("%s looked empty but listing again after %v found %d more raw objects; existing output kept, rerun the day",
+			day.UTC().Format("2006-01-02"), cfg.RecheckEmptyAfter, missed)
+	}
+	return nil
+}
 
-	log.Printf("Processing service events for prefix %s...", inputPrefix)
+func processDay(ctx context.Context, day time.Time, store storage.ObjectStore, cfg rollupConfig) error {
+	dayStr := day.UTC().Format("2006-01-02")
 
 	aggs := make(map[EventAggKey]int64)
 	seen := make(map[string]struct{})
 
-	keys, err := store.List(ctx, inputPrefix)
+	keys, err := listDayInputs(ctx, store, cfg, day)
 	if err != nil {
-		return fmt.Errorf("list error: %w", err)
+		return err
 	}
 
 	for _, key := range keys {
@@ -189,12 +362,24 @@ func processDay(ctx context.Context, day time.Time, store storage.ObjectStore, i
 			continue
 		}
 
+		// ScanLines drops a trailing "\r", so CRLF objects split cleanly too
 		scanner := bufio.NewScanner(rc)
 		buf := make([]byte, 0, 64*1024)
 		scanner.Buffer(buf, 1024*1024)
 
+		sum := batch.NewChecksum()
 		for scanner.Scan() {
 			line := scanner.Bytes()
+
+			// Integrity footer written by ingestion -batch-footer: verify, never aggregate
+			if footer, ok := batch.ParseFooter(line); ok {
+				if err := sum.Verify(footer); err != nil {
+					log.Printf("WARNING: batch %s may be truncated or corrupted: %v", key, err)
+				}
+				continue
+			}
+			sum.Add(line)
+
 			if len(line) == 0 {
 				continue
 			}
@@ -220,15 +405,31 @@ func processDay(ctx context.Context, day time.Time, store storage.ObjectStore, i
 			aggKey := EventAggKey{
 				Service:   event.Service,
 				EventType: event.EventType,
+				EntityID:  cfg.Entity.key(event.EntityId),
 			}
 			aggs[aggKey]++
 		}
 		rc.Close()
 	}
 
-	outputPrefix := strings.TrimPrefix(outputDir, "./data/")
+	outputPrefix := cfg.WarehousePrefix
+
+	if cfg.Output != nil {
+		// An empty day is still valid output (an empty table), there's just nothing to clear
+		rows := summaryRows(dayStr, aggs)
+		if err := writeRows(cfg.Output, cfg.OutputFormat, rows); err != nil {
+			return fmt.Errorf("failed to write event summary: %w", err)
+		}
+		log.Printf("Wrote %d event summary rows for %s", len(rows), dayStr)
+		return nil
+	}
 
 	if len(aggs) == 0 {
+		if cfg.RecheckEmptyAfter > 0 {
+			if err := recheckEmptyDay(ctx, store, cfg, day, keys); err != nil {
+				return err
+			}
+		}
 		// Idempotency: clear stale output even when no new data
 		existing, _ := store.List(ctx, outputPrefix)
 		for _, k := range existing {
@@ -236,45 +437,38 @@ func processDay(ctx context.Context, day time.Time, store storage.ObjectStore, i
 				store.Delete(ctx, k)
 			}
 		}
+		if cfg.WriteIndex {
+			if err := warehouse.UpdateIndex(ctx, store, outputPrefix, dayStr, nil); err != nil {
+				return fmt.Errorf("failed to update index: %w", err)
+			}
+		}
 		log.Printf("No service events found for %s.", dayStr)
 		return nil
 	}
 
-	// Build output rows
-	rows := make([]EventSummaryRow, 0, len(aggs))
-	for key, count := range aggs {
-		rows = append(rows, EventSummaryRow{
-			EventDay:   dayStr,
-			Service:    key.Service,
-			EventType:  key.EventType,
-			EventCount: count,
-		})
-	}
-
-	sort.Slice(rows, func(i, j int) bool {
-		if rows[i].Service == rows[j].Service {
-			return rows[i].EventType < rows[j].EventType
-		}
-		return rows[i].Service < rows[j].Service
-	})
+	rows := summaryRows(dayStr, aggs)
 
 	// Write Parquet
-	idx := uuid.New().String()
+	// UUIDv7 embeds the write time, which lets cmd/warehouse-doctor pick the
+	// newest file if a crash ever leaves more than one for the same day.
+	id, err := uuid.NewV7()
+	if err != nil {
+		return fmt.Errorf("failed to generate output id: %w", err)
+	}
+	idx := id.String()
 	destKey := fmt.Sprintf("%s/events_%s_%s.parquet", outputPrefix, idx, dayStr)
 
 	var parquetBuf bytes.Buffer
-	writer := parquet.NewGenericWriter[EventSummaryRow](&parquetBuf, parquet.Compression(&zstd.Codec{Level: zstd.SpeedDefault}))
-	if _, err := writer.Write(rows); err != nil {
-		return err
-	}
-	if err := writer.Close(); err != nil {
+	if err := writeRows(&parquetBuf, "parquet", rows); err != nil {
 		return err
 	}
 
 	// Write new file FIRST, then delete old files (write-then-swap).
 	// This ensures that if we crash between write and delete, stale data
 	// remains instead of no data at all.
-	if err := store.Put(ctx, destKey, bytes.NewReader(parquetBuf.Bytes())); err != nil {
+	// Tags let S3 lifecycle rules and cost reports select outputs by dataset/day
+	tags := storage.WithTags(map[string]string{"dataset": datasetName, "day": dayStr})
+	if err := store.Put(ctx, destKey, bytes.NewReader(parquetBuf.Bytes()), tags); err != nil {
 		return fmt.Errorf("failed to upload event summary: %w", err)
 	}
 
@@ -286,6 +480,39 @@ func processDay(ctx context.Context, day time.Time, store storage.ObjectStore, i
 		}
 	}
 
+	if cfg.WriteIndex {
+		entry := warehouse.NewIndexEntry(destKey, parquetBuf.Bytes(), len(rows), time.Now())
+		if err := warehouse.UpdateIndex(ctx, store, outputPrefix, dayStr, &entry); err != nil {
+			return fmt.Errorf("failed to update index: %w", err)
+		}
+	}
+
 	log.Printf("Uploaded %d event summary rows to %s", len(rows), destKey)
 	return nil
 }
+
+// summaryRows builds the output rows for dayStr, sorted by service, event type
+// and entity.
+func summaryRows(dayStr string, aggs map[EventAggKey]int64) []EventSummaryRow {
+	rows := make([]EventSummaryRow, 0, len(aggs))
+	for key, count := range aggs {
+		rows = append(rows, EventSummaryRow{
+			EventDay:   dayStr,
+			Service:    key.Service,
+			EventType:  key.EventType,
+			EventCount: count,
+			EntityID:   key.EntityID,
+		})
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Service != rows[j].Service {
+			return rows[i].Service < rows[j].Service
+		}
+		if rows[i].EventType != rows[j].EventType {
+			return rows[i].EventType < rows[j].EventType
+		}
+		return rows[i].EntityID < rows[j].EntityID
+	})
+	return rows
+}
@@ -4,17 +4,26 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/lgreene/gravix-dashboards/pkg/storage"
+	"github.com/lgreene/gravix-dashboards/pkg/warehouse"
+	"github.com/parquet-go/parquet-go"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	gravixv1 "github.com/lgreene/gravix-dashboards/gen/gravix/v1"
 )
 
+var defaultConfig = rollupConfig{
+	RawPrefix:       "raw/service_events",
+	WarehousePrefix: "warehouse/service_events_daily",
+}
+
 func newUUIDv7(t *testing.T) string {
 	t.Helper()
 	id, err := uuid.NewV7()
@@ -73,7 +82,7 @@ func TestProcessDay_BasicAggregation(t *testing.T) {
 	key := fmt.Sprintf("raw/service_events/%s/10/batch_test.jsonl", day.Format("2006-01-02"))
 	writeEvents(t, store, key, events)
 
-	err = processDay(context.Background(), day, store, "./data/raw/service_events", "./data/warehouse/service_events_daily")
+	err = processDay(context.Background(), day, store, defaultConfig)
 	if err != nil {
 		t.Fatalf("processDay failed: %v", err)
 	}
@@ -112,7 +121,7 @@ func TestProcessDay_Deduplication(t *testing.T) {
 	writeEvents(t, store, key1, []*gravixv1.ServiceEvent{event})
 	writeEvents(t, store, key2, []*gravixv1.ServiceEvent{duplicate})
 
-	err = processDay(context.Background(), day, store, "./data/raw/service_events", "./data/warehouse/service_events_daily")
+	err = processDay(context.Background(), day, store, defaultConfig)
 	if err != nil {
 		t.Fatalf("processDay failed: %v", err)
 	}
@@ -135,7 +144,7 @@ func TestProcessDay_EmptyInput(t *testing.T) {
 
 	day, _ := time.Parse("2006-01-02", "2025-01-15")
 
-	err = processDay(context.Background(), day, store, "./data/raw/service_events", "./data/warehouse/service_events_daily")
+	err = processDay(context.Background(), day, store, defaultConfig)
 	if err != nil {
 		t.Fatalf("processDay with empty input should not fail: %v", err)
 	}
@@ -168,7 +177,7 @@ func TestProcessDay_Idempotency(t *testing.T) {
 	writeEvents(t, store, key, events)
 
 	// First run
-	err = processDay(context.Background(), day, store, "./data/raw/service_events", "./data/warehouse/service_events_daily")
+	err = processDay(context.Background(), day, store, defaultConfig)
 	if err != nil {
 		t.Fatalf("first processDay failed: %v", err)
 	}
@@ -176,7 +185,7 @@ func TestProcessDay_Idempotency(t *testing.T) {
 	keys1, _ := store.List(context.Background(), "warehouse/service_events_daily")
 
 	// Second run (should overwrite, not duplicate)
-	err = processDay(context.Background(), day, store, "./data/raw/service_events", "./data/warehouse/service_events_daily")
+	err = processDay(context.Background(), day, store, defaultConfig)
 	if err != nil {
 		t.Fatalf("second processDay failed: %v", err)
 	}
@@ -211,7 +220,7 @@ func TestProcessDay_CrossDayFilter(t *testing.T) {
 	key := fmt.Sprintf("raw/service_events/%s/10/batch_cross.jsonl", day.Format("2006-01-02"))
 	writeEvents(t, store, key, events)
 
-	err = processDay(context.Background(), day, store, "./data/raw/service_events", "./data/warehouse/service_events_daily")
+	err = processDay(context.Background(), day, store, defaultConfig)
 	if err != nil {
 		t.Fatalf("processDay failed: %v", err)
 	}
@@ -223,6 +232,132 @@ func TestProcessDay_CrossDayFilter(t *testing.T) {
 	}
 }
 
+func TestProcessDay_DayBoundaryOverlap(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	day, _ := time.Parse("2006-01-02", "2025-01-15")
+	// Rotated after midnight, so filed under the next day's first hour
+	writeEvents(t, store, "raw/service_events/2025-01-16/00/batch_a.jsonl", []*gravixv1.ServiceEvent{
+		makeEvent(t, "auth-service", "deploy_started", time.Date(2025, 1, 15, 23, 59, 59, 0, time.UTC)),
+		makeEvent(t, "auth-service", "restart", time.Date(2025, 1, 16, 0, 0, 1, 0, time.UTC)), // Belongs to the next day
+	})
+	writeEvents(t, store, "raw/service_events/2025-01-14/23/batch_b.jsonl", []*gravixv1.ServiceEvent{
+		makeEvent(t, "auth-service", "deploy_started", time.Date(2025, 1, 15, 0, 0, 5, 0, time.UTC)),
+	})
+
+	if err := processDay(context.Background(), day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	rows := readSummaryRows(t, store)
+	if len(rows) != 1 || rows[0].EventType != "deploy_started" || rows[0].EventCount != 2 {
+		t.Errorf("expected both boundary deploys and no restart, got %+v", rows)
+	}
+}
+
+// readSummaryRows reads the single output file for the default warehouse prefix.
+func readSummaryRows(t *testing.T, store storage.ObjectStore) []EventSummaryRow {
+	t.Helper()
+	keys, _ := store.List(context.Background(), defaultConfig.WarehousePrefix)
+	if len(keys) != 1 {
+		t.Fatalf("expected 1 output file, got %v", keys)
+	}
+	rc, err := store.Get(context.Background(), keys[0])
+	if err != nil {
+		t.Fatalf("failed to get output: %v", err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	rows, err := parquet.Read[EventSummaryRow](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	return rows
+}
+
+func TestProcessDay_HashedEntityDimension(t *testing.T) {
+	day, _ := time.Parse("2006-01-02", "2025-01-15")
+	eventTime := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	run := func(hashKey string) []EventSummaryRow {
+		store, err := storage.NewLocalStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+		var events []*gravixv1.ServiceEvent
+		for _, id := range []string{"pay-123", "pay-123", "pay-456"} {
+			e := makeEvent(t, "payment-service", "payment_captured", eventTime)
+			e.EntityId = id
+			events = append(events, e)
+		}
+		writeEvents(t, store, "raw/service_events/2025-01-15/10/batch.jsonl", events)
+
+		entity, err := newEntityKeyer("hashed", hashKey)
+		if err != nil {
+			t.Fatalf("newEntityKeyer failed: %v", err)
+		}
+		cfg := defaultConfig
+		cfg.Entity = entity
+		if err := processDay(context.Background(), day, store, cfg); err != nil {
+			t.Fatalf("processDay failed: %v", err)
+		}
+		return readSummaryRows(t, store)
+	}
+
+	first := run("secret-a")
+	if len(first) != 2 {
+		t.Fatalf("expected one row per distinct entity, got %+v", first)
+	}
+	for _, row := range first {
+		if strings.HasPrefix(row.EntityID, "pay-") || len(row.EntityID) != 64 {
+			t.Errorf("expected a hex HMAC entity_id, got %q", row.EntityID)
+		}
+	}
+
+	// Separate runs with the same key produce the same join key
+	second := run("secret-a")
+	for i := range first {
+		if first[i].EntityID != second[i].EntityID || first[i].EventCount != second[i].EventCount {
+			t.Errorf("row %d differs between runs: %+v vs %+v", i, first[i], second[i])
+		}
+	}
+
+	// A different key yields unrelated values
+	other := run("secret-b")
+	if other[0].EntityID == first[0].EntityID || other[0].EntityID == first[1].EntityID {
+		t.Error("expected a different hash key to change entity_id")
+	}
+
+	if _, err := newEntityKeyer("hashed", ""); err == nil {
+		t.Error("expected hashed mode without a key to fail")
+	}
+}
+
+func TestProcessDay_EntityDimensionOffByDefault(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	day, _ := time.Parse("2006-01-02", "2025-01-15")
+	eventTime := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	a := makeEvent(t, "payment-service", "payment_captured", eventTime)
+	a.EntityId = "pay-123"
+	b := makeEvent(t, "payment-service", "payment_captured", eventTime)
+	b.EntityId = "pay-456"
+	writeEvents(t, store, "raw/service_events/2025-01-15/10/batch.jsonl", []*gravixv1.ServiceEvent{a, b})
+
+	if err := processDay(context.Background(), day, store, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	rows := readSummaryRows(t, store)
+	if len(rows) != 1 || rows[0].EventCount != 2 || rows[0].EntityID != "" {
+		t.Errorf("expected a single row without entity_id, got %+v", rows)
+	}
+}
+
 func TestAcquireReleaseLock(t *testing.T) {
 	dir := t.TempDir()
 
@@ -244,3 +379,121 @@ func TestAcquireReleaseLock(t *testing.T) {
 	}
 	releaseLock(f2)
 }
+
+func TestProcessDay_OutputWriter(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	writeEvents(t, store, "raw/service_events/2025-01-15/10/batch_a.jsonl", []*gravixv1.ServiceEvent{
+		makeEvent(t, "auth-service", "deploy_started", day.Add(10*time.Hour)),
+		makeEvent(t, "auth-service", "deploy_started", day.Add(11*time.Hour)),
+	})
+
+	var out bytes.Buffer
+	cfg := defaultConfig
+	cfg.Output = &out
+	cfg.OutputFormat = "csv"
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	want := "event_day,service,event_type,event_count,entity_id\n2025-01-15,auth-service,deploy_started,2,\n"
+	if out.String() != want {
+		t.Errorf("unexpected CSV:\n%s\nwant:\n%s", out.String(), want)
+	}
+	if keys, _ := store.List(ctx, "warehouse/service_events_daily"); len(keys) != 0 {
+		t.Errorf("expected nothing written to the store, got %v", keys)
+	}
+
+	out.Reset()
+	cfg.OutputFormat = "parquet"
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	rows, err := parquet.Read[EventSummaryRow](bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil || len(rows) != 1 || rows[0].EventCount != 2 {
+		t.Errorf("expected 1 parquet row of 2 events, got %+v (err %v)", rows, err)
+	}
+}
+
+func TestProcessDay_WriteIndex(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	batchKey := "raw/service_events/2025-01-15/10/batch_a.jsonl"
+	writeEvents(t, store, batchKey, []*gravixv1.ServiceEvent{
+		makeEvent(t, "api-service", "deploy", day.Add(10*time.Hour)),
+		makeEvent(t, "web-service", "restart", day.Add(11*time.Hour)),
+	})
+	cfg := defaultConfig
+	cfg.WriteIndex = true
+
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	idx, err := warehouse.ReadIndex(ctx, store, cfg.WarehousePrefix)
+	if err != nil {
+		t.Fatalf("ReadIndex failed: %v", err)
+	}
+	entry, ok := idx["2025-01-15"]
+	if !ok || entry.RowCount != 2 || !strings.HasSuffix(entry.Key, "_2025-01-15.parquet") {
+		t.Fatalf("expected an entry with 2 rows, got %+v", idx)
+	}
+
+	// Clearing an empty day drops it from the index
+	if err := store.Delete(ctx, batchKey); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := processDay(ctx, day, store, cfg); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	if idx, _ := warehouse.ReadIndex(ctx, store, cfg.WarehousePrefix); len(idx) != 0 {
+		t.Errorf("expected the cleared day to leave the index, got %+v", idx)
+	}
+}
+
+// lateListStore hides raw objects from the first emptyLists raw List calls,
+// like an eventually consistent listing.
+type lateListStore struct {
+	storage.ObjectStore
+	emptyLists int
+}
+
+func (s *lateListStore) List(ctx context.Context, prefix string) ([]string, error) {
+	if s.emptyLists > 0 && strings.HasPrefix(prefix, "raw/") {
+		s.emptyLists--
+		return nil, nil
+	}
+	return s.ObjectStore.List(ctx, prefix)
+}
+
+func TestProcessDay_RecheckEmptyDayKeepsOutput(t *testing.T) {
+	local, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	writeEvents(t, local, "raw/service_events/2025-01-15/10/batch_a.jsonl", []*gravixv1.ServiceEvent{
+		makeEvent(t, "api-service", "deploy", day.Add(10*time.Hour)),
+	})
+	if err := processDay(ctx, day, local, defaultConfig); err != nil {
+		t.Fatalf("processDay failed: %v", err)
+	}
+	good, _ := local.List(ctx, defaultConfig.WarehousePrefix)
+
+	cfg := defaultConfig
+	cfg.RecheckEmptyAfter = time.Millisecond
+	store := &lateListStore{ObjectStore: local, emptyLists: 3}
+	if err := processDay(ctx, day, store, cfg); err == nil || !strings.Contains(err.Error(), "looked empty") {
+		t.Errorf("expected the recheck to fail the day, got %v", err)
+	}
+	if after, _ := local.List(ctx, cfg.WarehousePrefix); len(after) != 1 || after[0] != good[0] {
+		t.Errorf("expected output %v to be kept, got %v", good, after)
+	}
+}
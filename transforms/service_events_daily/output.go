@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+)
+
+// outputFormats lists the -output-format values. Only parquet is written to
+// the store; the others are for -output -.
+var outputFormats = []string{"parquet", "jsonl", "csv"}
+
+// parseOutputFormat validates an -output-format name.
+func parseOutputFormat(name string) (string, error) {
+	if !slices.Contains(outputFormats, name) {
+		return "", fmt.Errorf("unknown output format %q (want one of parquet,jsonl,csv)", name)
+	}
+	return name, nil
+}
+
+// writeRows encodes rows to w in format.
+func writeRows(w io.Writer, format string, rows []EventSummaryRow) error {
+	switch format {
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		for _, row := range rows {
+			if err := enc.Encode(row); err != nil {
+				return fmt.Errorf("failed to encode event summary row: %w", err)
+			}
+		}
+		return nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"event_day", "service", "event_type", "event_count", "entity_id"}); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := cw.Write([]string{row.EventDay, row.Service, row.EventType, strconv.FormatInt(row.EventCount, 10), row.EntityID}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		writer := parquet.NewGenericWriter[EventSummaryRow](w, parquet.Compression(&zstd.Codec{Level: zstd.SpeedDefault}))
+		if _, err := writer.Write(rows); err != nil {
+			return err
+		}
+		return writer.Close()
+	}
+}